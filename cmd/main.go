@@ -1,7 +1,10 @@
 // Command muxmaster is the CLI entrypoint for the Muxmaster media encoder.
 //
 // It parses flags, validates configuration and paths, and either runs
-// system diagnostics (--check) or the encode/remux pipeline.
+// system diagnostics (--check), the encoder benchmark (--benchmark), the
+// output path preview (--dry-run-output-tree), the rename-only organizer
+// (--rename-only), a single-title assemble
+// (--concat / --image-seq), or the encode/remux pipeline.
 package main
 
 import (
@@ -17,6 +20,7 @@ import (
 	"github.com/backmassage/muxmaster/internal/display"
 	"github.com/backmassage/muxmaster/internal/ffmpeg"
 	"github.com/backmassage/muxmaster/internal/logging"
+	"github.com/backmassage/muxmaster/internal/naming"
 	"github.com/backmassage/muxmaster/internal/pipeline"
 )
 
@@ -49,6 +53,10 @@ func run() int {
 		fmt.Fprintf(os.Stderr, "muxmaster: %v\n", err)
 		return 1
 	}
+	if _, err := naming.NewConventionLayout(naming.Convention(cfg.NamingConvention), cfg.TVTemplate, cfg.MovieTemplate); err != nil {
+		fmt.Fprintf(os.Stderr, "muxmaster: %v\n", err)
+		return 1
+	}
 
 	log, err := logging.NewLogger(&cfg)
 	if err != nil {
@@ -58,7 +66,10 @@ func run() int {
 	defer log.Close()
 
 	// Phase 2: Logger available — all output goes through log from here on.
-	display.PrintBanner()
+	display.PrintBanner(log)
+	for _, m := range cfg.Mismatches() {
+		log.Warn("Conflicting options: %s", m)
+	}
 
 	if cfg.CheckOnly {
 		if !check.RunCheck(&cfg, log) {
@@ -67,6 +78,29 @@ func run() int {
 		return 0
 	}
 
+	if cfg.BenchmarkOnly {
+		log.Info("=== Muxmaster v%s (%s) — Benchmark ===", version, commit)
+		if err := check.CheckDeps(&cfg, log); err != nil {
+			log.Error("%v", err)
+			return 1
+		}
+
+		ctx, cancel := signalContext(log)
+		defer cancel()
+		cleanup, ok := setupRunTempDir(&cfg, log)
+		if !ok {
+			return 1
+		}
+		defer cleanup()
+
+		ffmpeg.ConfigureVAAPIConcurrency(cfg.Encoder.VaapiConcurrency)
+		run := ffmpeg.NewRunFunc(cfg.Display.Verbose)
+		if !pipeline.Benchmark(ctx, &cfg, log, run) {
+			return 1
+		}
+		return 0
+	}
+
 	if cfg.AnalyzeOnly {
 		inputAbs, err := absPath(cfg.InputDir)
 		if err != nil {
@@ -86,6 +120,104 @@ func run() int {
 		return 0
 	}
 
+	if cfg.ValidateOnly {
+		inputAbs, err := absPath(cfg.InputDir)
+		if err != nil {
+			log.Error("Input path error: %v", err)
+			return 1
+		}
+		cfg.InputDir = inputAbs
+
+		log.Info("=== Muxmaster v%s (%s) — Validate ===", version, commit)
+		log.Info("In: %s", cfg.InputDir)
+		log.Blank()
+
+		ctx, cancel := signalContext(log)
+		defer cancel()
+
+		if !pipeline.Validate(ctx, &cfg, log) {
+			return 1
+		}
+		return 0
+	}
+
+	if cfg.OutputTreeOnly {
+		inputAbs, err := absPath(cfg.InputDir)
+		if err != nil {
+			log.Error("Input path error: %v", err)
+			return 1
+		}
+		cfg.InputDir = inputAbs
+
+		log.Info("=== Muxmaster v%s (%s) — Output Tree ===", version, commit)
+		log.Info("In: %s", cfg.InputDir)
+		log.Blank()
+
+		pipeline.OutputTree(&cfg, log)
+		return 0
+	}
+
+	if cfg.RenameOnly != config.RenameOff {
+		inputAbs, err := absPath(cfg.InputDir)
+		if err != nil {
+			log.Error("Input path error: %v", err)
+			return 1
+		}
+		cfg.InputDir = inputAbs
+		if err := os.MkdirAll(cfg.OutputDir, 0o755); err != nil {
+			log.Error("Cannot create output directory: %v", err)
+			return 1
+		}
+
+		log.Info("=== Muxmaster v%s (%s) — Rename (%s) ===", version, commit, cfg.RenameOnly)
+		log.Info("In:  %s", cfg.InputDir)
+		log.Info("Out: %s", cfg.OutputDir)
+		if cfg.DryRun {
+			log.Warn("DRY RUN — no files will be written")
+		}
+		log.Blank()
+
+		ctx, cancel := signalContext(log)
+		defer cancel()
+
+		if !pipeline.RenameOnly(ctx, &cfg, log) {
+			return 1
+		}
+		return 0
+	}
+
+	if cfg.AssembleMode() {
+		if err := os.MkdirAll(cfg.OutputDir, 0o755); err != nil {
+			log.Error("Cannot create output directory: %v", err)
+			return 1
+		}
+		log.Info("=== Muxmaster v%s (%s) — Assemble ===", version, commit)
+		log.Info("Out: %s", cfg.OutputDir)
+		if cfg.DryRun {
+			log.Warn("DRY RUN — no files will be written")
+		}
+		log.Blank()
+		if err := check.CheckDeps(&cfg, log); err != nil {
+			log.Error("%v", err)
+			return 1
+		}
+
+		ctx, cancel := signalContext(log)
+		defer cancel()
+		cleanup, ok := setupRunTempDir(&cfg, log)
+		if !ok {
+			return 1
+		}
+		defer cleanup()
+
+		ffmpeg.ConfigureVAAPIConcurrency(cfg.Encoder.VaapiConcurrency)
+		run := ffmpeg.NewRunFunc(cfg.Display.Verbose || cfg.Display.FfmpegFPS)
+		if !pipeline.Assemble(ctx, &cfg, log, run) {
+			return 1
+		}
+		return 0
+	}
+
 	// Resolve and validate paths: input must exist, output is created if
 	// needed, and output must not be inside input (prevents recursive processing).
 	inputAbs, err := absPath(cfg.InputDir)
@@ -108,16 +240,35 @@ func run() int {
 		return 1
 	}
 
+	if cfg.StagingDir != "" {
+		if err := os.MkdirAll(cfg.StagingDir, 0o755); err != nil {
+			log.Error("Cannot create staging directory: %v", err)
+			return 1
+		}
+		stagingAbs, err := absPath(cfg.StagingDir)
+		if err != nil {
+			log.Error("Cannot resolve staging path: %v", err)
+			return 1
+		}
+		if err := cfg.ValidatePaths(inputAbs, stagingAbs); err != nil {
+			log.Error("Staging directory must not be inside input directory: %s", cfg.InputDir)
+			return 1
+		}
+	}
+
 	log.Info("=== Muxmaster v%s (%s) ===", version, commit)
 	log.Info("In:  %s", cfg.InputDir)
 	log.Info("Out: %s", cfg.OutputDir)
+	if cfg.StagingDir != "" {
+		log.Info("Staging: %s", cfg.StagingDir)
+	}
 	if cfg.DryRun {
 		log.Warn("DRY RUN — no files will be written")
 	}
 	log.Info("")
 
 	// Fail fast if ffmpeg/ffprobe or the chosen encoder are unavailable.
-	if err := check.CheckDeps(&cfg); err != nil {
+	if err := check.CheckDeps(&cfg, log); err != nil {
 		log.Error("%v", err)
 		return 1
 	}
@@ -125,8 +276,17 @@ func run() int {
 	// Phase 3: Signal handling + pipeline execution.
 	ctx, cancel := signalContext(log)
 	defer cancel()
+	cleanup, ok := setupRunTempDir(&cfg, log)
+	if !ok {
+		return 1
+	}
+	defer cleanup()
 
-	run := ffmpeg.NewRunFunc(cfg.Display.Verbose || cfg.Display.FfmpegFPS)
+	ffmpeg.ConfigureVAAPIConcurrency(cfg.Encoder.VaapiConcurrency)
+	// Live ffmpeg output from parallel workers would interleave on the
+	// terminal, so it is only shown for sequential runs (no --remux-jobs
+	// lane either).
+	run := ffmpeg.NewRunFunc(cfg.Jobs <= 1 && cfg.RemuxJobs == 0 && (cfg.Display.Verbose || cfg.Display.FfmpegFPS))
 	stats := pipeline.Run(ctx, &cfg, log, run)
 
 	if ctx.Err() != nil {
@@ -155,6 +315,20 @@ func signalContext(log *logging.Logger) (context.Context, context.CancelFunc) {
 	return ctx, cancel
 }
 
+// setupRunTempDir creates the run-scoped scratch directory and records it
+// in cfg.RunTempDir. The caller defers the returned cleanup, which also runs
+// after an interrupt because signalContext only cancels the context.
+func setupRunTempDir(cfg *config.Config, log *logging.Logger) (func(), bool) {
+	dir, cleanup, err := pipeline.NewRunTempDir(cfg.TempDir)
+	if err != nil {
+		log.Error("Cannot create temp dir: %v", err)
+		return nil, false
+	}
+	cfg.RunTempDir = dir
+	log.Debug(cfg.Display.Verbose, "Temp dir: %s", dir)
+	return cleanup, true
+}
+
 // absPath returns the absolute, symlink-resolved path for safe comparison
 // of input vs output directory hierarchies.
 func absPath(path string) (string, error) {
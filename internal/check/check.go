@@ -18,7 +18,9 @@ var (
 	ErrFfprobeNotFound   = errors.New("ffprobe not found on PATH")
 	ErrNoVAAPIDevice     = errors.New("no VAAPI render device found in /dev/dri/")
 	ErrVAAPITestFailed   = errors.New("VAAPI test encode failed (device exists but hevc_vaapi unusable)")
+	ErrVAAPINo10Bit      = errors.New("VAAPI main10 test encode failed and --require-10bit is set (device only supports 8-bit)")
 	ErrCPUEncodeFailed   = errors.New("CPU mode selected but libx265 test encode failed")
+	ErrQSVTestFailed     = errors.New("QSV mode selected but hevc_qsv test encode failed")
 	ErrAudioEncodeFailed = errors.New("configured AAC encoder test failed")
 )
 
@@ -35,38 +37,43 @@ type Logger interface {
 }
 
 // RunCheck runs the interactive --check flow: prints availability of ffmpeg,
-// ffprobe, HEVC encoders, VAAPI device/test, CPU x265, and AAC encoder.
+// ffprobe, HEVC encoders, VAAPI device/test, QSV, CPU x265, and AAC encoder.
 // Returns true if all critical checks passed (ffmpeg, ffprobe, and at least
-// one working encoder), false if any critical check failed.
+// one working encoder), false if any critical check failed. QSV is optional
+// hardware, so its result is informational unless QSV mode is selected.
 func RunCheck(cfg *config.Config, log Logger) bool {
 	log.Info("=== System Check ===")
 
 	ok := true
-	if !checkFfmpeg(log) {
+	if !checkFfmpeg(cfg, log) {
 		ok = false
 	}
-	checkHEVCEncoders(log)
-	if !checkVAAPI(log) {
+	checkHEVCEncoders(log, cfg.FFmpegPath)
+	if !checkVAAPI(log, cfg.FFmpegPath) {
 		ok = false
 	}
-	if !checkCPUx265(log) {
+	if !checkQSV(log, cfg.FFmpegPath) && cfg.Encoder.Mode == config.EncoderQSV {
 		ok = false
 	}
-	if !checkAudioEncoder(log, cfg.Audio.Encoder) {
+	if !checkCPUx265(log, cfg.FFmpegPath) {
+		ok = false
+	}
+	if !checkAudioEncoder(log, cfg.FFmpegPath, cfg.Audio.Encoder) {
 		ok = false
 	}
 	return ok
 }
 
-// checkFfmpeg verifies ffmpeg and ffprobe are on PATH and logs the ffmpeg version string.
+// checkFfmpeg verifies the configured ffmpeg and ffprobe (--ffmpeg-path,
+// --ffprobe-path) exist and logs the ffmpeg version string.
 // Returns true if both are found.
-func checkFfmpeg(log Logger) bool {
+func checkFfmpeg(cfg *config.Config, log Logger) bool {
 	ok := true
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		log.Error("ffmpeg not found")
+	if _, err := exec.LookPath(cfg.FFmpegPath); err != nil {
+		log.Error("ffmpeg not found (%s)", cfg.FFmpegPath)
 		ok = false
 	} else {
-		cmd := exec.Command("ffmpeg", "-version")
+		cmd := exec.Command(cfg.FFmpegPath, "-version")
 		out, err := cmd.Output()
 		if err != nil {
 			log.Warn("ffmpeg found but -version failed: %v", err)
@@ -78,8 +85,8 @@ func checkFfmpeg(log Logger) bool {
 			log.Success("ffmpeg: %s", firstLine)
 		}
 	}
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		log.Error("ffprobe not found")
+	if _, err := exec.LookPath(cfg.FFprobePath); err != nil {
+		log.Error("ffprobe not found (%s)", cfg.FFprobePath)
 		ok = false
 	} else {
 		log.Success("ffprobe: found")
@@ -88,9 +95,9 @@ func checkFfmpeg(log Logger) bool {
 }
 
 // checkHEVCEncoders lists all HEVC-related encoders reported by ffmpeg.
-func checkHEVCEncoders(log Logger) {
+func checkHEVCEncoders(log Logger, bin string) {
 	log.Info("HEVC encoders:")
-	cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
+	cmd := exec.Command(bin, "-hide_banner", "-encoders")
 	out, err := cmd.Output()
 	if err != nil {
 		log.Warn("Could not list encoders: %v", err)
@@ -107,18 +114,18 @@ func checkHEVCEncoders(log Logger) {
 // checkVAAPI finds the first render device and runs a minimal VAAPI encode test.
 // Returns true if VAAPI works, false otherwise. A missing VAAPI device is not
 // fatal (CPU mode may be used instead), so this is logged as a warning.
-func checkVAAPI(log Logger) bool {
+func checkVAAPI(log Logger, bin string) bool {
 	dev := getFirstRenderDevice()
 	if dev == "" {
 		log.Warn("No VAAPI device found")
 		return false
 	}
 	log.Info("Testing VAAPI on %s...", dev)
-	if testVAAPI(dev, "p010", "main10") {
+	if testVAAPI(bin, dev, "p010", "main10") {
 		log.Success("VAAPI works (main10)")
 		return true
 	}
-	if testVAAPI(dev, "nv12", "main") {
+	if testVAAPI(bin, dev, "nv12", "main") {
 		log.Success("VAAPI works (main/8-bit only)")
 		return true
 	}
@@ -126,11 +133,23 @@ func checkVAAPI(log Logger) bool {
 	return false
 }
 
+// checkQSV runs a minimal hevc_qsv encode to report Intel Quick Sync
+// availability. A failure is a warning: most systems use VAAPI or CPU.
+func checkQSV(log Logger, bin string) bool {
+	log.Info("Testing QSV...")
+	if runSilent(bin, qsvTestArgs()...) {
+		log.Success("QSV works (hevc_qsv)")
+		return true
+	}
+	log.Warn("QSV not available (hevc_qsv test encode failed)")
+	return false
+}
+
 // checkCPUx265 runs a minimal libx265 encode to verify CPU encoding works.
 // Returns true on success.
-func checkCPUx265(log Logger) bool {
+func checkCPUx265(log Logger, bin string) bool {
 	log.Info("Testing CPU x265...")
-	if runSilent("ffmpeg", cpuTestArgs()...) {
+	if runSilent(bin, cpuTestArgs()...) {
 		log.Success("CPU x265 works")
 		return true
 	}
@@ -140,9 +159,9 @@ func checkCPUx265(log Logger) bool {
 
 // checkAudioEncoder runs a minimal AAC encode to verify the encoder works.
 // Returns true on success.
-func checkAudioEncoder(log Logger, encoder string) bool {
+func checkAudioEncoder(log Logger, bin, encoder string) bool {
 	log.Info("Testing AAC encoder (%s)...", encoder)
-	if runSilent("ffmpeg",
+	if runSilent(bin,
 		"-hide_banner", "-nostdin",
 		"-f", "lavfi", "-i", "sine=frequency=1000:duration=0.1",
 		"-c:a", encoder, "-f", "null", "-",
@@ -155,41 +174,54 @@ func checkAudioEncoder(log Logger, encoder string) bool {
 }
 
 // CheckDeps is the pre-pipeline validation: it verifies that ffmpeg and
-// ffprobe are on PATH and that the chosen encoder mode actually works.
-// In CPU mode a quick libx265 encode is run; in VAAPI mode a render device
+// ffprobe (--ffmpeg-path, --ffprobe-path) are found and that the chosen encoder mode actually works.
+// In CPU mode a quick libx265 encode is run, in QSV mode a quick hevc_qsv
+// encode; in VAAPI mode a render device
 // must exist and pass a short encode test. On success in VAAPI mode, the
 // derived profile and software format are written back to cfg so the builder
-// and filter chain use the correct values.
-func CheckDeps(cfg *config.Config) error {
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		return ErrFfmpegNotFound
+// and filter chain use the correct values. A fallback from main10 to 8-bit
+// main is logged as a warning, or returns ErrVAAPINo10Bit when
+// cfg.Encoder.Require10Bit is set.
+func CheckDeps(cfg *config.Config, log Logger) error {
+	if _, err := lookPath(cfg.FFmpegPath); err != nil {
+		return fmt.Errorf("%w: %s", ErrFfmpegNotFound, cfg.FFmpegPath)
 	}
-	if _, err := exec.LookPath("ffprobe"); err != nil {
-		return ErrFfprobeNotFound
+	if _, err := lookPath(cfg.FFprobePath); err != nil {
+		return fmt.Errorf("%w: %s", ErrFfprobeNotFound, cfg.FFprobePath)
 	}
-	if !testAudioEncoder(cfg.Audio.Encoder) {
+	if !testAudioEncoder(cfg.FFmpegPath, cfg.Audio.Encoder) {
 		return fmt.Errorf("%w: %s", ErrAudioEncodeFailed, cfg.Audio.Encoder)
 	}
 
 	if cfg.Encoder.Mode == config.EncoderCPU {
-		if !runSilent("ffmpeg", cpuTestArgs()...) {
+		if !runSilent(cfg.FFmpegPath, cpuTestArgs()...) {
 			return ErrCPUEncodeFailed
 		}
 		return nil
 	}
+	if cfg.Encoder.Mode == config.EncoderQSV {
+		if !runSilent(cfg.FFmpegPath, qsvTestArgs()...) {
+			return ErrQSVTestFailed
+		}
+		return nil
+	}
 
 	// VAAPI mode: need a render device that passes an encode test.
 	// Prefer 10-bit (main10/p010); fall back to 8-bit (main/nv12).
-	dev := getFirstRenderDevice()
+	dev := renderDevice()
 	if dev == "" {
 		return ErrNoVAAPIDevice
 	}
-	if testVAAPI(dev, "p010", "main10") {
+	if testVAAPI(cfg.FFmpegPath, dev, "p010", "main10") {
 		cfg.Encoder.VaapiProfile = "main10"
 		cfg.Encoder.VaapiSwFormat = "p010"
 		return nil
 	}
-	if testVAAPI(dev, "nv12", "main") {
+	if testVAAPI(cfg.FFmpegPath, dev, "nv12", "main") {
+		if cfg.Encoder.Require10Bit {
+			return fmt.Errorf("%w: %s", ErrVAAPINo10Bit, dev)
+		}
+		log.Warn("VAAPI main10 unavailable on %s; falling back to 8-bit main (output will be 8-bit, use --require-10bit to fail instead)", dev)
 		cfg.Encoder.VaapiProfile = "main"
 		cfg.Encoder.VaapiSwFormat = "nv12"
 		return nil
@@ -197,8 +229,8 @@ func CheckDeps(cfg *config.Config) error {
 	return ErrVAAPITestFailed
 }
 
-func testAudioEncoder(encoder string) bool {
-	return runSilent("ffmpeg",
+func testAudioEncoder(bin, encoder string) bool {
+	return runSilent(bin,
 		"-hide_banner", "-nostdin", "-loglevel", "error",
 		"-f", "lavfi", "-i", "sine=frequency=1000:duration=0.1",
 		"-c:a", encoder, "-f", "null", "-",
@@ -207,6 +239,14 @@ func testAudioEncoder(encoder string) bool {
 
 // --- internal helpers ---
 
+// Test seams: CheckDeps resolves tools, the render device, and test encodes
+// through these so tests can simulate hardware without ffmpeg or /dev/dri.
+var (
+	lookPath     = exec.LookPath
+	renderDevice = getFirstRenderDevice
+	runSilent    = runSilentExec
+)
+
 // getFirstRenderDevice returns the first available /dev/dri/renderD* path,
 // or empty string if none exist.
 func getFirstRenderDevice() string {
@@ -222,10 +262,10 @@ func getFirstRenderDevice() string {
 	return ""
 }
 
-// testVAAPI runs a minimal ffmpeg VAAPI encode to verify the device supports
-// the given pixel format and HEVC profile.
-func testVAAPI(device, swFormat, profile string) bool {
-	return runSilent("ffmpeg",
+// testVAAPI runs a minimal ffmpeg (bin) VAAPI encode to verify the device
+// supports the given pixel format and HEVC profile.
+func testVAAPI(bin, device, swFormat, profile string) bool {
+	return runSilent(bin,
 		"-hide_banner", "-nostdin", "-loglevel", "error",
 		"-init_hw_device", "vaapi=va:"+device,
 		"-filter_hw_device", "va",
@@ -247,9 +287,23 @@ func cpuTestArgs() []string {
 	}
 }
 
-// runSilent runs a command and returns true if it exits with status 0.
+// qsvTestArgs returns the ffmpeg arguments for a minimal hevc_qsv test
+// encode, uploading NV12 frames the same way the encode filter chain does.
+func qsvTestArgs() []string {
+	return []string{
+		"-hide_banner", "-nostdin", "-loglevel", "error",
+		"-init_hw_device", "qsv=qs",
+		"-filter_hw_device", "qs",
+		"-f", "lavfi", "-i", "color=black:s=256x256:d=0.1",
+		"-vf", "format=nv12,hwupload=extra_hw_frames=64",
+		"-c:v", "hevc_qsv",
+		"-f", "null", "-",
+	}
+}
+
+// runSilentExec runs a command and returns true if it exits with status 0.
 // Both stdout and stderr are discarded.
-func runSilent(name string, args ...string) bool {
+func runSilentExec(name string, args ...string) bool {
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = nil
 	cmd.Stderr = nil
@@ -0,0 +1,167 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/backmassage/muxmaster/internal/config"
+)
+
+// fakeVAAPI replaces the CheckDeps seams with a host that has ffmpeg, a
+// working AAC encoder, and a render device whose test encodes succeed only
+// for the given profiles.
+func fakeVAAPI(t *testing.T, profiles ...string) {
+	t.Helper()
+	origLook, origDev, origRun := lookPath, renderDevice, runSilent
+	t.Cleanup(func() { lookPath, renderDevice, runSilent = origLook, origDev, origRun })
+
+	lookPath = func(name string) (string, error) { return "/usr/bin/" + name, nil }
+	renderDevice = func() string { return "/dev/dri/renderD128" }
+	runSilent = func(_ string, args ...string) bool {
+		joined := strings.Join(args, " ")
+		if !strings.Contains(joined, "hevc_vaapi") {
+			return true
+		}
+		for _, p := range profiles {
+			if strings.Contains(joined, "-profile:v "+p+" ") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestCheckDeps_QSV(t *testing.T) {
+	for _, works := range []bool{true, false} {
+		fakeVAAPI(t, "main10")
+		run := runSilent
+		runSilent = func(name string, args ...string) bool {
+			if strings.Contains(strings.Join(args, " "), "hevc_qsv") {
+				return works
+			}
+			return run(name, args...)
+		}
+		cfg := config.DefaultConfig()
+		cfg.Encoder.Mode = config.EncoderQSV
+
+		err := CheckDeps(&cfg, &recordLogger{})
+		if works && err != nil {
+			t.Errorf("working QSV: unexpected error %v", err)
+		}
+		if !works && !errors.Is(err, ErrQSVTestFailed) {
+			t.Errorf("broken QSV: got %v, want ErrQSVTestFailed", err)
+		}
+	}
+}
+
+func TestCheckDeps_VAAPI10BitNoWarning(t *testing.T) {
+	fakeVAAPI(t, "main10", "main")
+	cfg := config.DefaultConfig()
+	log := &recordLogger{}
+
+	if err := CheckDeps(&cfg, log); err != nil {
+		t.Fatalf("CheckDeps: %v", err)
+	}
+	if cfg.Encoder.VaapiProfile != "main10" || cfg.Encoder.VaapiSwFormat != "p010" {
+		t.Errorf("profile/format = %s/%s, want main10/p010", cfg.Encoder.VaapiProfile, cfg.Encoder.VaapiSwFormat)
+	}
+	if len(log.warns) != 0 {
+		t.Errorf("unexpected warnings: %v", log.warns)
+	}
+}
+
+func TestCheckDeps_VAAPI8BitFallbackWarns(t *testing.T) {
+	fakeVAAPI(t, "main")
+	cfg := config.DefaultConfig()
+	log := &recordLogger{}
+
+	if err := CheckDeps(&cfg, log); err != nil {
+		t.Fatalf("CheckDeps: %v", err)
+	}
+	if cfg.Encoder.VaapiProfile != "main" || cfg.Encoder.VaapiSwFormat != "nv12" {
+		t.Errorf("profile/format = %s/%s, want main/nv12", cfg.Encoder.VaapiProfile, cfg.Encoder.VaapiSwFormat)
+	}
+	if len(log.warns) != 1 || !strings.Contains(log.warns[0], "8-bit") {
+		t.Errorf("warnings = %v, want one 8-bit fallback warning", log.warns)
+	}
+}
+
+func TestCheckDeps_Require10BitFails(t *testing.T) {
+	fakeVAAPI(t, "main")
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Require10Bit = true
+	log := &recordLogger{}
+
+	err := CheckDeps(&cfg, log)
+	if !errors.Is(err, ErrVAAPINo10Bit) {
+		t.Fatalf("err = %v, want ErrVAAPINo10Bit", err)
+	}
+	if cfg.Encoder.VaapiProfile == "main" {
+		t.Error("8-bit profile written back despite --require-10bit")
+	}
+	if len(log.warns) != 0 {
+		t.Errorf("unexpected warnings: %v", log.warns)
+	}
+}
+
+func TestCheckDeps_VAAPIUnusable(t *testing.T) {
+	fakeVAAPI(t)
+	cfg := config.DefaultConfig()
+
+	if err := CheckDeps(&cfg, &recordLogger{}); !errors.Is(err, ErrVAAPITestFailed) {
+		t.Fatalf("err = %v, want ErrVAAPITestFailed", err)
+	}
+}
+
+func TestCheckDeps_CustomBinaryPaths(t *testing.T) {
+	fakeVAAPI(t, "main10")
+	var looked, ran []string
+	lookPath = func(name string) (string, error) {
+		looked = append(looked, name)
+		if name == "/opt/ffmpeg/bin/ffprobe" {
+			return "", errors.New("not found")
+		}
+		return name, nil
+	}
+	run := runSilent
+	runSilent = func(name string, args ...string) bool {
+		ran = append(ran, name)
+		return run(name, args...)
+	}
+	cfg := config.DefaultConfig()
+	cfg.FFmpegPath = "/opt/ffmpeg/bin/ffmpeg"
+	cfg.FFprobePath = "/usr/local/bin/ffprobe"
+
+	if err := CheckDeps(&cfg, &recordLogger{}); err != nil {
+		t.Fatalf("CheckDeps: %v", err)
+	}
+	if strings.Join(looked, " ") != "/opt/ffmpeg/bin/ffmpeg /usr/local/bin/ffprobe" {
+		t.Errorf("looked up %v, want the configured paths", looked)
+	}
+	for _, name := range ran {
+		if name != cfg.FFmpegPath {
+			t.Errorf("test encode ran %q, want %q", name, cfg.FFmpegPath)
+		}
+	}
+
+	cfg.FFprobePath = "/opt/ffmpeg/bin/ffprobe"
+	if err := CheckDeps(&cfg, &recordLogger{}); !errors.Is(err, ErrFfprobeNotFound) || !strings.Contains(err.Error(), cfg.FFprobePath) {
+		t.Errorf("err = %v, want ErrFfprobeNotFound naming the path", err)
+	}
+}
+
+// --- Helpers ---
+
+// recordLogger is a Logger that keeps warnings and discards everything else.
+type recordLogger struct{ warns []string }
+
+func (l *recordLogger) Info(string, ...interface{})    {}
+func (l *recordLogger) Success(string, ...interface{}) {}
+func (l *recordLogger) Warn(f string, a ...interface{}) {
+	l.warns = append(l.warns, fmt.Sprintf(f, a...))
+}
+func (l *recordLogger) Error(string, ...interface{})       {}
+func (l *recordLogger) Debug(bool, string, ...interface{}) {}
+func (l *recordLogger) Blank()                             {}
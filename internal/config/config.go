@@ -4,7 +4,9 @@ package config
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -17,16 +19,74 @@ type EncoderMode string
 const (
 	EncoderVAAPI EncoderMode = "vaapi" // Hardware encoding via VAAPI (default).
 	EncoderCPU   EncoderMode = "cpu"   // Software encoding via libx265.
+	EncoderQSV   EncoderMode = "qsv"   // Hardware encoding via Intel Quick Sync (hevc_qsv).
 )
 
+// UsesQP reports whether the mode encodes at a constant QP taken from
+// Encoder.VaapiQP (VAAPI -qp, QSV -global_quality) rather than a libx265 CRF.
+func (m EncoderMode) UsesQP() bool {
+	return m == EncoderVAAPI || m == EncoderQSV
+}
+
 // Container is the output container format.
 type Container string
 
 const (
 	ContainerMKV Container = "mkv" // Matroska (default, full feature support).
 	ContainerMP4 Container = "mp4" // MP4 (compatibility; limited subtitle support).
+	ContainerHLS Container = "hls" // HLS VOD playlist + MPEG-TS segments (no subtitles/attachments).
 )
 
+// AudioCodec is the target codec for transcoded audio (--audio-codec).
+type AudioCodec string
+
+const (
+	AudioCodecAuto AudioCodec = ""     // Derive from the output container (default).
+	AudioCodecAAC  AudioCodec = "aac"  // AAC via Audio.Encoder (libfdk_aac).
+	AudioCodecOpus AudioCodec = "opus" // Opus via libopus.
+)
+
+// containerAudioCodecs maps each output container to the audio codec used
+// when --audio-codec is not given. Every current container takes AAC for
+// the widest direct-play support.
+var containerAudioCodecs = map[Container]AudioCodec{
+	ContainerMKV: AudioCodecAAC,
+	ContainerMP4: AudioCodecAAC,
+	ContainerHLS: AudioCodecAAC,
+}
+
+// DefaultAudioCodec returns the audio codec for container c when
+// --audio-codec is not set.
+func DefaultAudioCodec(c Container) AudioCodec {
+	if ac, ok := containerAudioCodecs[c]; ok {
+		return ac
+	}
+	return AudioCodecAAC
+}
+
+// containerCopyCodecs is the container compatibility matrix consulted by
+// --reencode-audio-only-if-incompatible: source audio codecs (ffprobe
+// names) each container can carry as a straight copy. MP4 and the MPEG-TS
+// segments of HLS take the codecs common players decode; Matroska takes
+// nearly everything.
+var containerCopyCodecs = map[Container][]string{
+	ContainerMKV: {"aac", "ac3", "eac3", "dts", "truehd", "mlp", "flac", "alac", "opus", "vorbis", "mp3", "mp2",
+		"pcm_s16le", "pcm_s24le", "pcm_s32le", "pcm_f32le"},
+	ContainerMP4: {"aac", "ac3", "eac3", "mp3"},
+	ContainerHLS: {"aac", "ac3", "eac3", "mp3"},
+}
+
+// ContainerAcceptsAudio reports whether container c can carry audio in
+// codec (an ffprobe codec name) without transcoding.
+func ContainerAcceptsAudio(c Container, codec string) bool {
+	for _, ok := range containerCopyCodecs[c] {
+		if strings.EqualFold(ok, codec) {
+			return true
+		}
+	}
+	return false
+}
+
 // HDRMode controls HDR handling during encoding.
 type HDRMode string
 
@@ -35,6 +95,87 @@ const (
 	HDRTonemap  HDRMode = "tonemap"  // Tonemap to SDR.
 )
 
+// FieldOrder overrides the yadif field parity for interlaced sources
+// (--field-order), for captures whose field_order tag is wrong.
+type FieldOrder string
+
+const (
+	FieldOrderAuto FieldOrder = "auto" // Let yadif read parity from the frames (default).
+	FieldOrderTFF  FieldOrder = "tt"   // Top field first (yadif parity=0).
+	FieldOrderBFF  FieldOrder = "bb"   // Bottom field first (yadif parity=1).
+)
+
+// DenoiseLevel selects the --denoise filter strength.
+type DenoiseLevel string
+
+const (
+	DenoiseOff    DenoiseLevel = ""       // No denoise (default).
+	DenoiseLight  DenoiseLevel = "light"  // Mild grain cleanup.
+	DenoiseMedium DenoiseLevel = "medium" // Bare --denoise.
+	DenoiseHeavy  DenoiseLevel = "heavy"  // Strong cleanup for very noisy sources; softens detail.
+)
+
+// RemuxFallback selects what happens when a stream-copy remux is rejected
+// by the output container (--remux-fail).
+type RemuxFallback string
+
+const (
+	RemuxFallbackEncode RemuxFallback = "encode" // Re-encode the video (default).
+	RemuxFallbackMKV    RemuxFallback = "mkv"    // Remux into MKV instead.
+	RemuxFallbackFail   RemuxFallback = "fail"   // Fail the file.
+)
+
+// SubtitleCodec selects the subtitle output codec for MKV (--subtitle-codec).
+type SubtitleCodec string
+
+const (
+	SubtitleCodecCopy SubtitleCodec = "copy" // Stream-copy subtitles (default).
+	SubtitleCodecSRT  SubtitleCodec = "srt"  // Convert text subtitles to SubRip (drops ASS styling).
+	SubtitleCodecASS  SubtitleCodec = "ass"  // Convert text subtitles to ASS.
+)
+
+// ActionFilter restricts a run to files with one planned action (--only).
+type ActionFilter string
+
+const (
+	ActionFilterAll    ActionFilter = ""       // Process every file (default).
+	ActionFilterEncode ActionFilter = "encode" // Only files that would be encoded.
+	ActionFilterRemux  ActionFilter = "remux"  // Only files that would be remuxed.
+	ActionFilterSkip   ActionFilter = "skip"   // Only report files --skip-optimized would skip.
+)
+
+// InputSort is the order Run processes discovered files in (--input-sort).
+type InputSort string
+
+const (
+	InputSortName     InputSort = "name"     // Lexical path order, as discovered (default).
+	InputSortSize     InputSort = "size"     // Smallest file first.
+	InputSortMtime    InputSort = "mtime"    // Most recently modified first.
+	InputSortDuration InputSort = "duration" // Shortest duration first (probes every file up front).
+)
+
+// RenameMode selects how --rename-only places each original file at its
+// resolved output path.
+type RenameMode string
+
+const (
+	RenameOff  RenameMode = ""     // Encode/remux as usual (default).
+	RenameMove RenameMode = "move" // Move the file (copy and remove across filesystems).
+	RenameLink RenameMode = "link" // Hardlink the file; the input stays in place.
+	RenameCopy RenameMode = "copy" // Copy the file.
+)
+
+// NamingConvention selects the --naming-convention output path preset; see
+// naming.Convention for the templates.
+type NamingConvention string
+
+const (
+	NamingDefault  NamingConvention = "default"  // The built-in Jellyfin-style templates (default).
+	NamingJellyfin NamingConvention = "jellyfin" // Jellyfin's documented episode names.
+	NamingPlex     NamingConvention = "plex"     // Plex's documented episode names.
+	NamingKodi     NamingConvention = "kodi"     // Kodi: flat movie files.
+)
+
 // ColorMode controls ANSI color output.
 type ColorMode string
 
@@ -49,9 +190,12 @@ const (
 type EncoderConfig struct {
 	Mode             EncoderMode
 	VaapiDevice      string // Default: "/dev/dri/renderD128".
-	VaapiQP          int    // Default: 18. Overridden by --vaapi-qp or --quality.
+	VaapiConcurrency int    // Default: 1. Max simultaneous VAAPI encodes.
+	VaapiQP          int    // Default: 18. Also QSV's global_quality. Overridden by --vaapi-qp or --quality.
 	VaapiProfile     string // Derived at runtime: "main10" or "main".
 	VaapiSwFormat    string // Derived at runtime: "p010" or "nv12".
+	Require10Bit     bool   // --require-10bit: fail CheckDeps instead of falling back to 8-bit VAAPI.
+	Dither8Bit       bool   // --dither-8bit: error-diffusion dither when a 10-bit source is encoded to an 8-bit profile.
 	CpuCRF           int    // Default: 18. Overridden by --cpu-crf or --quality.
 	CpuPreset        string // Default: "slow".
 	CpuProfile       string // Fixed: "main10".
@@ -59,6 +203,29 @@ type EncoderConfig struct {
 	KeyframeInterval int    // Fixed: 48 frames.
 	HandleHDR        HDRMode
 	DeinterlaceAuto  bool
+	DetectInterlace  bool       // --detect-interlace: classify scan type with an idet pass.
+	FieldOrder       FieldOrder // Default: "auto". yadif parity override.
+	AutoCrop         bool       // --auto-crop: remove letterboxing measured by a cropdetect pass.
+
+	// Denoise (--denoise) filters grain after deinterlacing: hqdn3d in
+	// software, denoise_vaapi on VAAPI surfaces. DenoiseOff = none.
+	Denoise DenoiseLevel
+
+	// HDR→SDR tonemap tuning (--tonemap-peak, --tonemap-desat): the zscale
+	// nominal peak luminance in nits and the tonemap desaturation strength.
+	TonemapPeak  float64 // Default: 100.
+	TonemapDesat float64 // Default: 0 (no desaturation).
+
+	// Per-media-type downscale caps in pixels of height (0 = no cap).
+	// ScaleTo (--scale-to) caps every file; the lower set cap wins.
+	TVMaxHeight    int
+	MovieMaxHeight int
+	ScaleTo        int
+
+	// TargetBitrateKbps (--target-bitrate) encodes to an average video
+	// bitrate instead of a constant QP/CRF: two passes for CPU, VBR for
+	// VAAPI and QSV. 0 = off.
+	TargetBitrateKbps int
 
 	// Smart quality adaptation.
 	SmartQuality     bool // Default: true. Per-file quality adaptation.
@@ -76,8 +243,100 @@ type AudioConfig struct {
 	Channels    int    // Default: 2 (stereo).
 	Bitrate     string // Default: "320k".
 	SampleRate  int    // Fixed: 48000 Hz.
-	Encoder     string // Fixed default: "libfdk_aac".
+	Encoder     string // Default: "libfdk_aac"; "libopus" when Codec is opus.
 	MatchLayout bool   // Default: true. Normalize audio channel layout.
+
+	// Target codec for transcoded audio (--audio-codec). Streams already in
+	// this codec are copied. Left as AudioCodecAuto until ResolveAudioCodec
+	// derives it from the output container.
+	Codec AudioCodec
+
+	// AAC streams up to this bitrate are copied; higher ones are transcoded
+	// at Bitrate (--aac-copy-max). 0 = copy AAC at any bitrate.
+	AACCopyMaxKbps int // Default: 0 (AAC is always passthrough).
+
+	// CopyCompatible copies streams in any codec the output container
+	// accepts (ContainerAcceptsAudio), transcoding only the rest
+	// (--reencode-audio-only-if-incompatible). Copied streams keep their
+	// channel count.
+	CopyCompatible bool
+
+	// Per-codec channel caps from --audio-channels-by-codec, keyed by
+	// lowercase source codec name (e.g. "dts" → 2). Codecs without an entry
+	// use Channels.
+	ChannelsByCodec map[string]int
+
+	// Track selection: Langs keeps only streams in these languages
+	// (--audio-langs; empty keeps all), and DropCommentary drops commentary
+	// tracks (--drop-commentary). Neither leaves a file without audio: when
+	// a filter would drop every stream, it is not applied.
+	Langs          []string
+	DropCommentary bool
+
+	// PreferredOnly (--keep-only-preferred-audio-when-available) keeps only
+	// the non-commentary tracks in Config.MyLang when the file has one, and
+	// every track otherwise. Applied after Langs and DropCommentary.
+	PreferredOnly bool
+
+	// DualAudio makes untagged streams match Langs and PreferredOnly. It
+	// has no flag: the pipeline sets it on a per-file copy of the config
+	// for a "Dual Audio" release, whose untagged track is usually the
+	// second language.
+	DualAudio bool
+
+	// DownmixStereo downmixes 5.1 and 7.1 streams transcoded to stereo with
+	// an explicit Dolby Pro Logic II-style pan matrix (--downmix-stereo)
+	// instead of ffmpeg's default -ac downmix, which normalizes to a quiet
+	// level.
+	DownmixStereo bool
+
+	// Constant sync correction from --audio-delay, in milliseconds
+	// (negative = audio earlier). StreamDelayMs is keyed by audio stream
+	// index (a:N) and overrides DelayMs for that stream.
+	DelayMs       int
+	StreamDelayMs map[int]int
+
+	// AutoTitles sets each output audio track's title from its language,
+	// channel layout, and codec (--auto-audio-titles).
+	AutoTitles bool
+}
+
+// TargetCodec returns Codec, treating an unresolved AudioCodecAuto as AAC.
+func (a *AudioConfig) TargetCodec() AudioCodec {
+	if a.Codec == AudioCodecAuto {
+		return AudioCodecAAC
+	}
+	return a.Codec
+}
+
+// ChannelCap returns the channel cap for a transcoded stream of the given
+// source codec: its --audio-channels-by-codec entry, or Channels.
+func (a *AudioConfig) ChannelCap(codec string) int {
+	if n, ok := a.ChannelsByCodec[strings.ToLower(codec)]; ok {
+		return n
+	}
+	return a.Channels
+}
+
+// AudioDelayMs returns the --audio-delay for audio stream i (a:i).
+func (a *AudioConfig) AudioDelayMs(i int) int {
+	if ms, ok := a.StreamDelayMs[i]; ok {
+		return ms
+	}
+	return a.DelayMs
+}
+
+// HasAudioDelay reports whether any --audio-delay is configured.
+func (a *AudioConfig) HasAudioDelay() bool {
+	if a.DelayMs != 0 {
+		return true
+	}
+	for _, ms := range a.StreamDelayMs {
+		if ms != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // DisplayConfig groups logging and visual output settings.
@@ -87,6 +346,44 @@ type DisplayConfig struct {
 	FfmpegFPS bool      // Default: true.
 	ColorMode ColorMode // Default: "auto".
 	LogFile   string    // Optional log file path.
+	RetryLog  string    // --retry-log dir: full ffmpeg output of failed files as <basename>.<hash>.log.
+
+	// --progress-json target: a file path, or an inherited fd number,
+	// receiving NDJSON batch/file progress events. "" = off.
+	ProgressJSON string
+
+	// --summary-only: per-file lines are limited to warnings and errors;
+	// the batch header and final summary still print.
+	SummaryOnly bool
+
+	// --keep-ratio-report: list files whose output ended up larger than the
+	// input in the final summary.
+	RatioReport bool
+
+	// --summary-json: print the final summary as one JSON object on stdout;
+	// all log output moves to stderr.
+	SummaryJSON bool
+
+	// --checkpoint-every: log running encoded/skipped/failed totals and
+	// space saved after every N finished files. 0 = off.
+	CheckpointEvery int
+
+	// --print-commands: log each ffmpeg encode/remux command, shell-quoted
+	// for copy-paste, before it runs.
+	PrintCommands bool
+
+	// Per-file source bitrate outlier warnings.
+	ShowBitrateWarnings bool          // Default: true. Cleared by --no-bitrate-warnings.
+	BitrateTiers        []BitrateTier // From --bitrate-tiers; nil = built-in tiers.
+}
+
+// BitrateTier is a user-supplied expected source video bitrate range for
+// sources up to MaxHeight pixels tall (16:9 area). Tiers are kept sorted by
+// MaxHeight.
+type BitrateTier struct {
+	MaxHeight int
+	LowKbps   int64
+	HighKbps  int64
 }
 
 // Config holds all runtime settings. It is populated by [DefaultConfig] and
@@ -107,14 +404,217 @@ type Config struct {
 
 	// Behavior flags.
 	DryRun          bool
-	SkipExisting    bool // Default: true. Cleared by --force.
-	SkipHEVC        bool // Default: true. Cleared by --no-skip-hevc.
-	StrictMode      bool // Disable retry fallbacks.
-	CleanTimestamps bool // Default: true. Regenerate timestamps.
-	KeepSubtitles   bool // Default: true.
-	KeepAttachments bool // Default: true.
-	CheckOnly       bool // Run --check diagnostics and exit.
-	AnalyzeOnly     bool // Probe all files and print a codec/bitrate table.
+	SkipExisting    bool          // Default: true. Cleared by --force.
+	SkipHEVC        bool          // Default: true. Cleared by --no-skip-hevc.
+	SkipOptimized   bool          // Skip files that already match the target output.
+	RemuxFallback   RemuxFallback // Default: "encode". Response to container-rejected remuxes.
+	StrictMode      bool          // Disable retry fallbacks.
+	CleanTimestamps bool          // Default: true. Regenerate timestamps (used when CleanTimestampsAuto is off).
+	KeepSubtitles   bool          // Default: true.
+	SubtitleCodec   SubtitleCodec // Default: "copy". MKV subtitle output codec.
+	Only            ActionFilter  // --only: skip files whose planned action differs. "" = all.
+	InputSort       InputSort     // Default: "name". Processing order (--input-sort).
+	SidecarSubs     bool          // Mux external <stem>[.lang].srt/.ass/.vtt files found next to inputs.
+
+	// RetrySubTranscode (--retry-subtitle-transcode) retries a subtitle mux
+	// failure with the subtitles converted (srt for MKV, mov_text for MP4)
+	// before dropping them.
+	RetrySubTranscode bool
+
+	// ReplaceContainerOnly (--replace-container-only) keeps MKV output for
+	// files whose video is only remuxed when MP4 would drop their bitmap
+	// subtitles (see planner.KeepMKVForBitmapSubs).
+	ReplaceContainerOnly bool
+
+	// RemuxToFaststart (--remux-to-faststart) stream-copies MP4 sources
+	// whose video MP4 output can carry as-is (H.264, edge-safe HEVC, AV1)
+	// instead of encoding them, rewriting the file with +faststart (see
+	// planner.FaststartRemux).
+	RemuxToFaststart bool
+
+	// CleanTimestampsAuto leaves the timestamp fix to the planner, which
+	// enables it only for source formats known to need it (MPEG-TS, VOB).
+	// Cleared by an explicit --clean-timestamps or --no-clean-timestamps.
+	CleanTimestampsAuto bool // Default: true.
+
+	// SkipIfOutputNewer skips inputs whose output exists with an mtime at
+	// or after the input's (make-style). Stale outputs are re-processed even
+	// when SkipExisting is set.
+	SkipIfOutputNewer bool
+
+	// FaithfulRemux (--faithful-remux) rewraps every file losslessly: all
+	// streams copied with -map 0 -c copy, bypassing the audio, subtitle, and
+	// skip/encode decisions. MP4 output gets container fixups, and files
+	// with streams MP4 cannot carry fail.
+	FaithfulRemux bool
+
+	// BurnSubs (--burn-subs) renders one subtitle stream into the video for
+	// clients without soft-sub support, forcing an encode. BurnSubsLang
+	// (--burn-subs=lang) picks the first stream in that language; "" picks
+	// the source's default subtitle, else the first.
+	BurnSubs     bool
+	BurnSubsLang string
+
+	// StateFile (--state) is a JSON ledger of completed inputs, keyed by
+	// path and checked against size and mtime. Inputs it lists are skipped,
+	// so an interrupted run resumes where it stopped. "" = no ledger.
+	StateFile string
+
+	// Jobs is the number of files processed in parallel (--jobs). In VAAPI
+	// mode the pipeline caps it at Encoder.VaapiConcurrency.
+	Jobs int // Default: 1 (sequential).
+
+	// RemuxJobs (--remux-jobs) enables lane scheduling: a planning pre-pass
+	// routes files planned for an encode to the Jobs workers and all other
+	// files to RemuxJobs workers of their own. 0 = one shared pool.
+	RemuxJobs int
+
+	// ProbePrepass (--concurrent-probe-prepass) probes and plans every file
+	// concurrently before any is processed (pipeline.Plan), logs the planned
+	// action counts, and reuses the probes in the execution phase.
+	ProbePrepass bool
+
+	// MinHeight and MaxHeight skip sources whose video height falls outside
+	// the range (--min-height / --max-height), e.g. to leave 4K files
+	// untouched. 0 = no bound. Unlike the --tv-max-height / --movie-max-height
+	// downscale caps, files out of range are not processed at all.
+	MinHeight int
+	MaxHeight int
+
+	// MinBitrateKbps skips files that would be encoded when their video
+	// bitrate is below this many kbps (--min-bitrate-kbps): re-encoding
+	// already-small sources wastes time and can grow them. 0 = off.
+	MinBitrateKbps int
+
+	// MaxFileSize skips inputs larger than this many bytes (--max-file-size),
+	// e.g. a raw capture included by mistake. The upper-bound complement of
+	// the pipeline's fixed minimum file size. 0 = no cap.
+	MaxFileSize int64
+
+	// FailFastOnMismatch makes Validate reject option combinations listed by
+	// Mismatches instead of warning about them (--fail-fast-on-config-mismatch).
+	FailFastOnMismatch bool
+
+	// AbsoluteNumbering names anime-dash episodes ("Show - 137") by absolute
+	// number, without a season (--absolute-numbering).
+	AbsoluteNumbering bool
+
+	// KeepRawNames keeps a movie's cleaned filename when release-tag
+	// stripping would leave an empty or one-character name (--keep-raw-names).
+	KeepRawNames bool
+
+	// Output path templates (--tv-template / --movie-template), relative to
+	// OutputDir. Empty selects the default Jellyfin layout; main checks them
+	// with naming.NewLayout before any file is processed.
+	TVTemplate    string
+	MovieTemplate string
+
+	// NamingConvention is the --naming-convention preset supplying the
+	// templates left empty above. Default: "default".
+	NamingConvention NamingConvention
+
+	// ConfigFile is the --config TOML file applied beneath the command line.
+	ConfigFile string
+
+	// Subtitle language filter (--sub-langs). Empty keeps every stream. When
+	// no stream matches, all are kept unless SubsOnlyIfPresentLangs is set.
+	SubLangs               []string
+	SubsOnlyIfPresentLangs bool
+
+	// Default subtitle policy (--keep-subs-langs-default): when the default
+	// audio is not in MyLang, MyLang subtitles are defaulted on; otherwise off.
+	SubsDefaultByAudioLang bool
+	MyLang                 string // Default: "eng". Also read by Audio.PreferredOnly.
+
+	// Default subtitle language (--default-sub): the first mapped subtitle
+	// in this language becomes the default track and every other subtitle
+	// default is cleared. Takes precedence over SubsDefaultByAudioLang.
+	DefaultSubLang string
+
+	KeepAttachments bool   // Default: true.
+	KeepCoverArt    bool   // Carry embedded cover art (attached_pic) into MKV output.
+	CheckOnly       bool   // Run --check diagnostics and exit.
+	AnalyzeOnly     bool   // Probe all files and print a codec/bitrate table.
+	AnalyzeCSV      string // --analyze-csv: also write the analysis rows to this CSV file.
+	AnalyzeJSON     string // --analyze-json: also write the analysis rows and IQR summary to this JSON file.
+	CodecStats      bool   // --codec-stats: add a per-video-codec count/bitrate/size breakdown to --analyze.
+	OutputTreeOnly  bool   // Print the resolved output path tree without probing.
+	BenchmarkOnly   bool   // Time the configured encoder on a clip and exit.
+	BenchmarkInput  string // Clip for --benchmark; empty = generate a synthetic one.
+	ValidateOnly    bool   // Check each file is readable with a minimal ffprobe.
+
+	// --analyze outlier sensitivity (--outlier-mult, --extreme-mult): video
+	// bitrates beyond Q1/Q3 ± mult×IQR are flagged.
+	OutlierMult float64 // Default: 1.5.
+	ExtremeMult float64 // Default: 3.0.
+
+	// RenameOnly (--rename-only) organizes originals into the output
+	// layout (name parsing, harmonization, collisions) by moving,
+	// hardlinking, or copying them there, keeping their extension. Files
+	// are not probed or encoded. RenameOff = normal run.
+	RenameOnly RenameMode
+
+	// Assemble mode: encode one title from a concat list (--concat) or a
+	// numbered image sequence (--image-seq) instead of scanning InputDir.
+	// Output naming comes from Title.
+	ConcatList    string
+	ImageSequence string  // image2 pattern, e.g. "frames/%05d.png".
+	ImageFPS      float64 // Default: 24. Frame rate for --image-seq.
+	Title         string
+
+	// Output ownership (applied via chown after success). -1 = unchanged.
+	OutputUID int
+	OutputGID int
+
+	// Output permissions (applied via chmod after success, since ffmpeg and
+	// os.MkdirAll leave umask-derived modes). 0 = unchanged.
+	DirMode  os.FileMode // --dir-mode: created output directories.
+	FileMode os.FileMode // --file-mode: output files.
+
+	// Naming.
+	EpisodeOffset int // Added to parsed TV episode numbers (not specials). 0 = off.
+
+	// Tiny-output retry: re-encode once at higher quality when the output
+	// is below this percentage of the input (--retry-if-tiny-pct). 0 = off.
+	RetryIfTinyPct int
+
+	// Scratch space. TempDir is the --temp-dir base ("" = $TMPDIR);
+	// RunTempDir is the run-scoped directory created under it at startup.
+	TempDir    string
+	RunTempDir string // Derived at runtime; removed on exit.
+
+	// Staging: outputs are written under StagingDir (mirroring their path
+	// below OutputDir) and moved into OutputDir only once complete. "" = off.
+	StagingDir string
+
+	// Input throttling.
+	ReadRate float64 // ffmpeg -readrate multiplier (e.g. 2 = 2x realtime). 0 = unthrottled.
+
+	// Quality preview: seconds into each encoded file at which to write a
+	// source-vs-output comparison PNG (--preview-frame). 0 = off.
+	PreviewFrame float64
+
+	// Re-apply the source's creation_time tag to the output
+	// (--preserve-creation-time) instead of letting the muxer stamp it.
+	PreserveCreationTime bool
+
+	// Chapter handling: re-apply each source chapter title explicitly
+	// (--preserve-chapters-titles), and re-probe finished outputs to warn when
+	// the chapter count or titles differ from the source (--verify-chapters).
+	PreserveChapterTitles bool
+	VerifyChapters        bool
+
+	// Audio sync check (--verify-audio-sync): re-probe finished outputs and
+	// warn when an audio stream's duration, relative to the video's, has
+	// drifted from the source's by more than AudioSyncTolerance seconds
+	// (--audio-sync-tolerance).
+	VerifyAudioSync    bool
+	AudioSyncTolerance float64 // Default: 0.25.
+
+	// Tool binaries (--ffmpeg-path, --ffprobe-path): a bare name is looked
+	// up on PATH, anything else is used as given.
+	FFmpegPath  string // Default: "ffmpeg".
+	FFprobePath string // Default: "ffprobe".
 
 	// ffmpeg probe constants (not user-configurable).
 	FFmpegProbesize       string
@@ -128,6 +628,7 @@ func DefaultConfig() Config {
 		Encoder: EncoderConfig{
 			Mode:             EncoderVAAPI,
 			VaapiDevice:      "/dev/dri/renderD128",
+			VaapiConcurrency: 1,
 			VaapiQP:          18,
 			CpuCRF:           18,
 			CpuPreset:        "slow",
@@ -136,6 +637,8 @@ func DefaultConfig() Config {
 			KeyframeInterval: 48,
 			HandleHDR:        HDRPreserve,
 			DeinterlaceAuto:  true,
+			FieldOrder:       FieldOrderAuto,
+			TonemapPeak:      100,
 			SmartQuality:     true,
 			SmartQualityBias: -2,
 		},
@@ -151,16 +654,33 @@ func DefaultConfig() Config {
 			FileStats: true,
 			FfmpegFPS: true,
 			ColorMode: ColorAuto,
+
+			ShowBitrateWarnings: true,
 		},
 		OutputContainer:       ContainerMKV,
 		DryRun:                false,
 		SkipExisting:          true,
 		SkipHEVC:              true,
+		RemuxFallback:         RemuxFallbackEncode,
 		StrictMode:            false,
 		CleanTimestamps:       true,
+		CleanTimestampsAuto:   true,
+		Jobs:                  1,
+		InputSort:             InputSortName,
+		NamingConvention:      NamingDefault,
 		KeepSubtitles:         true,
+		SubtitleCodec:         SubtitleCodecCopy,
+		MyLang:                "eng",
 		KeepAttachments:       true,
 		CheckOnly:             false,
+		ImageFPS:              24,
+		AudioSyncTolerance:    0.25,
+		OutlierMult:           1.5,
+		ExtremeMult:           3.0,
+		OutputUID:             -1,
+		OutputGID:             -1,
+		FFmpegPath:            "ffmpeg",
+		FFprobePath:           "ffprobe",
 		FFmpegProbesize:       "100M",
 		FFmpegAnalyzeDuration: "100M",
 	}
@@ -181,22 +701,42 @@ func NormalizeDirArg(path string) string {
 	return trimmed
 }
 
-// Validate checks that enum fields (mode, container, HDR) hold valid values.
-// When not in CheckOnly mode, it also requires that both input and output
+// ResolveAudioCodec derives Audio.Codec from the output container when
+// --audio-codec was not given and selects the encoder for it. It runs once
+// the container is final (after --hls).
+func (c *Config) ResolveAudioCodec() {
+	if c.Audio.Codec == AudioCodecAuto {
+		c.Audio.Codec = DefaultAudioCodec(c.OutputContainer)
+	}
+	if c.Audio.Codec == AudioCodecOpus {
+		c.Audio.Encoder = "libopus"
+	}
+}
+
+// Validate checks that enum fields (mode, container, HDR) hold valid values
+// and, with --fail-fast-on-config-mismatch, that options do not conflict
+// (see Mismatches). When not in CheckOnly mode, it also requires that both input and output
 // directory paths are non-empty.
 func (c *Config) Validate() error {
 	switch c.Encoder.Mode {
-	case EncoderVAAPI, EncoderCPU:
+	case EncoderVAAPI, EncoderCPU, EncoderQSV:
 		// valid
 	default:
-		return errors.New("invalid mode (use 'vaapi' or 'cpu')")
+		return errors.New("invalid mode (use 'vaapi', 'cpu', or 'qsv')")
 	}
 
 	switch c.OutputContainer {
-	case ContainerMKV, ContainerMP4:
+	case ContainerMKV, ContainerMP4, ContainerHLS:
 		// valid
 	default:
-		return errors.New("invalid container (use 'mkv' or 'mp4')")
+		return errors.New("invalid container (use 'mkv', 'mp4', or 'hls')")
+	}
+
+	switch c.Audio.Codec {
+	case AudioCodecAuto, AudioCodecAAC, AudioCodecOpus:
+		// valid
+	default:
+		return errors.New("invalid audio codec (use 'aac' or 'opus')")
 	}
 
 	switch c.Encoder.HandleHDR {
@@ -205,13 +745,146 @@ func (c *Config) Validate() error {
 	default:
 		return errors.New("invalid HDR mode (use 'preserve' or 'tonemap')")
 	}
+	if c.Encoder.TVMaxHeight < 0 || c.Encoder.MovieMaxHeight < 0 || c.Encoder.ScaleTo < 0 {
+		return errors.New("invalid max height (use a positive pixel height, or 0 for no cap)")
+	}
+	if c.Encoder.TargetBitrateKbps < 0 {
+		return fmt.Errorf("invalid target bitrate %d kb/s (use a positive rate, or 0 for constant quality)", c.Encoder.TargetBitrateKbps)
+	}
+	switch c.Encoder.Denoise {
+	case DenoiseOff, DenoiseLight, DenoiseMedium, DenoiseHeavy:
+		// valid
+	default:
+		return errors.New("invalid --denoise level (use 'light', 'medium', or 'heavy')")
+	}
+	if strings.TrimSpace(c.FFmpegPath) == "" || strings.TrimSpace(c.FFprobePath) == "" {
+		return errors.New("empty --ffmpeg-path or --ffprobe-path (use a binary name or path)")
+	}
+	switch c.RemuxFallback {
+	case RemuxFallbackEncode, RemuxFallbackMKV, RemuxFallbackFail:
+		// valid
+	default:
+		return errors.New("invalid remux fallback (use 'encode', 'mkv', or 'fail')")
+	}
+	switch c.SubtitleCodec {
+	case SubtitleCodecCopy, SubtitleCodecSRT, SubtitleCodecASS:
+		// valid
+	default:
+		return errors.New("invalid subtitle codec (use 'copy', 'srt', or 'ass')")
+	}
+	switch c.InputSort {
+	case InputSortName, InputSortSize, InputSortMtime, InputSortDuration:
+		// valid
+	default:
+		return errors.New("invalid --input-sort order (use 'name', 'size', 'mtime', or 'duration')")
+	}
+	switch c.RenameOnly {
+	case RenameOff, RenameMove, RenameLink, RenameCopy:
+		// valid
+	default:
+		return errors.New("invalid --rename-only mode (use 'move', 'link', or 'copy')")
+	}
+	switch c.NamingConvention {
+	case NamingDefault, NamingJellyfin, NamingPlex, NamingKodi:
+		// valid
+	default:
+		return errors.New("invalid --naming-convention (use 'default', 'jellyfin', 'plex', or 'kodi')")
+	}
+	switch c.Only {
+	case ActionFilterAll, ActionFilterEncode, ActionFilterRemux, ActionFilterSkip:
+		// valid
+	default:
+		return errors.New("invalid --only action (use 'encode', 'remux', or 'skip')")
+	}
+	if c.Only == ActionFilterSkip && !c.SkipOptimized && c.MinHeight == 0 && c.MaxHeight == 0 && c.MinBitrateKbps == 0 {
+		return errors.New("--only skip requires --skip-optimized, --min-height, --max-height, or --min-bitrate-kbps (nothing is planned as skip without them)")
+	}
+	if c.MinHeight < 0 || c.MaxHeight < 0 {
+		return fmt.Errorf("invalid height bounds %d..%d (must be 0 or more)", c.MinHeight, c.MaxHeight)
+	}
+	if c.MinBitrateKbps < 0 {
+		return fmt.Errorf("invalid minimum bitrate %d kbps (must be 0 or more)", c.MinBitrateKbps)
+	}
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("invalid --max-file-size %d (must be 0 or more bytes)", c.MaxFileSize)
+	}
+	if c.MaxHeight > 0 && c.MinHeight > c.MaxHeight {
+		return fmt.Errorf("--min-height %d is above --max-height %d", c.MinHeight, c.MaxHeight)
+	}
+	if c.Jobs < 1 {
+		return fmt.Errorf("invalid jobs %d (must be at least 1)", c.Jobs)
+	}
+	if c.RemuxJobs < 0 {
+		return fmt.Errorf("invalid remux jobs %d (must be 0 or more)", c.RemuxJobs)
+	}
+	if c.Encoder.VaapiConcurrency < 1 {
+		return fmt.Errorf("invalid VAAPI concurrency %d (must be at least 1)", c.Encoder.VaapiConcurrency)
+	}
+	if c.SubsOnlyIfPresentLangs && len(c.SubLangs) == 0 {
+		return errors.New("--subtitles-only-if-present-langs requires --sub-langs")
+	}
+	if c.SubsDefaultByAudioLang && strings.TrimSpace(c.MyLang) == "" {
+		return errors.New("--keep-subs-langs-default requires --my-lang")
+	}
+	if c.Audio.PreferredOnly && strings.TrimSpace(c.MyLang) == "" {
+		return errors.New("--keep-only-preferred-audio-when-available requires --my-lang")
+	}
+	if c.Display.CheckpointEvery < 0 {
+		return fmt.Errorf("invalid checkpoint interval %d (must be 0 or greater)", c.Display.CheckpointEvery)
+	}
+	if c.EpisodeOffset < 0 {
+		return fmt.Errorf("invalid episode offset %d (must be 0 or greater)", c.EpisodeOffset)
+	}
+	if c.ReadRate < 0 {
+		return fmt.Errorf("invalid read rate %g (use a positive multiplier, or 0 for unthrottled)", c.ReadRate)
+	}
+	if c.RetryIfTinyPct < 0 || c.RetryIfTinyPct > 99 {
+		return fmt.Errorf("invalid tiny-output threshold %d%% (use 1-99, or 0 for off)", c.RetryIfTinyPct)
+	}
+	if c.Audio.AACCopyMaxKbps < 0 {
+		return fmt.Errorf("invalid AAC copy cap %d kbps (use a positive value, or 0 for no cap)", c.Audio.AACCopyMaxKbps)
+	}
+	if c.Encoder.TonemapPeak < 10 || c.Encoder.TonemapPeak > 10000 {
+		return fmt.Errorf("invalid tonemap peak %g nits (use 10-10000)", c.Encoder.TonemapPeak)
+	}
+	if c.Encoder.TonemapDesat < 0 || c.Encoder.TonemapDesat > 10 {
+		return fmt.Errorf("invalid tonemap desaturation %g (use 0-10)", c.Encoder.TonemapDesat)
+	}
+	if c.AudioSyncTolerance <= 0 {
+		return fmt.Errorf("invalid audio sync tolerance %g (use seconds above 0)", c.AudioSyncTolerance)
+	}
+	if c.PreviewFrame < 0 {
+		return fmt.Errorf("invalid preview frame time %g (use seconds into the file, or 0 for off)", c.PreviewFrame)
+	}
 	normalizedBitrate, err := normalizeAudioBitrate(c.Audio.Bitrate)
 	if err != nil {
 		return err
 	}
 	c.Audio.Bitrate = normalizedBitrate
+	if m := c.Mismatches(); c.FailFastOnMismatch && len(m) > 0 {
+		return fmt.Errorf("incompatible options: %s", strings.Join(m, "; "))
+	}
+
+	if c.AnalyzeCSV != "" && !c.AnalyzeOnly {
+		return errors.New("--analyze-csv requires --analyze")
+	}
+	if c.AnalyzeJSON != "" && !c.AnalyzeOnly {
+		return errors.New("--analyze-json requires --analyze")
+	}
+	if c.FaithfulRemux && c.OutputContainer == ContainerHLS {
+		return errors.New("--faithful-remux cannot write HLS output (use --container mkv or mp4)")
+	}
+	if c.BurnSubs && c.FaithfulRemux {
+		return errors.New("--burn-subs cannot be combined with --faithful-remux (it never encodes)")
+	}
+	if c.CodecStats && !c.AnalyzeOnly {
+		return errors.New("--codec-stats requires --analyze")
+	}
+	if c.OutlierMult <= 0 || c.ExtremeMult <= c.OutlierMult {
+		return fmt.Errorf("invalid outlier multipliers %g/%g (need --extreme-mult > --outlier-mult > 0)", c.OutlierMult, c.ExtremeMult)
+	}
 
-	if c.CheckOnly {
+	if c.CheckOnly || c.BenchmarkOnly {
 		return nil
 	}
 	if c.AnalyzeOnly {
@@ -220,12 +893,82 @@ func (c *Config) Validate() error {
 		}
 		return nil
 	}
+	if c.ValidateOnly {
+		if c.InputDir == "" {
+			return errors.New("--validate requires an input directory")
+		}
+		return nil
+	}
+	if c.AssembleMode() {
+		switch {
+		case c.ConcatList != "" && c.ImageSequence != "":
+			return errors.New("--concat and --image-seq cannot be combined")
+		case strings.TrimSpace(c.Title) == "":
+			return errors.New("--concat and --image-seq require --title")
+		case c.ImageFPS <= 0:
+			return fmt.Errorf("invalid image frame rate %g (must be positive)", c.ImageFPS)
+		case c.OutputDir == "":
+			return errors.New("--concat and --image-seq require an output directory")
+		}
+		return nil
+	}
 	if c.InputDir == "" || c.OutputDir == "" {
 		return errors.New("need exactly input_dir and output_dir")
 	}
 	return nil
 }
 
+// Mismatches returns option combinations that are each valid on their own
+// but conflict with one another, such as a subtitle codec the container
+// cannot carry. Without --fail-fast-on-config-mismatch they are logged as
+// warnings at startup and the run proceeds with the option ignored or
+// degraded; with it, Validate rejects them.
+func (c *Config) Mismatches() []string {
+	var m []string
+	if c.SubtitleCodec != SubtitleCodecCopy {
+		switch c.OutputContainer {
+		case ContainerMP4:
+			m = append(m, fmt.Sprintf("--subtitle-codec %s needs --container mkv (MP4 text subtitles are always mov_text)", c.SubtitleCodec))
+		case ContainerHLS:
+			m = append(m, fmt.Sprintf("--subtitle-codec %s has no effect with --container hls (HLS output carries no subtitles)", c.SubtitleCodec))
+		}
+	}
+	if c.Encoder.Mode == EncoderQSV && c.Encoder.HandleHDR == HDRPreserve {
+		m = append(m, "--mode qsv encodes 8-bit HEVC Main and cannot preserve HDR (use --hdr tonemap, or --mode vaapi or cpu)")
+	}
+	if c.Encoder.Require10Bit && c.Encoder.Mode != EncoderVAAPI {
+		m = append(m, fmt.Sprintf("--require-10bit only applies to --mode vaapi (mode is %s)", c.Encoder.Mode))
+	}
+	if c.Audio.Codec == AudioCodecOpus && c.OutputContainer == ContainerHLS {
+		m = append(m, "--audio-codec opus needs --container mkv or mp4 (HLS players expect AAC in the MPEG-TS segments)")
+	}
+	if c.Audio.AACCopyMaxKbps > 0 && c.Audio.TargetCodec() != AudioCodecAAC {
+		m = append(m, fmt.Sprintf("--aac-copy-max only applies when the audio codec is aac (it is %s)", c.Audio.TargetCodec()))
+	}
+	if c.Encoder.TargetBitrateKbps > 0 && (c.Encoder.QualityOverride != "" || c.Encoder.CpuCRFFixedOverride != "" || c.Encoder.VaapiQPFixedOverride != "") {
+		m = append(m, "--target-bitrate replaces QP/CRF (--quality, --cpu-crf and --vaapi-qp are ignored)")
+	}
+	if c.RetryIfTinyPct > 0 && c.Encoder.TargetBitrateKbps > 0 {
+		m = append(m, "--retry-if-tiny-pct raises QP/CRF quality, which --target-bitrate replaces (tiny outputs are not retried)")
+	}
+	if c.ReplaceContainerOnly && c.OutputContainer != ContainerMP4 {
+		m = append(m, fmt.Sprintf("--replace-container-only only applies to --container mp4 (container is %s)", c.OutputContainer))
+	}
+	if c.RemuxToFaststart && c.OutputContainer != ContainerMP4 {
+		m = append(m, fmt.Sprintf("--remux-to-faststart only applies to --container mp4 (container is %s)", c.OutputContainer))
+	}
+	if c.DefaultSubLang != "" && len(c.SubLangs) > 0 && !slices.ContainsFunc(c.SubLangs, func(l string) bool { return strings.EqualFold(l, c.DefaultSubLang) }) {
+		m = append(m, fmt.Sprintf("--default-sub %s is not in --sub-langs (those subtitles are dropped)", c.DefaultSubLang))
+	}
+	return m
+}
+
+// AssembleMode reports whether a single title is built from --concat or
+// --image-seq rather than a scanned input directory.
+func (c *Config) AssembleMode() bool {
+	return c.ConcatList != "" || c.ImageSequence != ""
+}
+
 // normalizeAudioBitrate validates and canonicalizes user bitrate input.
 // Accepted forms: "256", "256k", "256K", "256kbps". Output is "<n>k".
 func normalizeAudioBitrate(raw string) (string, error) {
@@ -1,6 +1,11 @@
 package config
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestNormalizeAudioBitrate(t *testing.T) {
 	tests := []struct {
@@ -58,3 +63,518 @@ func TestDefaultConfigAudioEncoder(t *testing.T) {
 		t.Fatalf("Audio.Encoder = %q, want libfdk_aac", cfg.Audio.Encoder)
 	}
 }
+
+func TestFileModeValue(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{in: "0775", want: 0o775},
+		{in: "664", want: 0o664},
+		{in: "2775", want: os.ModeSetgid | 0o775},
+		{in: "0", wantErr: true},
+		{in: "0999", wantErr: true},
+		{in: "17777", wantErr: true},
+	}
+	for _, tc := range tests {
+		var mode os.FileMode
+		v := &fileModeValue{&mode}
+		err := v.Set(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q): expected error, got mode %v", tc.in, mode)
+			}
+			continue
+		}
+		if err != nil || mode != tc.want {
+			t.Errorf("Set(%q) = %v, %v; want %v", tc.in, mode, err, tc.want)
+		}
+	}
+
+	mode := os.ModeSetgid | 0o775
+	if got := (&fileModeValue{&mode}).String(); got != "02775" {
+		t.Errorf("String() = %q, want 02775", got)
+	}
+}
+
+func TestOwnerValue(t *testing.T) {
+	tests := []struct {
+		name             string
+		in               string
+		wantUID, wantGID int
+		wantErr          bool
+	}{
+		{name: "uid and gid", in: "1000:100", wantUID: 1000, wantGID: 100},
+		{name: "uid only", in: "1000", wantUID: 1000, wantGID: -1},
+		{name: "root by name", in: "root:0", wantUID: 0, wantGID: 0},
+		{name: "empty user", in: ":100", wantErr: true},
+		{name: "negative", in: "-1", wantErr: true},
+		{name: "unknown user", in: "no-such-user-muxmaster", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			uid, gid := -1, -1
+			err := (&ownerValue{&uid, &gid}).Set(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for input %q, got nil", tc.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for input %q: %v", tc.in, err)
+			}
+			if uid != tc.wantUID || gid != tc.wantGID {
+				t.Fatalf("Set(%q) = %d:%d, want %d:%d", tc.in, uid, gid, tc.wantUID, tc.wantGID)
+			}
+		})
+	}
+}
+
+func TestBitrateTiersValue(t *testing.T) {
+	var tiers []BitrateTier
+	v := &bitrateTiersValue{&tiers}
+	if err := v.Set("1080=2500-10000, 720=1000-5000"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []BitrateTier{{720, 1000, 5000}, {1080, 2500, 10000}}
+	if len(tiers) != len(want) || tiers[0] != want[0] || tiers[1] != want[1] {
+		t.Fatalf("tiers = %+v, want %+v (sorted by height)", tiers, want)
+	}
+
+	for _, bad := range []string{"", "1080", "1080=5000", "1080=9000-100", "x=1-2", "0=1-2"} {
+		if err := v.Set(bad); err == nil {
+			t.Errorf("expected error for %q, got nil", bad)
+		}
+	}
+}
+
+func TestAudioDelayValue(t *testing.T) {
+	var a AudioConfig
+	v := &audioDelayValue{&a}
+	if err := v.Set("-80, 1=250"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.DelayMs != -80 || a.AudioDelayMs(0) != -80 || a.AudioDelayMs(1) != 250 {
+		t.Fatalf("got global %d, a:0 %d, a:1 %d; want -80, -80, 250", a.DelayMs, a.AudioDelayMs(0), a.AudioDelayMs(1))
+	}
+	if v.String() != "-80,1=250" {
+		t.Errorf("String() = %q, want -80,1=250", v.String())
+	}
+
+	if err := v.Set("0=0"); err != nil || a.HasAudioDelay() {
+		t.Errorf("zero per-stream delay should disable delays: err=%v has=%v", err, a.HasAudioDelay())
+	}
+	for _, bad := range []string{"", "abc", "1=", "-1=100", "x=100", "100ms"} {
+		if err := v.Set(bad); err == nil {
+			t.Errorf("expected error for %q, got nil", bad)
+		}
+	}
+}
+
+func TestChannelsByCodecValue(t *testing.T) {
+	a := AudioConfig{Channels: 2}
+	v := &channelsByCodecValue{&a.ChannelsByCodec}
+	if err := v.Set("DTS=2, eac3=6"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.ChannelCap("dts") != 2 || a.ChannelCap("eac3") != 6 || a.ChannelCap("ac3") != 2 {
+		t.Fatalf("got dts %d, eac3 %d, ac3 %d; want 2, 6, 2", a.ChannelCap("dts"), a.ChannelCap("eac3"), a.ChannelCap("ac3"))
+	}
+	if v.String() != "dts=2,eac3=6" {
+		t.Errorf("String() = %q, want dts=2,eac3=6", v.String())
+	}
+	for _, bad := range []string{"", "dts", "dts=", "=2", "dts=0", "dts=9", "dts=two"} {
+		if err := v.Set(bad); err == nil {
+			t.Errorf("expected error for %q, got nil", bad)
+		}
+	}
+}
+
+func TestValidateTonemapRanges(t *testing.T) {
+	for _, tc := range []struct {
+		peak, desat float64
+		ok          bool
+	}{
+		{100, 0, true},
+		{1000, 2.5, true},
+		{5, 0, false},
+		{20000, 0, false},
+		{100, -1, false},
+		{100, 11, false},
+	} {
+		cfg := DefaultConfig()
+		cfg.InputDir, cfg.OutputDir = "/in", "/out"
+		cfg.Encoder.TonemapPeak = tc.peak
+		cfg.Encoder.TonemapDesat = tc.desat
+		if err := cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("peak %g desat %g: err = %v, want ok=%v", tc.peak, tc.desat, err, tc.ok)
+		}
+	}
+}
+
+func TestValidateHeightBounds(t *testing.T) {
+	for _, tc := range []struct {
+		min, max int
+		ok       bool
+	}{
+		{0, 0, true},
+		{720, 0, true},
+		{0, 1080, true},
+		{720, 1080, true},
+		{1080, 720, false},
+		{-1, 0, false},
+	} {
+		cfg := DefaultConfig()
+		cfg.InputDir, cfg.OutputDir = "/in", "/out"
+		cfg.MinHeight, cfg.MaxHeight = tc.min, tc.max
+		if err := cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("min %d max %d: err = %v, want ok=%v", tc.min, tc.max, err, tc.ok)
+		}
+	}
+}
+
+func TestValidateFailFastOnMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{"srt subtitles in mp4", func(c *Config) { c.OutputContainer = ContainerMP4; c.SubtitleCodec = SubtitleCodecSRT }},
+		{"ass subtitles in hls", func(c *Config) { c.OutputContainer = ContainerHLS; c.SubtitleCodec = SubtitleCodecASS }},
+		{"qsv with hdr preserve", func(c *Config) { c.Encoder.Mode = EncoderQSV }},
+		{"require-10bit on cpu", func(c *Config) { c.Encoder.Mode = EncoderCPU; c.Encoder.Require10Bit = true }},
+		{"opus audio in hls", func(c *Config) { c.OutputContainer = ContainerHLS; c.Audio.Codec = AudioCodecOpus }},
+		{"aac-copy-max with opus", func(c *Config) { c.Audio.Codec = AudioCodecOpus; c.Audio.AACCopyMaxKbps = 256 }},
+		{"replace-container-only with mkv", func(c *Config) { c.ReplaceContainerOnly = true }},
+		{"remux-to-faststart with mkv", func(c *Config) { c.RemuxToFaststart = true }},
+		{"target-bitrate with quality", func(c *Config) { c.Encoder.TargetBitrateKbps = 4000; c.Encoder.QualityOverride = "20" }},
+		{"retry-if-tiny-pct with target-bitrate", func(c *Config) { c.Encoder.TargetBitrateKbps = 4000; c.RetryIfTinyPct = 5 }},
+		{"default-sub outside sub-langs", func(c *Config) { c.SubLangs = []string{"jpn"}; c.DefaultSubLang = "eng" }},
+	} {
+		cfg := DefaultConfig()
+		cfg.InputDir, cfg.OutputDir = "/in", "/out"
+		tc.mutate(&cfg)
+		if len(cfg.Mismatches()) != 1 {
+			t.Errorf("%s: got mismatches %q, want one", tc.name, cfg.Mismatches())
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s: without the flag Validate should pass, got %v", tc.name, err)
+		}
+		cfg.FailFastOnMismatch = true
+		if err := cfg.Validate(); err == nil || !strings.HasPrefix(err.Error(), "incompatible options: ") {
+			t.Errorf("%s: got %v, want an incompatible options error", tc.name, err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.InputDir, cfg.OutputDir = "/in", "/out"
+	cfg.FailFastOnMismatch = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults: got %v, want no mismatch", err)
+	}
+}
+
+func TestValidateOutlierMultipliers(t *testing.T) {
+	for _, tc := range []struct {
+		outlier, extreme float64
+		ok               bool
+	}{
+		{1.5, 3.0, true},
+		{1.0, 1.5, true},
+		{2.0, 2.0, false},
+		{3.0, 1.5, false},
+		{0, 3.0, false},
+	} {
+		cfg := DefaultConfig()
+		cfg.InputDir, cfg.OutputDir = "/in", "/out"
+		cfg.OutlierMult, cfg.ExtremeMult = tc.outlier, tc.extreme
+		if err := cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("outlier %g extreme %g: err = %v, want ok=%v", tc.outlier, tc.extreme, err, tc.ok)
+		}
+	}
+}
+
+func TestResolveAudioCodec_PerContainerDefault(t *testing.T) {
+	for _, c := range []Container{ContainerMKV, ContainerMP4, ContainerHLS} {
+		cfg := DefaultConfig()
+		cfg.OutputContainer = c
+		cfg.ResolveAudioCodec()
+		if cfg.Audio.Codec != AudioCodecAAC || cfg.Audio.Encoder != "libfdk_aac" {
+			t.Errorf("%s: got codec %q encoder %q, want aac via libfdk_aac", c, cfg.Audio.Codec, cfg.Audio.Encoder)
+		}
+	}
+}
+
+func TestResolveAudioCodec_ExplicitOverrides(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.OutputContainer = ContainerMP4
+	if err := (&audioCodecValue{&cfg.Audio.Codec}).Set("Opus"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	cfg.ResolveAudioCodec()
+	if cfg.Audio.Codec != AudioCodecOpus || cfg.Audio.Encoder != "libopus" {
+		t.Errorf("got codec %q encoder %q, want opus via libopus", cfg.Audio.Codec, cfg.Audio.Encoder)
+	}
+	if err := (&audioCodecValue{&cfg.Audio.Codec}).Set("mp3"); err == nil {
+		t.Error("expected error for unsupported codec mp3")
+	}
+}
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "muxmaster.toml")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `# library defaults
+mode = "cpu"
+cpu_crf = 20            # underscores work too
+sub-langs = ["eng", 'jpn']
+jobs = 2
+no-subs = true
+read-rate = 1.5
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Encoder.Mode != EncoderCPU || cfg.Encoder.CpuCRF != 20 {
+		t.Errorf("mode %q crf %d, want cpu 20", cfg.Encoder.Mode, cfg.Encoder.CpuCRF)
+	}
+	if strings.Join(cfg.SubLangs, ",") != "eng,jpn" {
+		t.Errorf("SubLangs = %v, want [eng jpn]", cfg.SubLangs)
+	}
+	if cfg.Jobs != 2 || cfg.KeepSubtitles || cfg.ReadRate != 1.5 {
+		t.Errorf("jobs %d subs %v read-rate %v, want 2 false 1.5", cfg.Jobs, cfg.KeepSubtitles, cfg.ReadRate)
+	}
+	if cfg.Audio.Bitrate != DefaultConfig().Audio.Bitrate {
+		t.Errorf("unset key changed: audio bitrate %q", cfg.Audio.Bitrate)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"unknown key", "mode = \"cpu\"\nvaapi_qpp = 20\n", `:2: unknown key "vaapi_qpp"`},
+		{"excluded key", "help = true\n", `unknown key "help"`},
+		{"bad value", "mode = \"nvenc\"\n", ":1: mode:"},
+		{"duplicate", "jobs = 2\njobs = 3\n", `duplicate key "jobs"`},
+		{"table", "[encoder]\nmode = \"cpu\"\n", "tables are not supported"},
+		{"bare string", "mode = cpu\n", "quote strings"},
+	}
+	for _, tt := range tests {
+		_, err := LoadFile(writeConfigFile(t, tt.body))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseFlags_ConfigFileUnderCLI(t *testing.T) {
+	path := writeConfigFile(t, "mode = \"cpu\"\npreset = \"slow\"\njobs = 4\n")
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = []string{"muxmaster", "--jobs", "2", "--config=" + path, "in", "out"}
+
+	cfg := DefaultConfig()
+	if err := ParseFlags(&cfg, "test", "none"); err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if cfg.Encoder.Mode != EncoderCPU || cfg.Encoder.CpuPreset != "slow" {
+		t.Errorf("file values not applied: mode %q preset %q", cfg.Encoder.Mode, cfg.Encoder.CpuPreset)
+	}
+	if cfg.Jobs != 2 {
+		t.Errorf("Jobs = %d, want CLI value 2 over file value 4", cfg.Jobs)
+	}
+	if cfg.ConfigFile != path {
+		t.Errorf("ConfigFile = %q, want %q", cfg.ConfigFile, path)
+	}
+}
+
+func TestParseFlags_BurnSubs(t *testing.T) {
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	for _, tc := range []struct {
+		args []string
+		lang string
+	}{
+		{[]string{"--burn-subs", "in", "out"}, ""},
+		{[]string{"--burn-subs=eng", "in", "out"}, "eng"},
+	} {
+		os.Args = append([]string{"muxmaster"}, tc.args...)
+		cfg := DefaultConfig()
+		if err := ParseFlags(&cfg, "test", "none"); err != nil {
+			t.Fatalf("%v: ParseFlags: %v", tc.args, err)
+		}
+		if !cfg.BurnSubs || cfg.BurnSubsLang != tc.lang || cfg.InputDir != "in" || cfg.OutputDir != "out" {
+			t.Errorf("%v: got burn %v lang %q dirs %q %q", tc.args, cfg.BurnSubs, cfg.BurnSubsLang, cfg.InputDir, cfg.OutputDir)
+		}
+	}
+}
+
+func TestParseFlags_Denoise(t *testing.T) {
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	for _, tc := range []struct {
+		args []string
+		want DenoiseLevel
+	}{
+		{[]string{"in", "out"}, DenoiseOff},
+		{[]string{"--denoise", "in", "out"}, DenoiseMedium},
+		{[]string{"--denoise=Heavy", "in", "out"}, DenoiseHeavy},
+	} {
+		os.Args = append([]string{"muxmaster"}, tc.args...)
+		cfg := DefaultConfig()
+		if err := ParseFlags(&cfg, "test", "none"); err != nil {
+			t.Fatalf("%v: ParseFlags: %v", tc.args, err)
+		}
+		if cfg.Encoder.Denoise != tc.want || cfg.InputDir != "in" {
+			t.Errorf("%v: got denoise %q, input %q", tc.args, cfg.Encoder.Denoise, cfg.InputDir)
+		}
+	}
+}
+
+func TestConfigPathFromArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--config", "a.toml", "in", "out"}, "a.toml"},
+		{[]string{"-v", "-config=b.toml"}, "b.toml"},
+		{[]string{"--", "--config", "c.toml"}, ""},
+		{[]string{"---config", "d.toml"}, ""},
+		{[]string{"in", "out"}, ""},
+	}
+	for _, tt := range tests {
+		if got := configPathFromArgs(tt.args); got != tt.want {
+			t.Errorf("configPathFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseFlags_EnvBetweenFileAndCLI(t *testing.T) {
+	path := writeConfigFile(t, "mode = \"vaapi\"\nvaapi-qp = 18\npreset = \"slow\"\n")
+	t.Setenv("MUXMASTER_MODE", "cpu")
+	t.Setenv("MUXMASTER_CPU_CRF", "22")
+	t.Setenv("MUXMASTER_NO_SUBS", "true")
+	t.Setenv("MUXMASTER_PRESET", "fast")
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = []string{"muxmaster", "--config", path, "--preset", "medium", "in", "out"}
+
+	cfg := DefaultConfig()
+	if err := ParseFlags(&cfg, "test", "none"); err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if cfg.Encoder.Mode != EncoderCPU || cfg.Encoder.CpuCRF != 22 || cfg.KeepSubtitles {
+		t.Errorf("env not applied over file: mode %q crf %d subs %v", cfg.Encoder.Mode, cfg.Encoder.CpuCRF, cfg.KeepSubtitles)
+	}
+	if cfg.Encoder.CpuPreset != "medium" {
+		t.Errorf("preset = %q, want CLI value medium over env", cfg.Encoder.CpuPreset)
+	}
+}
+
+func TestParseFlags_CLIBeatsOppositeFileAndEnv(t *testing.T) {
+	path := writeConfigFile(t, "no-clean-timestamps = true\nno-color = true\nno-fps = true\n")
+	t.Setenv("MUXMASTER_HLS", "true")
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = []string{"muxmaster", "--config", path, "--clean-timestamps", "--color", "--show-fps", "--container", "mkv", "in", "out"}
+
+	cfg := DefaultConfig()
+	if err := ParseFlags(&cfg, "test", "none"); err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if !cfg.CleanTimestamps || cfg.CleanTimestampsAuto {
+		t.Errorf("CleanTimestamps = %v (auto %v), want CLI --clean-timestamps over file no-clean-timestamps", cfg.CleanTimestamps, cfg.CleanTimestampsAuto)
+	}
+	if cfg.Display.ColorMode != ColorAlways {
+		t.Errorf("ColorMode = %v, want CLI --color over file no-color", cfg.Display.ColorMode)
+	}
+	if !cfg.Display.FfmpegFPS {
+		t.Error("FfmpegFPS = false, want CLI --show-fps over file no-fps")
+	}
+	if cfg.OutputContainer != ContainerMKV {
+		t.Errorf("OutputContainer = %v, want CLI --container mkv over MUXMASTER_HLS", cfg.OutputContainer)
+	}
+}
+
+func TestParseFlags_EnvBeatsOppositeFile(t *testing.T) {
+	path := writeConfigFile(t, "no-clean-timestamps = true\n")
+	t.Setenv("MUXMASTER_CLEAN_TIMESTAMPS", "true")
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = []string{"muxmaster", "--config", path, "in", "out"}
+
+	cfg := DefaultConfig()
+	if err := ParseFlags(&cfg, "test", "none"); err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if !cfg.CleanTimestamps {
+		t.Error("CleanTimestamps = false, want MUXMASTER_CLEAN_TIMESTAMPS over file no-clean-timestamps")
+	}
+}
+
+func TestParseFlags_CleanTimestampsFalse(t *testing.T) {
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	for _, args := range [][]string{
+		{"--clean-timestamps=false"},
+		{"--no-clean-timestamps"},
+		{"--config", writeConfigFile(t, "clean-timestamps = false\n")},
+	} {
+		os.Args = append(append([]string{"muxmaster"}, args...), "in", "out")
+		cfg := DefaultConfig()
+		if err := ParseFlags(&cfg, "test", "none"); err != nil {
+			t.Fatalf("%v: ParseFlags: %v", args, err)
+		}
+		if cfg.CleanTimestamps || cfg.CleanTimestampsAuto {
+			t.Errorf("%v: CleanTimestamps = %v (auto %v), want both off", args, cfg.CleanTimestamps, cfg.CleanTimestampsAuto)
+		}
+	}
+}
+
+func TestParseFlags_InvalidEnvNamesVariable(t *testing.T) {
+	t.Setenv("MUXMASTER_CONTAINER", "avi")
+	saved := os.Args
+	t.Cleanup(func() { os.Args = saved })
+	os.Args = []string{"muxmaster", "in", "out"}
+
+	cfg := DefaultConfig()
+	err := ParseFlags(&cfg, "test", "none")
+	if err == nil || !strings.Contains(err.Error(), `MUXMASTER_CONTAINER="avi"`) {
+		t.Errorf("err = %v, want one naming MUXMASTER_CONTAINER", err)
+	}
+}
+
+func TestContainerAcceptsAudio(t *testing.T) {
+	cases := []struct {
+		c     Container
+		codec string
+		want  bool
+	}{
+		{ContainerMP4, "ac3", true},
+		{ContainerMP4, "EAC3", true},
+		{ContainerMP4, "dts", false},
+		{ContainerMP4, "truehd", false},
+		{ContainerHLS, "mp3", true},
+		{ContainerHLS, "flac", false},
+		{ContainerMKV, "dts", true},
+		{ContainerMKV, "truehd", true},
+		{Container("avi"), "aac", false},
+	}
+	for _, c := range cases {
+		if got := ContainerAcceptsAudio(c.c, c.codec); got != c.want {
+			t.Errorf("ContainerAcceptsAudio(%s, %s) = %v, want %v", c.c, c.codec, got, c.want)
+		}
+	}
+}
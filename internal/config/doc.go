@@ -9,4 +9,6 @@
 // Files:
 //   - config.go:      Config + sub-structs, DefaultConfig, Validate, ValidatePaths
 //   - flags.go:       ParseFlags — CLI flag definitions and quality precedence logic
+//   - file.go:        LoadFile — --config TOML files applied beneath the command line
+//   - env.go:         MUXMASTER_* environment overrides, applied between the file and the command line
 package config
@@ -0,0 +1,42 @@
+// env.go applies MUXMASTER_* environment variables as flag values.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is prepended to the upper-cased long flag name, with dashes as
+// underscores: --vaapi-qp is MUXMASTER_VAAPI_QP.
+const envPrefix = "MUXMASTER_"
+
+// envVarName returns the environment variable that overrides a flag.
+func envVarName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvOverrides sets every long flag whose MUXMASTER_* variable is set
+// (e.g. MUXMASTER_MODE=cpu, MUXMASTER_NO_SUBS=true). Values go through the
+// flag's own Set, so they are parsed and validated exactly like the command
+// line. Short aliases and the non-setting flags (--config, --help,
+// --version) have no variable. An invalid value is reported with the
+// variable name.
+func applyEnvOverrides(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || len(f.Name) == 1 || nonSettingFlags[f.Name] {
+			return
+		}
+		name := envVarName(f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("%s=%q: %w", name, v, setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,223 @@
+// file.go loads --config TOML files: flag-name keys applied beneath the command line.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// nonSettingFlags lists flags that make no sense in a config file or the
+// environment: the file reference itself and the flags that print and exit.
+var nonSettingFlags = map[string]bool{
+	"config":  true,
+	"help":    true,
+	"h":       true,
+	"version": true,
+	"V":       true,
+}
+
+// LoadFile reads a TOML config file into a Config built on DefaultConfig.
+// Keys are long flag names (e.g. mode = "cpu", vaapi-qp = 20,
+// sub-langs = ["eng", "jpn"]); underscores may stand in for dashes. Values
+// go through the same parsing and validation as the command line. Unknown
+// keys, duplicate keys, and tables are errors.
+func LoadFile(path string) (Config, error) {
+	cfg := DefaultConfig()
+	fs := flag.NewFlagSet("muxmaster", flag.ContinueOnError)
+	var negated negatedFlags
+	defineFlags(fs, &cfg, &negated)
+	if err := applyConfigFile(fs, path); err != nil {
+		return Config{}, err
+	}
+	applyNegatedFlags(&cfg, &negated)
+	cfg.ResolveAudioCodec()
+	if err := applyQualityPrecedence(&cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyConfigFile sets every key in the TOML file at path on fs, as if it
+// had been passed on the command line. ParseFlags calls it after defining
+// the flags and before parsing os.Args, giving defaults → file → CLI.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	entries, err := parseTOML(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, e := range entries {
+		name := strings.ReplaceAll(e.key, "_", "-")
+		if fs.Lookup(name) == nil || nonSettingFlags[name] {
+			return fmt.Errorf("%s:%d: unknown key %q (keys are long flag names, e.g. vaapi-qp)", path, e.line, e.key)
+		}
+		if err := fs.Set(name, e.value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, e.line, e.key, err)
+		}
+	}
+	return nil
+}
+
+// configPathFromArgs returns the value of --config (or -config, with "="
+// or as the next argument) from args, or "" when absent. Scanning stops at
+// "--", after which everything is positional.
+func configPathFromArgs(args []string) string {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		name := strings.TrimLeft(a, "-")
+		if name == a || len(a)-len(name) > 2 {
+			continue
+		}
+		if v, ok := strings.CutPrefix(name, "config="); ok {
+			return v
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// tomlEntry is one key = value line, with the value rendered as the string
+// a flag would receive.
+type tomlEntry struct {
+	key   string
+	value string
+	line  int
+}
+
+// parseTOML parses the subset of TOML a flat settings file needs: comments,
+// bare keys, basic and literal strings, integers, floats, booleans, and
+// single-line arrays (joined with commas, as list flags expect).
+func parseTOML(data string) ([]tomlEntry, error) {
+	var entries []tomlEntry
+	seen := map[string]bool{}
+	for i, raw := range strings.Split(data, "\n") {
+		line := strings.TrimSpace(strings.TrimSuffix(raw, "\r"))
+		n := i + 1
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("line %d: tables are not supported (put flag-name keys at the top level)", n)
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isBareKey(key) {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		seen[key] = true
+		entries = append(entries, tomlEntry{key: key, value: value, line: n})
+	}
+	return entries, nil
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTOMLValue parses one value and any trailing comment.
+func parseTOMLValue(s string) (string, error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.LastIndex(s, "]")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated array")
+		}
+		if err := checkTrailing(s[end+1:]); err != nil {
+			return "", err
+		}
+		var items []string
+		for rest := strings.TrimSpace(s[1:end]); rest != ""; {
+			item, tail, err := scanScalar(rest)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+			tail = strings.TrimSpace(tail)
+			if tail != "" && tail[0] != ',' {
+				return "", fmt.Errorf("expected ',' between array items")
+			}
+			rest = strings.TrimSpace(strings.TrimPrefix(tail, ","))
+		}
+		return strings.Join(items, ","), nil
+	}
+	v, tail, err := scanScalar(s)
+	if err != nil {
+		return "", err
+	}
+	return v, checkTrailing(tail)
+}
+
+func checkTrailing(s string) error {
+	s = strings.TrimSpace(s)
+	if s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected %q after value", s)
+	}
+	return nil
+}
+
+// scanScalar reads a string, number, or boolean from the start of s and
+// returns it with the unread remainder.
+func scanScalar(s string) (value, rest string, err error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		v, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		return v, s[end+1:], nil
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexAny(s, ",]# \t")
+	if end < 0 {
+		end = len(s)
+	}
+	tok := s[:end]
+	if tok != "true" && tok != "false" {
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(tok, "_", ""), 64); err != nil {
+			return "", "", fmt.Errorf("invalid value %q (quote strings)", tok)
+		}
+		tok = strings.ReplaceAll(tok, "_", "")
+	}
+	return tok, s[end:], nil
+}
@@ -10,6 +10,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/user"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -29,17 +31,34 @@ func ParseFlags(cfg *Config, version, commit string) error {
 	// so that defaults from DefaultConfig() hold unless the user passes the flag.
 	var negated negatedFlags
 
-	defineEncodingFlags(fs, cfg)
-	defineContainerAndHDRFlags(fs, cfg, &negated)
-	defineBehaviorFlags(fs, cfg, &negated)
-	defineDisplayFlags(fs, cfg, &negated)
-	defineUtilityFlags(fs, cfg, &negated)
+	defineFlags(fs, cfg, &negated)
+
+	// --config and MUXMASTER_* variables are applied before the command line
+	// so flags override them (defaults → file → env → CLI). Setting values
+	// via fs keeps file, env, and CLI parsing identical. Each source's
+	// negated flags are applied and cleared before the next source is read,
+	// so a later source also wins where one sets a flag and an earlier one
+	// its opposite (no-clean-timestamps in the file, --clean-timestamps on
+	// the command line).
+	if path := configPathFromArgs(os.Args[1:]); path != "" {
+		if err := applyConfigFile(fs, path); err != nil {
+			return err
+		}
+		applyNegatedFlags(cfg, &negated)
+		negated = negatedFlags{}
+	}
+	if err := applyEnvOverrides(fs); err != nil {
+		return err
+	}
+	applyNegatedFlags(cfg, &negated)
+	negated = negatedFlags{}
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return err
 	}
 
 	applyNegatedFlags(cfg, &negated)
+	cfg.ResolveAudioCodec()
 
 	if negated.showHelp {
 		printUsage(fs, version)
@@ -63,59 +82,145 @@ type negatedFlags struct {
 	noSkipHEVC        bool
 	noFps             bool
 	noStats           bool
+	noBitrateWarnings bool
 	noSubs            bool
 	noAttachments     bool
 	noSmartQuality    bool
 	noCleanTimestamps bool
 	noMatchLayout     bool
 	force             bool
+	hls               bool
 	forceColor        bool
 	noColor           bool
 	showVersion       bool
 	showHelp          bool
 }
 
-// defineEncodingFlags registers -m/--mode, -q/--quality, --cpu-crf, --vaapi-qp, -p/--preset, --audio-bitrate.
+// defineFlags registers every flag group on fs, targeting cfg and n.
+func defineFlags(fs *flag.FlagSet, cfg *Config, n *negatedFlags) {
+	defineEncodingFlags(fs, cfg)
+	defineContainerAndHDRFlags(fs, cfg, n)
+	defineBehaviorFlags(fs, cfg, n)
+	defineDisplayFlags(fs, cfg, n)
+	defineUtilityFlags(fs, cfg, n)
+}
+
+// defineEncodingFlags registers -m/--mode, -q/--quality, --cpu-crf, --vaapi-qp, --target-bitrate, --vaapi-concurrency, --require-10bit, --dither-8bit, -p/--preset, --audio-bitrate, --audio-codec, --aac-copy-max, --reencode-audio-only-if-incompatible, --audio-channels-by-codec, --audio-langs, --drop-commentary, --keep-only-preferred-audio-when-available, --downmix-stereo, --audio-delay, --tv-max-height, --movie-max-height, --scale-to.
 func defineEncodingFlags(fs *flag.FlagSet, cfg *Config) {
-	fs.Var(&encoderModeValue{&cfg.Encoder.Mode}, "mode", "Encoder mode: vaapi | cpu")
+	fs.Var(&encoderModeValue{&cfg.Encoder.Mode}, "mode", "Encoder mode: vaapi | cpu | qsv")
 	fs.Var(&encoderModeValue{&cfg.Encoder.Mode}, "m", "Same as --mode")
 	fs.StringVar(&cfg.Encoder.QualityOverride, "quality", "", "Fixed quality for active mode (QP or CRF)")
 	fs.StringVar(&cfg.Encoder.QualityOverride, "q", "", "Same as --quality")
 	fs.StringVar(&cfg.Encoder.CpuCRFFixedOverride, "cpu-crf", "", "Fixed CPU CRF (overrides --quality in CPU mode)")
-	fs.StringVar(&cfg.Encoder.VaapiQPFixedOverride, "vaapi-qp", "", "Fixed VAAPI QP (overrides --quality in VAAPI mode)")
+	fs.StringVar(&cfg.Encoder.VaapiQPFixedOverride, "vaapi-qp", "", "Fixed VAAPI/QSV QP (overrides --quality in VAAPI and QSV modes)")
+	fs.IntVar(&cfg.Encoder.TargetBitrateKbps, "target-bitrate", 0, "Average video bitrate in kb/s: two-pass x265, VBR for VAAPI/QSV (0 = constant quality)")
+	fs.IntVar(&cfg.Encoder.VaapiConcurrency, "vaapi-concurrency", cfg.Encoder.VaapiConcurrency, "Max simultaneous VAAPI encodes")
+	fs.BoolVar(&cfg.Encoder.Require10Bit, "require-10bit", false, "Fail if VAAPI cannot encode main10 instead of falling back to 8-bit")
+	fs.BoolVar(&cfg.Encoder.Dither8Bit, "dither-8bit", false, "Dither 10-bit sources encoded to an 8-bit profile (QSV, VAAPI main fallback)")
 	fs.StringVar(&cfg.Encoder.CpuPreset, "preset", cfg.Encoder.CpuPreset, "x265 preset (e.g. slow, medium)")
 	fs.StringVar(&cfg.Encoder.CpuPreset, "p", cfg.Encoder.CpuPreset, "Same as --preset")
 	fs.StringVar(&cfg.Audio.Bitrate, "audio-bitrate", cfg.Audio.Bitrate, "Audio bitrate in Kbps (e.g. 128k, 320k)")
+	fs.Var(&audioCodecValue{&cfg.Audio.Codec}, "audio-codec", "Transcoded audio codec: aac | opus (default: per container)")
+	fs.IntVar(&cfg.Audio.AACCopyMaxKbps, "aac-copy-max", cfg.Audio.AACCopyMaxKbps, "Copy AAC up to N kbps; transcode higher (0 = always copy)")
+	fs.BoolVar(&cfg.Audio.CopyCompatible, "reencode-audio-only-if-incompatible", false, "Copy audio in any codec the container supports (e.g. AC3 in MP4); transcode the rest")
+	fs.Var(&channelsByCodecValue{&cfg.Audio.ChannelsByCodec}, "audio-channels-by-codec", "Per-codec channel caps for transcoded audio, e.g. dts=2,eac3=6")
+	fs.Var(&langListValue{&cfg.Audio.Langs}, "audio-langs", "Keep only audio in these languages (comma-separated, e.g. eng,jpn)")
+	fs.BoolVar(&cfg.Audio.DropCommentary, "drop-commentary", false, "Drop audio tracks titled or flagged as commentary")
+	fs.BoolVar(&cfg.Audio.PreferredOnly, "keep-only-preferred-audio-when-available", false, "Keep only --my-lang audio (no commentary) when the file has it; otherwise keep all")
+	fs.BoolVar(&cfg.Audio.DownmixStereo, "downmix-stereo", false, "Downmix 5.1/7.1 to stereo with Pro Logic II-style pan coefficients")
+	fs.Var(&audioDelayValue{&cfg.Audio}, "audio-delay", "Shift audio by ms: N for all streams, or idx=N[,...] per audio stream")
+	fs.IntVar(&cfg.Encoder.TVMaxHeight, "tv-max-height", 0, "Downscale TV episodes taller than N pixels (0 = no cap)")
+	fs.IntVar(&cfg.Encoder.MovieMaxHeight, "movie-max-height", 0, "Downscale movies taller than N pixels (0 = no cap)")
+	fs.IntVar(&cfg.Encoder.ScaleTo, "scale-to", 0, "Downscale every file taller than N pixels, e.g. 1080 (0 = no cap)")
 }
 
-// defineContainerAndHDRFlags registers --container, --hdr, --no-deinterlace.
+// defineContainerAndHDRFlags registers --container, --hls, --hdr, --tonemap-peak, --tonemap-desat, --no-deinterlace, --detect-interlace, --field-order, --auto-crop, --denoise.
 func defineContainerAndHDRFlags(fs *flag.FlagSet, cfg *Config, n *negatedFlags) {
-	fs.Var(&containerValue{&cfg.OutputContainer}, "container", "Output container: mkv | mp4")
+	fs.Var(&containerValue{&cfg.OutputContainer}, "container", "Output container: mkv | mp4 | hls")
+	fs.BoolVar(&n.hls, "hls", false, "Write an HLS VOD playlist + segments (same as --container hls)")
 	fs.Var(&hdrModeValue{&cfg.Encoder.HandleHDR}, "hdr", "HDR handling: preserve | tonemap")
+	fs.Float64Var(&cfg.Encoder.TonemapPeak, "tonemap-peak", cfg.Encoder.TonemapPeak, "Tonemap nominal peak luminance in nits (10-10000)")
+	fs.Float64Var(&cfg.Encoder.TonemapDesat, "tonemap-desat", cfg.Encoder.TonemapDesat, "Tonemap desaturation strength (0-10)")
 	fs.BoolVar(&n.noDeinterlace, "no-deinterlace", false, "Disable automatic deinterlace")
+	fs.BoolVar(&cfg.Encoder.DetectInterlace, "detect-interlace", false, "Classify interlace/telecine with an idet sampling pass")
+	fs.Var(&fieldOrderValue{&cfg.Encoder.FieldOrder}, "field-order", "Deinterlace field order: auto | tt | bb")
+	fs.BoolVar(&cfg.Encoder.AutoCrop, "auto-crop", false, "Detect letterboxing with a cropdetect pass and crop it away")
+	fs.Var(&denoiseValue{&cfg.Encoder.Denoise}, "denoise", "Denoise grainy sources; --denoise=light|medium|heavy (bare: medium)")
 }
 
-// defineBehaviorFlags registers dry-run, skip-hevc, subs, attachments, strict, quality, timestamps, force.
+// defineBehaviorFlags registers dry-run, fail-fast-on-config-mismatch, skip-hevc, only, input-sort, min-height, max-height, min-bitrate-kbps, max-file-size, subs, retry-subtitle-transcode, attachments, strict, remux-fail, replace-container-only, remux-to-faststart, absolute-numbering, keep-raw-names, tv-template, movie-template, naming-convention/output-structure, episode-offset, staging-dir, output-owner, dir-mode, file-mode, read-rate, preview-frame, preserve-creation-time, preserve-chapters-titles, verify-chapters, verify-audio-sync, audio-sync-tolerance, quality, retry-if-tiny-pct, timestamps, auto-audio-titles, force, skip-if-output-newer, state, faithful-remux/map-all-streams, burn-subs, jobs, remux-jobs, concurrent-probe-prepass.
 func defineBehaviorFlags(fs *flag.FlagSet, cfg *Config, n *negatedFlags) {
 	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Preview only; do not encode or remux")
 	fs.BoolVar(&cfg.DryRun, "d", false, "Same as --dry-run")
+	fs.BoolVar(&cfg.FailFastOnMismatch, "fail-fast-on-config-mismatch", false, "Reject conflicting options at startup instead of warning")
 	fs.BoolVar(&n.noSkipHEVC, "no-skip-hevc", false, "Re-encode HEVC instead of remuxing")
+	fs.BoolVar(&cfg.SkipOptimized, "skip-optimized", false, "Skip files that are already in the target format")
+	fs.Var(&actionFilterValue{&cfg.Only}, "only", "Process only files planned to: encode | remux | skip")
+	fs.Var(&inputSortValue{&cfg.InputSort}, "input-sort", "Processing order: name | size | mtime | duration")
+	fs.IntVar(&cfg.MinHeight, "min-height", 0, "Skip sources shorter than N pixels (0 = no bound)")
+	fs.IntVar(&cfg.MaxHeight, "max-height", 0, "Skip sources taller than N pixels, e.g. 1080 to leave 4K untouched (0 = no bound)")
+	fs.IntVar(&cfg.MinBitrateKbps, "min-bitrate-kbps", 0, "Skip files that would be encoded when their video bitrate is below N kbps (0 = off)")
+	fs.Int64Var(&cfg.MaxFileSize, "max-file-size", 0, "Skip input files larger than N bytes (0 = no cap)")
 	fs.BoolVar(&cfg.Encoder.SmartQuality, "smart-quality", cfg.Encoder.SmartQuality, "Per-file quality adaptation")
-	fs.BoolVar(&cfg.CleanTimestamps, "clean-timestamps", cfg.CleanTimestamps, "Regenerate timestamps")
+	fs.Var(&cleanTimestampsValue{&cfg.CleanTimestamps, &cfg.CleanTimestampsAuto}, "clean-timestamps", "Regenerate timestamps for every encode (default: only MPEG-TS/VOB sources)")
 	fs.BoolVar(&cfg.Audio.MatchLayout, "match-audio-layout", cfg.Audio.MatchLayout, "Normalize audio channel layout")
+	fs.BoolVar(&cfg.Audio.AutoTitles, "auto-audio-titles", false, "Title audio tracks from language, layout, and codec (e.g. English 5.1 EAC3)")
 	fs.BoolVar(&n.noFps, "no-fps", false, "Do not show live ffmpeg FPS")
 	fs.BoolVar(&n.noStats, "no-stats", false, "Hide per-file source stats")
+	fs.BoolVar(&n.noBitrateWarnings, "no-bitrate-warnings", false, "Hide per-file bitrate outlier warnings")
+	fs.Var(&bitrateTiersValue{&cfg.Display.BitrateTiers}, "bitrate-tiers", "Outlier tiers: height=low-high[,...] in kb/s")
 	fs.BoolVar(&n.noSubs, "no-subs", false, "Do not process subtitle streams")
+	fs.Var(&subtitleCodecValue{&cfg.SubtitleCodec}, "subtitle-codec", "MKV subtitle codec: copy | srt | ass")
+	fs.BoolVar(&cfg.RetrySubTranscode, "retry-subtitle-transcode", false, "On a subtitle mux failure, retry with srt (MKV) or mov_text (MP4) subtitles before dropping them")
+	fs.Var(&langListValue{&cfg.SubLangs}, "sub-langs", "Keep only subtitles in these languages (comma-separated, e.g. eng,jpn)")
+	fs.BoolVar(&cfg.SubsOnlyIfPresentLangs, "subtitles-only-if-present-langs", false, "Drop all subtitles when none match --sub-langs")
+	fs.BoolVar(&cfg.SidecarSubs, "sidecar-subs", false, "Mux external .srt/.ass/.vtt files next to inputs")
+	fs.BoolVar(&cfg.SubsDefaultByAudioLang, "keep-subs-langs-default", false, "Default --my-lang subs on only for foreign-language audio")
+	fs.StringVar(&cfg.MyLang, "my-lang", cfg.MyLang, "Preferred language code for --keep-subs-langs-default and --keep-only-preferred-audio-when-available")
+	fs.StringVar(&cfg.DefaultSubLang, "default-sub", "", "Make the first subtitle in this language the default track")
 	fs.BoolVar(&n.noAttachments, "no-attachments", false, "Do not include attachments")
+	fs.BoolVar(&cfg.KeepCoverArt, "keep-cover", false, "Carry embedded cover art into MKV output")
 	fs.BoolVar(&cfg.StrictMode, "strict", false, "Disable automatic ffmpeg retry fallbacks")
+	fs.Var(&remuxFallbackValue{&cfg.RemuxFallback}, "remux-fail", "When the container rejects a remux: encode | mkv | fail")
+	fs.BoolVar(&cfg.ReplaceContainerOnly, "replace-container-only", false, "Keep MKV when the video is only remuxed and MP4 would drop bitmap subtitles")
+	fs.BoolVar(&cfg.RemuxToFaststart, "remux-to-faststart", false, "Stream-copy MP4 sources with web-safe video (H.264, HEVC, AV1), adding +faststart")
+	fs.BoolVar(&cfg.AbsoluteNumbering, "absolute-numbering", false, "Name \"Show - 137\" episodes by absolute number (Show/Show - 137) instead of Season 1")
+	fs.BoolVar(&cfg.KeepRawNames, "keep-raw-names", false, "Keep a movie's filename when tag stripping leaves a too-short name")
+	fs.StringVar(&cfg.TVTemplate, "tv-template", "", "TV output path template, e.g. {show}/Season {season:02d}/{show} - S{season:02d}E{episode:02d}.{ext}")
+	fs.StringVar(&cfg.MovieTemplate, "movie-template", "", "Movie output path template, e.g. {title} ({year})/{title} ({year}).{ext}")
+	fs.Var(&namingConventionValue{&cfg.NamingConvention}, "naming-convention", "Output path preset: default | jellyfin | plex | kodi")
+	fs.Var(&namingConventionValue{&cfg.NamingConvention}, "output-structure", "Same as --naming-convention")
+	fs.IntVar(&cfg.EpisodeOffset, "episode-offset", 0, "Add N to parsed TV episode numbers (specials unchanged)")
+	fs.StringVar(&cfg.StagingDir, "staging-dir", "", "Write outputs here and move them into output_dir once complete")
+	fs.Var(&ownerValue{&cfg.OutputUID, &cfg.OutputGID}, "output-owner", "chown outputs to user[:group] (names or numeric ids)")
+	fs.Var(&fileModeValue{&cfg.DirMode}, "dir-mode", "chmod created output directories to this octal mode, e.g. 0775")
+	fs.Var(&fileModeValue{&cfg.FileMode}, "file-mode", "chmod output files to this octal mode, e.g. 0664")
+	fs.Float64Var(&cfg.ReadRate, "read-rate", 0, "Throttle input reads to N× realtime (0 = unthrottled)")
+	fs.Float64Var(&cfg.PreviewFrame, "preview-frame", 0, "Write a source|output comparison PNG at N seconds per encode")
+	fs.BoolVar(&cfg.PreserveCreationTime, "preserve-creation-time", false, "Re-apply the source creation_time tag to the output")
+	fs.BoolVar(&cfg.PreserveChapterTitles, "preserve-chapters-titles", false, "Re-apply each source chapter title to the output")
+	fs.BoolVar(&cfg.VerifyChapters, "verify-chapters", false, "Re-probe outputs and warn when chapters differ from the source")
+	fs.BoolVar(&cfg.VerifyAudioSync, "verify-audio-sync", false, "Re-probe outputs and warn when audio duration drifts from the video compared to the source")
+	fs.Float64Var(&cfg.AudioSyncTolerance, "audio-sync-tolerance", cfg.AudioSyncTolerance, "Drift in seconds --verify-audio-sync tolerates")
 	fs.BoolVar(&n.noSmartQuality, "no-smart-quality", false, "Use fixed quality only (no per-file adaptation)")
+	fs.IntVar(&cfg.RetryIfTinyPct, "retry-if-tiny-pct", 0, "Re-encode at higher quality when output is under N% of input (0 = off)")
 	fs.BoolVar(&n.noCleanTimestamps, "no-clean-timestamps", false, "Disable timestamp regeneration")
 	fs.BoolVar(&n.noMatchLayout, "no-match-audio-layout", false, "Disable audio layout normalization")
 	fs.BoolVar(&n.force, "force", false, "Overwrite existing output files")
 	fs.BoolVar(&n.force, "f", false, "Same as --force")
+	fs.BoolVar(&cfg.SkipIfOutputNewer, "skip-if-output-newer", false, "Skip inputs whose output is at least as new; re-process stale outputs")
+	fs.BoolVar(&cfg.FaithfulRemux, "faithful-remux", false, "Copy every stream as-is (-map 0 -c copy) into the output container; never encode")
+	fs.BoolVar(&cfg.FaithfulRemux, "map-all-streams", false, "Same as --faithful-remux")
+	fs.Var(&burnSubsValue{&cfg.BurnSubs, &cfg.BurnSubsLang}, "burn-subs", "Burn a subtitle into the video; --burn-subs=lang picks the language")
+	fs.StringVar(&cfg.StateFile, "state", "", "JSON ledger of completed inputs; skip them when resuming an interrupted run")
+	fs.IntVar(&cfg.Jobs, "jobs", cfg.Jobs, "Number of files to process in parallel")
+	fs.IntVar(&cfg.Jobs, "j", cfg.Jobs, "Same as --jobs")
+	fs.IntVar(&cfg.RemuxJobs, "remux-jobs", 0, "Run remuxes on N workers of their own; --jobs then bounds encodes (0 = off)")
+	fs.BoolVar(&cfg.ProbePrepass, "concurrent-probe-prepass", false, "Probe and plan every file concurrently before processing, and log the planned actions")
 }
 
-// defineDisplayFlags registers color, verbose, log, and --check flags.
+// defineDisplayFlags registers color, verbose, summary-only, keep-ratio-report, checkpoint-every, print-commands, summary-json, log, retry-log, progress-json, temp-dir, ffmpeg-path, ffprobe-path, and the --check, --analyze, --analyze-csv, --analyze-json, --codec-stats, --outlier-mult, --extreme-mult, --validate, --dry-run-output-tree, --rename-only, --benchmark,
+// and --concat/--image-seq mode flags.
 // Note: --check is a utility flag conceptually, but is registered here alongside
 // --verbose and --log because it controls what the program outputs rather than
 // how it encodes.
@@ -123,19 +228,44 @@ func defineDisplayFlags(fs *flag.FlagSet, cfg *Config, n *negatedFlags) {
 	fs.BoolVar(&n.forceColor, "color", false, "Force colored logs")
 	fs.BoolVar(&n.noColor, "no-color", false, "Disable colored logs")
 	fs.BoolVar(&cfg.Display.FfmpegFPS, "show-fps", cfg.Display.FfmpegFPS, "Show live ffmpeg FPS")
+	fs.BoolVar(&cfg.Display.SummaryOnly, "summary-only", false, "Hide per-file progress lines; print only warnings, errors, and the summary")
+	fs.BoolVar(&cfg.Display.RatioReport, "keep-ratio-report", false, "List outputs larger than their input in the summary")
+	fs.BoolVar(&cfg.Display.SummaryJSON, "summary-json", false, "Print the final summary as JSON on stdout; logs go to stderr")
+	fs.IntVar(&cfg.Display.CheckpointEvery, "checkpoint-every", 0, "Log running totals every N files (0 = off)")
+	fs.BoolVar(&cfg.Display.PrintCommands, "print-commands", false, "Log each ffmpeg command, shell-quoted, before running it")
 	fs.BoolVar(&cfg.Display.Verbose, "verbose", false, "Verbose output")
 	fs.BoolVar(&cfg.Display.Verbose, "v", false, "Same as --verbose")
 	fs.BoolVar(&cfg.CheckOnly, "check", false, "Run system diagnostics and exit")
 	fs.BoolVar(&cfg.CheckOnly, "c", false, "Same as --check")
 	fs.BoolVar(&cfg.AnalyzeOnly, "analyze", false, "Probe all files and print codec/bitrate table")
 	fs.BoolVar(&cfg.AnalyzeOnly, "a", false, "Same as --analyze")
+	fs.StringVar(&cfg.AnalyzeCSV, "analyze-csv", "", "With --analyze, also write the table as CSV to this file")
+	fs.StringVar(&cfg.AnalyzeJSON, "analyze-json", "", "With --analyze, also write the table and IQR summary as JSON to this file")
+	fs.BoolVar(&cfg.CodecStats, "codec-stats", false, "With --analyze, also summarize count, bitrate, and size per video codec")
+	fs.Float64Var(&cfg.OutlierMult, "outlier-mult", cfg.OutlierMult, "With --analyze, flag video bitrates beyond this many IQRs as outliers")
+	fs.Float64Var(&cfg.ExtremeMult, "extreme-mult", cfg.ExtremeMult, "With --analyze, flag video bitrates beyond this many IQRs as extreme")
+	fs.BoolVar(&cfg.ValidateOnly, "validate", false, "Check every file is readable with a minimal ffprobe and exit")
+	fs.BoolVar(&cfg.OutputTreeOnly, "dry-run-output-tree", false, "Print the resolved output path tree (no probing) and exit")
+	fs.Var(&renameModeValue{&cfg.RenameOnly}, "rename-only", "Move, hardlink, or copy files into the output layout without encoding: move | link | copy")
+	fs.BoolVar(&cfg.BenchmarkOnly, "benchmark", false, "Time the configured encoder on a clip and exit")
+	fs.StringVar(&cfg.BenchmarkInput, "benchmark-input", "", "Clip for --benchmark (default: synthetic 1080p)")
+	fs.StringVar(&cfg.ConcatList, "concat", "", "Encode one title from an ffmpeg concat list file")
+	fs.StringVar(&cfg.ImageSequence, "image-seq", "", "Encode one title from a numbered image pattern (e.g. frames/%05d.png)")
+	fs.Float64Var(&cfg.ImageFPS, "image-fps", cfg.ImageFPS, "Frame rate for --image-seq")
+	fs.StringVar(&cfg.Title, "title", "", "Output title for --concat / --image-seq")
 	fs.StringVar(&cfg.Display.LogFile, "log", "", "Append logs to file")
 	fs.StringVar(&cfg.Display.LogFile, "l", "", "Same as --log")
+	fs.StringVar(&cfg.Display.ProgressJSON, "progress-json", "", "Write NDJSON progress events to a file path or fd number")
+	fs.StringVar(&cfg.TempDir, "temp-dir", "", "Base directory for run scratch files (default: $TMPDIR)")
+	fs.StringVar(&cfg.FFmpegPath, "ffmpeg-path", cfg.FFmpegPath, "ffmpeg binary to run (name on PATH or a path)")
+	fs.StringVar(&cfg.FFprobePath, "ffprobe-path", cfg.FFprobePath, "ffprobe binary to run (name on PATH or a path)")
+	fs.StringVar(&cfg.Display.RetryLog, "retry-log", "", "Write each failed file's full ffmpeg commands and stderr to <dir>/<name>.<hash>.log")
 }
 
-// defineUtilityFlags registers --version and --help (both cause exit after printing).
-// The cfg parameter is unused but kept for signature consistency with other define* functions.
-func defineUtilityFlags(fs *flag.FlagSet, _ *Config, n *negatedFlags) {
+// defineUtilityFlags registers --config, --version and --help (the latter two cause exit after printing).
+// --config is read by ParseFlags before Parse; registering it here lets Parse accept it.
+func defineUtilityFlags(fs *flag.FlagSet, cfg *Config, n *negatedFlags) {
+	fs.StringVar(&cfg.ConfigFile, "config", "", "Load settings from a TOML file (flags override it)")
 	fs.BoolVar(&n.showVersion, "version", false, "Print version and exit")
 	fs.BoolVar(&n.showVersion, "V", false, "Same as --version")
 	fs.BoolVar(&n.showHelp, "help", false, "Show this help and exit")
@@ -156,6 +286,9 @@ func applyNegatedFlags(cfg *Config, n *negatedFlags) {
 	if n.noStats {
 		cfg.Display.FileStats = false
 	}
+	if n.noBitrateWarnings {
+		cfg.Display.ShowBitrateWarnings = false
+	}
 	if n.noSubs {
 		cfg.KeepSubtitles = false
 	}
@@ -167,6 +300,7 @@ func applyNegatedFlags(cfg *Config, n *negatedFlags) {
 	}
 	if n.noCleanTimestamps {
 		cfg.CleanTimestamps = false
+		cfg.CleanTimestampsAuto = false
 	}
 	if n.noMatchLayout {
 		cfg.Audio.MatchLayout = false
@@ -174,6 +308,9 @@ func applyNegatedFlags(cfg *Config, n *negatedFlags) {
 	if n.force {
 		cfg.SkipExisting = false
 	}
+	if n.hls {
+		cfg.OutputContainer = ContainerHLS
+	}
 	if n.noColor {
 		cfg.Display.ColorMode = ColorNever
 	} else if n.forceColor {
@@ -181,10 +318,10 @@ func applyNegatedFlags(cfg *Config, n *negatedFlags) {
 	}
 }
 
-// parsePositionalArgs sets InputDir and OutputDir from the two positional args when not in CheckOnly mode.
+// parsePositionalArgs sets InputDir and OutputDir from the two positional args when not in CheckOnly or BenchmarkOnly mode.
 func parsePositionalArgs(fs *flag.FlagSet, cfg *Config) error {
 	args := fs.Args()
-	if cfg.CheckOnly {
+	if cfg.CheckOnly || cfg.BenchmarkOnly {
 		return nil
 	}
 	if cfg.AnalyzeOnly {
@@ -194,6 +331,20 @@ func parsePositionalArgs(fs *flag.FlagSet, cfg *Config) error {
 		cfg.InputDir = NormalizeDirArg(args[0])
 		return nil
 	}
+	if cfg.ValidateOnly {
+		if len(args) < 1 {
+			return fmt.Errorf("--validate requires an input directory")
+		}
+		cfg.InputDir = NormalizeDirArg(args[0])
+		return nil
+	}
+	if cfg.AssembleMode() {
+		if len(args) != 1 {
+			return fmt.Errorf("--concat and --image-seq take only output_dir (see --help)")
+		}
+		cfg.OutputDir = NormalizeDirArg(args[0])
+		return nil
+	}
 	if len(args) != 2 {
 		return fmt.Errorf("need exactly input_dir and output_dir (see --help)")
 	}
@@ -206,7 +357,7 @@ func parsePositionalArgs(fs *flag.FlagSet, cfg *Config) error {
 // Precedence: mode-specific override (--vaapi-qp / --cpu-crf) > --quality > defaults.
 func applyQualityPrecedence(cfg *Config) error {
 	cfg.Encoder.ActiveQualityOverride = ""
-	if cfg.Encoder.Mode == EncoderVAAPI {
+	if cfg.Encoder.Mode.UsesQP() {
 		if cfg.Encoder.VaapiQPFixedOverride != "" {
 			q, err := parseInt(cfg.Encoder.VaapiQPFixedOverride, "VAAPI QP")
 			if err != nil {
@@ -271,48 +422,145 @@ func printUsage(_ *flag.FlagSet, version string) {
 		{"", "Muxmaster v" + version + " — Jellyfin-optimized media encoder"},
 		{"", ""},
 		{"  muxmaster [OPTIONS] <input_dir> <output_dir>", ""},
+		{"  muxmaster --concat <list> | --image-seq <pattern> --title <name> <output_dir>", ""},
 		{"", ""},
 		{"Encoding", ""},
-		{"  -m, --mode <vaapi|cpu>", "Encoder mode (default: vaapi)"},
+		{"  -m, --mode <vaapi|cpu|qsv>", "Encoder mode (default: vaapi)"},
 		{"  -q, --quality <value>", "Fixed QP (VAAPI) or CRF (CPU) for active mode"},
 		{"  --cpu-crf <value>", "Fixed CPU CRF (overrides --quality in CPU mode)"},
-		{"  --vaapi-qp <value>", "Fixed VAAPI QP (overrides --quality in VAAPI mode)"},
+		{"  --vaapi-qp <value>", "Fixed VAAPI/QSV QP (overrides --quality in VAAPI and QSV modes)"},
+		{"  --target-bitrate <kbps>", "Average video bitrate: two-pass x265, VBR for VAAPI/QSV"},
+		{"  --vaapi-concurrency <n>", "Max simultaneous VAAPI encodes (default: 1)"},
+		{"  --require-10bit", "Fail if VAAPI main10 is unavailable (no 8-bit fallback)"},
+		{"  --dither-8bit", "Dither 10-bit sources encoded to 8-bit (less banding)"},
 		{"  -p, --preset <name>", "x265 preset (default: slow)"},
 		{"  --audio-bitrate <rate>", "Audio bitrate in Kbps (default: 320k)"},
+		{"  --audio-codec <codec>", "aac|opus for transcoded audio (default: per container)"},
+		{"  --aac-copy-max <kbps>", "Transcode AAC above this bitrate (default: off)"},
+		{"  --reencode-audio-only-if-incompatible", "Copy audio the container supports; transcode the rest"},
+		{"  --audio-channels-by-codec <spec>", "Channel caps per source codec, e.g. dts=2,eac3=6"},
+		{"  --audio-langs <list>", "Keep only these audio languages (e.g. eng,jpn)"},
+		{"  --drop-commentary", "Drop commentary audio tracks"},
+		{"  --keep-only-preferred-audio-when-available", "Only --my-lang audio when present"},
+		{"  --downmix-stereo", "Pro Logic II-style 5.1/7.1 to stereo downmix"},
+		{"  --audio-delay <ms>", "Shift audio sync; idx=ms[,...] per stream"},
+		{"  --tv-max-height <px>", "Downscale taller TV episodes (e.g. 720)"},
+		{"  --movie-max-height <px>", "Downscale taller movies (e.g. 1080)"},
+		{"  --scale-to <px>", "Downscale all taller files (e.g. 1080)"},
 		{"", ""},
 		{"Container & HDR", ""},
-		{"  --container <mkv|mp4>", "Output container (default: mkv)"},
+		{"  --container <mkv|mp4|hls>", "Output container (default: mkv)"},
+		{"  --hls", "HLS VOD playlist + 6s segments per title"},
 		{"  --hdr <preserve|tonemap>", "HDR handling (default: preserve)"},
+		{"  --tonemap-peak <nits>", "Tonemap peak luminance, 10-10000 (default: 100)"},
+		{"  --tonemap-desat <n>", "Tonemap desaturation, 0-10 (default: 0)"},
 		{"  --no-deinterlace", "Disable automatic deinterlace"},
+		{"  --detect-interlace", "Sample with idet; inverse-telecine film"},
+		{"  --field-order <auto|tt|bb>", "Force yadif field parity (default: auto)"},
+		{"  --auto-crop", "Crop letterbox bars found by cropdetect"},
+		{"  --denoise[=light|medium|heavy]", "Denoise after deinterlace (hqdn3d / denoise_vaapi)"},
 		{"", ""},
 		{"Streams", ""},
 		{"  --no-skip-hevc", "Re-encode HEVC video (default: remux)"},
+		{"  --skip-optimized", "Skip files already in the target format"},
+		{"  --only <encode|remux|skip>", "Process only files with this planned action"},
+		{"  --input-sort <order>", "name|size|mtime|duration (default: name)"},
+		{"  --min-height <px>", "Skip sources shorter than this"},
+		{"  --max-height <px>", "Skip sources taller than this (e.g. 1080)"},
+		{"  --min-bitrate-kbps <n>", "Skip encodes of sources below this video bitrate"},
+		{"  --max-file-size <bytes>", "Skip input files larger than this"},
 		{"  --no-subs", "Do not process subtitle streams"},
+		{"  --subtitle-codec <codec>", "copy|srt|ass for MKV subtitles (default: copy)"},
+		{"  --retry-subtitle-transcode", "Convert subtitles before dropping them on retry"},
+		{"  --sub-langs <list>", "Keep only these subtitle languages (e.g. eng,jpn)"},
+		{"  --subtitles-only-if-present-langs", "No subs if none match"},
+		{"  --sidecar-subs", "Mux matching external .srt/.ass/.vtt files"},
+		{"  --keep-subs-langs-default", "Default my-lang subs on for foreign audio only"},
+		{"  --my-lang <code>", "Preferred language (default: eng)"},
+		{"  --default-sub <lang>", "Default subtitle track by language (e.g. eng)"},
 		{"  --no-attachments", "Do not include attachments"},
+		{"  --keep-cover", "Carry embedded cover art into MKV output"},
 		{"", ""},
 		{"Output & behavior", ""},
 		{"  -f, --force", "Overwrite existing output files"},
+		{"  --skip-if-output-newer", "Skip only when the output is newer than the input"},
+		{"  --faithful-remux", "Lossless rewrap of all streams (-map 0 -c copy)"},
+		{"  --burn-subs[=lang]", "Burn a subtitle into the video (forces encode)"},
+		{"  --state <path>", "Resume ledger: skip inputs completed by earlier runs"},
+		{"  -j, --jobs <n>", "Process n files in parallel (default: 1)"},
+		{"  --remux-jobs <n>", "Remux on n extra workers; --jobs then counts encodes only"},
+		{"  --concurrent-probe-prepass", "Probe and plan all files up front, in parallel"},
 		{"  -d, --dry-run", "Preview only; do not encode or remux"},
+		{"  --fail-fast-on-config-mismatch", "Exit on conflicting options instead of warning"},
 		{"  --strict", "Disable automatic ffmpeg retry fallbacks"},
+		{"  --remux-fail <mode>", "encode|mkv|fail when a remux is rejected (default: encode)"},
+		{"  --replace-container-only", "Keep MKV for remuxes when MP4 would drop bitmap subs"},
+		{"  --remux-to-faststart", "Remux web-safe MP4 sources with +faststart"},
+		{"  --episode-offset <n>", "Add n to parsed TV episode numbers"},
+		{"  --absolute-numbering", "Name \"Show - 137\" episodes Show/Show - 137, no season"},
+		{"  --keep-raw-names", "Keep a movie's filename when tag stripping empties it"},
+		{"  --tv-template <tmpl>", "TV output path: {show} {title} {year} {season} {episode} {ext}"},
+		{"  --movie-template <tmpl>", "Movie output path: {title} {year} {ext}"},
+		{"  --naming-convention <name>", "default|jellyfin|plex|kodi path preset"},
+		{"  --staging-dir <dir>", "Encode here, move into output_dir when complete"},
+		{"  --output-owner <u[:g]>", "chown created outputs to user[:group]"},
+		{"  --dir-mode <octal>", "chmod created output directories (e.g. 0775)"},
+		{"  --file-mode <octal>", "chmod output files (e.g. 0664)"},
+		{"  --read-rate <n>", "Throttle input reads to n× realtime (default: off)"},
+		{"  --preview-frame <sec>", "Save a source|output comparison PNG per encode"},
+		{"  --preserve-creation-time", "Keep the source creation_time tag"},
+		{"  --preserve-chapters-titles", "Re-apply source chapter titles"},
+		{"  --verify-chapters", "Warn when output chapters differ from the source"},
+		{"  --verify-audio-sync", "Warn when output audio drifts from the video"},
+		{"  --audio-sync-tolerance <sec>", "Drift --verify-audio-sync tolerates (default: 0.25)"},
 		{"  --smart-quality", "Per-file quality adaptation (default: on)"},
 		{"  --no-smart-quality", "Use fixed quality only"},
-		{"  --clean-timestamps", "Regenerate timestamps (default: on)"},
+		{"  --retry-if-tiny-pct <n>", "Re-encode sharper if output < n% of input"},
+		{"  --clean-timestamps", "Regenerate timestamps on every encode (default: TS/VOB only)"},
 		{"  --no-clean-timestamps", "Disable timestamp regeneration"},
 		{"  --match-audio-layout", "Normalize audio layout (default: on)"},
 		{"  --no-match-audio-layout", "Disable audio layout normalization"},
+		{"  --auto-audio-titles", "Title audio tracks, e.g. \"English 5.1 EAC3\""},
 		{"", ""},
 		{"Display", ""},
 		{"  --show-fps", "Show live ffmpeg FPS (default: on)"},
 		{"  --no-fps", "Disable live FPS"},
 		{"  --no-stats", "Hide per-file source stats"},
+		{"  --no-bitrate-warnings", "Hide per-file bitrate outlier warnings"},
+		{"  --bitrate-tiers <spec>", "Outlier ranges, e.g. 720=1000-5000,1080=2500-10000"},
 		{"  --color", "Force colored logs"},
 		{"  --no-color", "Disable colored logs"},
+		{"  --summary-only", "Only warnings, errors, and the final summary"},
+		{"  --keep-ratio-report", "List files whose output grew in the summary"},
+		{"  --summary-json", "Final summary as JSON on stdout (logs on stderr)"},
+		{"  --checkpoint-every N", "Log running totals every N files (0 = off)"},
+		{"  --print-commands", "Log each ffmpeg command (shell-quoted)"},
 		{"  -v, --verbose", "Verbose output"},
 		{"", ""},
 		{"Utility", ""},
 		{"  -l, --log <path>", "Append logs to file"},
+		{"  --retry-log <dir>", "Full ffmpeg output of failed files"},
+		{"  --progress-json <path|fd>", "NDJSON progress events for UIs/scripts"},
+		{"  --temp-dir <dir>", "Base for run scratch files (default: $TMPDIR)"},
+		{"  --ffmpeg-path <path>", "ffmpeg binary (default: ffmpeg on PATH)"},
+		{"  --ffprobe-path <path>", "ffprobe binary (default: ffprobe on PATH)"},
 		{"  -a, --analyze", "Probe all files and print codec/bitrate table"},
+		{"  --analyze-csv <path>", "Also write the --analyze table as CSV"},
+		{"  --analyze-json <path>", "Also write the --analyze table as JSON"},
+		{"  --codec-stats", "Per-codec count/bitrate/size in --analyze"},
+		{"  --outlier-mult <n>", "IQR multiple flagged as outlier (default: 1.5)"},
+		{"  --extreme-mult <n>", "IQR multiple flagged as extreme (default: 3.0)"},
+		{"  --validate", "Check every file is readable (fast minimal ffprobe)"},
+		{"  --dry-run-output-tree", "Print resolved output paths as a tree (no probing)"},
+		{"  --rename-only <move|link|copy>", "Organize originals into the output layout (no encoding)"},
 		{"  -c, --check", "System diagnostics (ffmpeg, VAAPI, x265, libfdk_aac)"},
+		{"  --benchmark", "Report encoder fps/speed on a clip (no output kept)"},
+		{"  --benchmark-input <file>", "Clip for --benchmark (default: synthetic 1080p)"},
+		{"  --concat <list>", "Encode a concat list as one --title (then output_dir)"},
+		{"  --image-seq <pattern>", "Encode numbered images as one --title"},
+		{"  --image-fps <n>", "Frame rate for --image-seq (default: 24)"},
+		{"  --title <name>", "Output title for --concat / --image-seq"},
+		{"  --config <file>", "Load settings from a TOML file; flags override it"},
 		{"  -V, --version", "Print version and exit"},
 		{"  -h, --help", "Show this help and exit"},
 	}
@@ -338,7 +586,7 @@ func printUsage(_ *flag.FlagSet, version string) {
 	}
 }
 
-// flag.Value adapters so we can use enum types (EncoderMode, Container, HDRMode) with flag.Var.
+// flag.Value adapters so we can use enum types (EncoderMode, Container, RemuxFallback, SubtitleCodec, ActionFilter, InputSort, RenameMode, DenoiseLevel, HDRMode) with flag.Var.
 
 type encoderModeValue struct{ p *EncoderMode }
 
@@ -349,8 +597,10 @@ func (e *encoderModeValue) Set(s string) error {
 		*e.p = EncoderVAAPI
 	case "cpu":
 		*e.p = EncoderCPU
+	case "qsv":
+		*e.p = EncoderQSV
 	default:
-		return fmt.Errorf("invalid mode %q (use 'vaapi' or 'cpu')", s)
+		return fmt.Errorf("invalid mode %q (use 'vaapi', 'cpu', or 'qsv')", s)
 	}
 	return nil
 }
@@ -364,8 +614,198 @@ func (c *containerValue) Set(s string) error {
 		*c.p = ContainerMKV
 	case "mp4":
 		*c.p = ContainerMP4
+	case "hls":
+		*c.p = ContainerHLS
+	default:
+		return fmt.Errorf("invalid container %q (use 'mkv', 'mp4', or 'hls')", s)
+	}
+	return nil
+}
+
+type remuxFallbackValue struct{ p *RemuxFallback }
+
+func (r *remuxFallbackValue) String() string { return string(*r.p) }
+func (r *remuxFallbackValue) Set(s string) error {
+	switch v := RemuxFallback(strings.ToLower(s)); v {
+	case RemuxFallbackEncode, RemuxFallbackMKV, RemuxFallbackFail:
+		*r.p = v
+	default:
+		return fmt.Errorf("invalid remux fallback %q (use 'encode', 'mkv', or 'fail')", s)
+	}
+	return nil
+}
+
+type audioCodecValue struct{ p *AudioCodec }
+
+func (c *audioCodecValue) String() string { return string(*c.p) }
+func (c *audioCodecValue) Set(s string) error {
+	switch v := AudioCodec(strings.ToLower(s)); v {
+	case AudioCodecAAC, AudioCodecOpus:
+		*c.p = v
 	default:
-		return fmt.Errorf("invalid container %q (use 'mkv' or 'mp4')", s)
+		return fmt.Errorf("invalid audio codec %q (use 'aac' or 'opus')", s)
+	}
+	return nil
+}
+
+type subtitleCodecValue struct{ p *SubtitleCodec }
+
+func (c *subtitleCodecValue) String() string { return string(*c.p) }
+func (c *subtitleCodecValue) Set(s string) error {
+	switch v := SubtitleCodec(strings.ToLower(s)); v {
+	case SubtitleCodecCopy, SubtitleCodecSRT, SubtitleCodecASS:
+		*c.p = v
+	default:
+		return fmt.Errorf("invalid subtitle codec %q (use 'copy', 'srt', or 'ass')", s)
+	}
+	return nil
+}
+
+type actionFilterValue struct{ p *ActionFilter }
+
+func (a *actionFilterValue) String() string { return string(*a.p) }
+func (a *actionFilterValue) Set(s string) error {
+	switch v := ActionFilter(strings.ToLower(s)); v {
+	case ActionFilterEncode, ActionFilterRemux, ActionFilterSkip:
+		*a.p = v
+	default:
+		return fmt.Errorf("invalid --only action %q (use 'encode', 'remux', or 'skip')", s)
+	}
+	return nil
+}
+
+type inputSortValue struct{ p *InputSort }
+
+func (v *inputSortValue) String() string { return string(*v.p) }
+func (v *inputSortValue) Set(s string) error {
+	switch o := InputSort(strings.ToLower(s)); o {
+	case InputSortName, InputSortSize, InputSortMtime, InputSortDuration:
+		*v.p = o
+	default:
+		return fmt.Errorf("invalid --input-sort order %q (use 'name', 'size', 'mtime', or 'duration')", s)
+	}
+	return nil
+}
+
+type renameModeValue struct{ p *RenameMode }
+
+func (v *renameModeValue) String() string { return string(*v.p) }
+func (v *renameModeValue) Set(s string) error {
+	switch m := RenameMode(strings.ToLower(s)); m {
+	case RenameMove, RenameLink, RenameCopy:
+		*v.p = m
+	default:
+		return fmt.Errorf("invalid --rename-only mode %q (use 'move', 'link', or 'copy')", s)
+	}
+	return nil
+}
+
+// burnSubsValue is --burn-subs: a bare flag burns the default subtitle, and
+// --burn-subs=lang picks a language. IsBoolFlag lets it stand alone, so the
+// language must be joined with "=".
+type burnSubsValue struct {
+	on   *bool
+	lang *string
+}
+
+func (v *burnSubsValue) IsBoolFlag() bool { return true }
+func (v *burnSubsValue) String() string {
+	if v.on == nil || !*v.on {
+		return ""
+	}
+	if *v.lang == "" {
+		return "true"
+	}
+	return *v.lang
+}
+func (v *burnSubsValue) Set(s string) error {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "1":
+		*v.on, *v.lang = true, ""
+	case "false", "0":
+		*v.on, *v.lang = false, ""
+	case "":
+		return errors.New("--burn-subs= needs a language code (or use --burn-subs alone)")
+	default:
+		*v.on, *v.lang = true, strings.TrimSpace(s)
+	}
+	return nil
+}
+
+// cleanTimestampsValue is --clean-timestamps. Either value turns the
+// planner's per-source choice (CleanTimestampsAuto) off, so
+// --clean-timestamps=false forces timestamps alone, like
+// --no-clean-timestamps, rather than leaving the default in place.
+type cleanTimestampsValue struct{ on, auto *bool }
+
+func (v *cleanTimestampsValue) IsBoolFlag() bool { return true }
+func (v *cleanTimestampsValue) String() string {
+	if v.on == nil || *v.auto {
+		return ""
+	}
+	return strconv.FormatBool(*v.on)
+}
+func (v *cleanTimestampsValue) Set(s string) error {
+	on, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid --clean-timestamps value %q (use true or false)", s)
+	}
+	*v.on, *v.auto = on, false
+	return nil
+}
+
+// denoiseValue is --denoise: a bare flag selects medium, and
+// --denoise=level picks a strength. Like --burn-subs, the level must be
+// joined with "=".
+type denoiseValue struct{ p *DenoiseLevel }
+
+func (v *denoiseValue) IsBoolFlag() bool { return true }
+func (v *denoiseValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return string(*v.p)
+}
+func (v *denoiseValue) Set(s string) error {
+	switch l := DenoiseLevel(strings.ToLower(strings.TrimSpace(s))); l {
+	case "true", "1":
+		*v.p = DenoiseMedium
+	case "false", "0":
+		*v.p = DenoiseOff
+	case DenoiseLight, DenoiseMedium, DenoiseHeavy:
+		*v.p = l
+	default:
+		return fmt.Errorf("invalid --denoise level %q (use 'light', 'medium', or 'heavy')", s)
+	}
+	return nil
+}
+
+type namingConventionValue struct{ p *NamingConvention }
+
+func (v *namingConventionValue) String() string { return string(*v.p) }
+func (v *namingConventionValue) Set(s string) error {
+	switch c := NamingConvention(strings.ToLower(s)); c {
+	case NamingDefault, NamingJellyfin, NamingPlex, NamingKodi:
+		*v.p = c
+	default:
+		return fmt.Errorf("invalid --naming-convention %q (use 'default', 'jellyfin', 'plex', or 'kodi')", s)
+	}
+	return nil
+}
+
+type fieldOrderValue struct{ p *FieldOrder }
+
+func (f *fieldOrderValue) String() string { return string(*f.p) }
+func (f *fieldOrderValue) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "auto":
+		*f.p = FieldOrderAuto
+	case "tt", "tff":
+		*f.p = FieldOrderTFF
+	case "bb", "bff":
+		*f.p = FieldOrderBFF
+	default:
+		return fmt.Errorf("invalid field order %q (use 'auto', 'tt', or 'bb')", s)
 	}
 	return nil
 }
@@ -384,3 +824,255 @@ func (h *hdrModeValue) Set(s string) error {
 	}
 	return nil
 }
+
+// fileModeValue parses --dir-mode / --file-mode as an octal permission
+// mode such as 0775, 775, or 2775. The setuid, setgid, and sticky digits
+// map to the matching os.FileMode bits, which do not share chmod's values.
+type fileModeValue struct{ p *os.FileMode }
+
+func (m *fileModeValue) String() string {
+	if m.p == nil || *m.p == 0 {
+		return ""
+	}
+	n := uint32(m.p.Perm())
+	for bit, mode := range specialModeBits {
+		if *m.p&mode != 0 {
+			n |= bit
+		}
+	}
+	return fmt.Sprintf("%#o", n)
+}
+
+func (m *fileModeValue) Set(s string) error {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || n == 0 || n > 0o7777 {
+		return fmt.Errorf("invalid mode %q (use octal permissions, e.g. 0775)", s)
+	}
+	mode := os.FileMode(n) & os.ModePerm
+	for bit, special := range specialModeBits {
+		if uint32(n)&bit != 0 {
+			mode |= special
+		}
+	}
+	*m.p = mode
+	return nil
+}
+
+// specialModeBits maps chmod's setuid/setgid/sticky octal digits to
+// os.FileMode bits.
+var specialModeBits = map[uint32]os.FileMode{
+	0o4000: os.ModeSetuid,
+	0o2000: os.ModeSetgid,
+	0o1000: os.ModeSticky,
+}
+
+// ownerValue parses --output-owner as "user[:group]". Each part may be a
+// name (resolved via the system user database) or a numeric id. An omitted
+// group leaves the group unchanged (-1).
+type ownerValue struct{ uid, gid *int }
+
+func (o *ownerValue) String() string {
+	if o.uid == nil || *o.uid < 0 {
+		return ""
+	}
+	if *o.gid < 0 {
+		return strconv.Itoa(*o.uid)
+	}
+	return fmt.Sprintf("%d:%d", *o.uid, *o.gid)
+}
+
+func (o *ownerValue) Set(s string) error {
+	userPart, groupPart, hasGroup := strings.Cut(strings.TrimSpace(s), ":")
+	if userPart == "" {
+		return fmt.Errorf("invalid owner %q (use user[:group])", s)
+	}
+	uid, err := lookupID(userPart, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid owner user %q: %w", userPart, err)
+	}
+	gid := -1
+	if hasGroup && groupPart != "" {
+		gid, err = lookupID(groupPart, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid owner group %q: %w", groupPart, err)
+		}
+	}
+	*o.uid, *o.gid = uid, gid
+	return nil
+}
+
+// lookupID returns s as a non-negative numeric id, or resolves it as a
+// name via lookup.
+func lookupID(s string, lookup func(string) (string, error)) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0, errors.New("id must not be negative")
+		}
+		return n, nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// langListValue parses a comma-separated list of language codes
+// (e.g. "eng,jpn"), lowercased and trimmed.
+type langListValue struct{ p *[]string }
+
+func (l *langListValue) String() string {
+	if l.p == nil {
+		return ""
+	}
+	return strings.Join(*l.p, ",")
+}
+
+func (l *langListValue) Set(s string) error {
+	var langs []string
+	for _, part := range strings.Split(s, ",") {
+		lang := strings.ToLower(strings.TrimSpace(part))
+		if lang == "" {
+			return fmt.Errorf("invalid language list %q (use comma-separated codes, e.g. eng,jpn)", s)
+		}
+		langs = append(langs, lang)
+	}
+	*l.p = langs
+	return nil
+}
+
+// audioDelayValue parses --audio-delay: a plain millisecond value applies
+// to every audio stream, "idx=ms" entries (comma-separated) target audio
+// stream a:idx, e.g. "250" or "0=250,1=-120" or "100,2=0".
+type audioDelayValue struct{ a *AudioConfig }
+
+func (d *audioDelayValue) String() string {
+	if d.a == nil {
+		return ""
+	}
+	parts := []string{}
+	if d.a.DelayMs != 0 {
+		parts = append(parts, strconv.Itoa(d.a.DelayMs))
+	}
+	idxs := make([]int, 0, len(d.a.StreamDelayMs))
+	for i := range d.a.StreamDelayMs {
+		idxs = append(idxs, i)
+	}
+	sort.Ints(idxs)
+	for _, i := range idxs {
+		parts = append(parts, fmt.Sprintf("%d=%d", i, d.a.StreamDelayMs[i]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d *audioDelayValue) Set(s string) error {
+	bad := fmt.Errorf("invalid audio delay %q (use ms, e.g. 250 or -120, or idx=ms per audio stream)", s)
+	global := 0
+	streams := map[int]int{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		idxStr, msStr, perStream := strings.Cut(entry, "=")
+		if !perStream {
+			msStr = idxStr
+		}
+		ms, err := strconv.Atoi(strings.TrimSpace(msStr))
+		if err != nil {
+			return bad
+		}
+		if !perStream {
+			global = ms
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSpace(idxStr))
+		if err != nil || idx < 0 {
+			return bad
+		}
+		streams[idx] = ms
+	}
+	d.a.DelayMs = global
+	d.a.StreamDelayMs = streams
+	return nil
+}
+
+// channelsByCodecValue parses --audio-channels-by-codec as a comma-separated
+// list of "codec=channels" entries, e.g. "dts=2,eac3=6". Codec names are
+// stored lowercase to match ffprobe codec_name.
+type channelsByCodecValue struct{ p *map[string]int }
+
+func (c *channelsByCodecValue) String() string {
+	if c.p == nil {
+		return ""
+	}
+	codecs := make([]string, 0, len(*c.p))
+	for codec := range *c.p {
+		codecs = append(codecs, codec)
+	}
+	sort.Strings(codecs)
+	parts := make([]string, len(codecs))
+	for i, codec := range codecs {
+		parts[i] = fmt.Sprintf("%s=%d", codec, (*c.p)[codec])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *channelsByCodecValue) Set(s string) error {
+	caps := map[string]int{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		codec, chStr, ok := strings.Cut(entry, "=")
+		codec = strings.ToLower(strings.TrimSpace(codec))
+		ch, err := strconv.Atoi(strings.TrimSpace(chStr))
+		if !ok || codec == "" || err != nil || ch < 1 || ch > 8 {
+			return fmt.Errorf("invalid audio channel cap %q (use codec=channels with 1-8 channels, e.g. dts=2)", entry)
+		}
+		caps[codec] = ch
+	}
+	*c.p = caps
+	return nil
+}
+
+// bitrateTiersValue parses --bitrate-tiers as a comma-separated list of
+// "height=low-high" entries (kb/s), e.g. "720=1000-5000,1080=2500-10000".
+type bitrateTiersValue struct{ p *[]BitrateTier }
+
+func (b *bitrateTiersValue) String() string {
+	if b.p == nil {
+		return ""
+	}
+	parts := make([]string, len(*b.p))
+	for i, t := range *b.p {
+		parts[i] = fmt.Sprintf("%d=%d-%d", t.MaxHeight, t.LowKbps, t.HighKbps)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (b *bitrateTiersValue) Set(s string) error {
+	var tiers []BitrateTier
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		height, rng, ok := strings.Cut(entry, "=")
+		lowStr, highStr, ok2 := strings.Cut(rng, "-")
+		h, errH := strconv.Atoi(strings.TrimSpace(height))
+		low, errL := strconv.ParseInt(strings.TrimSpace(lowStr), 10, 64)
+		high, errHi := strconv.ParseInt(strings.TrimSpace(highStr), 10, 64)
+		if !ok || !ok2 || errH != nil || errL != nil || errHi != nil || h <= 0 || low < 0 || high < low {
+			return fmt.Errorf("invalid bitrate tier %q (use height=low-high in kb/s, e.g. 1080=2500-10000)", entry)
+		}
+		tiers = append(tiers, BitrateTier{MaxHeight: h, LowKbps: low, HighKbps: high})
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MaxHeight < tiers[j].MaxHeight })
+	*b.p = tiers
+	return nil
+}
@@ -3,7 +3,7 @@ package display
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 
 	"github.com/backmassage/muxmaster/internal/term"
@@ -18,17 +18,18 @@ var bannerLines = []string{
 	`|_|  |_|\__,_/_/\_\_|  |_|\__,_|___/\__\___|_|`,
 }
 
-// PrintBanner writes the Muxmaster ASCII art logo to stdout.
-// When ANSI colors are enabled, each line gets a different rainbow color.
-func PrintBanner() {
+// PrintBanner writes the Muxmaster ASCII art logo to w. When ANSI colors
+// are enabled, each line gets a different rainbow color. Pass the
+// *logging.Logger rather than os.Stdout so a --log file gets the plain logo.
+func PrintBanner(w io.Writer) {
 	if !term.Enabled() {
-		fmt.Fprintln(os.Stdout, strings.Join(bannerLines, "\n"))
+		fmt.Fprintln(w, strings.Join(bannerLines, "\n"))
 		return
 	}
 	rainbow := []string{term.Red, term.Orange, term.Yellow, term.Green, term.Blue}
 	for i, line := range bannerLines {
 		color := rainbow[i%len(rainbow)]
-		fmt.Fprintf(os.Stdout, "%s%s%s\n", color, line, term.NC)
+		fmt.Fprintf(w, "%s%s%s\n", color, line, term.NC)
 	}
-	fmt.Fprintln(os.Stdout)
+	fmt.Fprintln(w)
 }
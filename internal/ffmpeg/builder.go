@@ -3,7 +3,9 @@ package ffmpeg
 
 import (
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/planner"
@@ -17,11 +19,27 @@ import (
 // The retry parameter supplies the current values for mux queue size,
 // timestamp fix, subtitle/attachment inclusion, and quality, which may
 // differ from the plan's initial values after retry adjustments.
+//
+// For a two-pass plan (plan.TwoPass) this is the second pass, which reads
+// the stats file BuildFirstPass wrote.
 func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string {
+	return build(cfg, plan, rs, false)
+}
+
+// BuildFirstPass constructs the analysis pass of a two-pass plan: the same
+// input and video encode as Build, writing x265 stats to plan.PassLogFile
+// and the video itself to the null muxer. Audio, subtitles, and metadata
+// are left out.
+func BuildFirstPass(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string {
+	return build(cfg, plan, rs, true)
+}
+
+// build is Build, or BuildFirstPass when firstPass is set.
+func build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState, firstPass bool) []string {
 	args := make([]string, 0, 64)
 
 	// --- Preamble ---
-	args = append(args, "ffmpeg", "-hide_banner", "-nostdin", "-y")
+	args = append(args, cfg.FFmpegPath, "-hide_banner", "-nostdin", "-y")
 
 	// Loglevel: info when verbose, otherwise error.
 	if cfg.Display.Verbose {
@@ -62,19 +80,62 @@ func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string
 		args = append(args, "-filter_hw_device", "va")
 	}
 
-	// --- Input ---
+	// --- QSV hardware device (encode path only) ---
+	// Decode stays in software; the filter chain uploads NV12 frames.
+	if plan.Action == planner.ActionEncode && cfg.Encoder.Mode == config.EncoderQSV {
+		args = append(args,
+			"-init_hw_device", "qsv=qs",
+			"-filter_hw_device", "qs",
+		)
+	}
+
+	// --- Input read throttling (must precede -i) ---
+	if cfg.ReadRate > 0 {
+		args = append(args, "-readrate", strconv.FormatFloat(cfg.ReadRate, 'g', -1, 64))
+	}
+
+	// --- Input (demuxer options such as -f concat must precede -i) ---
+	args = append(args, plan.InputOpts...)
 	args = append(args, "-i", plan.InputPath)
+	args = appendSidecarInputs(args, plan, rs)
+	args = appendAudioDelayInputs(args, plan)
 
 	// --- Video filter chain (encode path only, before maps) ---
-	if plan.Action == planner.ActionEncode && plan.VideoFilters != "" {
-		args = append(args, "-vf", plan.VideoFilters)
+	// With cover art mapped as a second (copied) video stream the filter
+	// must target only the primary stream; filtering a copied stream fails.
+	// A bitmap --burn-subs graph is mapped by its [vout] label instead.
+	complexVideo := plan.Action == planner.ActionEncode && plan.VideoFilterComplex != ""
+	if complexVideo {
+		args = append(args, "-filter_complex", plan.VideoFilterComplex)
+	} else if plan.Action == planner.ActionEncode && plan.VideoFilters != "" {
+		if plan.IncludeCoverArt {
+			args = append(args, "-filter:v:0", plan.VideoFilters)
+		} else {
+			args = append(args, "-vf", plan.VideoFilters)
+		}
 	}
 
 	// --- Stream maps ---
-	args = append(args, "-map", fmt.Sprintf("0:%d", plan.VideoStreamIdx))
-	args = appendAudioMaps(args, cfg, plan, rs)
-	args = appendSubtitleMaps(args, plan, rs)
-	args = appendAttachmentMaps(args, plan, rs)
+	// A --faithful-remux plan maps and copies every stream itself.
+	if plan.Faithful {
+		args = append(args, plan.FaithfulOpts...)
+	} else {
+		if complexVideo {
+			args = append(args, "-map", "[vout]")
+		} else {
+			args = append(args, "-map", fmt.Sprintf("0:%d", plan.VideoStreamIdx))
+		}
+		if firstPass {
+			args = append(args, "-an", "-sn")
+		} else {
+			if plan.IncludeCoverArt {
+				args = append(args, "-map", fmt.Sprintf("0:%d", plan.CoverArtIdx))
+			}
+			args = appendAudioMaps(args, cfg, plan, rs, 1+sidecarInputCount(plan, rs))
+			args = appendSubtitleMaps(args, plan, rs)
+			args = appendAttachmentMaps(args, plan, rs)
+		}
+	}
 
 	// --- Global stream flags ---
 	args = append(args,
@@ -83,7 +144,16 @@ func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string
 	)
 
 	// --- Video codec ---
-	args = appendVideoCodec(args, cfg, plan, rs)
+	if !plan.Faithful {
+		args = appendVideoCodec(args, cfg, plan, rs, firstPass)
+	}
+	if firstPass {
+		return append(args, "-f", "null", "-")
+	}
+	if plan.IncludeCoverArt {
+		// More specific specifier after -c:v overrides it for the cover.
+		args = append(args, "-c:v:1", "copy")
+	}
 
 	// --- Tag opts (e.g. -tag:v hvc1 for MP4) ---
 	args = append(args, plan.TagOpts...)
@@ -96,6 +166,10 @@ func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string
 
 	// --- Metadata and chapters ---
 	args = append(args, "-map_metadata", "0", "-map_chapters", "0")
+	args = append(args, plan.ChapterOpts...)
+	if plan.CreationTime != "" {
+		args = append(args, "-metadata", "creation_time="+plan.CreationTime)
+	}
 
 	// --- Post-input timestamp flag ---
 	if rs.TimestampFix {
@@ -104,6 +178,9 @@ func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string
 
 	// --- Container opts (e.g. -movflags +faststart) ---
 	args = append(args, plan.ContainerOpts...)
+	if plan.Container == config.ContainerHLS {
+		args = append(args, "-hls_segment_filename", HLSSegmentPattern(plan.OutputPath))
+	}
 
 	// --- Output ---
 	args = append(args, plan.OutputPath)
@@ -112,20 +189,43 @@ func Build(cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string
 }
 
 // appendVideoCodec adds the codec-specific arguments for the video stream.
-func appendVideoCodec(args []string, cfg *config.Config, plan *planner.FilePlan, rs *RetryState) []string {
+// With --target-bitrate (plan.TargetBitrateKbps) the rate control is an
+// average bitrate instead of QP/CRF; firstPass selects x265's analysis
+// pass of a two-pass plan.
+func appendVideoCodec(args []string, cfg *config.Config, plan *planner.FilePlan, rs *RetryState, firstPass bool) []string {
 	switch plan.Action {
 	case planner.ActionRemux:
 		args = append(args, "-c:v", "copy")
+		// Stream copy keeps the DOVI configuration record and the RPUs in
+		// the bitstream; the MP4 muxer writes the record (dvcC/dvvC) only
+		// at unofficial compliance.
+		if plan.DolbyVision {
+			args = append(args, "-strict", "unofficial")
+		}
 
 	case planner.ActionEncode:
 		switch cfg.Encoder.Mode {
 		case config.EncoderVAAPI:
+			args = append(args, "-c:v", "hevc_vaapi")
+			if plan.TargetBitrateKbps > 0 {
+				args = append(args, "-rc_mode", "VBR")
+				args = appendTargetBitrate(args, plan.TargetBitrateKbps)
+			} else {
+				args = append(args, "-qp", strconv.Itoa(rs.VaapiQP))
+			}
 			args = append(args,
-				"-c:v", "hevc_vaapi",
-				"-qp", strconv.Itoa(rs.VaapiQP),
 				"-profile:v", cfg.Encoder.VaapiProfile,
 				"-g", strconv.Itoa(cfg.Encoder.KeyframeInterval),
 			)
+		case config.EncoderQSV:
+			args = append(args, "-c:v", "hevc_qsv")
+			if plan.TargetBitrateKbps > 0 {
+				// hevc_qsv selects VBR when both -b:v and -maxrate are set.
+				args = appendTargetBitrate(args, plan.TargetBitrateKbps)
+			} else {
+				args = append(args, "-global_quality", strconv.Itoa(rs.VaapiQP))
+			}
+			args = append(args, "-g", strconv.Itoa(cfg.Encoder.KeyframeInterval))
 		case config.EncoderCPU:
 			x265Params := "log-level=error:open-gop=0"
 			if plan.MasterDisplay != "" {
@@ -134,9 +234,22 @@ func appendVideoCodec(args []string, cfg *config.Config, plan *planner.FilePlan,
 			if plan.MaxCLL != "" {
 				x265Params += ":max-cll=" + plan.MaxCLL
 			}
+			// x265 reads its multi-pass settings from x265-params; ffmpeg's
+			// -pass/-passlogfile do not reach the libx265 wrapper.
+			rate := []string{"-crf", strconv.Itoa(rs.CpuCRF)}
+			if plan.TargetBitrateKbps > 0 {
+				rate = []string{"-b:v", strconv.Itoa(plan.TargetBitrateKbps) + "k"}
+				if plan.TwoPass {
+					pass := "2"
+					if firstPass {
+						pass = "1"
+					}
+					x265Params += ":pass=" + pass + ":stats=" + escapeX265Param(plan.PassLogFile)
+				}
+			}
+			args = append(args, "-c:v", "libx265")
+			args = append(args, rate...)
 			args = append(args,
-				"-c:v", "libx265",
-				"-crf", strconv.Itoa(rs.CpuCRF),
 				"-preset", cfg.Encoder.CpuPreset,
 				"-profile:v", cfg.Encoder.CpuProfile,
 				"-pix_fmt", cfg.Encoder.CpuPixFmt,
@@ -156,8 +269,34 @@ func appendVideoCodec(args []string, cfg *config.Config, plan *planner.FilePlan,
 	return args
 }
 
+// VBR peak bounds around a --target-bitrate average, as percentages of it.
+const (
+	targetMaxratePct = 150
+	targetBufsizePct = 200
+)
+
+// appendTargetBitrate adds VBR rate control averaging kbps.
+func appendTargetBitrate(args []string, kbps int) []string {
+	return append(args,
+		"-b:v", strconv.Itoa(kbps)+"k",
+		"-maxrate", strconv.Itoa(kbps*targetMaxratePct/100)+"k",
+		"-bufsize", strconv.Itoa(kbps*targetBufsizePct/100)+"k",
+	)
+}
+
+// escapeX265Param escapes s for use as a value in -x265-params, whose
+// key=value pairs are separated by ':'.
+func escapeX265Param(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`, `=`, `\=`).Replace(s)
+}
+
 // appendAudioMaps adds audio mapping and codec arguments.
-func appendAudioMaps(args []string, cfg *config.Config, plan *planner.FilePlan, _ *RetryState) []string {
+//
+// Streams are mapped by source index (StreamIndex) and configured by output
+// index, which differ when degenerate source streams were left out. Streams
+// with an --audio-delay are mapped from the matching offset input (see
+// appendAudioDelayInputs); firstDelayInput is that first input's index.
+func appendAudioMaps(args []string, cfg *config.Config, plan *planner.FilePlan, _ *RetryState, firstDelayInput int) []string {
 	ap := &plan.Audio
 
 	if ap.NoAudio {
@@ -165,64 +304,168 @@ func appendAudioMaps(args []string, cfg *config.Config, plan *planner.FilePlan,
 	}
 
 	if ap.CopyAll {
-		return append(args, "-map", "0:a", "-c:a", "copy")
+		args = append(args, "-map", "0:a", "-c:a", "copy")
+		return appendAudioTitles(args, ap)
 	}
 
-	for _, s := range ap.Streams {
-		args = append(args, "-map", fmt.Sprintf("0:a:%d", s.StreamIndex))
+	delays := audioDelays(plan)
+	for out, s := range ap.Streams {
+		input := 0
+		if s.DelayMs != 0 {
+			input = firstDelayInput + indexOf(delays, s.DelayMs)
+		}
+		args = append(args, "-map", fmt.Sprintf("%d:a:%d", input, s.StreamIndex))
 
 		if s.Copy {
-			args = append(args, fmt.Sprintf("-c:a:%d", s.StreamIndex), "copy")
+			args = append(args, fmt.Sprintf("-c:a:%d", out), "copy")
 			continue
 		}
 
 		args = append(args,
-			fmt.Sprintf("-c:a:%d", s.StreamIndex), cfg.Audio.Encoder,
-			fmt.Sprintf("-ac:a:%d", s.StreamIndex), strconv.Itoa(s.Channels),
-			fmt.Sprintf("-ar:a:%d", s.StreamIndex), strconv.Itoa(s.SampleRate),
-			fmt.Sprintf("-b:a:%d", s.StreamIndex), s.Bitrate,
+			fmt.Sprintf("-c:a:%d", out), cfg.Audio.Encoder,
+			fmt.Sprintf("-ac:a:%d", out), strconv.Itoa(s.Channels),
+			fmt.Sprintf("-ar:a:%d", out), strconv.Itoa(s.SampleRate),
+			fmt.Sprintf("-b:a:%d", out), s.Bitrate,
 		)
 
 		if s.NeedsFilter && s.FilterStr != "" {
 			args = append(args,
-				fmt.Sprintf("-filter:a:%d", s.StreamIndex), s.FilterStr,
+				fmt.Sprintf("-filter:a:%d", out), s.FilterStr,
 			)
 		}
+
+		// Copied streams keep their tags; re-apply language explicitly for
+		// encoded ones so players still see it.
+		if s.Language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:a:%d", out), "language="+s.Language)
+		}
+	}
+	return appendAudioTitles(args, ap)
+}
+
+// appendAudioTitles sets --auto-audio-titles names on the output audio
+// streams. Metadata applies to copied and transcoded streams alike.
+func appendAudioTitles(args []string, ap *planner.AudioPlan) []string {
+	for i, title := range ap.Titles {
+		if title != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:a:%d", i), "title="+title)
+		}
+	}
+	return args
+}
+
+// appendAudioDelayInputs implements --audio-delay. ffmpeg cannot offset a
+// single mapped stream, so the source is opened again once per distinct
+// delay with -itsoffset (which works for copied and transcoded audio alike)
+// and the delayed streams are mapped from that input. These inputs follow
+// the sidecar subtitle inputs.
+func appendAudioDelayInputs(args []string, plan *planner.FilePlan) []string {
+	for _, ms := range audioDelays(plan) {
+		args = append(args, "-itsoffset", fmt.Sprintf("%.3f", float64(ms)/1000))
+		args = append(args, plan.InputOpts...)
+		args = append(args, "-i", plan.InputPath)
+	}
+	return args
+}
+
+// audioDelays returns the distinct non-zero audio stream delays in first-use
+// order; delay k is read from the k-th offset input.
+func audioDelays(plan *planner.FilePlan) []int {
+	var delays []int
+	for _, s := range plan.Audio.Streams {
+		if s.DelayMs != 0 && indexOf(delays, s.DelayMs) < 0 {
+			delays = append(delays, s.DelayMs)
+		}
+	}
+	return delays
+}
+
+func indexOf(xs []int, x int) int {
+	for i, v := range xs {
+		if v == x {
+			return i
+		}
+	}
+	return -1
+}
+
+// sidecarInputCount is the number of -i inputs added by appendSidecarInputs.
+func sidecarInputCount(plan *planner.FilePlan, rs *RetryState) int {
+	if !plan.Subtitles.Include || !rs.IncludeSubs {
+		return 0
+	}
+	return len(plan.Subtitles.Sidecars)
+}
+
+// appendSidecarInputs adds one -i per external subtitle file. Sidecars follow
+// the main input, so sidecar k is ffmpeg input k+1. They are dropped together
+// with embedded subs when the retry engine disables subtitles.
+func appendSidecarInputs(args []string, plan *planner.FilePlan, rs *RetryState) []string {
+	if !plan.Subtitles.Include || !rs.IncludeSubs {
+		return args
+	}
+	for _, sc := range plan.Subtitles.Sidecars {
+		args = append(args, "-i", sc.Path)
 	}
 	return args
 }
 
 // appendSubtitleMaps adds subtitle mapping arguments, respecting the retry
-// state's IncludeSubs flag. When SkipBitmap is set (MP4 with mixed text+bitmap
-// subs), individual text streams are mapped instead of all subtitle streams.
+// state's IncludeSubs flag. When the plan is selective (MP4 with mixed
+// text+bitmap subs, or --sub-langs filtering), the chosen streams are mapped
+// individually instead of all subtitle streams.
+// Sidecar inputs are mapped after the embedded streams and tagged with the
+// language parsed from their filename.
 func appendSubtitleMaps(args []string, plan *planner.FilePlan, rs *RetryState) []string {
 	if !plan.Subtitles.Include || !rs.IncludeSubs {
 		return args
 	}
 
-	if plan.Subtitles.SkipBitmap && len(plan.Subtitles.TextIdxs) > 0 {
-		// Map only text subtitle streams by absolute index.
-		for _, idx := range plan.Subtitles.TextIdxs {
+	switch {
+	case plan.Subtitles.SidecarOnly:
+		// No embedded subtitle streams to map.
+	case plan.Subtitles.Selective() && len(plan.Subtitles.StreamIdxs) > 0:
+		// Map only the selected subtitle streams by absolute index.
+		for _, idx := range plan.Subtitles.StreamIdxs {
 			args = append(args, "-map", fmt.Sprintf("0:%d", idx))
 		}
-	} else {
+	default:
 		args = append(args, "-map", "0:s?")
 	}
 
-	if plan.Subtitles.Codec != "" {
-		args = append(args, "-c:s", plan.Subtitles.Codec)
+	for i, sc := range plan.Subtitles.Sidecars {
+		args = append(args, "-map", fmt.Sprintf("%d:s:0", i+1))
+		if sc.Language != "" {
+			outIdx := plan.Subtitles.EmbeddedCount + i
+			args = append(args, fmt.Sprintf("-metadata:s:s:%d", outIdx), "language="+sc.Language)
+		}
 	}
-	return args
+
+	codec := plan.Subtitles.Codec
+	if rs.SubCodec != "" {
+		codec = rs.SubCodec
+	}
+	if codec != "" {
+		args = append(args, "-c:s", codec)
+	}
+	return append(args, plan.Subtitles.DispositionOpts...)
 }
 
 // appendAttachmentMaps adds attachment mapping arguments (MKV only),
-// respecting the retry state's IncludeAttach flag and MP4 constraints.
+// respecting the retry state's IncludeAttach flag and MP4/HLS constraints.
 func appendAttachmentMaps(args []string, plan *planner.FilePlan, rs *RetryState) []string {
 	if !plan.Attachments.Include || !rs.IncludeAttach {
 		return args
 	}
-	if plan.Container == config.ContainerMP4 {
+	if plan.Container == config.ContainerMP4 || plan.Container == config.ContainerHLS {
 		return args
 	}
 	return append(args, "-map", "0:t?", "-c:t", "copy")
 }
+
+// HLSSegmentPattern returns the ffmpeg segment filename pattern for an HLS
+// playlist path: segments sit next to the playlist as <stem>_00000.ts, etc.
+func HLSSegmentPattern(playlistPath string) string {
+	ext := filepath.Ext(playlistPath)
+	return strings.TrimSuffix(playlistPath, ext) + "_%05d.ts"
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
 )
 
 func cpuCfg() *config.Config {
@@ -57,6 +58,32 @@ func TestBuild_CPUx265Params_HDR10(t *testing.T) {
 	}
 }
 
+func TestBuild_FFmpegPath(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.FFmpegPath = "/opt/ffmpeg/bin/ffmpeg"
+	cfg.Encoder.TargetBitrateKbps = 4000
+	plan := planner.BuildPlan(cfg, &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+	})
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	rs := NewRetryState(plan)
+
+	for name, args := range map[string][]string{
+		"Build":            Build(cfg, plan, rs),
+		"BuildFirstPass":   BuildFirstPass(cfg, plan, rs),
+		"IdetArgs":         IdetArgs(cfg.FFmpegPath, "/in/a.mkv", 0),
+		"CropdetectArgs":   CropdetectArgs(cfg.FFmpegPath, "/in/a.mkv", 0),
+		"CompareFrameArgs": CompareFrameArgs(cfg.FFmpegPath, "/in/a.mkv", "/out/a.mkv", 0, "/out/a.png"),
+	} {
+		if args[0] != cfg.FFmpegPath {
+			t.Errorf("%s: args[0] = %q, want %q", name, args[0], cfg.FFmpegPath)
+		}
+	}
+	if got := Build(cpuCfg(), plan, rs)[0]; got != "ffmpeg" {
+		t.Errorf("default args[0] = %q, want ffmpeg", got)
+	}
+}
+
 func TestBuild_CPUx265Params_SDR(t *testing.T) {
 	cfg := cpuCfg()
 	plan := &planner.FilePlan{
@@ -103,3 +130,707 @@ func TestBuild_VAAPI_NoX265Params(t *testing.T) {
 		}
 	}
 }
+
+func TestBuild_QSVArgs(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderQSV
+	plan := &planner.FilePlan{
+		Action:       planner.ActionEncode,
+		VideoCodec:   "hevc_qsv",
+		VideoFilters: "format=nv12,hwupload=extra_hw_frames=64",
+		InputPath:    "/in/test.mkv",
+		OutputPath:   "/out/test.mkv",
+		VaapiQP:      21,
+		MuxQueueSize: 4096,
+	}
+	rs := NewRetryState(plan)
+	joined := strings.Join(Build(&cfg, plan, rs), " ")
+
+	for _, want := range []string{
+		"-init_hw_device qsv=qs -filter_hw_device qs",
+		"-vf format=nv12,hwupload=extra_hw_frames=64",
+		"-c:v hevc_qsv -global_quality 21",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("QSV args missing %q in: %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "vaapi") {
+		t.Errorf("QSV build should not initialise VAAPI: %s", joined)
+	}
+}
+
+func TestBuild_HLSArgs(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.OutputContainer = config.ContainerHLS
+	plan := &planner.FilePlan{
+		Action:        planner.ActionEncode,
+		VideoCodec:    "libx265",
+		InputPath:     "/in/test.mkv",
+		OutputPath:    "/out/Show/Season 01/Show - S01E01/Show - S01E01.m3u8",
+		CpuCRF:        18,
+		MuxQueueSize:  4096,
+		Container:     config.ContainerHLS,
+		ContainerOpts: []string{"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod"},
+		Attachments:   planner.AttachmentPlan{Include: true},
+		IncludeAttach: true,
+	}
+	rs := NewRetryState(plan)
+	args := Build(cfg, plan, rs)
+	joined := strings.Join(args, " ")
+
+	for _, want := range []string{
+		"-f hls",
+		"-hls_time 6",
+		"-hls_playlist_type vod",
+		"-hls_segment_filename /out/Show/Season 01/Show - S01E01/Show - S01E01_%05d.ts",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("HLS args missing %q: %s", want, joined)
+		}
+	}
+	if args[len(args)-1] != plan.OutputPath {
+		t.Errorf("last arg should be playlist path, got %q", args[len(args)-1])
+	}
+	if strings.Contains(joined, "0:t?") {
+		t.Error("HLS build should not map attachments")
+	}
+}
+
+func TestBuild_MKVCoverArt(t *testing.T) {
+	cfg := cpuCfg()
+	plan := &planner.FilePlan{
+		Action:          planner.ActionEncode,
+		VideoCodec:      "libx265",
+		VideoStreamIdx:  1,
+		VideoFilters:    "scale=1920:-2",
+		InputPath:       "/in/test.mkv",
+		OutputPath:      "/out/test.mkv",
+		CpuCRF:          18,
+		MuxQueueSize:    4096,
+		Container:       config.ContainerMKV,
+		IncludeCoverArt: true,
+		CoverArtIdx:     0,
+		DispositionOpts: []string{"-disposition:v:0", "default", "-disposition:v:1", "attached_pic"},
+	}
+	rs := NewRetryState(plan)
+	args := Build(cfg, plan, rs)
+	joined := strings.Join(args, " ")
+
+	for _, want := range []string{
+		"-map 0:1 -map 0:0",
+		"-c:v:1 copy",
+		"-disposition:v:1 attached_pic",
+		"-filter:v:0 scale=1920:-2",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("cover art args missing %q: %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "-vf ") {
+		t.Errorf("-vf would also apply to the copied cover stream: %s", joined)
+	}
+	codecIdx, coverIdx := -1, -1
+	for i, a := range args {
+		switch a {
+		case "-c:v":
+			codecIdx = i
+		case "-c:v:1":
+			coverIdx = i
+		}
+	}
+	if codecIdx < 0 || coverIdx < codecIdx {
+		t.Errorf("-c:v:1 (idx %d) must follow -c:v (idx %d) to override it", coverIdx, codecIdx)
+	}
+}
+
+func TestBuild_ReadRateBeforeInput(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.ReadRate = 2
+	plan := &planner.FilePlan{
+		Action:       planner.ActionEncode,
+		VideoCodec:   "libx265",
+		InputPath:    "/in/test.mkv",
+		OutputPath:   "/out/test.mkv",
+		MuxQueueSize: 4096,
+	}
+	args := Build(cfg, plan, NewRetryState(plan))
+
+	rateIdx, inputIdx := -1, -1
+	for i, a := range args {
+		switch a {
+		case "-readrate":
+			rateIdx = i
+		case "-i":
+			inputIdx = i
+		}
+	}
+	if rateIdx < 0 {
+		t.Fatal("missing -readrate in args")
+	}
+	if args[rateIdx+1] != "2" {
+		t.Errorf("-readrate value: got %q, want 2", args[rateIdx+1])
+	}
+	if inputIdx < 0 || rateIdx > inputIdx {
+		t.Errorf("-readrate (idx %d) must precede -i (idx %d)", rateIdx, inputIdx)
+	}
+
+	cfg.ReadRate = 0
+	for _, a := range Build(cfg, plan, NewRetryState(plan)) {
+		if a == "-readrate" {
+			t.Error("-readrate should be omitted when unthrottled")
+		}
+	}
+}
+
+func TestBuild_PreserveCreationTime(t *testing.T) {
+	cfg := cpuCfg()
+	pr := &probe.ProbeResult{
+		Format:       probe.FormatInfo{Tags: map[string]string{"CREATION_TIME": "2009-06-21T18:04:11.000000Z"}},
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	build := func() string {
+		plan := planner.BuildPlan(cfg, pr)
+		plan.InputPath = "/in/a.mkv"
+		plan.OutputPath = "/out/a.mkv"
+		return strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	}
+
+	if joined := build(); strings.Contains(joined, "creation_time=") {
+		t.Errorf("creation_time should not be set without --preserve-creation-time: %s", joined)
+	}
+
+	cfg.PreserveCreationTime = true
+	joined := build()
+	if !strings.Contains(joined, "-map_metadata 0 -map_chapters 0 -metadata creation_time=2009-06-21T18:04:11.000000Z") {
+		t.Errorf("source creation_time should be re-applied after -map_metadata: %s", joined)
+	}
+
+	pr.Format.Tags = nil
+	if joined := build(); strings.Contains(joined, "creation_time=") {
+		t.Errorf("no creation_time tag should add nothing: %s", joined)
+	}
+}
+
+func TestBuild_PreserveChapterTitles(t *testing.T) {
+	cfg := cpuCfg()
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		Chapters:     []probe.Chapter{{Title: "Opening"}, {}, {Title: "Part B: Ending"}},
+	}
+	build := func() string {
+		plan := planner.BuildPlan(cfg, pr)
+		plan.InputPath = "/in/a.mkv"
+		plan.OutputPath = "/out/a.mp4"
+		return strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	}
+
+	if joined := build(); strings.Contains(joined, "-metadata:c:") {
+		t.Errorf("chapter titles should not be set without --preserve-chapters-titles: %s", joined)
+	}
+
+	cfg.PreserveChapterTitles = true
+	joined := build()
+	if !strings.Contains(joined, "-map_chapters 0 -metadata:c:0 title=Opening -metadata:c:2 title=Part B: Ending") {
+		t.Errorf("titled chapters should follow -map_chapters by index: %s", joined)
+	}
+	if strings.Contains(joined, "-metadata:c:1") {
+		t.Errorf("untitled chapter should be left alone: %s", joined)
+	}
+}
+
+func TestBuild_BurnSubsBitmapGraph(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.BurnSubs = true
+	pr := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams:    []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 2, Codec: "hdmv_pgs_subtitle", IsBitmap: true}},
+		HasBitmapSubs:   true,
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/a.mkv"
+	plan.OutputPath = "/out/a.mkv"
+	got := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if !strings.Contains(got, "-filter_complex [0:0][0:2]overlay=eof_action=pass[vout] -map [vout] -map 0:a ") {
+		t.Errorf("want the overlay graph mapped by [vout]: %s", got)
+	}
+	if strings.Contains(got, " -vf ") || strings.Contains(got, "-map 0:0") || strings.Contains(got, "0:s") {
+		t.Errorf("burned stream should not be filtered by -vf or mapped as video/subtitle: %s", got)
+	}
+}
+
+func TestBuild_FaithfulRemux(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.FaithfulRemux = true
+	pr := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams:    []probe.AudioStream{{Index: 1, Codec: "ac3", Channels: 6}, {Index: 2, Codec: "aac", Channels: 2}},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 3, Codec: "subrip"}},
+		Chapters:        []probe.Chapter{{Title: "Intro"}},
+	}
+	build := func(output string) string {
+		plan := planner.BuildPlan(cfg, pr)
+		if plan.Err != nil {
+			t.Fatalf("unexpected plan error: %v", plan.Err)
+		}
+		if plan.Action != planner.ActionRemux {
+			t.Fatalf("faithful plan should remux, got %s", plan.Action)
+		}
+		plan.InputPath = "/in/a.mkv"
+		plan.OutputPath = output
+		return strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	}
+
+	mkv := build("/out/a.mkv")
+	if !strings.Contains(mkv, "-i /in/a.mkv -map 0 -c copy -dn") {
+		t.Errorf("MKV: want -map 0 -c copy right after the input: %s", mkv)
+	}
+	for _, unwanted := range []string{"-map 0:", "-c:v", "-c:a", "-ac", "-c:s", "-tag:v", "-disposition"} {
+		if strings.Contains(mkv, unwanted) {
+			t.Errorf("MKV: selective planning leaked %q: %s", unwanted, mkv)
+		}
+	}
+	if !strings.Contains(mkv, "-map_chapters 0") {
+		t.Errorf("MKV: chapters should be carried: %s", mkv)
+	}
+
+	cfg.OutputContainer = config.ContainerMP4
+	mp4 := build("/out/a.mp4")
+	if !strings.Contains(mp4, "-map 0 -map -0:t? -c copy -c:s mov_text -dn") {
+		t.Errorf("MP4: want attachments unmapped and text subs as mov_text: %s", mp4)
+	}
+	if !strings.Contains(mp4, "-movflags +faststart") || strings.Contains(mp4, "-tag:v hvc1") {
+		t.Errorf("MP4: want faststart and no hvc1 tag on H.264: %s", mp4)
+	}
+
+	pr.PrimaryVideo.Codec = "hevc"
+	if mp4 := build("/out/a.mp4"); !strings.Contains(mp4, "-tag:v hvc1") {
+		t.Errorf("MP4: HEVC should be tagged hvc1: %s", mp4)
+	}
+}
+
+func TestBuild_ConcatInput(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.ConcatList = "/in/list.txt"
+	cfg.Title = "Concert"
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/list.txt"
+	plan.OutputPath = "/out/Concert/Concert.mkv"
+
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if !strings.Contains(joined, "-f concat -safe 0 -i /in/list.txt") {
+		t.Errorf("concat demuxer options must directly precede -i: %s", joined)
+	}
+	if !strings.Contains(joined, "-c:v libx265") {
+		t.Errorf("concat input should use the normal encode path: %s", joined)
+	}
+
+	// Image sequences use image2 at --image-fps and software decode.
+	vcfg := vaapiCfg()
+	vcfg.ImageSequence = "/in/frames/%05d.png"
+	vcfg.ImageFPS = 23.976
+	pr = &probe.ProbeResult{PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "png", PixFmt: "rgb24", Width: 1920, Height: 1080}}
+	plan = planner.BuildPlan(vcfg, pr)
+	plan.InputPath = vcfg.ImageSequence
+	plan.OutputPath = "/out/Frames/Frames.mkv"
+	joined = strings.Join(Build(vcfg, plan, NewRetryState(plan)), " ")
+	if !strings.Contains(joined, "-f image2 -framerate 23.976 -i /in/frames/%05d.png") {
+		t.Errorf("image2 demuxer options must directly precede -i: %s", joined)
+	}
+	if plan.HWDecode || strings.Contains(joined, "-hwaccel ") {
+		t.Errorf("image sequences must not use VAAPI decode: %s", joined)
+	}
+}
+
+func TestBuild_AudioDelay(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.Audio.DelayMs = 250
+	cfg.Audio.StreamDelayMs = map[int]int{1: -120, 2: 0}
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "aac", Channels: 2},  // copied, +250ms
+			{Index: 2, Codec: "ac3", Channels: 6},  // transcoded, -120ms
+			{Index: 3, Codec: "aac", Channels: 2},  // explicitly undelayed
+			{Index: 4, Codec: "flac", Channels: 2}, // transcoded, +250ms
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/test.mkv"
+	plan.OutputPath = "/out/test.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+
+	// One offset input per distinct delay, in first-use order.
+	if !strings.Contains(joined, "-i /in/test.mkv -itsoffset 0.250 -i /in/test.mkv -itsoffset -0.120 -i /in/test.mkv") {
+		t.Errorf("expected +0.250 and -0.120 offset inputs after the main input: %s", joined)
+	}
+	for _, want := range []string{
+		"-map 1:a:0 -c:a:0 copy",
+		"-map 2:a:1 -c:a:1 libfdk_aac",
+		"-map 0:a:2 -c:a:2 copy",
+		"-map 1:a:3 -c:a:3 libfdk_aac",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q in %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "-map 0:a ") {
+		t.Errorf("delayed all-AAC audio must not use the blanket copy map: %s", joined)
+	}
+}
+
+func TestBuild_TranscodedAudioLanguage(t *testing.T) {
+	cfg := cpuCfg()
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "ac3", Channels: 6, Language: "jpn"},
+			{Index: 2, Codec: "aac", Channels: 2, Language: "eng"}, // copied: tags ride along
+			{Index: 3, Codec: "dts", Channels: 6, Language: "und"},
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/test.mkv"
+	plan.OutputPath = "/out/test.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+
+	if !strings.Contains(joined, "-metadata:s:a:0 language=jpn") {
+		t.Errorf("transcoded stream should re-apply its language: %s", joined)
+	}
+	if strings.Contains(joined, "-metadata:s:a:1") || strings.Contains(joined, "-metadata:s:a:2") {
+		t.Errorf("copied and 'und' streams need no language metadata: %s", joined)
+	}
+}
+
+func TestBuild_AudioLangsMapsKeptStreams(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.Audio.Langs = []string{"jpn", "eng"}
+	cfg.Audio.DropCommentary = true
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "aac", Channels: 2, Language: "fre"},
+			{Index: 2, Codec: "aac", Channels: 2, Language: "jpn"},
+			{Index: 3, Codec: "aac", Channels: 2, Language: "eng", Title: "Commentary"},
+			{Index: 4, Codec: "ac3", Channels: 6, Language: "eng"},
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/test.mkv"
+	plan.OutputPath = "/out/test.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+
+	if !strings.Contains(joined, "-map 0:a:1 -c:a:0 copy -map 0:a:3 -c:a:1 ") {
+		t.Errorf("want a:1 and a:3 mapped as outputs a:0 and a:1: %s", joined)
+	}
+	for _, dropped := range []string{"0:a:0", "0:a:2", "-map 0:a ", "-c:a:2"} {
+		if strings.Contains(joined, dropped) {
+			t.Errorf("filtered stream leaked (%q): %s", dropped, joined)
+		}
+	}
+}
+
+func TestBuild_DegenerateAudioNotMapped(t *testing.T) {
+	cfg := cpuCfg()
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "pcm_s16le", Channels: 0, Degenerate: true},
+			{Index: 2, Codec: "ac3", Channels: 6, Language: "jpn"},
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath = "/in/test.mkv"
+	plan.OutputPath = "/out/test.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+
+	// Mapped by source index, configured by output index.
+	if !strings.Contains(joined, "-map 0:a:1 -c:a:0 ") {
+		t.Errorf("want a:1 mapped as output a:0: %s", joined)
+	}
+	if strings.Contains(joined, "0:a:0") || strings.Contains(joined, "-map 0:a ") || strings.Contains(joined, "-c:a:1") {
+		t.Errorf("degenerate a:0 should not be mapped: %s", joined)
+	}
+}
+
+func TestBuild_SidecarSubtitleInputs(t *testing.T) {
+	cfg := vaapiCfg()
+	plan := &planner.FilePlan{
+		Action:       planner.ActionRemux,
+		VideoCodec:   "copy",
+		InputPath:    "/in/Show - S01E05.mkv",
+		OutputPath:   "/out/Show - S01E05.mkv",
+		MuxQueueSize: 4096,
+		IncludeSubs:  true,
+		Subtitles: planner.SubtitlePlan{
+			Include:       true,
+			Codec:         "copy",
+			EmbeddedCount: 2,
+			Sidecars: []planner.SidecarSubtitle{
+				{Path: "/in/Show - S01E05.eng.srt", Language: "eng"},
+				{Path: "/in/Show - S01E05.srt"},
+			},
+		},
+	}
+	args := Build(cfg, plan, NewRetryState(plan))
+	joined := strings.Join(args, " ")
+
+	var inputs []string
+	for i, a := range args {
+		if a == "-i" {
+			inputs = append(inputs, args[i+1])
+		}
+	}
+	wantInputs := []string{plan.InputPath, "/in/Show - S01E05.eng.srt", "/in/Show - S01E05.srt"}
+	if strings.Join(inputs, "|") != strings.Join(wantInputs, "|") {
+		t.Errorf("inputs: got %v, want %v", inputs, wantInputs)
+	}
+	for _, want := range []string{"-map 0:s?", "-map 1:s:0", "-map 2:s:0", "-metadata:s:s:2 language=eng"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args missing %q: %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "-metadata:s:s:3") {
+		t.Error("sidecar without language should not get language metadata")
+	}
+
+	// Subtitle retry drops sidecar inputs along with their maps.
+	rs := NewRetryState(plan)
+	rs.IncludeSubs = false
+	joined = strings.Join(Build(cfg, plan, rs), " ")
+	if strings.Contains(joined, ".srt") || strings.Contains(joined, "1:s:0") {
+		t.Errorf("sidecars should be dropped with subtitles: %s", joined)
+	}
+}
+
+func TestBuild_SubtitleDispositionsFollowSubs(t *testing.T) {
+	cfg := vaapiCfg()
+	plan := &planner.FilePlan{
+		Action:       planner.ActionRemux,
+		VideoCodec:   "copy",
+		InputPath:    "/in/a.mkv",
+		OutputPath:   "/out/a.mkv",
+		MuxQueueSize: 4096,
+		IncludeSubs:  true,
+		Subtitles: planner.SubtitlePlan{
+			Include:         true,
+			Codec:           "copy",
+			DispositionOpts: []string{"-disposition:s:0", "0", "-disposition:s:1", "default"},
+		},
+	}
+	rs := NewRetryState(plan)
+	if joined := strings.Join(Build(cfg, plan, rs), " "); !strings.Contains(joined, "-disposition:s:1 default") {
+		t.Errorf("missing subtitle disposition: %s", joined)
+	}
+
+	// Once the retry engine drops subtitles, their dispositions go too.
+	rs.IncludeSubs = false
+	if joined := strings.Join(Build(cfg, plan, rs), " "); strings.Contains(joined, "-disposition:s:") {
+		t.Errorf("subtitle dispositions without subtitles: %s", joined)
+	}
+}
+
+func TestBuild_MP4ForcedTextSubDisposition(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+		SubtitleStreams: []probe.SubtitleStream{
+			{Index: 2, Codec: "hdmv_pgs_subtitle", Language: "eng", IsBitmap: true},
+			{Index: 3, Codec: "subrip", Language: "eng", IsForced: true},
+		},
+		HasBitmapSubs: true,
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mp4"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	// Source stream 3 is the only mapped subtitle, so it is output s:0.
+	if !strings.Contains(joined, "-map 0:3 -c:s mov_text -disposition:s:0 forced") {
+		t.Errorf("forced eng text sub should be s:0 with forced disposition: %s", joined)
+	}
+}
+
+func TestBuild_AutoAudioTitles(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.Audio.AutoTitles = true
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "eac3", Channels: 6, Language: "eng"},
+			{Index: 2, Codec: "aac", Channels: 2, Language: "jpn"},
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	// The EAC3 stream is transcoded to stereo AAC; the AAC one is copied.
+	for _, want := range []string{
+		"-metadata:s:a:0 title=English Stereo AAC",
+		"-metadata:s:a:1 title=Japanese Stereo AAC",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q: %s", want, joined)
+		}
+	}
+
+	// Copy-all plans describe the source streams.
+	pr.AudioStreams[0] = probe.AudioStream{Index: 1, Codec: "aac", Channels: 6, Language: "ger"}
+	plan = planner.BuildPlan(cfg, pr)
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	joined = strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if !strings.Contains(joined, "-c:a copy -metadata:s:a:0 title=German 5.1 AAC -metadata:s:a:1 title=Japanese Stereo AAC") {
+		t.Errorf("copy-all titles: %s", joined)
+	}
+
+	cfg.Audio.AutoTitles = false
+	plan = planner.BuildPlan(cfg, pr)
+	if joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " "); strings.Contains(joined, "title=") {
+		t.Errorf("titles without --auto-audio-titles: %s", joined)
+	}
+}
+
+func TestBuild_DolbyVisionRemux(t *testing.T) {
+	cfg := cpuCfg()
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{
+			Index: 0, Codec: "hevc", Width: 3840, Height: 2160,
+			ColorTransfer: "smpte2084", ColorPrimaries: "bt2020",
+			DolbyVision: &probe.DolbyVisionConfig{Profile: 8, Level: 6, RPUPresent: true, BLPresent: true, BLCompatID: 1},
+		},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	if !plan.DolbyVision {
+		t.Fatal("plan.DolbyVision should be set for a DoVi source")
+	}
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mp4"
+
+	plan.Action = planner.ActionRemux
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if !strings.Contains(joined, "-c:v copy -strict unofficial") {
+		t.Errorf("DoVi remux should keep the configuration record: %s", joined)
+	}
+
+	plan.Action = planner.ActionEncode
+	joined = strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if strings.Contains(joined, "-strict unofficial") {
+		t.Errorf("encode should not relax compliance: %s", joined)
+	}
+
+	plan.Action, plan.DolbyVision = planner.ActionRemux, false
+	joined = strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if strings.Contains(joined, "-strict") {
+		t.Errorf("non-DoVi remux should not relax compliance: %s", joined)
+	}
+}
+
+func TestBuild_RemuxToFaststart(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.RemuxToFaststart = true
+	pr := &probe.ProbeResult{
+		Format: probe.FormatInfo{FormatName: "mov,mp4,m4a,3gp,3g2,mj2"},
+		PrimaryVideo: &probe.VideoStream{
+			Index: 0, Codec: "h264", Profile: "High", PixFmt: "yuv420p",
+			Width: 1920, Height: 1080, FieldOrder: "progressive",
+		},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2, SampleRate: 48000, BitRate: 128000}},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	if plan.Action != planner.ActionRemux || !plan.Faststart {
+		t.Fatalf("h264 MP4: got action %v faststart %v, want a faststart remux", plan.Action, plan.Faststart)
+	}
+	plan.InputPath, plan.OutputPath = "/in/a.mp4", "/out/a.mp4"
+
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	for _, want := range []string{"-c:v copy", "-c:a copy", "-movflags +faststart"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing %q: %s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "hvc1") || strings.Contains(joined, "libx265") {
+		t.Errorf("copied H.264 must not be tagged or encoded as HEVC: %s", joined)
+	}
+
+	// MKV sources are still encoded.
+	pr.Format.FormatName = "matroska,webm"
+	if plan := planner.BuildPlan(cfg, pr); plan.Action != planner.ActionEncode {
+		t.Errorf("h264 MKV: got action %v, want encode", plan.Action)
+	}
+}
+
+func TestBuild_TargetBitrateTwoPass(t *testing.T) {
+	cfg := cpuCfg()
+	cfg.Encoder.TargetBitrateKbps = 4000
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Index: 0, Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "ac3", Channels: 6, SampleRate: 48000}},
+	}
+	plan := planner.BuildPlan(cfg, pr)
+	if !plan.TwoPass || plan.TargetBitrateKbps != 4000 {
+		t.Fatalf("CPU --target-bitrate: got two-pass %v at %d kb/s", plan.TwoPass, plan.TargetBitrateKbps)
+	}
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	plan.PassLogFile = "/tmp/muxmaster-1/pass-1/x265.stats"
+	rs := NewRetryState(plan)
+
+	first := strings.Join(BuildFirstPass(cfg, plan, rs), " ")
+	for _, want := range []string{"-c:v libx265 -b:v 4000k", "pass=1:stats=/tmp/muxmaster-1/pass-1/x265.stats", "-an -sn", "-f null -"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("first pass missing %q: %s", want, first)
+		}
+	}
+	if !strings.HasSuffix(first, "-f null -") || strings.Contains(first, "/out/a.mkv") || strings.Contains(first, "-c:a") {
+		t.Errorf("first pass must write only video to the null muxer: %s", first)
+	}
+
+	second := strings.Join(Build(cfg, plan, rs), " ")
+	for _, want := range []string{"-b:v 4000k", "pass=2:stats=/tmp/muxmaster-1/pass-1/x265.stats", "-map 0:a", "/out/a.mkv"} {
+		if !strings.Contains(second, want) {
+			t.Errorf("second pass missing %q: %s", want, second)
+		}
+	}
+	if strings.Contains(second, "-crf") || strings.Contains(second, "-maxrate") {
+		t.Errorf("second pass should use the average bitrate only: %s", second)
+	}
+
+	// VAAPI encodes one VBR pass.
+	cfg = vaapiCfg()
+	cfg.Encoder.TargetBitrateKbps = 4000
+	plan = planner.BuildPlan(cfg, pr)
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if plan.TwoPass || !strings.Contains(joined, "-c:v hevc_vaapi -rc_mode VBR -b:v 4000k -maxrate 6000k -bufsize 8000k") || strings.Contains(joined, "-qp") {
+		t.Errorf("VAAPI VBR: got two-pass %v, args %s", plan.TwoPass, joined)
+	}
+}
+
+func TestBuild_SidecarOnlySkipsEmbeddedMap(t *testing.T) {
+	cfg := vaapiCfg()
+	plan := &planner.FilePlan{
+		Action:       planner.ActionRemux,
+		InputPath:    "/in/a.mp4",
+		OutputPath:   "/out/a.mp4",
+		MuxQueueSize: 4096,
+		IncludeSubs:  true,
+		Subtitles: planner.SubtitlePlan{
+			Include:     true,
+			Codec:       "mov_text",
+			SidecarOnly: true,
+			Sidecars:    []planner.SidecarSubtitle{{Path: "/in/a.eng.srt", Language: "eng"}},
+		},
+	}
+	joined := strings.Join(Build(cfg, plan, NewRetryState(plan)), " ")
+	if strings.Contains(joined, "0:s?") {
+		t.Errorf("sidecar-only plan should not map embedded subs: %s", joined)
+	}
+	if !strings.Contains(joined, "-map 1:s:0 -metadata:s:s:0 language=eng") {
+		t.Errorf("sidecar should be output subtitle 0: %s", joined)
+	}
+}
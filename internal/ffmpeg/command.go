@@ -0,0 +1,42 @@
+// command.go implements --print-commands: shell-quoted logging of each command Execute runs.
+package ffmpeg
+
+import (
+	"context"
+	"strings"
+)
+
+// commandLogKey is the context key for WithCommandLog.
+type commandLogKey struct{}
+
+// WithCommandLog returns a context under which Execute and ExecuteFirstPass
+// pass each command to fn, shell-quoted (see ShellQuote), before running
+// it. The command is the Build output, without the -progress pipe that
+// WithProgress adds, so it can be pasted into a shell as-is.
+func WithCommandLog(ctx context.Context, fn func(string)) context.Context {
+	return context.WithValue(ctx, commandLogKey{}, fn)
+}
+
+// logCommand passes args to the WithCommandLog function in ctx, if any.
+func logCommand(ctx context.Context, args []string) {
+	if fn, ok := ctx.Value(commandLogKey{}).(func(string)); ok && fn != nil {
+		fn(ShellQuote(args))
+	}
+}
+
+// ShellQuote joins args into one POSIX shell command line, as logged by
+// --print-commands and written to --retry-log. Arguments made only of
+// characters no shell treats specially are left bare; others are
+// single-quoted, with each embedded single quote closing the quoting,
+// escaped with a backslash, and reopening it.
+func ShellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a != "" && strings.Trim(a, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,/:@%") == "" {
+			quoted[i] = a
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,48 @@
+package ffmpeg
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ffmpeg", "-i", "/in/a.mkv", "-c:v", "libx265"}, "ffmpeg -i /in/a.mkv -c:v libx265"},
+		{[]string{"-i", "/in/Show Name/S01E01 [1080p].mkv"}, "-i '/in/Show Name/S01E01 [1080p].mkv'"},
+		{[]string{"-metadata", "title=Bob's Movie"}, `-metadata 'title=Bob'\''s Movie'`},
+		{[]string{"-vf", "scale=-2:720,format=yuv420p10le"}, "-vf scale=-2:720,format=yuv420p10le"},
+		{[]string{"-map", "0:m:language:eng?", "-x", ""}, "-map '0:m:language:eng?' -x ''"},
+		{[]string{"a$b", "c;d", "*.mkv"}, "'a$b' 'c;d' '*.mkv'"},
+	}
+	for _, tt := range tests {
+		if got := ShellQuote(tt.args); got != tt.want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestExecute_CommandLog(t *testing.T) {
+	cfg := cpuCfg()
+	plan := testPlan()
+	plan.InputPath = "/in/Show Name/S01E01 [1080p].mkv"
+
+	var logged []string
+	ctx := WithCommandLog(context.Background(), func(cmd string) { logged = append(logged, cmd) })
+	ctx = WithProgress(ctx, func(Progress) {})
+	run := RunFunc(func(context.Context, []string) ExecResult { return ExecResult{} })
+	Execute(ctx, cfg, plan, NewRetryState(plan), 60, run)
+
+	if len(logged) != 1 {
+		t.Fatalf("logged %d commands, want 1", len(logged))
+	}
+	if want := ShellQuote(Build(cfg, plan, NewRetryState(plan))); logged[0] != want {
+		t.Errorf("logged %s, want the Build output %s", logged[0], want)
+	}
+	if !strings.Contains(logged[0], "'/in/Show Name/S01E01 [1080p].mkv'") {
+		t.Errorf("input path not quoted: %s", logged[0])
+	}
+}
@@ -0,0 +1,47 @@
+// compare.go builds and runs the side-by-side source/output frame comparison
+// used by --preview-frame.
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// compareFilter stacks source (left) and output (right) frames. The output
+// is scaled to the source's height (aspect kept) so differing resolutions
+// line up, and both sides are converted to square-pixel RGB because hstack
+// requires matching heights and pixel formats (HDR/10-bit outputs differ
+// from SDR sources).
+const compareFilter = "[0:v]setsar=1,format=rgb24[src];" +
+	"[1:v][src]scale2ref=w=oh*mdar:h=ih[out][ref];" +
+	"[out]setsar=1,format=rgb24[outrgb];" +
+	"[ref][outrgb]hstack=inputs=2[cmp]"
+
+// CompareFrameArgs returns the ffmpeg (bin) command that grabs the frame at atSec
+// from src and out and writes them side by side to dest (a PNG).
+func CompareFrameArgs(bin, src, out string, atSec float64, dest string) []string {
+	ts := strconv.FormatFloat(atSec, 'f', -1, 64)
+	return []string{
+		bin, "-hide_banner", "-nostdin", "-y", "-loglevel", "error",
+		"-ss", ts, "-i", src,
+		"-ss", ts, "-i", out,
+		"-filter_complex", compareFilter,
+		"-map", "[cmp]", "-frames:v", "1",
+		dest,
+	}
+}
+
+// CompareFrame writes a source-vs-output comparison image for atSec to dest.
+// Returns an error including ffmpeg's stderr when the frame cannot be
+// extracted (e.g. atSec is past the end of either file).
+func CompareFrame(ctx context.Context, bin, src, out string, atSec float64, dest string, run RunFunc) error {
+	res := run(ctx, CompareFrameArgs(bin, src, out, atSec, dest))
+	if res.Err != nil {
+		if res.Stderr != "" {
+			return fmt.Errorf("compare frame: %w: %s", res.Err, res.Stderr)
+		}
+		return fmt.Errorf("compare frame: %w", res.Err)
+	}
+	return nil
+}
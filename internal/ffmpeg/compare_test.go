@@ -0,0 +1,46 @@
+package ffmpeg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompareFrameArgs(t *testing.T) {
+	args := CompareFrameArgs("ffmpeg", "/in/a.mkv", "/out/a.mkv", 90.5, "/out/.compare/a.png")
+	joined := strings.Join(args, " ")
+
+	if !strings.Contains(joined, "-ss 90.5 -i /in/a.mkv -ss 90.5 -i /out/a.mkv") {
+		t.Errorf("both inputs should seek to the same timestamp: %s", joined)
+	}
+	if !strings.HasSuffix(joined, "-map [cmp] -frames:v 1 /out/.compare/a.png") {
+		t.Errorf("should write one mapped frame to dest: %s", joined)
+	}
+
+	var fc string
+	for i, a := range args {
+		if a == "-filter_complex" && i+1 < len(args) {
+			fc = args[i+1]
+		}
+	}
+	for _, want := range []string{
+		"[1:v][src]scale2ref=w=oh*mdar:h=ih", // output scaled to source height
+		"format=rgb24",
+		"[ref][outrgb]hstack=inputs=2[cmp]", // source left, output right
+	} {
+		if !strings.Contains(fc, want) {
+			t.Errorf("filter_complex missing %q: %s", want, fc)
+		}
+	}
+}
+
+func TestCompareFrame_Error(t *testing.T) {
+	run := RunFunc(func(_ context.Context, _ []string) ExecResult {
+		return ExecResult{Stderr: "Output file is empty", Err: errors.New("exit status 1")}
+	})
+	err := CompareFrame(context.Background(), "ffmpeg", "a.mkv", "b.mkv", 10, "c.png", run)
+	if err == nil || !strings.Contains(err.Error(), "Output file is empty") {
+		t.Errorf("expected error with stderr, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// cropdetect.go runs short cropdetect sampling passes and picks the
+// letterbox crop of the source (--auto-crop).
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// CropSamplePoints is how many evenly spaced points across the file the
+// cropdetect pass samples, so a dark intro or a single letterboxed scene
+// does not decide the crop for the whole title.
+const CropSamplePoints = 5
+
+// CropSampleFrames is how many frames cropdetect analyzes at each point.
+const CropSampleFrames = 60
+
+// reCropdetect matches the crop= suggestion cropdetect prints per frame.
+// Negative sizes (printed for all-black frames) do not match.
+var reCropdetect = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// CropdetectArgs returns the ffmpeg (bin) command that runs cropdetect over
+// CropSampleFrames frames of the primary video starting at startSec,
+// discarding output. round=2 keeps the crop on even sizes and offsets,
+// which 4:2:0 chroma needs.
+func CropdetectArgs(bin, input string, startSec float64) []string {
+	return []string{
+		bin, "-hide_banner", "-nostdin",
+		"-ss", strconv.FormatFloat(startSec, 'f', -1, 64), "-i", input,
+		"-map", "0:v:0", "-vf", "cropdetect=round=2",
+		"-frames:v", strconv.Itoa(CropSampleFrames),
+		"-an", "-sn", "-dn", "-f", "null", "-",
+	}
+}
+
+// ParseCropdetect returns the most frequent crop= suggestion in cropdetect
+// stderr; ties go to the larger area, which crops less. Returns false when
+// there is no suggestion (e.g. ffmpeg failed to decode, or every frame
+// was black).
+func ParseCropdetect(stderr string) (probe.CropRect, bool) {
+	counts := map[probe.CropRect]int{}
+	var best probe.CropRect
+	for _, m := range reCropdetect.FindAllStringSubmatch(stderr, -1) {
+		var r probe.CropRect
+		r.W, _ = strconv.Atoi(m[1])
+		r.H, _ = strconv.Atoi(m[2])
+		r.X, _ = strconv.Atoi(m[3])
+		r.Y, _ = strconv.Atoi(m[4])
+		if r.W == 0 || r.H == 0 {
+			continue
+		}
+		counts[r]++
+		if n, bn := counts[r], counts[best]; n > bn || (n == bn && r.W*r.H > best.W*best.H) {
+			best = r
+		}
+	}
+	return best, len(counts) > 0
+}
+
+// DetectCrop samples CropSamplePoints points across duration seconds of
+// input (just the start when the duration is unknown) and returns the
+// letterbox crop for a width×height frame, or nil when the picture fills
+// the frame. Returns an error including stderr when ffmpeg fails, and an
+// error when cropdetect suggests nothing or a crop keeping less than half
+// the frame in either direction, which points at dark footage rather than
+// letterboxing.
+func DetectCrop(ctx context.Context, bin, input string, duration float64, width, height int, run RunFunc) (*probe.CropRect, error) {
+	starts := []float64{0}
+	if duration > 0 {
+		starts = starts[:0]
+		for i := 1; i <= CropSamplePoints; i++ {
+			starts = append(starts, duration*float64(i)/float64(CropSamplePoints+1))
+		}
+	}
+
+	var stderr string
+	for _, start := range starts {
+		res := run(ctx, CropdetectArgs(bin, input, start))
+		if res.Err != nil {
+			if res.Stderr != "" {
+				return nil, fmt.Errorf("cropdetect: %w: %s", res.Err, res.Stderr)
+			}
+			return nil, fmt.Errorf("cropdetect: %w", res.Err)
+		}
+		stderr += res.Stderr
+	}
+
+	r, ok := ParseCropdetect(stderr)
+	if !ok {
+		return nil, fmt.Errorf("cropdetect: no crop suggestion in ffmpeg output")
+	}
+	if r.W*2 < width || r.H*2 < height {
+		return nil, fmt.Errorf("cropdetect: implausible crop %dx%d for a %dx%d frame", r.W, r.H, width, height)
+	}
+	if r.W >= width && r.H >= height {
+		return nil, nil
+	}
+	return &r, nil
+}
@@ -0,0 +1,79 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// cropdetectStderr returns canned ffmpeg stderr with one cropdetect line
+// per crop value, in order.
+func cropdetectStderr(crops ...string) string {
+	out := "Input #0, matroska,webm, from 'in.mkv':\n"
+	for i, c := range crops {
+		out += fmt.Sprintf("[Parsed_cropdetect_0 @ 0x5581f2c4e140] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:%d t:%d.041708 limit:0.094118 crop=%s\n", i*1001, i, c)
+	}
+	return out + "frame=   60 fps=0.0 q=-0.0 Lsize=N/A time=00:00:02.50 bitrate=N/A speed=9.8x\n"
+}
+
+func TestParseCropdetect(t *testing.T) {
+	// Early frames of a sample still show the crop converging, and a black
+	// frame prints negative sizes; the settled value wins.
+	r, ok := ParseCropdetect(cropdetectStderr(
+		"-1904:-1072:1912:1080",
+		"1904:784:8:148",
+		"1920:800:0:140",
+		"1920:800:0:140",
+		"1920:800:0:140",
+	))
+	if !ok {
+		t.Fatal("expected a crop suggestion to parse")
+	}
+	if want := (probe.CropRect{W: 1920, H: 800, X: 0, Y: 140}); r != want {
+		t.Errorf("crop = %+v, want %+v", r, want)
+	}
+	if r.Filter() != "crop=1920:800:0:140" {
+		t.Errorf("Filter() = %q", r.Filter())
+	}
+
+	// Ties go to the larger area.
+	r, _ = ParseCropdetect(cropdetectStderr("1920:800:0:140", "1920:816:0:132"))
+	if r.H != 816 {
+		t.Errorf("tie: crop = %+v, want the 1920x816 one", r)
+	}
+
+	if _, ok := ParseCropdetect("Error opening input file in.mkv"); ok {
+		t.Error("expected no crop for stderr without cropdetect lines")
+	}
+}
+
+func TestDetectCrop(t *testing.T) {
+	var starts []string
+	stderr := cropdetectStderr("1920:800:0:140")
+	run := RunFunc(func(_ context.Context, args []string) ExecResult {
+		starts = append(starts, args[4])
+		return ExecResult{Stderr: stderr}
+	})
+	crop, err := DetectCrop(context.Background(), "ffmpeg", "/in/a.mkv", 600, 1920, 1080, run)
+	if err != nil || crop == nil || crop.Filter() != "crop=1920:800:0:140" {
+		t.Fatalf("got %+v, %v; want crop=1920:800:0:140", crop, err)
+	}
+	if strings.Join(starts, " ") != "100 200 300 400 500" {
+		t.Errorf("sample starts = %v, want 5 evenly spaced points", starts)
+	}
+
+	// A full-frame suggestion means no letterboxing.
+	stderr = cropdetectStderr("1920:1080:0:0")
+	if crop, err := DetectCrop(context.Background(), "ffmpeg", "/in/a.mkv", 600, 1920, 1080, run); err != nil || crop != nil {
+		t.Errorf("full frame: got %+v, %v; want nil, nil", crop, err)
+	}
+
+	// A dark sample suggesting a sliver of the frame is rejected.
+	stderr = cropdetectStderr("1920:200:0:440")
+	if _, err := DetectCrop(context.Background(), "ffmpeg", "/in/a.mkv", 600, 1920, 1080, run); err == nil {
+		t.Error("expected an error for an implausible crop")
+	}
+}
@@ -6,8 +6,14 @@
 // and verify the builder→executor path without spawning real ffmpeg.
 //
 // Files:
-//   - builder.go:     Build — constructs the full ffmpeg argument list from plan + retry state
-//   - executor.go:    Execute, RunFunc, NewRunFunc — injectable subprocess execution
-//   - errors.go:      Error pattern regexes and ClassifyError — maps stderr to RetryAction
+//   - builder.go:     Build, BuildFirstPass — construct the full ffmpeg argument list from plan + retry state (and the two-pass analysis pass)
+//   - executor.go:    Execute, ExecuteFirstPass, RunFunc, NewRunFunc, WithStderrTee — injectable subprocess execution
+//   - progress.go:    ProgressParser, WithProgress — -progress pipe parsing into percent/ETA updates
+//   - command.go:     WithCommandLog — --print-commands shell-quoted command logging
+//   - limiter.go:     DeviceLimiter, ConfigureVAAPIConcurrency — caps concurrent VAAPI sessions
+//   - compare.go:     CompareFrame — side-by-side source/output frame PNG via hstack
+//   - idet.go:        DetectScanType — --detect-interlace idet pass, progressive/interlaced/telecined classification
+//   - cropdetect.go:  DetectCrop — --auto-crop cropdetect sampling pass, most frequent letterbox crop
+//   - errors.go:      Error pattern regexes, ClassifyError, ExecError — typed, categorized ffmpeg failures
 //   - retry.go:       RetryState, NewRetryState, Advance — state machine for error recovery
 package ffmpeg
@@ -1,7 +1,11 @@
-// errors.go classifies ffmpeg stderr output using regex-based patterns.
+// errors.go classifies ffmpeg stderr output using regex-based patterns and
+// defines ExecError, the typed error Execute returns on failure.
 package ffmpeg
 
-import "regexp"
+import (
+	"errors"
+	"regexp"
+)
 
 // Pre-compiled regexes for classifying ffmpeg stderr output into retryable
 // error categories. Checked in order by [RetryState.Advance]; the first
@@ -27,6 +31,26 @@ var (
 			`invalid, non monotonically increasing dts|` +
 			`DTS .*out of order|PTS .*out of order|` +
 			`pts has no value|missing PTS|Timestamps are unset`)
+
+	// reRemuxIncompatible matches the output muxer rejecting a copied video
+	// stream (e.g. an HEVC profile the MP4 muxer has no tag for). Subtitle
+	// codec rejections are covered by reSubtitleIssue instead.
+	reRemuxIncompatible = regexp.MustCompile(
+		`(?i)Could not find tag for codec (hevc|h264|av1|vp9|mpeg4) in stream #0|` +
+			`Tag \S+ incompatible with output codec id`)
+
+	// reTooManyOpenFiles matches file-descriptor exhaustion (EMFILE). This is
+	// an environmental failure, not a per-file one: the fix is to lower
+	// concurrency and retry, so it is not part of the RetryState sequence.
+	reTooManyOpenFiles = regexp.MustCompile(
+		`(?i)Too many open files`)
+
+	// reOutputTransient matches a network output share (SMB/NFS) dropping
+	// out mid-write (ESTALE, ENOTCONN). The file itself is fine: the fix is
+	// to remove the partial output and run the file again after a short
+	// pause, so it is not part of the RetryState sequence either.
+	reOutputTransient = regexp.MustCompile(
+		`(?i)Stale file handle|Transport endpoint is not connected`)
 )
 
 // MatchAttachmentIssue reports whether stderr contains an attachment tag error.
@@ -48,3 +72,128 @@ func MatchMuxQueueOverflow(stderr string) bool {
 func MatchTimestampIssue(stderr string) bool {
 	return reTimestampIssue.MatchString(stderr)
 }
+
+// MatchRemuxIncompatible reports whether stderr shows the output container
+// rejecting a stream-copied video codec. Used by the --remux-fail fallback;
+// not part of the RetryState sequence because the fix replaces the plan.
+func MatchRemuxIncompatible(stderr string) bool {
+	return reRemuxIncompatible.MatchString(stderr)
+}
+
+// MatchTooManyOpenFiles reports whether stderr contains a file-descriptor
+// exhaustion error ("Too many open files").
+func MatchTooManyOpenFiles(stderr string) bool {
+	return reTooManyOpenFiles.MatchString(stderr)
+}
+
+// MatchOutputTransient reports whether stderr contains a transient
+// network-share write error ("Stale file handle", "Transport endpoint is
+// not connected").
+func MatchOutputTransient(stderr string) bool {
+	return reOutputTransient.MatchString(stderr)
+}
+
+// ErrorCategory is a class of ffmpeg failure recognized from stderr.
+type ErrorCategory int
+
+const (
+	CategoryUnknown           ErrorCategory = iota // No known pattern matched.
+	CategoryAttachment                             // Attachment missing filename/mimetype tag.
+	CategorySubtitle                               // Subtitle codec rejected by the muxer or encoder.
+	CategoryMuxQueue                               // Mux queue overflow ("Too many packets buffered").
+	CategoryTimestamp                              // DTS/PTS discontinuity or missing timestamps.
+	CategoryRemuxIncompatible                      // Container rejected a stream-copied video codec.
+	CategoryTooManyOpenFiles                       // File-descriptor exhaustion (EMFILE).
+	CategoryOutputTransient                        // Network output share dropped mid-write (ESTALE/ENOTCONN).
+)
+
+// String returns a short lowercase name for the category.
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryAttachment:
+		return "attachment"
+	case CategorySubtitle:
+		return "subtitle"
+	case CategoryMuxQueue:
+		return "mux-queue"
+	case CategoryTimestamp:
+		return "timestamp"
+	case CategoryRemuxIncompatible:
+		return "remux-incompatible"
+	case CategoryTooManyOpenFiles:
+		return "too-many-open-files"
+	case CategoryOutputTransient:
+		return "output-transient"
+	}
+	return "unknown"
+}
+
+// categoryPatterns lists the matchers in [RetryState.Advance] order, then
+// the categories that are handled outside the retry sequence.
+var categoryPatterns = []struct {
+	category ErrorCategory
+	re       *regexp.Regexp
+}{
+	{CategoryAttachment, reAttachmentIssue},
+	{CategorySubtitle, reSubtitleIssue},
+	{CategoryMuxQueue, reMuxQueueOverflow},
+	{CategoryTimestamp, reTimestampIssue},
+	{CategoryRemuxIncompatible, reRemuxIncompatible},
+	{CategoryTooManyOpenFiles, reTooManyOpenFiles},
+	{CategoryOutputTransient, reOutputTransient},
+}
+
+// ClassifyError runs stderr through every matcher once and returns the
+// matching categories in the order above. ffmpeg often prints several
+// problems for one failure, so more than one category can match. Returns
+// nil when nothing matches.
+func ClassifyError(stderr string) []ErrorCategory {
+	var cats []ErrorCategory
+	for _, p := range categoryPatterns {
+		if p.re.MatchString(stderr) {
+			cats = append(cats, p.category)
+		}
+	}
+	return cats
+}
+
+// ExecError is the error Execute returns when ffmpeg fails. It wraps the
+// process error and carries stderr plus its classification, so callers
+// can switch on the category instead of re-running the matchers.
+type ExecError struct {
+	Err        error           // Underlying process error (e.g. exit status 1).
+	Stderr     string          // Captured ffmpeg stderr.
+	Categories []ErrorCategory // From ClassifyError; empty when unrecognized.
+}
+
+// NewExecError wraps err with stderr and its classification.
+func NewExecError(err error, stderr string) *ExecError {
+	return &ExecError{Err: err, Stderr: stderr, Categories: ClassifyError(stderr)}
+}
+
+func (e *ExecError) Error() string { return e.Err.Error() }
+func (e *ExecError) Unwrap() error { return e.Err }
+
+// Category returns the first matching category, or CategoryUnknown.
+func (e *ExecError) Category() ErrorCategory {
+	if len(e.Categories) == 0 {
+		return CategoryUnknown
+	}
+	return e.Categories[0]
+}
+
+// Has reports whether c is among the error's categories.
+func (e *ExecError) Has(c ErrorCategory) bool {
+	for _, got := range e.Categories {
+		if got == c {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCategory reports whether err is (or wraps) an *ExecError in category c.
+func HasCategory(err error, c ErrorCategory) bool {
+	var ee *ExecError
+	return errors.As(err, &ee) && ee.Has(c)
+}
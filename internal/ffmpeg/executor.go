@@ -1,4 +1,4 @@
-// executor.go runs ffmpeg subprocesses with stderr capture and optional FPS display.
+// executor.go runs ffmpeg subprocesses with stderr capture, optional FPS display, and -progress reporting.
 package ffmpeg
 
 import (
@@ -23,22 +23,63 @@ type ExecResult struct {
 // a mock that inspects arguments and returns controlled results.
 type RunFunc func(ctx context.Context, args []string) ExecResult
 
+// stderrTeeKey is the context key for WithStderrTee.
+type stderrTeeKey struct{}
+
+// WithStderrTee returns a context under which a RunFunc from NewRunFunc also
+// copies ffmpeg stderr to w as it is produced, e.g. to parse live progress.
+// The full stderr is still captured in ExecResult.
+func WithStderrTee(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, stderrTeeKey{}, w)
+}
+
 // NewRunFunc returns a RunFunc that spawns a real OS process. When
 // showOutput is true, stderr is tee'd to os.Stderr in real time for
 // verbose/FPS display; otherwise it is captured silently for retry
-// classification.
+// classification. A writer attached with WithStderrTee receives it too.
+// Under a progress context bound by Execute (see WithProgress), ffmpeg's
+// -progress output is read from a pipe on fd 3.
 func NewRunFunc(showOutput bool) RunFunc {
 	return func(ctx context.Context, args []string) ExecResult {
 		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 
 		var stderrBuf bytes.Buffer
+		writers := []io.Writer{&stderrBuf}
 		if showOutput {
-			cmd.Stderr = io.MultiWriter(&stderrBuf, os.Stderr)
-		} else {
-			cmd.Stderr = &stderrBuf
+			writers = append(writers, os.Stderr)
+		}
+		if tee, ok := ctx.Value(stderrTeeKey{}).(io.Writer); ok && tee != nil {
+			writers = append(writers, tee)
 		}
+		cmd.Stderr = io.MultiWriter(writers...)
 
-		err := cmd.Run()
+		sink := boundProgress(ctx)
+		if sink == nil {
+			err := cmd.Run()
+			return ExecResult{
+				Stderr: stderrBuf.String(),
+				Err:    err,
+			}
+		}
+
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return ExecResult{Err: err}
+		}
+		defer pr.Close()
+		cmd.ExtraFiles = []*os.File{pw} // fd 3 (progressFD) in the child.
+		if err := cmd.Start(); err != nil {
+			pw.Close()
+			return ExecResult{Err: err}
+		}
+		pw.Close() // The child holds its own copy; EOF follows its exit.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			readProgress(pr, sink)
+		}()
+		err = cmd.Wait()
+		<-done
 		return ExecResult{
 			Stderr: stderrBuf.String(),
 			Err:    err,
@@ -48,8 +89,43 @@ func NewRunFunc(showOutput bool) RunFunc {
 
 // Execute builds and runs the ffmpeg command for a file. The run parameter
 // controls how the subprocess is launched — production callers pass a RunFunc
-// from NewRunFunc; tests pass a mock.
-func Execute(ctx context.Context, cfg *config.Config, plan *planner.FilePlan, rs *RetryState, run RunFunc) ExecResult {
-	args := Build(cfg, plan, rs)
-	return run(ctx, args)
+// from NewRunFunc; tests pass a mock. When ffmpeg fails, the result's Err is
+// an *ExecError carrying the classified stderr.
+//
+// VAAPI encodes hold a slot in the process-wide device limiter (see
+// [ConfigureVAAPIConcurrency]) for the duration of the run.
+//
+// Under a WithProgress context, ffmpeg also reports -progress updates, with
+// percent and ETA computed against duration (the input's length in
+// seconds; 0 = unknown). Under a WithCommandLog context, the command is
+// logged first.
+func Execute(ctx context.Context, cfg *config.Config, plan *planner.FilePlan, rs *RetryState, duration float64, run RunFunc) ExecResult {
+	return execute(ctx, cfg, plan, Build(cfg, plan, rs), duration, run)
+}
+
+// ExecuteFirstPass runs the analysis pass of a two-pass plan (see
+// BuildFirstPass) once, like Execute. The retry state machine does not
+// apply: its fixes concern the muxed output, which this pass does not
+// write, so callers fail the file when it fails.
+func ExecuteFirstPass(ctx context.Context, cfg *config.Config, plan *planner.FilePlan, rs *RetryState, duration float64, run RunFunc) ExecResult {
+	return execute(ctx, cfg, plan, BuildFirstPass(cfg, plan, rs), duration, run)
+}
+
+// execute runs args for plan under the command logging, progress, and
+// VAAPI device handling described on Execute.
+func execute(ctx context.Context, cfg *config.Config, plan *planner.FilePlan, args []string, duration float64, run RunFunc) ExecResult {
+	logCommand(ctx, args)
+	ctx, args = withProgressParser(ctx, args, duration)
+	if usesVAAPIDevice(cfg, plan) {
+		lim := currentVAAPILimiter()
+		if err := lim.Acquire(ctx); err != nil {
+			return ExecResult{Err: err}
+		}
+		defer lim.Release()
+	}
+	res := run(ctx, args)
+	if res.Err != nil {
+		res.Err = NewExecError(res.Err, res.Stderr)
+	}
+	return res
 }
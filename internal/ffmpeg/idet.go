@@ -0,0 +1,117 @@
+// idet.go runs a short idet sampling pass and classifies the source as
+// progressive, interlaced, or telecined (--detect-interlace).
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// IdetSampleFrames is how many frames the idet pass analyzes. A few
+// hundred frames cover many 3:2 pulldown cycles while keeping the pass
+// to a few seconds of decode.
+const IdetSampleFrames = 500
+
+// IdetStats holds the summary counters idet prints when the pass ends.
+// TFF/BFF/Progressive are from the multi-frame detector, which is more
+// stable than the single-frame one; the Repeated* counters come from the
+// repeated-field detector that exposes hard telecine.
+type IdetStats struct {
+	TFF, BFF, Progressive, Undetermined int
+	RepeatedNeither, RepeatedTop        int
+	RepeatedBottom                      int
+}
+
+var (
+	reIdetMulti    = regexp.MustCompile(`Multi frame detection:\s*TFF:\s*(\d+)\s*BFF:\s*(\d+)\s*Progressive:\s*(\d+)\s*Undetermined:\s*(\d+)`)
+	reIdetRepeated = regexp.MustCompile(`Repeated Fields:\s*Neither:\s*(\d+)\s*Top:\s*(\d+)\s*Bottom:\s*(\d+)`)
+)
+
+// IdetArgs returns the ffmpeg (bin) command that runs idet over
+// IdetSampleFrames frames of the primary video starting at startSec,
+// discarding output.
+func IdetArgs(bin, input string, startSec float64) []string {
+	return []string{
+		bin, "-hide_banner", "-nostdin",
+		"-ss", strconv.FormatFloat(startSec, 'f', -1, 64), "-i", input,
+		"-map", "0:v:0", "-vf", "idet",
+		"-frames:v", strconv.Itoa(IdetSampleFrames),
+		"-an", "-sn", "-dn", "-f", "null", "-",
+	}
+}
+
+// ParseIdet extracts the idet summary from ffmpeg stderr. Returns false
+// when the multi-frame line is missing (e.g. ffmpeg failed to decode).
+func ParseIdet(stderr string) (IdetStats, bool) {
+	var st IdetStats
+	m := reIdetMulti.FindAllStringSubmatch(stderr, -1)
+	if len(m) == 0 {
+		return st, false
+	}
+	last := m[len(m)-1]
+	st.TFF, _ = strconv.Atoi(last[1])
+	st.BFF, _ = strconv.Atoi(last[2])
+	st.Progressive, _ = strconv.Atoi(last[3])
+	st.Undetermined, _ = strconv.Atoi(last[4])
+
+	if r := reIdetRepeated.FindAllStringSubmatch(stderr, -1); len(r) > 0 {
+		last := r[len(r)-1]
+		st.RepeatedNeither, _ = strconv.Atoi(last[1])
+		st.RepeatedTop, _ = strconv.Atoi(last[2])
+		st.RepeatedBottom, _ = strconv.Atoi(last[3])
+	}
+	return st, true
+}
+
+// Classify maps idet counters to a scan type:
+//
+//   - under 10% interlaced frames → progressive
+//   - at least 15% repeated fields and not overwhelmingly interlaced →
+//     telecined (3:2 pulldown repeats a field in 2 of every 5 frames)
+//   - otherwise → interlaced
+//
+// Returns ScanUnknown when idet could not decide on any frame.
+func (s IdetStats) Classify() probe.ScanType {
+	interlaced := s.TFF + s.BFF
+	decided := interlaced + s.Progressive
+	if decided == 0 {
+		return probe.ScanUnknown
+	}
+	interlacedFrac := float64(interlaced) / float64(decided)
+
+	var repeatedFrac float64
+	if fields := s.RepeatedNeither + s.RepeatedTop + s.RepeatedBottom; fields > 0 {
+		repeatedFrac = float64(s.RepeatedTop+s.RepeatedBottom) / float64(fields)
+	}
+
+	switch {
+	case interlacedFrac < 0.10:
+		return probe.ScanProgressive
+	case repeatedFrac >= 0.15 && interlacedFrac < 0.80:
+		return probe.ScanTelecined
+	default:
+		return probe.ScanInterlaced
+	}
+}
+
+// DetectScanType runs the idet pass on input from startSec and returns the
+// classified scan type. Returns an error including stderr when ffmpeg
+// fails or prints no idet summary.
+func DetectScanType(ctx context.Context, bin, input string, startSec float64, run RunFunc) (probe.ScanType, error) {
+	res := run(ctx, IdetArgs(bin, input, startSec))
+	if res.Err != nil {
+		if res.Stderr != "" {
+			return probe.ScanUnknown, fmt.Errorf("idet: %w: %s", res.Err, res.Stderr)
+		}
+		return probe.ScanUnknown, fmt.Errorf("idet: %w", res.Err)
+	}
+	st, ok := ParseIdet(res.Stderr)
+	if !ok {
+		return probe.ScanUnknown, fmt.Errorf("idet: no detection summary in ffmpeg output")
+	}
+	return st.Classify(), nil
+}
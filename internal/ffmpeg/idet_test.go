@@ -0,0 +1,68 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// idetStderr returns canned ffmpeg stderr ending in an idet summary block.
+func idetStderr(neither, top, bottom, tff, bff, prog, undet int) string {
+	return "Input #0, matroska,webm, from 'in.mkv':\n" +
+		"frame=  500 fps=250 q=-0.0 Lsize=N/A time=00:00:20.85 bitrate=N/A speed=10.4x\n" +
+		fmt.Sprintf("[Parsed_idet_0 @ 0x55d0c8a3b2c0] Repeated Fields: Neither: %5d Top: %5d Bottom: %5d\n", neither, top, bottom) +
+		"[Parsed_idet_0 @ 0x55d0c8a3b2c0] Single frame detection: TFF:    90 BFF:     0 Progressive:   300 Undetermined:   111\n" +
+		fmt.Sprintf("[Parsed_idet_0 @ 0x55d0c8a3b2c0] Multi frame detection: TFF: %5d BFF: %5d Progressive: %5d Undetermined: %5d\n", tff, bff, prog, undet)
+}
+
+func TestParseIdet(t *testing.T) {
+	st, ok := ParseIdet(idetStderr(301, 100, 100, 198, 0, 296, 7))
+	if !ok {
+		t.Fatal("expected idet summary to parse")
+	}
+	want := IdetStats{TFF: 198, Progressive: 296, Undetermined: 7, RepeatedNeither: 301, RepeatedTop: 100, RepeatedBottom: 100}
+	if st != want {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
+	if _, ok := ParseIdet("Error opening input file in.mkv"); ok {
+		t.Error("expected no stats for stderr without an idet summary")
+	}
+}
+
+func TestIdetClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   probe.ScanType
+	}{
+		{"progressive", idetStderr(498, 1, 1, 3, 0, 490, 7), probe.ScanProgressive},
+		{"interlaced", idetStderr(495, 2, 3, 0, 470, 12, 18), probe.ScanInterlaced},
+		{"telecined 3:2", idetStderr(301, 100, 100, 198, 0, 296, 6), probe.ScanTelecined},
+		{"undecided", idetStderr(0, 0, 0, 0, 0, 0, 500), probe.ScanUnknown},
+	}
+	for _, tt := range tests {
+		st, _ := ParseIdet(tt.stderr)
+		if got := st.Classify(); got != tt.want {
+			t.Errorf("%s: Classify() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectScanType(t *testing.T) {
+	var got []string
+	run := RunFunc(func(_ context.Context, args []string) ExecResult {
+		got = args
+		return ExecResult{Stderr: idetStderr(301, 100, 100, 198, 0, 296, 6)}
+	})
+	scan, err := DetectScanType(context.Background(), "ffmpeg", "/in/a.mkv", 300, run)
+	if err != nil || scan != probe.ScanTelecined {
+		t.Fatalf("got %q, %v; want telecined", scan, err)
+	}
+	joined := strings.Join(got, " ")
+	if !strings.Contains(joined, "-ss 300 -i /in/a.mkv -map 0:v:0 -vf idet -frames:v 500") {
+		t.Errorf("unexpected idet args: %s", joined)
+	}
+}
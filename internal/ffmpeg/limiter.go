@@ -0,0 +1,67 @@
+// limiter.go bounds concurrent VAAPI device sessions across the process.
+package ffmpeg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+)
+
+// DeviceLimiter is a counting semaphore that caps how many ffmpeg processes
+// may hold the VAAPI device at once. Concurrent VAAPI initialisation can
+// thrash the driver, while CPU encodes and remuxes do not touch the device
+// and are never gated.
+type DeviceLimiter struct {
+	slots chan struct{}
+}
+
+// NewDeviceLimiter returns a limiter allowing n concurrent holders (min 1).
+func NewDeviceLimiter(n int) *DeviceLimiter {
+	if n < 1 {
+		n = 1
+	}
+	return &DeviceLimiter{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free or ctx is cancelled.
+func (l *DeviceLimiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot obtained by Acquire.
+func (l *DeviceLimiter) Release() {
+	<-l.slots
+}
+
+var (
+	vaapiMu      sync.Mutex
+	vaapiLimiter = NewDeviceLimiter(1)
+)
+
+// ConfigureVAAPIConcurrency sets the process-wide VAAPI session limit. Call
+// once during startup, before any Execute calls are in flight.
+func ConfigureVAAPIConcurrency(n int) {
+	vaapiMu.Lock()
+	defer vaapiMu.Unlock()
+	vaapiLimiter = NewDeviceLimiter(n)
+}
+
+// currentVAAPILimiter returns the limiter configured by ConfigureVAAPIConcurrency.
+func currentVAAPILimiter() *DeviceLimiter {
+	vaapiMu.Lock()
+	defer vaapiMu.Unlock()
+	return vaapiLimiter
+}
+
+// usesVAAPIDevice reports whether a plan's ffmpeg run opens the VAAPI device.
+// Only the encode path initialises the device; remuxes copy video.
+func usesVAAPIDevice(cfg *config.Config, plan *planner.FilePlan) bool {
+	return plan.Action == planner.ActionEncode && cfg.Encoder.Mode == config.EncoderVAAPI
+}
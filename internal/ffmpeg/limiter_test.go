@@ -0,0 +1,76 @@
+package ffmpeg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+)
+
+// maxConcurrentRuns executes n plans in parallel through Execute and returns
+// the peak number of simultaneously running mock ffmpeg processes.
+func maxConcurrentRuns(t *testing.T, cfg *config.Config, action planner.Action, n int) int32 {
+	t.Helper()
+	var active, peak int32
+	run := RunFunc(func(_ context.Context, _ []string) ExecResult {
+		cur := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return ExecResult{}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plan := &planner.FilePlan{Action: action, MuxQueueSize: 4096}
+			Execute(context.Background(), cfg, plan, NewRetryState(plan), 0, run)
+		}()
+	}
+	wg.Wait()
+	return peak
+}
+
+func TestExecute_VAAPIConcurrencyBounded(t *testing.T) {
+	ConfigureVAAPIConcurrency(2)
+	defer ConfigureVAAPIConcurrency(1)
+
+	if peak := maxConcurrentRuns(t, vaapiCfg(), planner.ActionEncode, 6); peak > 2 {
+		t.Errorf("VAAPI encodes: peak concurrency %d, want <= 2", peak)
+	}
+}
+
+func TestExecute_CPUAndRemuxNotGated(t *testing.T) {
+	ConfigureVAAPIConcurrency(1)
+
+	if peak := maxConcurrentRuns(t, cpuCfg(), planner.ActionEncode, 4); peak < 2 {
+		t.Errorf("CPU encodes should run in parallel, peak %d", peak)
+	}
+	if peak := maxConcurrentRuns(t, vaapiCfg(), planner.ActionRemux, 4); peak < 2 {
+		t.Errorf("remuxes should run in parallel, peak %d", peak)
+	}
+}
+
+func TestDeviceLimiter_AcquireHonorsContext(t *testing.T) {
+	lim := NewDeviceLimiter(1)
+	if err := lim.Acquire(context.Background()); err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lim.Acquire(ctx); err == nil {
+		t.Error("Acquire on a full limiter with cancelled ctx should fail")
+	}
+	lim.Release()
+}
@@ -0,0 +1,133 @@
+// progress.go parses ffmpeg's -progress key=value output into percent and ETA updates.
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progressFD is the file descriptor ffmpeg writes -progress output to. It
+// is the first of exec.Cmd.ExtraFiles, so the key=value lines stay out of
+// the stderr that retry classification and the FPS display read.
+const progressFD = 3
+
+// Progress is one ffmpeg -progress update.
+type Progress struct {
+	Seconds float64       // Output media time reached.
+	Frame   int64         // Frames written.
+	Speed   float64       // Processing speed as a multiple of realtime (0 = unknown).
+	Percent int           // Of the input duration, 0-100; -1 when the duration is unknown.
+	ETA     time.Duration // Remaining time at the current speed; 0 when unknown.
+	Done    bool          // ffmpeg reported progress=end.
+}
+
+// ProgressParser accumulates -progress key=value lines into Progress
+// updates for an input of the given duration (seconds; 0 = unknown).
+type ProgressParser struct {
+	duration float64
+	cur      Progress
+}
+
+// NewProgressParser returns a parser for an input of duration seconds.
+func NewProgressParser(duration float64) *ProgressParser {
+	return &ProgressParser{duration: duration}
+}
+
+// ParseLine consumes one -progress line. ffmpeg writes a block of keys per
+// update, ending with progress=continue (or progress=end); the completed
+// update is returned with ok=true on that line. Unknown keys and malformed
+// values are ignored.
+func (p *ProgressParser) ParseLine(line string) (Progress, bool) {
+	key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+	if !found {
+		return Progress{}, false
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "frame":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			p.cur.Frame = n
+		}
+	case "out_time_us", "out_time_ms":
+		// Both are microseconds: out_time_ms is misnamed in ffmpeg.
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			p.cur.Seconds = float64(us) / 1e6
+		}
+	case "speed":
+		if x, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			p.cur.Speed = x
+		}
+	case "progress":
+		p.cur.Done = value == "end"
+		return p.snapshot(), true
+	}
+	return Progress{}, false
+}
+
+// snapshot fills in the derived percent and ETA.
+func (p *ProgressParser) snapshot() Progress {
+	out := p.cur
+	out.Percent = -1
+	if p.duration > 0 {
+		out.Percent = int(math.Min(100, math.Floor(out.Seconds*100/p.duration)))
+		if out.Speed > 0 && out.Seconds < p.duration {
+			out.ETA = time.Duration((p.duration - out.Seconds) / out.Speed * float64(time.Second)).Round(time.Second)
+		}
+	}
+	if out.Done {
+		out.Percent, out.ETA = 100, 0
+	}
+	return out
+}
+
+// progressKey is the context key for WithProgress.
+type progressKey struct{}
+
+// progressSink is what WithProgress attaches; Execute adds the parser.
+type progressSink struct {
+	fn     func(Progress)
+	parser *ProgressParser
+}
+
+// WithProgress returns a context under which Execute asks ffmpeg for
+// -progress output and a RunFunc from NewRunFunc passes each update to fn.
+// fn runs on a reader goroutine while ffmpeg is running; all calls finish
+// before the RunFunc returns.
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressSink{fn: fn})
+}
+
+// withProgressParser binds a parser for the current input to the sink in
+// ctx, if any, and returns the ffmpeg arguments requesting -progress output.
+func withProgressParser(ctx context.Context, args []string, duration float64) (context.Context, []string) {
+	sink, ok := ctx.Value(progressKey{}).(*progressSink)
+	if !ok || sink.fn == nil || len(args) == 0 {
+		return ctx, args
+	}
+	bound := &progressSink{fn: sink.fn, parser: NewProgressParser(duration)}
+	withArgs := append([]string{args[0], "-progress", "pipe:" + strconv.Itoa(progressFD)}, args[1:]...)
+	return context.WithValue(ctx, progressKey{}, bound), withArgs
+}
+
+// boundProgress returns the sink bound by Execute, or nil.
+func boundProgress(ctx context.Context) *progressSink {
+	if sink, ok := ctx.Value(progressKey{}).(*progressSink); ok && sink.parser != nil {
+		return sink
+	}
+	return nil
+}
+
+// readProgress feeds -progress lines from r to sink until EOF.
+func readProgress(r io.Reader, sink *progressSink) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if p, ok := sink.parser.ParseLine(sc.Text()); ok {
+			sink.fn(p)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ffmpeg
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// progressBlock is one ffmpeg -progress update as written to the pipe.
+const progressBlock = `frame=1200
+fps=48.00
+stream_0_0_q=28.0
+bitrate=2048.0kbits/s
+total_size=12800000
+out_time_us=50000000
+out_time_ms=50000000
+out_time=00:00:50.000000
+dup_frames=0
+drop_frames=0
+speed=2.00x
+progress=continue`
+
+func parseBlock(p *ProgressParser, block string) (got []Progress) {
+	for _, line := range strings.Split(block, "\n") {
+		if u, ok := p.ParseLine(line); ok {
+			got = append(got, u)
+		}
+	}
+	return got
+}
+
+func TestProgressParser_Block(t *testing.T) {
+	got := parseBlock(NewProgressParser(200), progressBlock)
+	if len(got) != 1 {
+		t.Fatalf("got %d updates, want 1 per block", len(got))
+	}
+	want := Progress{Seconds: 50, Frame: 1200, Speed: 2, Percent: 25, ETA: 75 * time.Second}
+	if got[0] != want {
+		t.Errorf("got %+v, want %+v", got[0], want)
+	}
+}
+
+func TestProgressParser_End(t *testing.T) {
+	p := NewProgressParser(200)
+	parseBlock(p, progressBlock)
+	got := parseBlock(p, "frame=4800\nout_time_ms=199960000\nspeed=2.1x\nprogress=end")
+	if len(got) != 1 || !got[0].Done || got[0].Percent != 100 || got[0].ETA != 0 {
+		t.Errorf("end update: got %+v", got)
+	}
+}
+
+func TestProgressParser_UnknownDurationAndJunk(t *testing.T) {
+	p := NewProgressParser(0)
+	got := parseBlock(p, "garbage\nframe=abc\nout_time_us=N/A\nspeed=N/A\nout_time_us=3000000\nprogress=continue")
+	if len(got) != 1 {
+		t.Fatalf("got %d updates, want 1", len(got))
+	}
+	if got[0].Percent != -1 || got[0].ETA != 0 || got[0].Seconds != 3 || got[0].Speed != 0 {
+		t.Errorf("got %+v, want seconds 3 with unknown percent, speed, and ETA", got[0])
+	}
+}
+
+func TestWithProgressParser_Args(t *testing.T) {
+	args := []string{"ffmpeg", "-i", "in.mkv", "out.mkv"}
+	if _, got := withProgressParser(context.Background(), args, 60); !slices.Equal(got, args) {
+		t.Errorf("without WithProgress: args changed to %q", got)
+	}
+
+	ctx := WithProgress(context.Background(), func(Progress) {})
+	ctx, got := withProgressParser(ctx, args, 60)
+	want := []string{"ffmpeg", "-progress", "pipe:3", "-i", "in.mkv", "out.mkv"}
+	if !slices.Equal(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	if sink := boundProgress(ctx); sink == nil || sink.parser.duration != 60 {
+		t.Errorf("expected a parser bound for a 60s input, got %+v", sink)
+	}
+}
@@ -1,7 +1,11 @@
 // retry.go implements the retry state machine for recoverable ffmpeg failures.
 package ffmpeg
 
-import "github.com/backmassage/muxmaster/internal/planner"
+import (
+	"errors"
+
+	"github.com/backmassage/muxmaster/internal/planner"
+)
 
 // RetryAction identifies which fix was applied (or none).
 type RetryAction int
@@ -10,6 +14,7 @@ const (
 	RetryNone          RetryAction = iota
 	RetryDropAttach                // Remove attachment streams.
 	RetryDropSubs                  // Remove subtitle streams.
+	RetrySubCodec                  // Switch subtitles to the plan's RetryCodec.
 	RetryIncreaseMux               // Raise max_muxing_queue_size to 16384.
 	RetryFixTimestamps             // Enable +genpts+discardcorrupt.
 )
@@ -31,6 +36,12 @@ type RetryState struct {
 	MuxQueueSize  int
 	TimestampFix  bool
 
+	// Two-stage subtitle retry (--retry-subtitle-transcode): SubRetryCodec
+	// is tried first, then subtitles are dropped. SubCodec is the -c:s
+	// override once switched; "" = the plan's codec.
+	SubRetryCodec string
+	SubCodec      string
+
 	VaapiQP int
 	CpuCRF  int
 }
@@ -42,6 +53,7 @@ func NewRetryState(plan *planner.FilePlan) *RetryState {
 		MaxAttempts:   maxAttempts,
 		IncludeAttach: plan.IncludeAttach,
 		IncludeSubs:   plan.IncludeSubs,
+		SubRetryCodec: plan.Subtitles.RetryCodec,
 		MuxQueueSize:  plan.MuxQueueSize,
 		TimestampFix:  plan.TimestampFix,
 		VaapiQP:       plan.VaapiQP,
@@ -55,26 +67,47 @@ func NewRetryState(plan *planner.FilePlan) *RetryState {
 // or the attempt limit is reached.
 //
 // Pattern evaluation order: attachment → subtitle → mux queue → timestamp.
-// Only one fix is applied per call (one fix per retry attempt).
+// Only one fix is applied per call (one fix per retry attempt). A subtitle
+// failure first switches the subtitle codec when SubRetryCodec is set, and
+// drops subtitles only if that fails too.
 func (s *RetryState) Advance(stderr string) RetryAction {
+	return s.advance(&ExecError{Categories: ClassifyError(stderr)})
+}
+
+// AdvanceError is Advance for an error returned by Execute: it reuses the
+// *ExecError's categories instead of classifying stderr again. Errors that
+// are not an *ExecError count as an attempt with no applicable fix.
+func (s *RetryState) AdvanceError(err error) RetryAction {
+	var ee *ExecError
+	if !errors.As(err, &ee) {
+		ee = &ExecError{}
+	}
+	return s.advance(ee)
+}
+
+func (s *RetryState) advance(ee *ExecError) RetryAction {
 	s.Attempt++
 	if s.Attempt >= s.MaxAttempts {
 		return RetryNone
 	}
 
-	if s.IncludeAttach && MatchAttachmentIssue(stderr) {
+	if s.IncludeAttach && ee.Has(CategoryAttachment) {
 		s.IncludeAttach = false
 		return RetryDropAttach
 	}
-	if s.IncludeSubs && MatchSubtitleIssue(stderr) {
+	if s.IncludeSubs && ee.Has(CategorySubtitle) {
+		if s.SubRetryCodec != "" && s.SubCodec == "" {
+			s.SubCodec = s.SubRetryCodec
+			return RetrySubCodec
+		}
 		s.IncludeSubs = false
 		return RetryDropSubs
 	}
-	if s.MuxQueueSize < muxQueueEscalate && MatchMuxQueueOverflow(stderr) {
+	if s.MuxQueueSize < muxQueueEscalate && ee.Has(CategoryMuxQueue) {
 		s.MuxQueueSize = muxQueueEscalate
 		return RetryIncreaseMux
 	}
-	if !s.TimestampFix && MatchTimestampIssue(stderr) {
+	if !s.TimestampFix && ee.Has(CategoryTimestamp) {
 		s.TimestampFix = true
 		return RetryFixTimestamps
 	}
@@ -1,8 +1,12 @@
 package ffmpeg
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/planner"
 )
 
@@ -62,6 +66,36 @@ func TestAdvance_DropSubs(t *testing.T) {
 	}
 }
 
+func TestAdvance_SubCodecThenDropSubs(t *testing.T) {
+	cfg := vaapiCfg()
+	plan := testPlan()
+	plan.IncludeAttach = false
+	plan.InputPath, plan.OutputPath = "/in/a.mkv", "/out/a.mkv"
+	plan.Subtitles = planner.SubtitlePlan{Include: true, Codec: "copy", RetryCodec: "srt"}
+	rs := NewRetryState(plan)
+	const stderr = "Subtitle codec 94213 is not supported."
+
+	if action := rs.Advance(stderr); action != RetrySubCodec {
+		t.Fatalf("first subtitle failure: expected RetrySubCodec, got %d", action)
+	}
+	if !rs.IncludeSubs || rs.SubCodec != "srt" {
+		t.Errorf("after switch: IncludeSubs=%v SubCodec=%q, want true and srt", rs.IncludeSubs, rs.SubCodec)
+	}
+	if joined := strings.Join(Build(cfg, plan, rs), " "); !strings.Contains(joined, "-c:s srt") || strings.Contains(joined, "-c:s copy") {
+		t.Errorf("switched codec not used: %s", joined)
+	}
+
+	if action := rs.Advance(stderr); action != RetryDropSubs {
+		t.Fatalf("second subtitle failure: expected RetryDropSubs, got %d", action)
+	}
+	if rs.IncludeSubs {
+		t.Error("IncludeSubs should be false after the second failure")
+	}
+	if joined := strings.Join(Build(cfg, plan, rs), " "); strings.Contains(joined, "-c:s") {
+		t.Errorf("subtitle codec after drop: %s", joined)
+	}
+}
+
 func TestAdvance_RespectsMaxAttempts(t *testing.T) {
 	rs := NewRetryState(testPlan())
 	for i := 0; i < maxAttempts; i++ {
@@ -85,3 +119,109 @@ func TestAdvance_MuxQueueEscalation(t *testing.T) {
 		t.Errorf("MuxQueueSize: got %d, want %d", rs.MuxQueueSize, muxQueueEscalate)
 	}
 }
+
+func TestMatchTooManyOpenFiles(t *testing.T) {
+	cases := []struct {
+		stderr string
+		want   bool
+	}{
+		{"/out/a.mkv: Too many open files", true},
+		{"Error opening input: too many open files", true},
+		{"Too many packets buffered for output stream #0:1", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if got := MatchTooManyOpenFiles(tc.stderr); got != tc.want {
+			t.Errorf("MatchTooManyOpenFiles(%q) = %v, want %v", tc.stderr, got, tc.want)
+		}
+	}
+}
+
+func TestAdvance_TooManyOpenFilesNotRetried(t *testing.T) {
+	rs := NewRetryState(testPlan())
+	if action := rs.Advance("Too many open files"); action != RetryNone {
+		t.Errorf("fd exhaustion is handled by the scheduler, got action %d", action)
+	}
+}
+
+func TestMatchOutputTransient(t *testing.T) {
+	cases := []struct {
+		stderr string
+		want   bool
+	}{
+		{"[matroska @ 0x55d] Error writing packet: Stale file handle", true},
+		{"av_interleaved_write_frame(): Transport endpoint is not connected", true},
+		{"/mnt/nas/out.mkv: No such file or directory", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		if got := MatchOutputTransient(tc.stderr); got != tc.want {
+			t.Errorf("MatchOutputTransient(%q) = %v, want %v", tc.stderr, got, tc.want)
+		}
+	}
+}
+
+func TestAdvance_OutputTransientNotRetried(t *testing.T) {
+	rs := NewRetryState(testPlan())
+	if action := rs.Advance("Error writing trailer: Stale file handle"); action != RetryNone {
+		t.Errorf("output-share errors are retried by the pipeline, got action %d", action)
+	}
+}
+
+func TestExecute_ReturnsCategorizedError(t *testing.T) {
+	cases := []struct {
+		stderr string
+		want   ErrorCategory
+	}{
+		{"Attachment stream 3 has no mimetype tag", CategoryAttachment},
+		{"Subtitle codec mov_text is not supported", CategorySubtitle},
+		{"Too many packets buffered for output stream #0:1", CategoryMuxQueue},
+		{"Non-monotonous DTS in output stream 0:1", CategoryTimestamp},
+		{"[mp4 @ 0x55d] Could not find tag for codec hevc in stream #0, codec not currently supported in container", CategoryRemuxIncompatible},
+		{"/out/a.mkv: Too many open files", CategoryTooManyOpenFiles},
+		{"av_interleaved_write_frame(): Stale file handle", CategoryOutputTransient},
+		{"Conversion failed!", CategoryUnknown},
+	}
+	plan := testPlan()
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	for _, tc := range cases {
+		exit := errors.New("exit status 1")
+		run := RunFunc(func(context.Context, []string) ExecResult {
+			return ExecResult{Stderr: tc.stderr, Err: exit}
+		})
+		res := Execute(context.Background(), &cfg, plan, NewRetryState(plan), 0, run)
+
+		var ee *ExecError
+		if !errors.As(res.Err, &ee) {
+			t.Fatalf("%q: Err is %T, want *ExecError", tc.stderr, res.Err)
+		}
+		if ee.Category() != tc.want {
+			t.Errorf("%q: category %s, want %s", tc.stderr, ee.Category(), tc.want)
+		}
+		if !errors.Is(res.Err, exit) || ee.Stderr != tc.stderr {
+			t.Errorf("%q: ExecError should wrap the process error and keep stderr", tc.stderr)
+		}
+		if tc.want != CategoryUnknown && !HasCategory(res.Err, tc.want) {
+			t.Errorf("%q: HasCategory(%s) = false", tc.stderr, tc.want)
+		}
+	}
+
+	if res := Execute(context.Background(), &cfg, plan, NewRetryState(plan), 0, RunFunc(func(context.Context, []string) ExecResult {
+		return ExecResult{}
+	})); res.Err != nil {
+		t.Errorf("success should have nil Err, got %v", res.Err)
+	}
+}
+
+func TestAdvanceError_UsesCategories(t *testing.T) {
+	rs := NewRetryState(testPlan())
+	rs.IncludeSubs = true
+	err := NewExecError(errors.New("exit status 1"), "Subtitle codec mov_text is not supported")
+	if action := rs.AdvanceError(err); action != RetryDropSubs || rs.IncludeSubs {
+		t.Errorf("got action %d (IncludeSubs=%v), want RetryDropSubs", action, rs.IncludeSubs)
+	}
+	if action := rs.AdvanceError(errors.New("signal: killed")); action != RetryNone {
+		t.Errorf("non-ExecError should not trigger a fix, got %d", action)
+	}
+}
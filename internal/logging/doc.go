@@ -3,5 +3,5 @@
 // and optionally appends plain-text logs to a file.
 //
 // Files:
-//   - logger.go:      NewLogger, Logger methods (Info, Warn, Error, Success, Debug, Outlier)
+//   - logger.go:      NewLogger, Logger methods (Info, Warn, Error, Success, Debug, Outlier, Write)
 package logging
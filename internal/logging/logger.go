@@ -19,19 +19,27 @@ var reANSI = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
 // Logger writes leveled messages to stdout/stderr and optionally to a log
 // file. All write operations are serialized under a mutex for safe
-// concurrent use.
+// concurrent use. The file sink never receives ANSI escapes, whatever the
+// color mode: term colors only ever apply to the terminal writers.
 type Logger struct {
-	mu   sync.Mutex
-	file *os.File
+	mu     sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	file   io.WriteCloser
 }
 
 // NewLogger initializes terminal colors via [term.Configure] and opens a
-// log file if cfg.Display.LogFile is set. The caller must call [Logger.Close] when
+// log file if cfg.Display.LogFile is set. With --summary-json every level
+// goes to stderr. The caller must call [Logger.Close] when
 // finished.
 func NewLogger(cfg *config.Config) (*Logger, error) {
 	term.Configure(cfg.Display.ColorMode)
 
-	l := &Logger{}
+	l := &Logger{stdout: os.Stdout, stderr: os.Stderr}
+	if cfg.Display.SummaryJSON {
+		// stdout is reserved for the --summary-json object.
+		l.stdout = os.Stderr
+	}
 	if cfg.Display.LogFile != "" {
 		dir := filepath.Dir(cfg.Display.LogFile)
 		if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -69,9 +77,9 @@ func (l *Logger) line(level, ansiColor, text string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	out := os.Stdout
+	out := l.stdout
 	if level == "ERROR" {
-		out = os.Stderr
+		out = l.stderr
 	}
 
 	if ansiColor != "" {
@@ -127,8 +135,22 @@ func (l *Logger) Debug(verbose bool, format string, args ...interface{}) {
 func (l *Logger) Blank() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	_, _ = io.WriteString(os.Stdout, "\n")
+	_, _ = io.WriteString(l.stdout, "\n")
 	if l.file != nil {
 		_, _ = io.WriteString(l.file, "\n")
 	}
 }
+
+// Write passes p to stdout unchanged and appends it to the log file with
+// ANSI escapes stripped, so pre-rendered output such as the banner follows
+// the same terminal/file separation as leveled lines. It implements
+// io.Writer and always reports the full length written.
+func (l *Logger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.stdout.Write(p)
+	if l.file != nil {
+		_, _ = l.file.Write(reANSI.ReplaceAll(p, nil))
+	}
+	return len(p), nil
+}
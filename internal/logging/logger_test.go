@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/display"
+	"github.com/backmassage/muxmaster/internal/term"
+)
+
+func TestNewLogger_SummaryJSONKeepsStdoutFree(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Display.SummaryJSON = true
+	l, err := NewLogger(&cfg)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	defer l.Close()
+	if l.stdout != os.Stderr || l.stderr != os.Stderr {
+		t.Error("--summary-json: all log output should go to stderr")
+	}
+}
+
+func TestLogger_FileSinkANSIFreeUnderColorAlways(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Display.ColorMode = config.ColorAlways
+	cfg.Display.LogFile = filepath.Join(t.TempDir(), "logs", "run.log")
+	defer term.Configure(config.ColorNever)
+
+	l, err := NewLogger(&cfg)
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	l.stdout, l.stderr = &stdout, &stderr
+
+	display.PrintBanner(l)
+	l.Info("[1/2] %sShow - S01E01.mkv%s", term.Cyan, term.NC)
+	l.Error("Encode failed")
+	l.Blank()
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if !strings.Contains(stdout.String(), "\x1b[") || !strings.Contains(stderr.String(), "\x1b[") {
+		t.Errorf("terminal sinks should be colored under --color always:\nstdout=%q\nstderr=%q", stdout.String(), stderr.String())
+	}
+
+	data, err := os.ReadFile(cfg.Display.LogFile)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	file := string(data)
+	if strings.Contains(file, "\x1b") {
+		t.Errorf("log file contains ANSI escapes:\n%q", file)
+	}
+	for _, want := range []string{`|_|  |_|\__,_/_/\_\_|`, "[INFO] [1/2] Show - S01E01.mkv", "[ERROR] Encode failed"} {
+		if !strings.Contains(file, want) {
+			t.Errorf("log file missing %q:\n%s", want, file)
+		}
+	}
+}
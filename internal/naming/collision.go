@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // CollisionResolver tracks output paths claimed by input files and resolves
-// duplicates by appending " - dupN" suffixes. It is used sequentially within
-// a single pipeline run — one file at a time, no concurrency.
+// duplicates by appending " - dupN" suffixes. It is safe for concurrent use
+// by --jobs workers. Which of two colliding inputs gets the plain name
+// depends on which is resolved first, so Run resolves every file in
+// discovery order before its workers start.
 type CollisionResolver struct {
-	owners   map[string]string // output path → input path that owns it
-	counters map[string]int    // base output path → next dup counter
+	mu       sync.Mutex
+	owners   map[string]string    // output path → input path that owns it
+	counters map[string]int       // base output path → next dup counter
+	resolved map[[2]string]string // {input, requested output} → path returned
 }
 
 // NewCollisionResolver creates a ready-to-use resolver.
@@ -20,13 +25,48 @@ func NewCollisionResolver() *CollisionResolver {
 	return &CollisionResolver{
 		owners:   make(map[string]string),
 		counters: make(map[string]int),
+		resolved: make(map[[2]string]string),
 	}
 }
 
 // Resolve returns the final output path for input, handling collisions.
 // If requestedOutput is unclaimed (or already owned by input), it is returned
-// as-is. Otherwise a " - dupN" variant is generated.
+// as-is. Otherwise a " - dupN" variant is generated. Resolving the same
+// input and request again returns the same path.
 func (cr *CollisionResolver) Resolve(input, requestedOutput string) string {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	key := [2]string{input, requestedOutput}
+	if out, ok := cr.resolved[key]; ok {
+		return out
+	}
+	out := cr.resolve(input, requestedOutput)
+	cr.resolved[key] = out
+	return out
+}
+
+// Release gives up input's claim on output, a path Resolve returned for
+// it, so another input can be resolved to it. Run releases the output a
+// file moves away from when it switches container. Paths input does not
+// own are left alone.
+func (cr *CollisionResolver) Release(input, output string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.owners[output] != input {
+		return
+	}
+	delete(cr.owners, output)
+	for key, out := range cr.resolved {
+		if key[0] == input && out == output {
+			delete(cr.resolved, key)
+		}
+	}
+}
+
+// resolve implements Resolve for a request not seen before.
+func (cr *CollisionResolver) resolve(input, requestedOutput string) string {
 	owner, exists := cr.owners[requestedOutput]
 	if !exists || owner == input {
 		cr.owners[requestedOutput] = input
@@ -0,0 +1,60 @@
+// convention.go defines the --naming-convention presets: the TV and movie templates each media server expects.
+package naming
+
+import "fmt"
+
+// Convention is a --naming-convention preset: the TV and movie path
+// templates a media server's library scanner matches best. The TV presets
+// spell the show as "{title} ({year})", so an episode filename carries the
+// show's year whenever one was parsed, and drops the " ()" when none was.
+type Convention string
+
+const (
+	ConventionDefault  Convention = "default"  // DefaultTVTemplate and DefaultMovieTemplate.
+	ConventionJellyfin Convention = "jellyfin" // Show (Year)/Season 01/Show (Year) - S01E01.ext
+	ConventionPlex     Convention = "plex"     // Show (Year)/Season 01/Show (Year) - s01e01.ext
+	ConventionKodi     Convention = "kodi"     // Show (Year)/Season 01/Show S01E01.ext; movies flat in the output directory.
+)
+
+// conventionTemplates holds each preset's TV and movie templates.
+var conventionTemplates = map[Convention][2]string{
+	ConventionDefault: {DefaultTVTemplate, DefaultMovieTemplate},
+	ConventionJellyfin: {
+		"{title} ({year})/Season {season:02d}/{title} ({year}) - S{season:02d}E{episode:02d}.{ext}",
+		"{title} ({year})/{title} ({year}).{ext}",
+	},
+	// Plex documents lowercase episode tags; ranges render as s01e01-e02.
+	ConventionPlex: {
+		"{title} ({year})/Season {season:02d}/{title} ({year}) - s{season:02d}e{episode:02d}.{ext}",
+		"{title} ({year})/{title} ({year}).{ext}",
+	},
+	// Kodi identifies the show from its folder ("Show (Year)") and reads
+	// only SxxEyy from episode filenames, as in its wiki's "Show S01E01"
+	// examples. Its scraper defaults to one folder of movie files ("Movies
+	// are in separate folders that match the movie title" is off).
+	ConventionKodi: {
+		"{title} ({year})/Season {season:02d}/{title} S{season:02d}E{episode:02d}.{ext}",
+		"{title} ({year}).{ext}",
+	},
+}
+
+// NewConventionLayout is NewLayout with convention c's templates standing in
+// for an empty tvTemplate or movieTemplate, so --tv-template and
+// --movie-template still override the preset. An empty c selects
+// ConventionDefault.
+func NewConventionLayout(c Convention, tvTemplate, movieTemplate string) (*Layout, error) {
+	if c == "" {
+		c = ConventionDefault
+	}
+	preset, ok := conventionTemplates[c]
+	if !ok {
+		return nil, fmt.Errorf("unknown naming convention %q (use 'default', 'jellyfin', 'plex', or 'kodi')", c)
+	}
+	if tvTemplate == "" {
+		tvTemplate = preset[0]
+	}
+	if movieTemplate == "" {
+		movieTemplate = preset[1]
+	}
+	return NewLayout(tvTemplate, movieTemplate)
+}
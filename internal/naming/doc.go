@@ -4,9 +4,10 @@
 //
 // Files:
 //   - parser.go:      ParseFilename — ordered regex rule matching
-//   - rules.go:       ParseRule definitions — 14 regex rules with priority ordering
-//   - postprocess.go: Title-casing, bracket stripping, release tag removal
-//   - outputpath.go:  GetOutputPath — Jellyfin-style directory/file naming
+//   - rules.go:       ParseRule definitions — 15 regex rules (multi-episode SxxExx ranges ahead of the 14 legacy rules) with priority ordering
+//   - postprocess.go: Title-casing, bracket stripping, release tag removal, raw-name guard, absolute numbering, episode offset
+//   - outputpath.go:  GetOutputPath, Layout — Jellyfin-style directory/file naming from path templates
+//   - convention.go:  Convention, NewConventionLayout — --naming-convention presets (jellyfin, plex, kodi)
 //   - collision.go:   CollisionResolver — deduplicates output paths with -dupN suffixes
 //   - harmonize.go:   HarmonizeShowName — normalizes TV show year variants across a batch
 package naming
@@ -1,28 +1,283 @@
-// outputpath.go generates Jellyfin-style output directories and file paths.
+// outputpath.go generates Jellyfin-style output directories and file paths from path templates.
 package naming
 
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-// GetOutputPath builds the canonical output file path for a parsed name.
-// container is the file extension without dot (e.g. "mkv", "mp4").
-//
-//	TV:    <outputDir>/<ShowName>/Season XX/<ShowName> - SXXEXX.<ext>
-//	Movie: <outputDir>/<Name (Year)>/<Name (Year)>.<ext>    (or <Name>/<Name>.<ext> if no year)
-func GetOutputPath(p ParsedName, outputDir, container string) string {
+// hlsContainer is the container name that selects HLS playlist output.
+// HLS writes a playlist plus many segment files, so each title gets its
+// own directory and the returned path is the .m3u8 playlist inside it.
+const hlsContainer = "hls"
+
+// Default path templates (--tv-template / --movie-template). They produce
+// the Jellyfin layout documented on GetOutputPath.
+const (
+	DefaultTVTemplate    = "{show}/Season {season:02d}/{show} - S{season:02d}E{episode:02d}.{ext}"
+	DefaultMovieTemplate = "{title} ({year})/{title} ({year}).{ext}"
+)
+
+// reSeasonDir matches a {season} token. reSeasonMark matches one in a
+// file name together with the letters around it, such as the "S" and "E"
+// of S{season:02d}E or the "x" of {season}x. reEpisodeToken matches an
+// {episode} token and its spec.
+var (
+	reSeasonDir    = regexp.MustCompile(`\{season(?::[^}]*)?\}`)
+	reSeasonMark   = regexp.MustCompile(`[A-Za-z]*\{season(?::[^}]*)?\}[A-Za-z]*`)
+	reEpisodeToken = regexp.MustCompile(`\{episode(?::0([1-9])d)?\}`)
+)
+
+// absoluteTVTemplate derives the template for --absolute-numbering
+// episodes, which have no season, from the TV template: directories named
+// by {season} are dropped, the season marker leaves the file name, and
+// the episode is zero-padded to at least three digits. The default
+// template gives {show}/{show} - {episode:03d}.{ext}.
+func absoluteTVTemplate(tv string) string {
+	segs := strings.Split(tv, "/")
+	kept := make([]string, 0, len(segs))
+	for _, seg := range segs[:len(segs)-1] {
+		if !reSeasonDir.MatchString(seg) {
+			kept = append(kept, seg)
+		}
+	}
+	file := reSeasonMark.ReplaceAllString(segs[len(segs)-1], "")
+	file = reEpisodeToken.ReplaceAllStringFunc(file, func(tok string) string {
+		if m := reEpisodeToken.FindStringSubmatch(tok); m[1] >= "3" {
+			return tok
+		}
+		return "{episode:03d}"
+	})
+	return strings.Join(append(kept, file), "/")
+}
+
+// templateTokens lists the tokens each media type accepts, and whether the
+// token is numeric (and so takes a :0Nd zero-padding spec).
+var templateTokens = map[MediaType]map[string]bool{
+	MediaTV:    {"show": true, "title": true, "year": true, "season": true, "episode": true, "ext": true},
+	MediaMovie: {"title": true, "year": true, "ext": true},
+}
+
+// numericTokens are the tokens rendered from integers.
+var numericTokens = map[string]bool{"season": true, "episode": true}
+
+// reTemplateToken matches {name} and {name:spec} tokens.
+var reTemplateToken = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// reZeroPad matches the only supported format spec: 0Nd, zero-padding to N digits.
+var reZeroPad = regexp.MustCompile(`^0([1-9])d$`)
+
+// reEmptyGroup matches a bracket pair left empty by an unset token, with its
+// leading whitespace, e.g. the " ()" of "{title} ({year})" without a year.
+var reEmptyGroup = regexp.MustCompile(`\s*(\(\s*\)|\[\s*\])`)
+
+// templatePart is one literal run or token of a parsed template.
+type templatePart struct {
+	literal string
+	token   string // "" for literal parts
+	width   int    // zero-pad width for numeric tokens (0 = none)
+}
+
+// pathTemplate is a parsed output path template, relative to the output
+// directory, with "/" separating directories.
+type pathTemplate []templatePart
+
+// parseTemplate parses s for media type kind. Unknown tokens, tokens for the
+// other media type, unsupported format specs, stray braces, absolute paths,
+// empty or ".." path segments, and templates without {ext} are errors.
+func parseTemplate(s string, kind MediaType) (pathTemplate, error) {
+	if strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("template %q must be relative to the output directory", s)
+	}
+	for _, seg := range strings.Split(s, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return nil, fmt.Errorf("template %q has an empty or relative path segment", s)
+		}
+	}
+
+	var t pathTemplate
+	hasExt := false
+	last := 0
+	for _, m := range reTemplateToken.FindAllStringSubmatchIndex(s, -1) {
+		if err := checkLiteral(s, s[last:m[0]]); err != nil {
+			return nil, err
+		}
+		t = append(t, templatePart{literal: s[last:m[0]]})
+
+		name := s[m[2]:m[3]]
+		if !templateTokens[kind][name] {
+			return nil, fmt.Errorf("template %q: unknown token {%s} for %s names", s, name, kind)
+		}
+		part := templatePart{token: name}
+		if m[4] >= 0 {
+			spec := s[m[4]:m[5]]
+			pad := reZeroPad.FindStringSubmatch(spec)
+			if pad == nil || !numericTokens[name] {
+				return nil, fmt.Errorf("template %q: unsupported format {%s:%s} (numeric tokens take :0Nd)", s, name, spec)
+			}
+			part.width, _ = strconv.Atoi(pad[1])
+		}
+		hasExt = hasExt || name == "ext"
+		t = append(t, part)
+		last = m[1]
+	}
+	if err := checkLiteral(s, s[last:]); err != nil {
+		return nil, err
+	}
+	t = append(t, templatePart{literal: s[last:]})
+	if !hasExt {
+		return nil, fmt.Errorf("template %q must contain {ext}", s)
+	}
+	return t, nil
+}
+
+// checkLiteral rejects braces outside tokens, which usually mean a typo such
+// as "{season" or "{Season}".
+func checkLiteral(template, lit string) error {
+	if strings.ContainsAny(lit, "{}") {
+		return fmt.Errorf("template %q: malformed token near %q", template, lit)
+	}
+	return nil
+}
+
+// render expands the template for p. Unset values (no year) render empty;
+// bracket pairs left empty are dropped along with their leading space. For
+// TV, {title} and {year} split a show name such as "Show (2019)" into
+// "Show" and "2019"; {show} is the whole name.
+func (t pathTemplate) render(p ParsedName, ext string) string {
+	title, year := p.MovieName, p.Year
 	if p.MediaType == MediaTV {
-		s := fmt.Sprintf("%02d", p.Season)
-		e := fmt.Sprintf("%02d", p.Episode)
-		dir := filepath.Join(outputDir, p.ShowName, "Season "+s)
-		file := fmt.Sprintf("%s - S%sE%s.%s", p.ShowName, s, e, container)
-		return filepath.Join(dir, file)
+		title, year = extractShowBaseAndYear(p.ShowName)
+	}
+	var b strings.Builder
+	for _, part := range t {
+		if part.token == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		switch part.token {
+		case "show":
+			b.WriteString(p.ShowName)
+		case "title":
+			b.WriteString(title)
+		case "year":
+			b.WriteString(year)
+		case "ext":
+			b.WriteString(ext)
+		case "season":
+			b.WriteString(fmt.Sprintf("%0*d", part.width, p.Season))
+		case "episode":
+			b.WriteString(fmt.Sprintf("%0*d", part.width, p.Episode))
+			if p.EpisodeEnd > 0 {
+				b.WriteString("-" + episodeRangePrefix(b.String()) + fmt.Sprintf("%0*d", part.width, p.EpisodeEnd))
+			}
+		}
 	}
+	segs := strings.Split(b.String(), "/")
+	for i, seg := range segs {
+		segs[i] = strings.TrimSpace(reEmptyGroup.ReplaceAllString(seg, ""))
+	}
+	return filepath.Join(segs...)
+}
 
-	name := p.MovieName
-	if p.Year != "" {
-		name = fmt.Sprintf("%s (%s)", p.MovieName, p.Year)
+// episodeRangePrefix returns the "E" (or "e") that introduced the episode
+// number in rendered, so a range repeats it: S01E01-E02. Other templates
+// get a bare range ({season}x{episode} → 1x01-02).
+func episodeRangePrefix(rendered string) string {
+	num := strings.TrimRight(rendered, "0123456789")
+	if strings.HasSuffix(num, "E") || strings.HasSuffix(num, "e") {
+		return num[len(num)-1:]
+	}
+	return ""
+}
+
+// Layout renders output paths from a TV and a movie template.
+type Layout struct {
+	tv       pathTemplate
+	absolute pathTemplate // tv without seasons (see absoluteTVTemplate)
+	movie    pathTemplate
+}
+
+// NewLayout parses the --tv-template and --movie-template strings; an empty
+// string selects the default template. Templates use "/" between
+// directories and the tokens {show}, {season}, {episode} (TV), {title},
+// {year} (both; see render), plus {ext}; season and episode accept a zero-padding
+// spec such as {season:02d}. For multi-episode files {episode} renders the
+// range (see episodeRangePrefix). Absolute-numbered episodes are placed by
+// the TV template with its season parts removed (see absoluteTVTemplate).
+func NewLayout(tvTemplate, movieTemplate string) (*Layout, error) {
+	if tvTemplate == "" {
+		tvTemplate = DefaultTVTemplate
+	}
+	if movieTemplate == "" {
+		movieTemplate = DefaultMovieTemplate
+	}
+	tv, err := parseTemplate(tvTemplate, MediaTV)
+	if err != nil {
+		return nil, fmt.Errorf("--tv-template: %w", err)
+	}
+	absolute, err := parseTemplate(absoluteTVTemplate(tvTemplate), MediaTV)
+	if err != nil {
+		return nil, fmt.Errorf("--tv-template (absolute numbering): %w", err)
+	}
+	movie, err := parseTemplate(movieTemplate, MediaMovie)
+	if err != nil {
+		return nil, fmt.Errorf("--movie-template: %w", err)
 	}
-	return filepath.Join(outputDir, name, name+"."+container)
+	return &Layout{tv: tv, absolute: absolute, movie: movie}, nil
+}
+
+// defaultLayout renders the default templates.
+var defaultLayout = func() *Layout {
+	l, err := NewLayout("", "")
+	if err != nil {
+		panic(err)
+	}
+	return l
+}()
+
+// OutputPath renders the output file path for a parsed name under
+// outputDir. container is the file extension without dot, or "hls" for an
+// HLS playlist, which is placed in a directory named after the playlist
+// unless its rendered directory already has that name.
+func (l *Layout) OutputPath(p ParsedName, outputDir, container string) string {
+	ext := container
+	if container == hlsContainer {
+		ext = "m3u8"
+	}
+	t := l.movie
+	switch {
+	case p.MediaType == MediaTV && p.Absolute:
+		t = l.absolute
+	case p.MediaType == MediaTV:
+		t = l.tv
+	}
+	rel := t.render(p, ext)
+	if container == hlsContainer {
+		stem := strings.TrimSuffix(filepath.Base(rel), "."+ext)
+		if filepath.Base(filepath.Dir(rel)) != stem {
+			rel = filepath.Join(filepath.Dir(rel), stem, filepath.Base(rel))
+		}
+	}
+	return filepath.Join(outputDir, rel)
+}
+
+// GetOutputPath builds the canonical output file path for a parsed name
+// with the default templates. container is the file extension without dot
+// (e.g. "mkv", "mp4"), or "hls" for an HLS playlist.
+//
+//	TV:    <outputDir>/<ShowName>/Season XX/<ShowName> - SXXEXX.<ext>    (SXXEXX-EYY for multi-episode files)
+//	       <outputDir>/<ShowName>/<ShowName> - NNN.<ext>                 (absolute numbering)
+//	Movie: <outputDir>/<Name (Year)>/<Name (Year)>.<ext>    (or <Name>/<Name>.<ext> if no year)
+//
+// HLS output places the playlist in a per-title directory. Movies already
+// have one; TV episodes get an extra directory named after the episode:
+//
+//	TV:    <outputDir>/<ShowName>/Season XX/<ShowName> - SXXEXX/<ShowName> - SXXEXX.m3u8
+//	Movie: <outputDir>/<Name (Year)>/<Name (Year)>.m3u8
+func GetOutputPath(p ParsedName, outputDir, container string) string {
+	return defaultLayout.OutputPath(p, outputDir, container)
 }
@@ -22,6 +22,28 @@ type ParsedName struct {
 	Episode   int
 	MovieName string
 	Year      string
+	DualAudio bool // Release is tagged "Dual Audio" (two language tracks expected).
+
+	// EpisodeEnd is the last episode of a multi-episode file
+	// (S01E01-E03 → Episode 1, EpisodeEnd 3); 0 for a single episode.
+	EpisodeEnd int
+
+	// Rule is the Name of the ParseRule that matched, or "Fallback".
+	Rule string
+
+	// BareEpisode marks an episode numbered with no season in the name
+	// ("[Group] Show - 137"); Season is then 1 by default.
+	// ApplyAbsoluteNumbering turns such episodes into absolute ones.
+	BareEpisode bool
+
+	// Absolute marks Episode as a series-wide number with no season
+	// (Season 0), as set by ApplyAbsoluteNumbering.
+	Absolute bool
+
+	// RawMovieName is the cleaned movie name without release-tag stripping,
+	// set only when stripping left fewer than minStrippedNameLen characters
+	// (e.g. a title that is itself tag-like, such as "4K"). See KeepRawName.
+	RawMovieName string
 }
 
 // ParseFilename parses a media filename into structured naming components.
@@ -39,6 +61,8 @@ func ParseFilename(basename, parentPath string) ParsedName {
 			continue
 		}
 		parsed := rule.Extract(base, m, parent)
+		parsed.Rule = rule.Name
+		parsed.DualAudio = reDualAudio.MatchString(base)
 		return postProcess(parsed, parent)
 	}
 
@@ -47,6 +71,8 @@ func ParseFilename(basename, parentPath string) ParsedName {
 	parsed := ParsedName{
 		MediaType: MediaMovie,
 		MovieName: strings.TrimSpace(name),
+		DualAudio: reDualAudio.MatchString(base),
+		Rule:      "Fallback",
 	}
 	return postProcess(parsed, parent)
 }
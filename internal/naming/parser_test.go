@@ -3,6 +3,7 @@ package naming
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -206,6 +207,87 @@ func TestParseFilename(t *testing.T) {
 	}
 }
 
+func TestMultiEpisode(t *testing.T) {
+	cases := []struct {
+		basename  string
+		wantShow  string
+		wantStart int
+		wantEnd   int
+		wantPath  string
+	}{
+		{"Show.S01E01E02.mkv", "Show", 1, 2, "/output/Show/Season 01/Show - S01E01-E02.mkv"},
+		{"Show.S01E01-E03.1080p.mkv", "Show", 1, 3, "/output/Show/Season 01/Show - S01E01-E03.mkv"},
+		{"My Show - S02E09-10.mkv", "My Show", 9, 10, "/output/My Show/Season 02/My Show - S02E09-E10.mkv"},
+		{"Show.1x01-1x02.mkv", "Show", 1, 2, "/output/Show/Season 01/Show - S01E01-E02.mkv"},
+		{"Show.S01E05E03.mkv", "Show", 5, 0, "/output/Show/Season 01/Show - S01E05.mkv"},
+		{"Show.S01E05.mkv", "Show", 5, 0, "/output/Show/Season 01/Show - S01E05.mkv"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.basename, func(t *testing.T) {
+			p := ParseFilename(tc.basename, "/media/Show")
+			if p.MediaType != MediaTV || p.ShowName != tc.wantShow || p.Episode != tc.wantStart || p.EpisodeEnd != tc.wantEnd {
+				t.Errorf("got %+v, want %s E%d-E%d", p, tc.wantShow, tc.wantStart, tc.wantEnd)
+			}
+			if got := GetOutputPath(p, "/output", "mkv"); got != tc.wantPath {
+				t.Errorf("path: got %q, want %q", got, tc.wantPath)
+			}
+		})
+	}
+
+	l, err := NewLayout("{show}/{show} {season}x{episode:02d}.{ext}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := ParsedName{MediaType: MediaTV, ShowName: "Show", Season: 1, Episode: 1, EpisodeEnd: 2}
+	if got := l.OutputPath(p, "/output", "mkv"); got != "/output/Show/Show 1x01-02.mkv" {
+		t.Errorf("custom template range: got %q", got)
+	}
+	if got := ApplyEpisodeOffset(p, 12); got.Episode != 13 || got.EpisodeEnd != 14 {
+		t.Errorf("offset range: got E%d-E%d, want E13-E14", got.Episode, got.EpisodeEnd)
+	}
+}
+
+func TestAbsoluteNumbering(t *testing.T) {
+	cases := []struct {
+		basename string
+		wantShow string
+		wantEp   int
+		wantPath string
+	}{
+		{"[Group] Long Show - 137.mkv", "Long Show", 137, "/output/Long Show/Long Show - 137.mkv"},
+		{"[Group] Long Show - 101 [1080p].mkv", "Long Show", 101, "/output/Long Show/Long Show - 101.mkv"},
+		{"[Group] Long Show - 999v2.mkv", "Long Show", 999, "/output/Long Show/Long Show - 999.mkv"},
+		{"[Group] Long Show - 07.mkv", "Long Show", 7, "/output/Long Show/Long Show - 007.mkv"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.basename, func(t *testing.T) {
+			p := ApplyAbsoluteNumbering(ParseFilename(tc.basename, "/media/Long Show"))
+			if p.ShowName != tc.wantShow || p.Season != 0 || p.Episode != tc.wantEp || !p.Absolute {
+				t.Errorf("got %+v, want %s absolute E%d", p, tc.wantShow, tc.wantEp)
+			}
+			if got := GetOutputPath(p, "/output", "mkv"); got != tc.wantPath {
+				t.Errorf("path: got %q, want %q", got, tc.wantPath)
+			}
+		})
+	}
+
+	// Other rules keep their seasons.
+	p := ApplyAbsoluteNumbering(ParseFilename("Show.S02E05.mkv", "/media/Show"))
+	if p.Season != 2 || p.Absolute {
+		t.Errorf("SxxExx should be unchanged, got %+v", p)
+	}
+	// Only the seasonless form is renumbered, not a name that merely
+	// carries the rule's name.
+	if p := ApplyAbsoluteNumbering(ParsedName{MediaType: MediaTV, ShowName: "Show", Season: 1, Episode: 5, Rule: "Anime-dash"}); p.Absolute {
+		t.Errorf("a name without BareEpisode should be unchanged, got %+v", p)
+	}
+	// Absolute episodes are offset even past 100.
+	abs := ApplyAbsoluteNumbering(ParseFilename("[Group] Long Show - 137.mkv", "/media/Long Show"))
+	if got := ApplyEpisodeOffset(abs, 12); got.Episode != 149 {
+		t.Errorf("offset absolute: got %d, want 149", got.Episode)
+	}
+}
+
 func TestGetOutputPath(t *testing.T) {
 	cases := []struct {
 		name string
@@ -239,6 +321,173 @@ func TestGetOutputPath(t *testing.T) {
 	}
 }
 
+func TestGetOutputPath_HLS(t *testing.T) {
+	cases := []struct {
+		name string
+		p    ParsedName
+		want string
+	}{
+		{
+			name: "TV episode gets its own directory",
+			p:    ParsedName{MediaType: MediaTV, ShowName: "My Show", Season: 1, Episode: 5},
+			want: "/output/My Show/Season 01/My Show - S01E05/My Show - S01E05.m3u8",
+		},
+		{
+			name: "Movie uses title directory",
+			p:    ParsedName{MediaType: MediaMovie, MovieName: "The Matrix", Year: "1999"},
+			want: "/output/The Matrix (1999)/The Matrix (1999).m3u8",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := GetOutputPath(tc.p, "/output", "hls")
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLayout_CustomTemplates(t *testing.T) {
+	l, err := NewLayout("{show}/S{season}/{show} {season}x{episode:02d}.{ext}", "Movies/{title} [{year}].{ext}")
+	if err != nil {
+		t.Fatalf("NewLayout: %v", err)
+	}
+	cases := []struct {
+		name      string
+		p         ParsedName
+		container string
+		want      string
+	}{
+		{"TV", ParsedName{MediaType: MediaTV, ShowName: "My Show", Season: 1, Episode: 5}, "mkv", "/output/My Show/S1/My Show 1x05.mkv"},
+		{"movie with year", ParsedName{MediaType: MediaMovie, MovieName: "The Matrix", Year: "1999"}, "mp4", "/output/Movies/The Matrix [1999].mp4"},
+		{"movie without year drops empty brackets", ParsedName{MediaType: MediaMovie, MovieName: "Cool Film"}, "mkv", "/output/Movies/Cool Film.mkv"},
+		{"HLS gets a playlist directory", ParsedName{MediaType: MediaMovie, MovieName: "Cool Film"}, "hls", "/output/Movies/Cool Film/Cool Film.m3u8"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := l.OutputPath(tc.p, "/output", tc.container); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLayout_AbsoluteFollowsTVTemplate(t *testing.T) {
+	abs := ApplyAbsoluteNumbering(ParseFilename("[Group] Long Show - 37.mkv", "/media/Long Show"))
+	cases := []struct {
+		tv   string
+		want string
+	}{
+		{"", "/output/Long Show/Long Show - 037.mkv"},
+		{"{show}/S{season}/{show} {season}x{episode:02d}.{ext}", "/output/Long Show/Long Show 037.mkv"},
+		{"TV/{show}/Season {season:02d}/{show}.S{season:02d}E{episode:04d}.{ext}", "/output/TV/Long Show/Long Show.0037.mkv"},
+		{"{show}/{show} - {episode}.{ext}", "/output/Long Show/Long Show - 037.mkv"},
+	}
+	for _, tc := range cases {
+		l, err := NewLayout(tc.tv, "")
+		if err != nil {
+			t.Fatalf("NewLayout(%q): %v", tc.tv, err)
+		}
+		if got := l.OutputPath(abs, "/output", "mkv"); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.tv, got, tc.want)
+		}
+	}
+
+	l, err := NewConventionLayout(ConventionPlex, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.OutputPath(abs, "/output", "mkv"); got != "/output/Long Show/Long Show - 037.mkv" {
+		t.Errorf("plex: got %q", got)
+	}
+}
+
+func TestNewConventionLayout(t *testing.T) {
+	tv := ParsedName{MediaType: MediaTV, ShowName: "My Show (2019)", Season: 1, Episode: 5, EpisodeEnd: 6}
+	movie := ParsedName{MediaType: MediaMovie, MovieName: "The Matrix", Year: "1999"}
+	cases := []struct {
+		convention Convention
+		wantTV     string
+		wantMovie  string
+	}{
+		{"", "/output/My Show (2019)/Season 01/My Show (2019) - S01E05-E06.mkv", "/output/The Matrix (1999)/The Matrix (1999).mkv"},
+		{ConventionDefault, "/output/My Show (2019)/Season 01/My Show (2019) - S01E05-E06.mkv", "/output/The Matrix (1999)/The Matrix (1999).mkv"},
+		{ConventionJellyfin, "/output/My Show (2019)/Season 01/My Show (2019) - S01E05-E06.mkv", "/output/The Matrix (1999)/The Matrix (1999).mkv"},
+		{ConventionPlex, "/output/My Show (2019)/Season 01/My Show (2019) - s01e05-e06.mkv", "/output/The Matrix (1999)/The Matrix (1999).mkv"},
+		{ConventionKodi, "/output/My Show (2019)/Season 01/My Show S01E05-E06.mkv", "/output/The Matrix (1999).mkv"},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.convention), func(t *testing.T) {
+			l, err := NewConventionLayout(tc.convention, "", "")
+			if err != nil {
+				t.Fatalf("NewConventionLayout: %v", err)
+			}
+			if got := l.OutputPath(tv, "/output", "mkv"); got != tc.wantTV {
+				t.Errorf("TV: got %q, want %q", got, tc.wantTV)
+			}
+			if got := l.OutputPath(movie, "/output", "mkv"); got != tc.wantMovie {
+				t.Errorf("movie: got %q, want %q", got, tc.wantMovie)
+			}
+		})
+	}
+
+	// Without a parsed show year, the year-bearing presets drop the " ()".
+	bare := ParsedName{MediaType: MediaTV, ShowName: "My Show", Season: 1, Episode: 5}
+	for c, want := range map[Convention]string{
+		ConventionJellyfin: "/output/My Show/Season 01/My Show - S01E05.mkv",
+		ConventionPlex:     "/output/My Show/Season 01/My Show - s01e05.mkv",
+		ConventionKodi:     "/output/My Show/Season 01/My Show S01E05.mkv",
+	} {
+		l, err := NewConventionLayout(c, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.OutputPath(bare, "/output", "mkv"); got != want {
+			t.Errorf("%s without year: got %q, want %q", c, got, want)
+		}
+	}
+
+	// An explicit template overrides the preset's; the other half is kept.
+	l, err := NewConventionLayout(ConventionKodi, "{show}/{show} {season}x{episode:02d}.{ext}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.OutputPath(tv, "/output", "mkv"); got != "/output/My Show (2019)/My Show (2019) 1x05-06.mkv" {
+		t.Errorf("TV override: got %q", got)
+	}
+	if got := l.OutputPath(movie, "/output", "mkv"); got != "/output/The Matrix (1999).mkv" {
+		t.Errorf("movie keeps the preset: got %q", got)
+	}
+
+	if _, err := NewConventionLayout("emby", "", ""); err == nil {
+		t.Error("unknown convention should be rejected")
+	}
+}
+
+func TestNewLayout_RejectsBadTemplates(t *testing.T) {
+	cases := []struct {
+		name, tv, movie, want string
+	}{
+		{"unknown token", "{show}/{sesaon}.{ext}", "", "unknown token {sesaon}"},
+		{"TV token in movie", "", "{show}/{title}.{ext}", "unknown token {show} for movie"},
+		{"bad spec", "{show}/{season:x}.{ext}", "", "unsupported format {season:x}"},
+		{"spec on string token", "", "{title:02d}.{ext}", "unsupported format {title:02d}"},
+		{"stray brace", "{show}/{season.{ext}", "", "malformed token"},
+		{"missing ext", "{show}/{season}", "", "must contain {ext}"},
+		{"absolute", "", "/{title}.{ext}", "relative to the output directory"},
+		{"parent segment", "../{show}.{ext}", "", "empty or relative path segment"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewLayout(tc.tv, tc.movie)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
 func TestCollisionResolver(t *testing.T) {
 	cr := NewCollisionResolver()
 
@@ -264,6 +513,56 @@ func TestCollisionResolver(t *testing.T) {
 	if out1b != "/output/Show/Season 01/Show - S01E01.mkv" {
 		t.Errorf("re-claim: got %q", out1b)
 	}
+	// So is a dup: resolving again returns the same suffix, not the next.
+	if out2b := cr.Resolve("/input/b.mkv", "/output/Show/Season 01/Show - S01E01.mkv"); out2b != want2 {
+		t.Errorf("re-claim dup1: got %q, want %q", out2b, want2)
+	}
+}
+
+func TestCollisionResolver_Release(t *testing.T) {
+	cr := NewCollisionResolver()
+	mp4 := "/output/Movie (2020)/Movie (2020).mp4"
+	if out := cr.Resolve("/input/a.mkv", mp4); out != mp4 {
+		t.Fatalf("first claim: got %q", out)
+	}
+
+	// Another input cannot take a path it does not own away.
+	cr.Release("/input/b.mkv", mp4)
+	if out := cr.Resolve("/input/b.mkv", mp4); out != "/output/Movie (2020)/Movie (2020) - dup1.mp4" {
+		t.Errorf("claim while owned: got %q", out)
+	}
+
+	// Once a.mkv moves to .mkv, the plain .mp4 name is free again.
+	cr.Release("/input/a.mkv", mp4)
+	if out := cr.Resolve("/input/c.mkv", mp4); out != mp4 {
+		t.Errorf("claim after release: got %q, want %q", out, mp4)
+	}
+	if out := cr.Resolve("/input/a.mkv", mp4); out == mp4 {
+		t.Errorf("released input still resolves to %q", out)
+	}
+}
+
+func TestCollisionResolver_Concurrent(t *testing.T) {
+	cr := NewCollisionResolver()
+	const n = 16
+	outs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i] = cr.Resolve(fmt.Sprintf("/input/%d.mkv", i), "/output/Movie (2020)/Movie (2020).mkv")
+		}(i)
+	}
+	wg.Wait()
+
+	unique := map[string]bool{}
+	for _, o := range outs {
+		unique[o] = true
+	}
+	if len(unique) != n {
+		t.Errorf("concurrent claims produced %d distinct paths, want %d", len(unique), n)
+	}
 }
 
 func TestHarmonize(t *testing.T) {
@@ -413,6 +712,62 @@ func TestSeasonHint(t *testing.T) {
 	}
 }
 
+func TestApplyEpisodeOffset(t *testing.T) {
+	cases := []struct {
+		name        string
+		basename    string
+		parent      string
+		wantSeason  int
+		wantEpisode int
+	}{
+		{"regular episode", "[Group] Show - 01 [1080p].mkv", "/media/Show", 1, 13},
+		{"SxxEyy episode", "Show.S02E05.mkv", "/media/Show/Season 02", 2, 17},
+		{"NC special skipped", "Show.S01.NCOP1.mkv", "/media/Show/NCOP", 1, 101},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := ApplyEpisodeOffset(ParseFilename(tc.basename, tc.parent), 12)
+			if p.Season != tc.wantSeason || p.Episode != tc.wantEpisode {
+				t.Errorf("got S%02dE%02d, want S%02dE%02d", p.Season, p.Episode, tc.wantSeason, tc.wantEpisode)
+			}
+		})
+	}
+
+	special := ParsedName{MediaType: MediaTV, ShowName: "Show", Season: 0, Episode: 3}
+	if got := ApplyEpisodeOffset(special, 12); got != special {
+		t.Errorf("season-0 special should be unchanged, got %+v", got)
+	}
+
+	movie := ParsedName{MediaType: MediaMovie, MovieName: "Film"}
+	if got := ApplyEpisodeOffset(movie, 12); got != movie {
+		t.Errorf("movie should be unchanged, got %+v", got)
+	}
+}
+
+func TestDualAudio(t *testing.T) {
+	cases := []struct {
+		basename string
+		want     bool
+	}{
+		{"[Group] Show - 01 [1080p][Dual Audio].mkv", true},
+		{"Show.S01E02.1080p.BluRay.Dual.Audio.x265.mkv", true},
+		{"Movie.2019.DualAudio.1080p.mkv", true},
+		{"Show - S01E03 [Dual-Audio].mkv", true},
+		{"Show.S01E04.1080p.mkv", false},
+		{"Individual Audiobook Club - 01.mkv", false},
+	}
+	for _, tc := range cases {
+		if got := ParseFilename(tc.basename, "/media/Show").DualAudio; got != tc.want {
+			t.Errorf("%q: DualAudio = %v, want %v", tc.basename, got, tc.want)
+		}
+	}
+
+	p := ParseFilename("Show.S01E02.1080p.BluRay.Dual.Audio.x265.mkv", "/media/Show")
+	if p.ShowName != "Show" || p.Episode != 2 {
+		t.Errorf("dual-audio tag should not affect naming, got %+v", p)
+	}
+}
+
 func TestStripReleaseTags(t *testing.T) {
 	cases := []struct {
 		input string
@@ -433,6 +788,35 @@ func TestStripReleaseTags(t *testing.T) {
 	}
 }
 
+func TestKeepRawName(t *testing.T) {
+	cases := []struct {
+		name     string
+		basename string
+		want     string
+	}{
+		{"tag-like title", "4K.2019.mkv", "4K"},
+		{"leading tag", "720p At Start.mkv", "720p At Start"},
+		{"all tags", "1080p.BluRay.x265.mkv", "1080p BluRay X265"},
+		{"normal title untouched", "Film.2020.1080p.BluRay.mkv", "Film"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := ParseFilename(tc.basename, "/media/Movies")
+			if tc.want != "Film" && p.MovieName != "Unknown" {
+				t.Errorf("without the guard: got %q, want Unknown", p.MovieName)
+			}
+			if got := KeepRawName(p).MovieName; got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	show := ParsedName{MediaType: MediaTV, ShowName: "Show", RawMovieName: "x"}
+	if got := KeepRawName(show); got != show {
+		t.Errorf("TV name should be unchanged, got %+v", got)
+	}
+}
+
 func TestStripBrackets(t *testing.T) {
 	got := stripBrackets("[Group] Show Name [1080p]")
 	want := "Show Name"
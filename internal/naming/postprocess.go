@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var sepReplacer = strings.NewReplacer(".", " ", "_", " ")
@@ -36,6 +37,10 @@ var reReleaseTags = regexp.MustCompile(
 		`EMBER|NF|AMZN|DSNP|HMAX|ATVP` +
 		`)([\s._\-]|$)`)
 
+// reDualAudio matches the "Dual Audio" release tag (one of reReleaseTags),
+// with a space, dot, dash, underscore, or nothing between the words.
+var reDualAudio = regexp.MustCompile(`(?i)(^|[\s._\-\[(])Dual[\s._\-]?Audio([\s._\-\])]|$)`)
+
 // stripReleaseTags removes the first matching release tag and everything
 // after it. Returns the prefix before the tag.
 func stripReleaseTags(s string) string {
@@ -88,6 +93,11 @@ func extractParentSeasonHint(parent string) int {
 	return 0
 }
 
+// minStrippedNameLen is the shortest movie name release-tag stripping may
+// leave before the name is considered suspect: the tag list also matches
+// real titles ("4K"), and a leading tag strips the whole name.
+const minStrippedNameLen = 2
+
 // postProcess applies universal cleaning to a parsed name: strip release
 // tags, remove brackets, title-case, apply season hints, and set fallback
 // names. Called after the rule-specific extraction.
@@ -97,10 +107,17 @@ func postProcess(p ParsedName, parent string) ParsedName {
 	p.ShowName = strings.TrimSpace(p.ShowName)
 	p.ShowName = titleCase(p.ShowName)
 
+	raw := p.MovieName
 	p.MovieName = stripReleaseTags(p.MovieName)
 	p.MovieName = stripBrackets(p.MovieName)
 	p.MovieName = strings.TrimSpace(p.MovieName)
 	p.MovieName = titleCase(p.MovieName)
+	if utf8.RuneCountInString(p.MovieName) < minStrippedNameLen {
+		raw = titleCase(stripBrackets(raw))
+		if utf8.RuneCountInString(raw) > utf8.RuneCountInString(p.MovieName) {
+			p.RawMovieName = raw
+		}
+	}
 
 	if p.MediaType == MediaTV && p.Season >= 1 {
 		hint := extractParentSeasonHint(parent)
@@ -117,3 +134,44 @@ func postProcess(p ParsedName, parent string) ParsedName {
 	}
 	return p
 }
+
+// KeepRawName implements --keep-raw-names: when release-tag stripping left a
+// movie name suspiciously short (see ParsedName.RawMovieName), the cleaned
+// name without tag stripping is used instead. Other names are returned
+// unchanged.
+func KeepRawName(p ParsedName) ParsedName {
+	if p.MediaType == MediaMovie && p.RawMovieName != "" {
+		p.MovieName = p.RawMovieName
+	}
+	return p
+}
+
+// ApplyAbsoluteNumbering implements --absolute-numbering: a bare episode
+// ("[Group] Show - 137", see ParsedName.BareEpisode) keeps its number as an
+// absolute episode with Season 0 instead of being placed in Season 1, and
+// is named by the TV layout without its season parts, <Show>/<Show> - NNN
+// by default (see Layout.OutputPath). Other names are returned unchanged.
+func ApplyAbsoluteNumbering(p ParsedName) ParsedName {
+	if p.MediaType != MediaTV || !p.BareEpisode {
+		return p
+	}
+	p.Season = 0
+	p.Absolute = true
+	return p
+}
+
+// ApplyEpisodeOffset adds offset to the episode number of a regular TV
+// episode, for folders whose files restart numbering (e.g. a second cour
+// numbered 1-12 that should be E13-E24). Specials (season 0, or the 100+
+// episode scheme used for OP/ED/NC extras) and movies are returned
+// unchanged; absolute episodes are offset like regular ones.
+func ApplyEpisodeOffset(p ParsedName, offset int) ParsedName {
+	if offset == 0 || p.MediaType != MediaTV || (!p.Absolute && (p.Season == 0 || p.Episode >= 100)) {
+		return p
+	}
+	p.Episode += offset
+	if p.EpisodeEnd > 0 {
+		p.EpisodeEnd += offset
+	}
+	return p
+}
@@ -76,11 +76,14 @@ func resolveGroupReleaseYear(show, parent string) string {
 // --- Compiled rule patterns (order matters) ---
 
 var (
+	reSxxExxRange = regexp.MustCompile(
+		`(^|[^[:alnum:]])[Ss]([0-9]{1,2})[Ee]([0-9]{1,3})(-?[Ee]|-)([0-9]{1,3})([Vv][0-9]+)?([^[:alnum:]]|$)`)
+
 	reSxxExx = regexp.MustCompile(
 		`(^|[^[:alnum:]])[Ss]([0-9]{1,2})[Ee]([0-9]{1,3})([Vv][0-9]+)?([^[:alnum:]]|$)`)
 
 	re1x01 = regexp.MustCompile(
-		`(^|[^0-9])([0-9]{1,2})[xX]([0-9]{1,3})([Vv][0-9]+)?([^0-9]|$)`)
+		`(^|[^0-9])([0-9]{1,2})[xX]([0-9]{1,3})(-[0-9]{1,2}[xX]([0-9]{1,3}))?([Vv][0-9]+)?([^0-9]|$)`)
 
 	reSeasonOPED = regexp.MustCompile(
 		`(?i)^(.*?)[\s_.\-]*[Ss]([0-9]{1,2})[\s_.\-]*(NC)?(OP|ED)([0-9]{0,2})([^[:alnum:]]|$)`)
@@ -121,6 +124,7 @@ var (
 
 // Rules is the ordered parse-rule table. First match wins.
 var Rules = []ParseRule{
+	{"SxxExx-range", reSxxExxRange, extractSxxExxRange},
 	{"SxxExx", reSxxExx, extractSxxExx},
 	{"1x01", re1x01, extract1x01},
 	{"S01-OP/ED", reSeasonOPED, extractSeasonOPED},
@@ -152,17 +156,36 @@ func extractSxxExx(base string, matches []string, parent string) ParsedName {
 	}
 }
 
+// extractSxxExxRange handles multi-episode files (S01E01E02, S01E01-E03,
+// S01E01-03). A range that does not go forward is kept as its first episode.
+func extractSxxExxRange(base string, matches []string, parent string) ParsedName {
+	p := extractSxxExx(base, matches, parent)
+	p.EpisodeEnd = episodeEnd(p.Episode, matches[5])
+	return p
+}
+
 func extract1x01(base string, matches []string, parent string) ParsedName {
 	show := extractShowFromBase(base, reStrip1x01)
 	if show == "" {
 		show = extractShowFromParent(parent)
 	}
+	ep := parseIntOr0(matches[3])
 	return ParsedName{
-		MediaType: MediaTV,
-		ShowName:  show,
-		Season:    parseIntOr0(matches[2]),
-		Episode:   parseIntOr0(matches[3]),
+		MediaType:  MediaTV,
+		ShowName:   show,
+		Season:     parseIntOr0(matches[2]),
+		Episode:    ep,
+		EpisodeEnd: episodeEnd(ep, matches[5]),
+	}
+}
+
+// episodeEnd returns the last episode of a multi-episode range, or 0 when
+// end is absent or not after first.
+func episodeEnd(first int, end string) int {
+	if n := parseIntOr0(end); n > first {
+		return n
 	}
+	return 0
 }
 
 func extractSeasonOPED(_ string, matches []string, parent string) ParsedName {
@@ -298,10 +321,11 @@ func extractAnimeDash(_ string, matches []string, _ string) ParsedName {
 		ep = parseIntOr0(m[2])
 	}
 	return ParsedName{
-		MediaType: MediaTV,
-		ShowName:  cleanName(show),
-		Season:    1,
-		Episode:   ep,
+		MediaType:   MediaTV,
+		ShowName:    cleanName(show),
+		Season:      1,
+		Episode:     ep,
+		BareEpisode: true,
 	}
 }
 
@@ -3,12 +3,16 @@ package pipeline
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/display"
@@ -19,14 +23,18 @@ import (
 // fileRow holds the probed per-file data for the analysis table.
 type fileRow struct {
 	Name       string
+	Dir        string // Parent directory, for show/season grouping.
+	Container  string // Lowercase extension without the dot, e.g. "mkv".
 	Resolution string
 	VideoCodec string
 	VideoKbps  int64
 	AudioDesc  string // e.g. "aac 2ch" or "ac3 6ch"
+	Bytes      int64  // Container size from the probe; 0 = unknown.
 }
 
 // Analyze discovers media files, probes each one, and prints a tabular
-// codec/bitrate report with statistical outlier highlighting.
+// codec/bitrate report with statistical outlier highlighting, followed by
+// a list of TV seasons whose episodes are inconsistently encoded.
 func Analyze(ctx context.Context, cfg *config.Config, log Logger) {
 	files, err := Discover(cfg.InputDir)
 	if err != nil {
@@ -58,7 +66,7 @@ func Analyze(ctx context.Context, cfg *config.Config, log Logger) {
 
 		printProgress(isTTY, i+1, total, skipped, filepath.Base(path))
 
-		pr, err := probe.Probe(ctx, path)
+		pr, err := probe.Probe(ctx, cfg.FFprobePath, path)
 		if err != nil {
 			skipped++
 			if isTTY {
@@ -68,7 +76,12 @@ func Analyze(ctx context.Context, cfg *config.Config, log Logger) {
 			continue
 		}
 
-		row := fileRow{Name: filepath.Base(path)}
+		row := fileRow{
+			Name:      filepath.Base(path),
+			Dir:       filepath.Dir(path),
+			Container: strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")),
+			Bytes:     pr.Format.Size,
+		}
 
 		if pr.PrimaryVideo != nil {
 			row.VideoCodec = pr.PrimaryVideo.Codec
@@ -95,25 +108,87 @@ func Analyze(ctx context.Context, cfg *config.Config, log Logger) {
 		return
 	}
 
-	vStats := computeStats(videoKbpsVals)
+	vStats := computeStats(videoKbpsVals, cfg.OutlierMult, cfg.ExtremeMult)
 
 	outliers, extremes := printAnalysisTable(rows, vStats)
-	printAnalysisSummary(log, len(rows), skipped, outliers, extremes, vStats)
+	var codecs []codecStat
+	if cfg.CodecStats {
+		codecs = aggregateCodecStats(rows)
+	}
+	printAnalysisSummary(log, len(rows), skipped, outliers, extremes, vStats, codecs)
+	printConsistencyReport(log, findInconsistentSeasons(rows))
+
+	if cfg.AnalyzeCSV != "" {
+		if err := saveAnalysisCSV(cfg.AnalyzeCSV, rows, vStats); err != nil {
+			log.Error("Cannot write analysis CSV: %v", err)
+			return
+		}
+		log.Info("Analysis CSV: %s", cfg.AnalyzeCSV)
+	}
+	if cfg.AnalyzeJSON != "" {
+		if err := saveAnalysisJSON(cfg.AnalyzeJSON, rows, skipped, vStats); err != nil {
+			log.Error("Cannot write analysis JSON: %v", err)
+			return
+		}
+		log.Info("Analysis JSON: %s", cfg.AnalyzeJSON)
+	}
+}
+
+// analysisCSVHeader names the --analyze-csv columns.
+var analysisCSVHeader = []string{"file", "resolution", "video_codec", "video_kbps", "audio", "outlier"}
+
+// writeAnalysisCSV writes one CSV row per analyzed file: the table's
+// columns plus the video bitrate's outlier class ("", "outlier", or
+// "extreme"). video_kbps is empty when the bitrate is unknown.
+func writeAnalysisCSV(w io.Writer, rows []fileRow, vStats iqrBounds) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(analysisCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		kbps := ""
+		if r.VideoKbps > 0 {
+			kbps = strconv.FormatInt(r.VideoKbps, 10)
+		}
+		rec := []string{r.Name, r.Resolution, r.VideoCodec, kbps, r.AudioDesc, vStats.classify(float64(r.VideoKbps))}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// saveAnalysisCSV writes the analysis CSV to path, replacing any existing file.
+func saveAnalysisCSV(path string, rows []fileRow, vStats iqrBounds) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeAnalysisCSV(f, rows, vStats); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
 // iqrBounds holds the IQR-based thresholds for outlier classification.
+// The multipliers come from --outlier-mult and --extreme-mult (default 1.5
+// and 3.0).
 type iqrBounds struct {
-	q1, q3    float64
-	outlierLo float64 // Q1 - 1.5*IQR.
-	outlierHi float64 // Q3 + 1.5*IQR.
-	extremeLo float64 // Q1 - 3.0*IQR.
-	extremeHi float64 // Q3 + 3.0*IQR.
-	valid     bool
+	q1, q3      float64
+	outlierMult float64
+	extremeMult float64
+	outlierLo   float64 // Q1 - outlierMult*IQR.
+	outlierHi   float64 // Q3 + outlierMult*IQR.
+	extremeLo   float64 // Q1 - extremeMult*IQR.
+	extremeHi   float64 // Q3 + extremeMult*IQR.
+	valid       bool
 }
 
-func computeStats(vals []float64) iqrBounds {
+func computeStats(vals []float64, outlierMult, extremeMult float64) iqrBounds {
 	if len(vals) < 4 {
-		return iqrBounds{}
+		return iqrBounds{outlierMult: outlierMult, extremeMult: extremeMult}
 	}
 
 	sorted := make([]float64, len(vals))
@@ -125,14 +200,67 @@ func computeStats(vals []float64) iqrBounds {
 	iqr := q3 - q1
 
 	return iqrBounds{
-		q1:        q1,
-		q3:        q3,
-		outlierLo: q1 - 1.5*iqr,
-		outlierHi: q3 + 1.5*iqr,
-		extremeLo: q1 - 3.0*iqr,
-		extremeHi: q3 + 3.0*iqr,
-		valid:     iqr > 0,
+		q1:          q1,
+		q3:          q3,
+		outlierMult: outlierMult,
+		extremeMult: extremeMult,
+		outlierLo:   q1 - outlierMult*iqr,
+		outlierHi:   q3 + outlierMult*iqr,
+		extremeLo:   q1 - extremeMult*iqr,
+		extremeHi:   q3 + extremeMult*iqr,
+		valid:       iqr > 0,
+	}
+}
+
+// codecStat is one --codec-stats line: the analyzed files sharing a video codec.
+type codecStat struct {
+	Codec      string // "" = no video stream.
+	Count      int
+	MeanKbps   int64 // Over files with a known video bitrate; 0 = none known.
+	MedianKbps int64
+	Bytes      int64 // Total container size.
+}
+
+// aggregateCodecStats groups rows by video codec, largest total size first
+// (ties by codec name), so the biggest re-encode targets lead the list.
+func aggregateCodecStats(rows []fileRow) []codecStat {
+	byCodec := make(map[string]*codecStat)
+	kbps := make(map[string][]float64)
+	var stats []*codecStat
+	for _, r := range rows {
+		s, ok := byCodec[r.VideoCodec]
+		if !ok {
+			s = &codecStat{Codec: r.VideoCodec}
+			byCodec[r.VideoCodec] = s
+			stats = append(stats, s)
+		}
+		s.Count++
+		s.Bytes += r.Bytes
+		if r.VideoKbps > 0 {
+			kbps[r.VideoCodec] = append(kbps[r.VideoCodec], float64(r.VideoKbps))
+		}
 	}
+
+	out := make([]codecStat, 0, len(stats))
+	for _, s := range stats {
+		if vals := kbps[s.Codec]; len(vals) > 0 {
+			sort.Float64s(vals)
+			var sum float64
+			for _, v := range vals {
+				sum += v
+			}
+			s.MeanKbps = int64(math.Round(sum / float64(len(vals))))
+			s.MedianKbps = int64(math.Round(percentile(vals, 50)))
+		}
+		out = append(out, *s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Codec < out[j].Codec
+	})
+	return out
 }
 
 // classify returns "" (normal), "outlier", or "extreme" for a value.
@@ -149,6 +277,20 @@ func (b *iqrBounds) classify(v float64) string {
 	return ""
 }
 
+// truncateRunes shortens s to at most w runes, ending with "…" when cut.
+// Cuts fall on rune boundaries, so the result is always valid UTF-8.
+func truncateRunes(s string, w int) string {
+	if utf8.RuneCountInString(s) <= w {
+		return s
+	}
+	return string([]rune(s)[:w-1]) + "…"
+}
+
+// fitName pads or truncates name to exactly w runes.
+func fitName(name string, w int) string {
+	return fmt.Sprintf("%-*s", w, truncateRunes(name, w))
+}
+
 func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes int) {
 	// Column headers.
 	const (
@@ -159,29 +301,21 @@ func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes in
 		hADesc  = "Audio"
 	)
 
-	nameW := len(hFile)
-	resW := len(hRes)
-	vcW := len(hVCodec)
-	vbW := len(hVBR)
-	adW := len(hADesc)
+	// Widths are in runes, matching how fmt pads %-*s, so multibyte
+	// filenames (common in anime) stay aligned.
+	width := utf8.RuneCountInString
+	nameW := width(hFile)
+	resW := width(hRes)
+	vcW := width(hVCodec)
+	vbW := width(hVBR)
+	adW := width(hADesc)
 
 	for _, r := range rows {
-		if len(r.Name) > nameW {
-			nameW = len(r.Name)
-		}
-		if len(r.Resolution) > resW {
-			resW = len(r.Resolution)
-		}
-		if len(r.VideoCodec) > vcW {
-			vcW = len(r.VideoCodec)
-		}
-		vbStr := display.FormatBitrateLabel(r.VideoKbps)
-		if len(vbStr) > vbW {
-			vbW = len(vbStr)
-		}
-		if len(r.AudioDesc) > adW {
-			adW = len(r.AudioDesc)
-		}
+		nameW = max(nameW, width(r.Name))
+		resW = max(resW, width(r.Resolution))
+		vcW = max(vcW, width(r.VideoCodec))
+		vbW = max(vbW, width(display.FormatBitrateLabel(r.VideoKbps)))
+		adW = max(adW, width(r.AudioDesc))
 	}
 
 	if nameW > 45 {
@@ -196,7 +330,7 @@ func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes in
 		vbW, hVBR,
 		adW, hADesc,
 	)
-	separator := "  " + strings.Repeat("─", len(plainHeader)-2)
+	separator := "  " + strings.Repeat("─", width(plainHeader)-2)
 
 	// Print colored header and dim separator.
 	fmt.Printf("  %s%-*s%s  %s%-*s%s  %s%-*s%s  %s%*s%s  %s%-*s%s\n",
@@ -209,11 +343,6 @@ func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes in
 	fmt.Printf("%s%s%s\n", term.Dim, separator, term.NC)
 
 	for _, r := range rows {
-		name := r.Name
-		if len(name) > nameW {
-			name = name[:nameW-1] + "…"
-		}
-
 		vbPlain := display.FormatBitrateLabel(r.VideoKbps)
 		vClass := vStats.classify(float64(r.VideoKbps))
 
@@ -221,7 +350,7 @@ func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes in
 		flagStr := formatFlag(flag)
 
 		// Per-column coloring.
-		nameCell := fmt.Sprintf("%-*s", nameW, name)
+		nameCell := fitName(r.Name, nameW)
 		resCell := colorResolution(fmt.Sprintf("%-*s", resW, r.Resolution), r.Resolution)
 		vcCell := colorCodec(fmt.Sprintf("%-*s", vcW, r.VideoCodec), r.VideoCodec)
 		vbCell := colorRightAlign(vbPlain, vbW, vClass)
@@ -250,7 +379,7 @@ func printAnalysisTable(rows []fileRow, vStats iqrBounds) (outliers, extremes in
 	return outliers, extremes
 }
 
-func printAnalysisSummary(log Logger, probed, skipped, outliers, extremes int, vStats iqrBounds) {
+func printAnalysisSummary(log Logger, probed, skipped, outliers, extremes int, vStats iqrBounds, codecs []codecStat) {
 	log.Info("Results: %d probed, %d skipped", probed, skipped)
 
 	if vStats.valid {
@@ -270,8 +399,21 @@ func printAnalysisSummary(log Logger, probed, skipped, outliers, extremes int, v
 		log.Success("  No outliers detected")
 	}
 
+	if len(codecs) > 0 {
+		log.Info("  By codec:")
+		for _, c := range codecs {
+			name := c.Codec
+			if name == "" {
+				name = "(no video)"
+			}
+			log.Info("    %s: %d file(s), avg %s, median %s, %s",
+				name, c.Count, display.FormatBitrateLabel(c.MeanKbps),
+				display.FormatBitrateLabel(c.MedianKbps), display.FormatBytes(c.Bytes))
+		}
+	}
+
 	fmt.Println()
-	log.Info("  Legend: [*] outlier (1.5× IQR)  [!] extreme (3× IQR)")
+	log.Info("  Legend: [*] outlier (%g× IQR)  [!] extreme (%g× IQR)", vStats.outlierMult, vStats.extremeMult)
 }
 
 func fmtAudioDesc(codec string, channels int) string {
@@ -393,14 +535,10 @@ func printProgress(isTTY bool, current, total, skipped int, name string) {
 		status += fmt.Sprintf("(%d skipped) ", skipped)
 	}
 
-	maxName := 40
-	if len(name) > maxName {
-		name = name[:maxName-1] + "…"
-	}
-	status += name
+	status += truncateRunes(name, 40)
 
-	if len(status) < 80 {
-		status += strings.Repeat(" ", 80-len(status))
+	if n := utf8.RuneCountInString(status); n < 80 {
+		status += strings.Repeat(" ", 80-n)
 	}
 	fmt.Fprintf(os.Stdout, "\r%s", status)
 }
@@ -0,0 +1,91 @@
+// analyzejson.go implements --analyze-json: the analysis table and its IQR summary as a JSON document.
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// analysisJSON is the --analyze-json document.
+type analysisJSON struct {
+	Files    []analysisFileJSON `json:"files"`
+	Probed   int                `json:"probed"`
+	Skipped  int                `json:"skipped"` // Files whose probe failed.
+	Outliers int                `json:"outliers"`
+	Extremes int                `json:"extremes"`
+	IQR      *iqrJSON           `json:"video_kbps_iqr"` // null with fewer than 4 bitrates or no spread.
+}
+
+// analysisFileJSON is one fileRow with its outlier class.
+type analysisFileJSON struct {
+	File       string `json:"file"`
+	Dir        string `json:"dir"`
+	Container  string `json:"container"`
+	Resolution string `json:"resolution"`
+	VideoCodec string `json:"video_codec"`
+	VideoKbps  int64  `json:"video_kbps"` // 0 = unknown.
+	Audio      string `json:"audio"`
+	Class      string `json:"class"` // "", "outlier", or "extreme".
+}
+
+// iqrJSON is iqrBounds for the video bitrate, in kbps.
+type iqrJSON struct {
+	Q1        float64 `json:"q1"`
+	Q3        float64 `json:"q3"`
+	OutlierLo float64 `json:"outlier_lo"`
+	OutlierHi float64 `json:"outlier_hi"`
+	ExtremeLo float64 `json:"extreme_lo"`
+	ExtremeHi float64 `json:"extreme_hi"`
+}
+
+// writeAnalysisJSON writes rows, classified with vStats exactly as the
+// table classifies them, and the IQR summary to w as indented JSON.
+func writeAnalysisJSON(w io.Writer, rows []fileRow, skipped int, vStats iqrBounds) error {
+	doc := analysisJSON{Files: []analysisFileJSON{}, Probed: len(rows), Skipped: skipped}
+	for _, r := range rows {
+		class := vStats.classify(float64(r.VideoKbps))
+		switch class {
+		case "extreme":
+			doc.Extremes++
+		case "outlier":
+			doc.Outliers++
+		}
+		doc.Files = append(doc.Files, analysisFileJSON{
+			File:       r.Name,
+			Dir:        r.Dir,
+			Container:  r.Container,
+			Resolution: r.Resolution,
+			VideoCodec: r.VideoCodec,
+			VideoKbps:  r.VideoKbps,
+			Audio:      r.AudioDesc,
+			Class:      class,
+		})
+	}
+	if vStats.valid {
+		doc.IQR = &iqrJSON{
+			Q1:        vStats.q1,
+			Q3:        vStats.q3,
+			OutlierLo: vStats.outlierLo,
+			OutlierHi: vStats.outlierHi,
+			ExtremeLo: vStats.extremeLo,
+			ExtremeHi: vStats.extremeHi,
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// saveAnalysisJSON writes the analysis JSON to path, replacing any existing file.
+func saveAnalysisJSON(path string, rows []fileRow, skipped int, vStats iqrBounds) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeAnalysisJSON(f, rows, skipped, vStats); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
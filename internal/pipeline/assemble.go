@@ -0,0 +1,115 @@
+// assemble.go implements --concat / --image-seq: encode a single title from
+// a concat list or a numbered image sequence.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/display"
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+	"github.com/backmassage/muxmaster/internal/naming"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// assembleOutputPath names the assembled title like a movie without a year:
+// <outputDir>/<Title>/<Title>.<ext>. Path separators in the title are
+// replaced so it stays a single directory level.
+func assembleOutputPath(cfg *config.Config) string {
+	title := strings.TrimSpace(strings.ReplaceAll(cfg.Title, string(filepath.Separator), "-"))
+	parsed := naming.ParsedName{MediaType: naming.MediaMovie, MovieName: title}
+	return naming.GetOutputPath(parsed, cfg.OutputDir, string(cfg.OutputContainer))
+}
+
+// assemblePlan probes the concat list or image pattern through its demuxer
+// and builds the plan for it. The returned config is a copy with
+// --skip-optimized, attachments, and cover art disabled: the concat and
+// image2 demuxers do not carry attachments, and an assembled title is never
+// "already optimized".
+func assemblePlan(ctx context.Context, cfg *config.Config) (*config.Config, *probe.ProbeResult, *planner.FilePlan, error) {
+	input := cfg.ConcatList
+	if input == "" {
+		input = cfg.ImageSequence
+	}
+	pr, err := probe.ProbeInput(ctx, cfg.FFprobePath, input, planner.AssembleInputOpts(cfg)...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	acfg := *cfg
+	acfg.SkipOptimized = false
+	acfg.KeepAttachments = false
+	acfg.KeepCoverArt = false
+	plan := planner.BuildPlan(&acfg, pr)
+	plan.InputPath = input
+	plan.OutputPath = assembleOutputPath(&acfg)
+	return &acfg, pr, plan, nil
+}
+
+// Assemble encodes the --concat list or --image-seq pattern into one output
+// named by --title. It reuses the normal plan, retry, and ownership logic
+// but skips directory discovery and filename parsing. Returns false on
+// failure.
+func Assemble(ctx context.Context, cfg *config.Config, log Logger, run ffmpeg.RunFunc) bool {
+	acfg, pr, plan, err := assemblePlan(ctx, cfg)
+	if err != nil {
+		log.Error("Cannot probe input: %v", err)
+		return false
+	}
+	if pr.PrimaryVideo == nil {
+		log.Error("No video stream found in %s", plan.InputPath)
+		return false
+	}
+	if plan.Err != nil {
+		log.Error("%v", plan.Err)
+		return false
+	}
+
+	log.Info("Assembling: %s", plan.InputPath)
+	log.Info("  -> %s", plan.OutputPath)
+	logInputMeta(log, pr)
+	if acfg.Display.FileStats {
+		logFileStats(log, plan)
+	}
+
+	if acfg.SkipExisting {
+		if _, err := os.Stat(plan.OutputPath); err == nil {
+			log.Warn("Skip (exists): %s", filepath.Base(plan.OutputPath))
+			return true
+		}
+	}
+	if acfg.DryRun {
+		log.Success("[DRY] Would encode")
+		return true
+	}
+
+	createdDirs := missingDirs(filepath.Dir(plan.OutputPath))
+	if err := os.MkdirAll(filepath.Dir(plan.OutputPath), 0o755); err != nil {
+		log.Error("Cannot create output directory: %v", err)
+		return false
+	}
+
+	var trail *attemptTrail
+	if acfg.Display.RetryLog != "" {
+		trail = &attemptTrail{}
+		run = trail.wrap(run)
+	}
+	start := time.Now()
+	if !attemptWithErrorRetry(ctx, acfg, log, pr, plan, ffmpeg.NewRetryState(plan), run) {
+		log.Error("Encode failed")
+		writeRetryLog(log, acfg.Display.RetryLog, trail, plan.InputPath)
+		removeOutput(plan)
+		return false
+	}
+	applyOutputMode(acfg, log, plan, createdDirs)
+	applyOutputOwner(acfg, log, plan, createdDirs)
+
+	outSize, _ := outputSize(plan)
+	log.Success("Encoded in %ds (%s)", int(time.Since(start).Seconds()), display.FormatBytes(outSize))
+	return true
+}
@@ -0,0 +1,65 @@
+// audiosync.go implements --verify-audio-sync: a post-encode re-probe comparing audio/video duration gaps with the source.
+package pipeline
+
+import (
+	"context"
+	"math"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// verifyAudioSync re-probes the finished output and warns for each audio
+// stream whose drift (see audioSyncDrift) exceeds cfg.AudioSyncTolerance.
+// Streams shifted by --audio-delay, and streams or videos with no reported
+// duration, are not checked; neither is HLS output. A failed probe is a
+// warning too; the encode itself succeeded.
+func verifyAudioSync(ctx context.Context, cfg *config.Config, log Logger, pr *probe.ProbeResult, plan *planner.FilePlan) {
+	if !cfg.VerifyAudioSync || plan.Container == config.ContainerHLS || plan.Audio.NoAudio || pr.PrimaryVideo == nil {
+		return
+	}
+	out, err := probeFile(ctx, cfg.FFprobePath, plan.OutputPath)
+	if err != nil {
+		log.Warn("  Cannot verify audio sync: %v", err)
+		return
+	}
+	if out.PrimaryVideo == nil {
+		return
+	}
+	for i, a := range out.AudioStreams {
+		src, ok := sourceAudioIndex(plan, i)
+		if !ok || src >= len(pr.AudioStreams) {
+			continue
+		}
+		drift, ok := audioSyncDrift(pr.PrimaryVideo.Duration, pr.AudioStreams[src].Duration, out.PrimaryVideo.Duration, a.Duration)
+		if ok && math.Abs(drift) > cfg.AudioSyncTolerance {
+			log.Warn("  Audio sync drift on a:%d: %+.2fs against the video, compared to the source (tolerance %.2fs)", i, drift, cfg.AudioSyncTolerance)
+		}
+	}
+}
+
+// sourceAudioIndex maps output audio stream i to its source audio index.
+// ok is false for a stream shifted by --audio-delay, whose duration gap
+// moves on purpose.
+func sourceAudioIndex(plan *planner.FilePlan, i int) (int, bool) {
+	if plan.Faithful || plan.Audio.CopyAll {
+		return i, true
+	}
+	if i >= len(plan.Audio.Streams) || plan.Audio.Streams[i].DelayMs != 0 {
+		return 0, false
+	}
+	return plan.Audio.Streams[i].StreamIndex, true
+}
+
+// audioSyncDrift returns how far the output's audio-minus-video duration
+// gap has moved from the source's, in seconds (positive = the audio grew
+// longer relative to the video). Comparing gaps rather than raw durations
+// tolerates sources whose audio already runs past the last frame. ok is
+// false when any duration is unknown.
+func audioSyncDrift(srcVideo, srcAudio, outVideo, outAudio float64) (drift float64, ok bool) {
+	if srcVideo <= 0 || srcAudio <= 0 || outVideo <= 0 || outAudio <= 0 {
+		return 0, false
+	}
+	return (outAudio - outVideo) - (srcAudio - srcVideo), true
+}
@@ -0,0 +1,180 @@
+// benchmark.go implements --benchmark: time the configured encoder on a clip
+// written to the null muxer and report throughput.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// benchmarkClipSeconds is the length of the generated synthetic clip: long
+// enough for encoder ramp-up to wash out, short enough to run in seconds on
+// a GPU. The clip is 1080p24 testsrc2 (moving, detailed content) with a
+// stereo sine track, H.264 so the encode path matches a typical source.
+const benchmarkClipSeconds = 30
+
+// BenchmarkStats holds the figures parsed from ffmpeg's final -stats line.
+type BenchmarkStats struct {
+	Frames  int
+	FPS     float64 // ffmpeg-reported encode fps.
+	Speed   float64 // Realtime factor (e.g. 4.2 = 4.2× realtime).
+	Seconds float64 // Media time processed.
+}
+
+var (
+	reStatFrame = regexp.MustCompile(`frame=\s*(\d+)`)
+	reStatFPS   = regexp.MustCompile(`fps=\s*([\d.]+)`)
+	reStatTime  = regexp.MustCompile(`time=\s*(\d+):(\d+):([\d.]+)`)
+	reStatSpeed = regexp.MustCompile(`speed=\s*([\d.]+)x`)
+)
+
+// ParseFFmpegStats extracts frame count, fps, media time, and speed from the
+// last progress line in ffmpeg stderr (lines are \r-separated with -stats).
+// Returns false if no progress line is present.
+func ParseFFmpegStats(stderr string) (BenchmarkStats, bool) {
+	i := strings.LastIndex(stderr, "frame=")
+	if i < 0 {
+		return BenchmarkStats{}, false
+	}
+	line := stderr[i:]
+	if j := strings.IndexAny(line, "\r\n"); j >= 0 {
+		line = line[:j]
+	}
+
+	var st BenchmarkStats
+	if m := reStatFrame.FindStringSubmatch(line); m != nil {
+		st.Frames, _ = strconv.Atoi(m[1])
+	}
+	if m := reStatFPS.FindStringSubmatch(line); m != nil {
+		st.FPS, _ = strconv.ParseFloat(m[1], 64)
+	}
+	st.Seconds, _ = parseStatTime(line)
+	if m := reStatSpeed.FindStringSubmatch(line); m != nil {
+		st.Speed, _ = strconv.ParseFloat(m[1], 64)
+	}
+	return st, true
+}
+
+// parseStatTime returns the media time in seconds from the time= field of
+// an ffmpeg progress line.
+func parseStatTime(line string) (float64, bool) {
+	m := reStatTime.FindStringSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.ParseFloat(m[3], 64)
+	return float64(h*3600+mins*60) + sec, true
+}
+
+// benchmarkClipArgs returns the ffmpeg (bin) command that writes the
+// synthetic benchmark clip to path.
+func benchmarkClipArgs(bin, path string) []string {
+	return []string{
+		bin, "-hide_banner", "-nostdin", "-y", "-loglevel", "error",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=1920x1080:rate=24:duration=%d", benchmarkClipSeconds),
+		"-f", "lavfi", "-i", fmt.Sprintf("sine=frequency=440:sample_rate=48000:duration=%d", benchmarkClipSeconds),
+		"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-ac", "2",
+		path,
+	}
+}
+
+// benchmarkPlan builds an encode plan for input using the configured
+// encoder and quality, writing to the null muxer. The returned config is a
+// copy with remux, skip, and stream-copy extras disabled and live stats on,
+// so ffmpeg.Build always produces a full encode with a parseable stats line.
+func benchmarkPlan(cfg *config.Config, pr *probe.ProbeResult, input string) (*config.Config, *planner.FilePlan) {
+	bcfg := *cfg
+	bcfg.SkipHEVC = false
+	bcfg.SkipOptimized = false
+	bcfg.KeepSubtitles = false
+	bcfg.KeepAttachments = false
+	bcfg.KeepCoverArt = false
+	bcfg.OutputContainer = config.ContainerMKV
+	bcfg.Display.FfmpegFPS = true
+
+	plan := planner.BuildPlan(&bcfg, pr)
+	plan.InputPath = input
+	plan.OutputPath = "-"
+	plan.ContainerOpts = []string{"-f", "null"}
+	plan.TagOpts = nil
+	plan.TwoPass = false // A --target-bitrate benchmark times one average-bitrate pass.
+	return &bcfg, plan
+}
+
+// Benchmark encodes a clip (cfg.BenchmarkInput, or a generated synthetic
+// one) with the configured encoder to the null muxer and logs fps, speed,
+// and wall-clock timing. Returns false if the clip cannot be prepared or the
+// encode fails.
+func Benchmark(ctx context.Context, cfg *config.Config, log Logger, run ffmpeg.RunFunc) bool {
+	input := cfg.BenchmarkInput
+	if input == "" {
+		dir, cleanup, err := runTempDir(cfg)
+		if err != nil {
+			log.Error("Cannot create temp dir: %v", err)
+			return false
+		}
+		defer cleanup()
+
+		input = filepath.Join(dir, "clip.mkv")
+		log.Info("Generating %ds 1080p24 synthetic clip …", benchmarkClipSeconds)
+		if res := run(ctx, benchmarkClipArgs(cfg.FFmpegPath, input)); res.Err != nil {
+			log.Error("Clip generation failed: %v", res.Err)
+			logStderr(log, res.Stderr)
+			return false
+		}
+	}
+
+	pr, err := probe.Probe(ctx, cfg.FFprobePath, input)
+	if err != nil || pr.PrimaryVideo == nil {
+		log.Error("Cannot probe benchmark clip %s: %v", input, err)
+		return false
+	}
+
+	bcfg, plan := benchmarkPlan(cfg, pr, input)
+	quality := fmt.Sprintf("CRF %d", plan.CpuCRF)
+	if bcfg.Encoder.Mode.UsesQP() {
+		quality = fmt.Sprintf("QP %d", plan.VaapiQP)
+	}
+	log.Info("Benchmarking %s (%s) on %s %s", plan.VideoCodec, quality, pr.Resolution(), filepath.Base(input))
+
+	start := time.Now()
+	res := ffmpeg.Execute(ctx, bcfg, plan, ffmpeg.NewRetryState(plan), pr.Format.Duration, run)
+	wall := time.Since(start).Seconds()
+	if res.Err != nil {
+		log.Error("Benchmark encode failed: %v", res.Err)
+		logStderr(log, res.Stderr)
+		return false
+	}
+
+	st, ok := ParseFFmpegStats(res.Stderr)
+	if !ok {
+		log.Warn("No ffmpeg stats line found; wall time only")
+	}
+	log.Blank()
+	log.Info("=== Benchmark ===")
+	log.Info("Encoder:     %s (%s, %s)", plan.VideoCodec, bcfg.Encoder.Mode, quality)
+	log.Info("Frames:      %d (%.1fs of media)", st.Frames, st.Seconds)
+	log.Info("Wall time:   %.1fs", wall)
+	log.Info("FPS:         %.1f (ffmpeg)", st.FPS)
+	if wall > 0 && st.Frames > 0 {
+		log.Info("FPS (wall):  %.1f", float64(st.Frames)/wall)
+	}
+	log.Info("Realtime:    %.2f×", st.Speed)
+	if st.Seconds > 0 {
+		log.Info("Cost:        %.1fs wall per hour of media", wall/st.Seconds*3600)
+	}
+	return true
+}
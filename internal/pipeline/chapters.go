@@ -0,0 +1,47 @@
+// chapters.go implements --verify-chapters: a post-encode re-probe comparing output chapters with the source.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// verifyChapters re-probes the finished output and warns when its chapters
+// differ from the source's. HLS output carries no chapters and is not
+// checked. A failed probe is a warning too; the encode itself succeeded.
+func verifyChapters(ctx context.Context, cfg *config.Config, log Logger, pr *probe.ProbeResult, plan *planner.FilePlan) {
+	if !cfg.VerifyChapters || plan.Container == config.ContainerHLS {
+		return
+	}
+	out, err := probeFile(ctx, cfg.FFprobePath, plan.OutputPath)
+	if err != nil {
+		log.Warn("  Cannot verify chapters: %v", err)
+		return
+	}
+	if msg := chapterMismatch(pr.Chapters, out.Chapters); msg != "" {
+		log.Warn("  %s", msg)
+	}
+}
+
+// chapterMismatch compares source and output chapter lists. It reports a
+// count mismatch, or else the number of chapters whose title changed; ""
+// means the chapters round-tripped.
+func chapterMismatch(src, out []probe.Chapter) string {
+	if len(src) != len(out) {
+		return fmt.Sprintf("Chapter count mismatch: source %d, output %d", len(src), len(out))
+	}
+	changed := 0
+	for i := range src {
+		if src[i].Title != out[i].Title {
+			changed++
+		}
+	}
+	if changed > 0 {
+		return fmt.Sprintf("Chapter titles changed: %d of %d", changed, len(src))
+	}
+	return ""
+}
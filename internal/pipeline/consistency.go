@@ -0,0 +1,114 @@
+// consistency.go groups analyzed files into (show, season) buckets and flags
+// seasons whose episodes mix video codecs, resolutions, or containers.
+package pipeline
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/naming"
+)
+
+// seasonKey identifies one season of one show.
+type seasonKey struct {
+	Show   string
+	Season int
+}
+
+// seasonMix describes a season whose episodes are not encoded uniformly.
+// Each slice lists the distinct values seen, sorted; a slice with more than
+// one entry is what made the season inconsistent.
+type seasonMix struct {
+	Key         seasonKey
+	Files       int
+	Codecs      []string
+	Resolutions []string
+	Containers  []string
+}
+
+// findInconsistentSeasons parses each row's filename into a (show, season)
+// bucket and returns the buckets whose episodes differ in video codec,
+// resolution, or container. Movies and rows without a probed value for a
+// field are ignored for that field. Results are sorted by show then season.
+func findInconsistentSeasons(rows []fileRow) []seasonMix {
+	type sets struct {
+		files                           int
+		codecs, resolutions, containers map[string]bool
+	}
+	buckets := make(map[seasonKey]*sets)
+	add := func(m map[string]bool, v string) {
+		if v != "" && v != "unknown" {
+			m[strings.ToLower(v)] = true
+		}
+	}
+
+	for _, r := range rows {
+		parsed := naming.ParseFilename(r.Name, r.Dir)
+		if parsed.MediaType != naming.MediaTV || parsed.ShowName == "" {
+			continue
+		}
+		key := seasonKey{Show: parsed.ShowName, Season: parsed.Season}
+		b := buckets[key]
+		if b == nil {
+			b = &sets{codecs: map[string]bool{}, resolutions: map[string]bool{}, containers: map[string]bool{}}
+			buckets[key] = b
+		}
+		b.files++
+		add(b.codecs, r.VideoCodec)
+		add(b.resolutions, r.Resolution)
+		add(b.containers, r.Container)
+	}
+
+	var mixed []seasonMix
+	for key, b := range buckets {
+		if len(b.codecs) < 2 && len(b.resolutions) < 2 && len(b.containers) < 2 {
+			continue
+		}
+		mixed = append(mixed, seasonMix{
+			Key:         key,
+			Files:       b.files,
+			Codecs:      sortedKeys(b.codecs),
+			Resolutions: sortedKeys(b.resolutions),
+			Containers:  sortedKeys(b.containers),
+		})
+	}
+	sort.Slice(mixed, func(i, j int) bool {
+		if mixed[i].Key.Show != mixed[j].Key.Show {
+			return mixed[i].Key.Show < mixed[j].Key.Show
+		}
+		return mixed[i].Key.Season < mixed[j].Key.Season
+	})
+	return mixed
+}
+
+// printConsistencyReport logs one line per inconsistent season, naming only
+// the fields that actually differ.
+func printConsistencyReport(log Logger, mixed []seasonMix) {
+	if len(mixed) == 0 {
+		return
+	}
+	log.Blank()
+	log.Warn("%d season(s) with inconsistent encodes:", len(mixed))
+	for _, m := range mixed {
+		var parts []string
+		if len(m.Codecs) > 1 {
+			parts = append(parts, "codecs "+strings.Join(m.Codecs, "/"))
+		}
+		if len(m.Resolutions) > 1 {
+			parts = append(parts, "resolutions "+strings.Join(m.Resolutions, "/"))
+		}
+		if len(m.Containers) > 1 {
+			parts = append(parts, "containers "+strings.Join(m.Containers, "/"))
+		}
+		log.Outlier("  %s S%02d (%d files): %s", m.Key.Show, m.Key.Season, m.Files, strings.Join(parts, ", "))
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
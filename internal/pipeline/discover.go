@@ -1,11 +1,16 @@
-// Recursive media file discovery with extras directory pruning.
+// Recursive media file discovery with extras directory pruning, plus
+// sidecar subtitle lookup for individual inputs.
 package pipeline
 
 import (
 	"io/fs"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/backmassage/muxmaster/internal/planner"
 )
 
 // Supported media file extensions (lowercase, with leading dot).
@@ -70,3 +75,61 @@ func isExtrasDir(name string) bool {
 	}
 	return false
 }
+
+// Sidecar subtitle extensions (lowercase, with leading dot). Only text
+// formats are accepted so they can be carried by both MKV and MP4.
+var sidecarSubExtensions = map[string]bool{
+	".srt": true,
+	".ass": true,
+	".ssa": true,
+	".vtt": true,
+}
+
+// reSidecarLang matches an ISO 639-1/639-2 language tag in a sidecar suffix.
+var reSidecarLang = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// FindSidecarSubs returns the external subtitle files that belong to
+// videoPath: files in the same directory named <stem>.<ext> or
+// <stem>.<tag>.<ext>, where ext is a text subtitle format. A two- or
+// three-letter tag is recorded as the language ("Show - S01E05.eng.srt" →
+// "eng"); other tags (e.g. "forced") are accepted without a language.
+// Results are sorted by filename.
+func FindSidecarSubs(videoPath string) []planner.SidecarSubtitle {
+	dir := filepath.Dir(videoPath)
+	stem := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var subs []planner.SidecarSubtitle
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if !sidecarSubExtensions[strings.ToLower(ext)] {
+			continue
+		}
+		rest := strings.TrimSuffix(name, ext)
+		if rest == stem {
+			subs = append(subs, planner.SidecarSubtitle{Path: filepath.Join(dir, name)})
+			continue
+		}
+		if !strings.HasPrefix(rest, stem+".") {
+			continue
+		}
+		tag := strings.ToLower(strings.TrimPrefix(rest, stem+"."))
+		if tag == "" || strings.Contains(tag, ".") {
+			continue
+		}
+		sc := planner.SidecarSubtitle{Path: filepath.Join(dir, name)}
+		if reSidecarLang.MatchString(tag) {
+			sc.Language = tag
+		}
+		subs = append(subs, sc)
+	}
+	return subs
+}
@@ -1,6 +1,6 @@
 // Package pipeline orchestrates file discovery, per-file processing, and
 // batch summary reporting. It wires together probe, naming, planner, and
-// ffmpeg into the sequential processing loop.
+// ffmpeg into the batch processing loop (sequential, or a --jobs worker pool).
 //
 // All logging goes through the Logger interface (logger.go), and all ffmpeg
 // execution goes through an injected ffmpeg.RunFunc, so the orchestration
@@ -8,10 +8,32 @@
 // without real subprocesses or stdout/stderr.
 //
 // Files:
-//   - logger.go:      Logger — interface for dependency-injected logging
-//   - discover.go:    Discover — recursive media file discovery with extras pruning
-//   - runner.go:      Run, processFile — per-file orchestration and post-encode quality escalation
+//   - logger.go:      Logger — interface for dependency-injected logging; per-file buffered and summary-only wrappers
+//   - discover.go:    Discover, FindSidecarSubs — media discovery with extras pruning, sidecar subtitle lookup
+//   - runner.go:      Run, processFile — --jobs worker pool, per-file orchestration, and post-encode quality escalation
+//   - inputsort.go:   sortInputs — --input-sort processing order (name, size, mtime, or probed duration)
+//   - lanes.go:       splitLanes — --remux-jobs split of pre-pass results into encode and remux lanes
+//   - plan.go:        Plan, planFiles — concurrent probe-and-plan pre-pass (--concurrent-probe-prepass, --remux-jobs)
+//   - pool.go:        workerPool — Run's worker lanes under a running-file cap that can be lowered mid-batch
+//   - progress.go:    progressEmitter, logProgress — --progress-json NDJSON events and --show-fps percent/ETA log lines
+//   - summaryjson.go: writeSummaryJSON — --summary-json final summary object on stdout
+//   - ledger.go:      openLedger — --state JSON ledger of completed inputs for resuming interrupted runs
+//   - tempdir.go:     NewRunTempDir — run-scoped scratch directory (--temp-dir / $TMPDIR), removed on exit
+//   - staging.go:     publishOutput — --staging-dir encode outside the library, then move (or copy across filesystems) into place
+//   - owner.go:       applyOutputOwner, applyOutputMode — --output-owner chown and --dir-mode/--file-mode chmod of created outputs and directories
+//   - retrylog.go:    attemptTrail, writeRetryLog — --retry-log full ffmpeg output of failed files
+//   - chapters.go:    verifyChapters — --verify-chapters post-encode chapter count/title comparison
+//   - audiosync.go:   verifyAudioSync — --verify-audio-sync post-encode audio/video duration drift check
+//   - twopass.go:     runFirstPass — --target-bitrate x265 analysis pass with a scratch stats file
+//   - preview.go:     writePreviewFrame — --preview-frame comparison images in .compare/
+//   - assemble.go:    Assemble — --concat / --image-seq single-title encode named by --title
 //   - report.go:      Batch header, per-file metadata, outlier, and summary logging helpers
-//   - analyze.go:     Analyze — probe-only mode with tabular codec/bitrate report
+//   - analyze.go:     Analyze — probe-only mode with tabular codec/bitrate report, --codec-stats breakdown, and --analyze-csv export
+//   - analyzejson.go: writeAnalysisJSON — --analyze-json rows, outlier classes, and IQR summary
+//   - validate.go:    Validate — --validate readability sweep with a minimal ffprobe per file
+//   - outtree.go:     OutputTree — --dry-run-output-tree resolved output paths without probing
+//   - rename.go:      RenameOnly — --rename-only move/hardlink/copy of originals into the output layout
+//   - consistency.go: findInconsistentSeasons — --analyze report of seasons with mixed codecs/resolutions/containers
+//   - benchmark.go:   Benchmark — --benchmark encoder throughput run to the null muxer
 //   - stats.go:       RunStats — aggregate batch statistics
 package pipeline
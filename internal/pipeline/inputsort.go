@@ -0,0 +1,81 @@
+// inputsort.go implements --input-sort: the order Run processes discovered files in.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"slices"
+
+	"github.com/backmassage/muxmaster/internal/config"
+)
+
+// sortInputs reorders files (in discovery order) for --input-sort. size
+// and mtime come from os.Stat; duration probes every file, and the results
+// are returned as a probeCache for the rest of the run (nil for the other
+// orders). Files whose size, mtime, or duration cannot be read sort last;
+// ties keep discovery order.
+func sortInputs(ctx context.Context, cfg *config.Config, files []string) probeCache {
+	switch cfg.InputSort {
+	case config.InputSortSize:
+		sizes := make(map[string]int64, len(files))
+		for _, path := range files {
+			sizes[path] = -1
+			if fi, err := os.Stat(path); err == nil {
+				sizes[path] = fi.Size()
+			}
+		}
+		slices.SortStableFunc(files, func(a, b string) int {
+			return compareKnown(sizes[a], sizes[b], sizes[a] >= 0, sizes[b] >= 0)
+		})
+	case config.InputSortMtime:
+		// Keyed by negated mtime so the newest file sorts first.
+		age := make(map[string]int64, len(files))
+		for _, path := range files {
+			if fi, err := os.Stat(path); err == nil {
+				age[path] = -fi.ModTime().UnixNano()
+			}
+		}
+		slices.SortStableFunc(files, func(a, b string) int {
+			ka, okA := age[a]
+			kb, okB := age[b]
+			return compareKnown(ka, kb, okA, okB)
+		})
+	case config.InputSortDuration:
+		probed := probeCache{}
+		durations := make(map[string]float64, len(files))
+		for _, path := range files {
+			if ctx.Err() != nil {
+				break
+			}
+			if fi, err := os.Stat(path); err != nil || fi.Size() < minFileSize || exceedsMaxFileSize(cfg, fi.Size()) {
+				continue
+			}
+			if pr, err := probeFile(ctx, cfg.FFprobePath, path); err == nil {
+				probed[path] = pr
+				durations[path] = pr.Format.Duration
+			}
+		}
+		slices.SortStableFunc(files, func(a, b string) int {
+			return compareKnown(durations[a], durations[b], durations[a] > 0, durations[b] > 0)
+		})
+		return probed
+	}
+	return nil
+}
+
+// compareKnown orders x before y by value, with unknown values after
+// known ones.
+func compareKnown[T int64 | float64](x, y T, xKnown, yKnown bool) int {
+	switch {
+	case xKnown != yKnown:
+		if xKnown {
+			return -1
+		}
+		return 1
+	case !xKnown || x == y:
+		return 0
+	case x < y:
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,53 @@
+// lanes.go implements --remux-jobs: routing planned encodes and remuxes to
+// separate worker lanes.
+package pipeline
+
+import (
+	"context"
+
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// probeFile is probe.Probe, replaceable in tests.
+var probeFile = probe.Probe
+
+// probeCache holds the pre-pass probe results (see plan.go) by input path, so processFile
+// does not probe a file twice. A nil cache probes every file. It is only
+// written before the workers start.
+type probeCache map[string]*probe.ProbeResult
+
+// probe returns the cached result for path, or probes it with ffprobe (bin).
+func (c probeCache) probe(ctx context.Context, bin, path string) (*probe.ProbeResult, error) {
+	if pr, ok := c[path]; ok {
+		return pr, nil
+	}
+	return probeFile(ctx, bin, path)
+}
+
+// laneSplit is the outcome of the planning pre-pass: the indices of files
+// planned for a video encode, and of all other files (remuxes, and files
+// that will be skipped or fail, which finish quickly).
+type laneSplit struct {
+	encodes []int
+	remuxes []int
+}
+
+// splitLanes routes the pre-pass results (see planFiles) to lanes. The
+// plan is built from the filename's media type and the probe alone, so
+// files whose action later changes (a remux falling back to an encode,
+// --only) still run in the lane chosen here; in VAAPI mode the device
+// limiter bounds those encodes regardless of lane. Files without a plan
+// (unprobed, unprobeable, or without usable video) go to the remux lane,
+// where processFile reports them.
+func splitLanes(planned []PlannedFile) laneSplit {
+	var split laneSplit
+	for i, pf := range planned {
+		if pf.Plan != nil && pf.Plan.Action == planner.ActionEncode {
+			split.encodes = append(split.encodes, i)
+		} else {
+			split.remuxes = append(split.remuxes, i)
+		}
+	}
+	return split
+}
@@ -0,0 +1,116 @@
+// ledger.go implements --state: a JSON ledger of completed inputs so an interrupted run can resume.
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ledgerVersion is written to the ledger so a future format change can be
+// detected.
+const ledgerVersion = 1
+
+// ledgerEntry records one completed input. The size and mtime identify the
+// input version: a file replaced or modified since is processed again.
+type ledgerEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Output  string    `json:"output"`
+	DoneAt  time.Time `json:"done_at"`
+}
+
+// ledgerFile is the on-disk --state document.
+type ledgerFile struct {
+	Version int                    `json:"version"`
+	Files   map[string]ledgerEntry `json:"files"` // Keyed by input path.
+}
+
+// ledger is the --state ledger of a run. A nil *ledger (no --state) never
+// reports a file done and records nothing. Workers share it, so access is
+// serialized.
+type ledger struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]ledgerEntry
+}
+
+// openLedger loads the ledger at path, starting an empty one when the file
+// does not exist yet. An empty path returns nil.
+func openLedger(path string) (*ledger, error) {
+	if path == "" {
+		return nil, nil
+	}
+	l := &ledger{path: path, files: map[string]ledgerEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc ledgerFile
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for input, e := range doc.Files {
+		l.files[input] = e
+	}
+	return l, nil
+}
+
+// done reports whether input was completed in an earlier run and has the
+// same size and mtime now.
+func (l *ledger) done(input string, fi os.FileInfo) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.files[input]
+	return ok && e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime())
+}
+
+// markDone records input as completed and flushes the ledger, so a crash
+// loses at most the file in progress.
+func (l *ledger) markDone(input string, fi os.FileInfo, output string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files[input] = ledgerEntry{Size: fi.Size(), ModTime: fi.ModTime(), Output: output, DoneAt: time.Now()}
+	return l.flush()
+}
+
+// flush writes the ledger to a temporary file beside it and renames it into
+// place, so an interrupted write never leaves a truncated ledger. The caller
+// holds l.mu.
+func (l *ledger) flush() error {
+	data, err := json.MarshalIndent(ledgerFile{Version: ledgerVersion, Files: l.files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -12,5 +12,93 @@ type Logger interface {
 	Error(string, ...interface{})
 	Debug(bool, string, ...interface{})
 	Outlier(string, ...interface{})
+	Render(string, ...interface{})
 	Blank()
 }
+
+// bufferedLogger records one file's log calls so a --jobs worker can replay
+// them as a single uninterrupted block once the file is done, instead of
+// interleaving its lines with other workers'.
+type bufferedLogger struct {
+	calls []func(Logger)
+}
+
+func (b *bufferedLogger) record(fn func(Logger)) { b.calls = append(b.calls, fn) }
+
+func (b *bufferedLogger) Info(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Info(f, a...) })
+}
+
+func (b *bufferedLogger) Success(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Success(f, a...) })
+}
+
+func (b *bufferedLogger) Warn(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Warn(f, a...) })
+}
+
+func (b *bufferedLogger) Error(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Error(f, a...) })
+}
+
+func (b *bufferedLogger) Debug(verbose bool, f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Debug(verbose, f, a...) })
+}
+
+func (b *bufferedLogger) Outlier(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Outlier(f, a...) })
+}
+
+func (b *bufferedLogger) Render(f string, a ...interface{}) {
+	b.record(func(l Logger) { l.Render(f, a...) })
+}
+
+func (b *bufferedLogger) Blank() {
+	b.record(func(l Logger) { l.Blank() })
+}
+
+// flushTo replays the recorded calls on l in order and clears the buffer.
+// Callers serialize flushes so each file's block stays contiguous.
+func (b *bufferedLogger) flushTo(l Logger) {
+	for _, fn := range b.calls {
+		fn(l)
+	}
+	b.calls = nil
+}
+
+// summaryOnlyLogger implements --summary-only for processFile: per-file
+// Info, Success, Debug, Render, and Blank lines are dropped, while warnings,
+// outliers, and errors pass through. The file's "[i/total] name" header is
+// replayed before its first surviving line so problems keep their context.
+type summaryOnlyLogger struct {
+	Logger
+	header string // Pending per-file header; cleared once printed.
+}
+
+func (l *summaryOnlyLogger) flushHeader() {
+	if l.header != "" {
+		l.Logger.Info("%s", l.header)
+		l.header = ""
+	}
+}
+
+func (l *summaryOnlyLogger) Info(string, ...interface{})        {}
+func (l *summaryOnlyLogger) Success(string, ...interface{})     {}
+func (l *summaryOnlyLogger) Debug(bool, string, ...interface{}) {}
+func (l *summaryOnlyLogger) Render(string, ...interface{})      {}
+func (l *summaryOnlyLogger) Blank()                             {}
+
+func (l *summaryOnlyLogger) Warn(f string, a ...interface{}) {
+	l.flushHeader()
+	l.Logger.Warn(f, a...)
+}
+
+func (l *summaryOnlyLogger) Outlier(f string, a ...interface{}) {
+	l.flushHeader()
+	l.Logger.Outlier(f, a...)
+}
+
+func (l *summaryOnlyLogger) Error(f string, a ...interface{}) {
+	l.flushHeader()
+	l.Logger.Error(f, a...)
+}
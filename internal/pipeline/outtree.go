@@ -0,0 +1,81 @@
+// outtree.go implements --dry-run-output-tree: the resolved output layout without probing.
+package pipeline
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/naming"
+)
+
+// OutputTree discovers media files, resolves every output path the way Run
+// would (filename parsing, show harmonization, episode offset, collisions),
+// and logs the result as a sorted directory tree rooted at OutputDir. Files
+// are never probed, so the tree reflects naming only: files Run would later
+// skip still appear.
+func OutputTree(cfg *config.Config, log Logger) {
+	files, err := Discover(cfg.InputDir)
+	if err != nil {
+		log.Error("File discovery failed: %v", err)
+		return
+	}
+	if len(files) == 0 {
+		log.Warn("No media files found in %s", cfg.InputDir)
+		return
+	}
+
+	layout, err := outputLayout(cfg)
+	if err != nil {
+		log.Error("Invalid output layout: %v", err)
+		return
+	}
+	for _, line := range renderOutputTree(cfg.OutputDir, resolveOutputPaths(cfg, log, layout, files)) {
+		log.Info("%s", line)
+	}
+	log.Blank()
+	log.Info("%d files", len(files))
+}
+
+// resolveOutputPaths returns the final output path of each file under
+// layout, relative to cfg.OutputDir, in sorted order.
+func resolveOutputPaths(cfg *config.Config, log Logger, layout *naming.Layout, files []string) []string {
+	yearIndex := naming.BuildYearVariantIndex(files)
+	resolver := naming.NewCollisionResolver()
+
+	rels := make([]string, 0, len(files))
+	for _, path := range files {
+		_, out := resolveOutput(cfg, log, path, yearIndex, resolver, layout)
+		rel, err := filepath.Rel(cfg.OutputDir, out)
+		if err != nil {
+			rel = out
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+// renderOutputTree formats sorted slash-separated relative paths as an
+// indented tree under root. Each directory is printed once, with a trailing
+// slash, before its entries.
+func renderOutputTree(root string, rels []string) []string {
+	lines := []string{strings.TrimSuffix(root, "/") + "/"}
+	var prev []string
+	for _, rel := range rels {
+		parts := strings.Split(rel, "/")
+		dirs := parts[:len(parts)-1]
+
+		common := 0
+		for common < len(dirs) && common < len(prev) && dirs[common] == prev[common] {
+			common++
+		}
+		for i := common; i < len(dirs); i++ {
+			lines = append(lines, strings.Repeat("  ", i+1)+dirs[i]+"/")
+		}
+		lines = append(lines, strings.Repeat("  ", len(dirs)+1)+parts[len(parts)-1])
+		prev = dirs
+	}
+	return lines
+}
@@ -0,0 +1,86 @@
+// owner.go applies --output-owner and --dir-mode/--file-mode to created output files and directories.
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+)
+
+// chownFunc is the chown implementation. Tests replace it because a real
+// ownership change requires privileges.
+var chownFunc = os.Chown
+
+// missingDirs returns dir and each of its ancestors that do not exist yet,
+// deepest first. Called before os.MkdirAll so only directories Muxmaster
+// creates are later re-owned.
+func missingDirs(dir string) []string {
+	var dirs []string
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dirs
+		}
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// applyOutputOwner chowns the plan's output (plus HLS segments) and the
+// directories created for it to the configured owner. Failures are logged
+// as warnings; the encode itself already succeeded.
+func applyOutputOwner(cfg *config.Config, log Logger, plan *planner.FilePlan, createdDirs []string) {
+	paths := append([]string{plan.OutputPath}, hlsSegments(plan)...)
+	setOwner(cfg, log, append(paths, createdDirs...))
+}
+
+// applyOutputMode chmods the plan's output (plus HLS segments) to
+// --file-mode and the directories created for it to --dir-mode. created may
+// also hold files (a --preview-frame image), which get --file-mode.
+// Failures are logged as warnings; the encode itself already succeeded.
+func applyOutputMode(cfg *config.Config, log Logger, plan *planner.FilePlan, created []string) {
+	paths := append([]string{plan.OutputPath}, hlsSegments(plan)...)
+	setMode(cfg, log, append(paths, created...))
+}
+
+// setOwner chowns paths to --output-owner, warning on failure.
+func setOwner(cfg *config.Config, log Logger, paths []string) {
+	if cfg.OutputUID < 0 && cfg.OutputGID < 0 {
+		return
+	}
+	for _, p := range paths {
+		if err := chownFunc(p, cfg.OutputUID, cfg.OutputGID); err != nil {
+			log.Warn("Cannot set owner of %s: %v", p, err)
+		}
+	}
+}
+
+// setMode chmods directories in paths to --dir-mode and files to
+// --file-mode, warning on failure.
+func setMode(cfg *config.Config, log Logger, paths []string) {
+	if cfg.FileMode == 0 && cfg.DirMode == 0 {
+		return
+	}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			log.Warn("Cannot set mode of %s: %v", p, err)
+			continue
+		}
+		mode := cfg.FileMode
+		if fi.IsDir() {
+			mode = cfg.DirMode
+		}
+		if mode == 0 {
+			continue
+		}
+		if err := os.Chmod(p, mode); err != nil {
+			log.Warn("Cannot set mode of %s: %v", p, err)
+		}
+	}
+}
@@ -1,16 +1,33 @@
 package pipeline
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/ffmpeg"
 	"github.com/backmassage/muxmaster/internal/logging"
+	"github.com/backmassage/muxmaster/internal/naming"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
 )
 
 // --- Discover tests ---
@@ -133,54 +150,2649 @@ func TestDiscover_CaseInsensitiveExtension(t *testing.T) {
 	}
 }
 
+// --- Sidecar subtitle tests ---
+
+func TestFindSidecarSubs_MatchesStemAndLanguage(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "Show - S01E05.mkv")
+	touch(t, dir, "Show - S01E05.eng.srt")
+	touch(t, dir, "Show - S01E05.jpn.ass")
+	touch(t, dir, "Show - S01E05.srt")
+	touch(t, dir, "Show - S01E05.forced.srt")
+	touch(t, dir, "Show - S01E06.eng.srt")    // different episode
+	touch(t, dir, "Show - S01E05.eng.txt")    // not a subtitle
+	touch(t, dir, "Show - S01E05.en.sdh.srt") // nested tags unsupported
+	touch(t, dir, "Show - S01E05 extra.srt")  // stem must match exactly
+
+	subs := FindSidecarSubs(filepath.Join(dir, "Show - S01E05.mkv"))
+
+	want := map[string]string{
+		"Show - S01E05.eng.srt":    "eng",
+		"Show - S01E05.forced.srt": "",
+		"Show - S01E05.jpn.ass":    "jpn",
+		"Show - S01E05.srt":        "",
+	}
+	if len(subs) != len(want) {
+		t.Fatalf("got %d sidecars %v, want %d", len(subs), subs, len(want))
+	}
+	for _, sc := range subs {
+		lang, ok := want[filepath.Base(sc.Path)]
+		if !ok {
+			t.Errorf("unexpected sidecar %q", sc.Path)
+			continue
+		}
+		if sc.Language != lang {
+			t.Errorf("%s: language %q, want %q", filepath.Base(sc.Path), sc.Language, lang)
+		}
+	}
+}
+
+func TestFindSidecarSubs_None(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "Movie (2020).mkv")
+	if subs := FindSidecarSubs(filepath.Join(dir, "Movie (2020).mkv")); len(subs) != 0 {
+		t.Errorf("got %v, want no sidecars", subs)
+	}
+}
+
 // --- RunStats tests ---
 
-func TestRunStats_SpaceSaved(t *testing.T) {
-	s := RunStats{TotalInputBytes: 1000, TotalOutputBytes: 600}
-	if got := s.SpaceSaved(); got != 400 {
-		t.Errorf("SpaceSaved: got %d, want 400", got)
+func TestRunStats_SpaceSaved(t *testing.T) {
+	s := RunStats{TotalInputBytes: 1000, TotalOutputBytes: 600}
+	if got := s.SpaceSaved(); got != 400 {
+		t.Errorf("SpaceSaved: got %d, want 400", got)
+	}
+
+	s2 := RunStats{TotalInputBytes: 100, TotalOutputBytes: 150}
+	if got := s2.SpaceSaved(); got != -50 {
+		t.Errorf("SpaceSaved (negative): got %d, want -50", got)
+	}
+}
+
+// --- Bitrate outlier tests ---
+
+func TestBitrateOutlierTiers(t *testing.T) {
+	cases := []struct {
+		w, h    int
+		kbps    int64
+		outlier bool
+		dir     string
+	}{
+		{1920, 1080, 5000, false, ""},
+		{1920, 1080, 500, true, "low"},
+		{1920, 1080, 20000, true, "high"},
+		{1280, 720, 3000, false, ""},
+		{3840, 2160, 50000, true, "high"},
+		{640, 360, 100, true, "low"},
+	}
+	for _, tc := range cases {
+		pixels := tc.w * tc.h
+		var low, high int64
+		var label string
+		for _, tier := range bitrateTiers {
+			if pixels <= tier.maxPixels {
+				low, high, label = tier.lowKbps, tier.highKbps, tier.label
+				break
+			}
+		}
+		if label == "" {
+			low, high = 15000, 65000
+		}
+		isOutlier := tc.kbps < low || tc.kbps > high
+		if isOutlier != tc.outlier {
+			t.Errorf("%dx%d@%dkbps: outlier=%v, want %v", tc.w, tc.h, tc.kbps, isOutlier, tc.outlier)
+		}
+	}
+}
+
+func lowBitrate1080p() *probe.ProbeResult {
+	return &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", Width: 1920, Height: 1080, BitRate: 1500000},
+	}
+}
+
+func TestLogBitrateOutlier_Disabled(t *testing.T) {
+	cfg := config.DefaultConfig()
+	log := &recordLogger{}
+	logBitrateOutlier(&cfg, log, lowBitrate1080p())
+	if len(log.outliers) != 1 {
+		t.Fatalf("enabled: expected 1 outlier warning, got %v", log.outliers)
+	}
+
+	cfg.Display.ShowBitrateWarnings = false
+	log = &recordLogger{}
+	logBitrateOutlier(&cfg, log, lowBitrate1080p())
+	if len(log.outliers) != 0 {
+		t.Errorf("disabled: expected no outlier warnings, got %v", log.outliers)
+	}
+}
+
+func TestLogBitrateOutlier_CustomTiers(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Display.BitrateTiers = []config.BitrateTier{
+		{MaxHeight: 720, LowKbps: 500, HighKbps: 4000},
+		{MaxHeight: 1080, LowKbps: 1000, HighKbps: 8000},
+	}
+	tiers := outlierTiers(&cfg)
+	if tiers[1].maxPixels != 1920*1080 || tiers[1].label != "<=1080p" {
+		t.Errorf("1080 tier: got %+v", tiers[1])
+	}
+
+	// 1.5 Mb/s at 1080p is low under the built-in tiers but normal here.
+	log := &recordLogger{}
+	logBitrateOutlier(&cfg, log, lowBitrate1080p())
+	if len(log.outliers) != 0 {
+		t.Errorf("custom tiers: expected no warning, got %v", log.outliers)
+	}
+
+	pr := lowBitrate1080p()
+	pr.PrimaryVideo.BitRate = 9000000
+	if dir, _, _, _ := classifyBitrate(pr, tiers, true); dir != "high" {
+		t.Errorf("9 Mb/s at 1080p: got %q, want high", dir)
+	}
+
+	// Above the highest custom tier: not checked.
+	pr.PrimaryVideo.Width, pr.PrimaryVideo.Height = 3840, 2160
+	if dir, _, _, _ := classifyBitrate(pr, tiers, true); dir != "" {
+		t.Errorf("2160p above custom tiers: got %q, want unchecked", dir)
+	}
+}
+
+// --- File stats tests ---
+
+func TestLogFileStats_Chapters(t *testing.T) {
+	log := &transcriptLogger{}
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionRemux, VideoCodec: "copy", ChapterCount: 3})
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionEncode, VideoCodec: "libx265", CpuCRF: 20, ChapterCount: 1})
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionRemux, VideoCodec: "copy"})
+	want := []string{
+		"INFO   Video: copy (remux)",
+		"INFO   Chapters: 3 chapters",
+		"INFO   Video: libx265 | CRF 20 | CPU",
+		"INFO   Chapters: 1 chapter",
+		"INFO   Video: copy (remux)",
+	}
+	if strings.Join(log.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", log.lines, want)
+	}
+}
+
+func TestLogFileStats_HDR10PlusTag(t *testing.T) {
+	log := &transcriptLogger{}
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionRemux, VideoCodec: "copy", HDR10Plus: true})
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionEncode, VideoCodec: "libx265", CpuCRF: 20, HDR10Plus: true})
+	logFileStats(log, &planner.FilePlan{Action: planner.ActionEncode, VideoCodec: "libx265", CpuCRF: 20})
+	want := []string{
+		"INFO   Video: copy (remux) [HDR10+]",
+		"INFO   Video: libx265 | CRF 20 | CPU [HDR10+]",
+		"INFO   Video: libx265 | CRF 20 | CPU",
+	}
+	if strings.Join(log.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", log.lines, want)
+	}
+}
+
+func TestRun_PlanWarningsLogged(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "Movie A (2001).mkv"), make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", Profile: "High 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080},
+		}, nil
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderQSV
+	cfg.DryRun = true
+
+	log := &transcriptLogger{}
+	Run(context.Background(), &cfg, log, nil)
+	want := "WARN   10-bit source encoded to 8-bit profile; banding risk (--dither-8bit to dither)"
+	if !slices.Contains(log.lines, want) {
+		t.Errorf("missing %q in %q", want, log.lines)
+	}
+}
+
+// --- Output retry tests ---
+
+const staleHandleStderr = "[matroska @ 0x55d] Error writing packet: Stale file handle\n" +
+	"av_interleaved_write_frame(): Stale file handle"
+
+// outputRetryCase runs a CPU encode whose ffmpeg fails the given number of
+// times with a stale NFS handle, writing a partial output each time. It
+// returns the number of ffmpeg runs, whether a partial output was still
+// present when a later run began, the result, and the logger.
+func outputRetryCase(t *testing.T, failures int) (runs int, partialSeen bool, ok bool, log *recordLogger) {
+	t.Helper()
+	prev := outputRetryBackoff
+	outputRetryBackoff = time.Millisecond
+	t.Cleanup(func() { outputRetryBackoff = prev })
+
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+	}
+	plan := planner.BuildPlan(&cfg, pr)
+	plan.InputPath = filepath.Join(t.TempDir(), "in.mkv")
+	plan.OutputPath = filepath.Join(t.TempDir(), "out.mkv")
+
+	run := ffmpeg.RunFunc(func(context.Context, []string) ffmpeg.ExecResult {
+		runs++
+		if runs > 1 {
+			if _, err := os.Stat(plan.OutputPath); err == nil {
+				partialSeen = true
+			}
+		}
+		if runs <= failures {
+			touch(t, filepath.Dir(plan.OutputPath), filepath.Base(plan.OutputPath))
+			return ffmpeg.ExecResult{Stderr: staleHandleStderr, Err: errors.New("exit status 1")}
+		}
+		return ffmpeg.ExecResult{}
+	})
+	log = &recordLogger{}
+	ok = attemptWithErrorRetry(context.Background(), &cfg, log, pr, plan, ffmpeg.NewRetryState(plan), run)
+	return runs, partialSeen, ok, log
+}
+
+func TestAttemptWithErrorRetry_StaleHandleRetriesFile(t *testing.T) {
+	runs, partialSeen, ok, log := outputRetryCase(t, 1)
+	if !ok || runs != 2 {
+		t.Fatalf("expected success on the second run, ok=%v runs=%d", ok, runs)
+	}
+	if partialSeen {
+		t.Error("partial output was not removed before the retry")
+	}
+	if len(log.warns) != 1 || !strings.Contains(log.warns[0], "network share") {
+		t.Errorf("warnings: got %v, want one output retry warning", log.warns)
+	}
+}
+
+func TestAttemptWithErrorRetry_StaleHandleGivesUp(t *testing.T) {
+	runs, _, ok, _ := outputRetryCase(t, maxOutputRetries+1)
+	if ok {
+		t.Fatal("expected failure once output retries are exhausted")
+	}
+	if runs != maxOutputRetries+1 {
+		t.Errorf("runs: got %d, want %d", runs, maxOutputRetries+1)
+	}
+}
+
+// --- Remux fallback tests ---
+
+const mp4RejectStderr = "[mp4 @ 0x55d] Could not find tag for codec hevc in stream #0, " +
+	"codec not currently supported in container\nCould not write header for output file #0"
+
+func remuxFallbackCase(t *testing.T, mode config.RemuxFallback) (*planner.FilePlan, []string, bool) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.RemuxFallback = mode
+
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	plan := planner.BuildPlanWithMaxHeight(&cfg, pr, 1080)
+	if plan.Action != planner.ActionRemux {
+		t.Fatalf("setup: expected remux plan, got %v", plan.Action)
+	}
+	plan.InputPath = filepath.Join(t.TempDir(), "in.mkv")
+	plan.OutputPath = filepath.Join(t.TempDir(), "out.mp4")
+
+	var outputs []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		outputs = append(outputs, args[len(args)-1])
+		if len(outputs) == 1 {
+			return ffmpeg.ExecResult{Stderr: mp4RejectStderr, Err: errors.New("exit status 1")}
+		}
+		return ffmpeg.ExecResult{}
+	})
+	ok := attemptWithErrorRetry(context.Background(), &cfg, &recordLogger{}, pr, plan, ffmpeg.NewRetryState(plan), run)
+	return plan, outputs, ok
+}
+
+func TestMatchRemuxIncompatible(t *testing.T) {
+	if !ffmpeg.MatchRemuxIncompatible(mp4RejectStderr) {
+		t.Error("expected MP4 HEVC tag rejection to match")
+	}
+	if ffmpeg.MatchRemuxIncompatible("Could not find tag for codec subrip in stream #2, codec not currently supported in container") {
+		t.Error("subtitle rejections belong to the subtitle retry")
+	}
+}
+
+func TestRemuxFallback_Encode(t *testing.T) {
+	plan, outputs, ok := remuxFallbackCase(t, config.RemuxFallbackEncode)
+	if !ok || len(outputs) != 2 {
+		t.Fatalf("expected success on second run, ok=%v runs=%d", ok, len(outputs))
+	}
+	if plan.Action != planner.ActionEncode || plan.VideoCodec != "libx265" {
+		t.Errorf("fallback plan: action=%v codec=%q, want encode libx265", plan.Action, plan.VideoCodec)
+	}
+	if plan.MaxHeight != 1080 {
+		t.Errorf("fallback plan height cap = %d, want the original 1080", plan.MaxHeight)
+	}
+	if outputs[1] != outputs[0] {
+		t.Errorf("encode fallback should keep output path: %v", outputs)
+	}
+}
+
+func TestRemuxFallback_MKV(t *testing.T) {
+	plan, outputs, ok := remuxFallbackCase(t, config.RemuxFallbackMKV)
+	if !ok || len(outputs) != 2 {
+		t.Fatalf("expected success on second run, ok=%v runs=%d", ok, len(outputs))
+	}
+	if plan.Action != planner.ActionRemux || plan.Container != config.ContainerMKV {
+		t.Errorf("fallback plan: action=%v container=%v, want remux mkv", plan.Action, plan.Container)
+	}
+	if !strings.HasSuffix(outputs[1], "out.mkv") || plan.OutputPath != outputs[1] {
+		t.Errorf("MKV fallback output: got %v, plan %q", outputs, plan.OutputPath)
+	}
+}
+
+func TestRemuxFallback_EncodeTwoPass(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.TargetBitrateKbps = 4000
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.RunTempDir = t.TempDir()
+
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	plan := planner.BuildPlan(&cfg, pr)
+	if plan.Action != planner.ActionRemux {
+		t.Fatalf("setup: expected remux plan, got %v", plan.Action)
+	}
+	plan.InputPath = filepath.Join(t.TempDir(), "in.mkv")
+	plan.OutputPath = filepath.Join(t.TempDir(), "out.mp4")
+
+	var ran, stats []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		joined := strings.Join(args, " ")
+		if i := strings.Index(joined, ":stats="); i >= 0 {
+			stats = append(stats, strings.Fields(joined[i+len(":stats="):])[0])
+		}
+		switch {
+		case len(ran) == 0:
+			ran = append(ran, "remux")
+			return ffmpeg.ExecResult{Stderr: mp4RejectStderr, Err: errors.New("exit status 1")}
+		case args[len(args)-1] == "-":
+			ran = append(ran, "pass 1")
+		default:
+			ran = append(ran, "pass 2")
+		}
+		return ffmpeg.ExecResult{}
+	})
+	if !attemptWithErrorRetry(context.Background(), &cfg, &recordLogger{}, pr, plan, ffmpeg.NewRetryState(plan), run) {
+		t.Fatal("fallback encode failed")
+	}
+	if !plan.TwoPass || !sliceEqual(ran, []string{"remux", "pass 1", "pass 2"}) {
+		t.Fatalf("two-pass %v, ran %v; want the rejected remux, then an analysis pass and the encode", plan.TwoPass, ran)
+	}
+	if len(stats) != 2 || stats[0] == "" || stats[0] != stats[1] {
+		t.Errorf("stats files %q, want one shared non-empty path", stats)
+	}
+}
+
+func TestRun_RemuxFallbackMKVKeepsExistingOutput(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "Movie A (2001).mkv"), make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080},
+			AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+		}, nil
+	}
+	var outputs []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		outputs = append(outputs, args[len(args)-1])
+		return ffmpeg.ExecResult{Stderr: mp4RejectStderr, Err: errors.New("exit status 1")}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.RemuxFallback = config.RemuxFallbackMKV
+
+	files, err := Discover(inputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), files)[0]
+	existing := filepath.Join(cfg.OutputDir, strings.TrimSuffix(rel, ".mp4")+".mkv")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := &transcriptLogger{}
+	if st := Run(context.Background(), &cfg, log, run); st.Failed != 1 {
+		t.Fatalf("failed=%d, want 1: %q", st.Failed, log.lines)
+	}
+	if len(outputs) != 1 || !strings.HasSuffix(outputs[0], ".mp4") {
+		t.Errorf("ran %v, want only the rejected MP4 remux", outputs)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "keep" {
+		t.Errorf("existing MKV output overwritten: %q, %v", data, err)
+	}
+	want := "ERROR Remux rejected by MP4 muxer; MKV fallback skipped: Movie A (2001).mkv exists"
+	if !slices.Contains(log.lines, want) {
+		t.Errorf("missing %q in %q", want, log.lines)
+	}
+}
+
+func TestRemuxFallback_Fail(t *testing.T) {
+	plan, outputs, ok := remuxFallbackCase(t, config.RemuxFallbackFail)
+	if ok || len(outputs) != 1 {
+		t.Errorf("expected failure after one run, ok=%v runs=%d", ok, len(outputs))
+	}
+	if plan.Action != planner.ActionRemux {
+		t.Errorf("plan should be unchanged, got %v", plan.Action)
+	}
+}
+
+// --- Only filter tests ---
+
+func TestExcludedByOnly(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Only = config.ActionFilterRemux
+
+	files := map[string]*probe.ProbeResult{
+		"hevc.mkv": {
+			PrimaryVideo: &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080},
+			AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+		},
+		"h264.mkv": {
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+			AudioStreams: []probe.AudioStream{{Index: 1, Codec: "ac3", Channels: 6}},
+		},
+		"mpeg2.mkv": {
+			PrimaryVideo: &probe.VideoStream{Codec: "mpeg2video", PixFmt: "yuv420p", Width: 720, Height: 480},
+		},
+	}
+
+	var processed []string
+	for _, name := range []string{"h264.mkv", "hevc.mkv", "mpeg2.mkv"} {
+		if !excludedByOnly(&cfg, planner.BuildPlan(&cfg, files[name])) {
+			processed = append(processed, name)
+		}
+	}
+	if !sliceEqual(processed, []string{"hevc.mkv"}) {
+		t.Errorf("--only remux processed %v, want [hevc.mkv]", processed)
+	}
+
+	cfg.Only = config.ActionFilterAll
+	if excludedByOnly(&cfg, planner.BuildPlan(&cfg, files["h264.mkv"])) {
+		t.Error("no --only should keep every file")
+	}
+}
+
+func TestRun_OnlyExcludedFilesNotProcessed(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Show S01E01 hevc.mkv", "Show S01E02 h264.mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probes := countingProbe(t)
+
+	var inputs []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		inputs = append(inputs, filepath.Base(args[slices.Index(args, "-i")+1]))
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o644)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.AutoCrop = true
+	cfg.Only = config.ActionFilterRemux
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != 1 || stats.Skipped != 1 || stats.Failed != 0 {
+		t.Fatalf("Encoded=%d Skipped=%d Failed=%d, want 1, 1, 0: %q", stats.Encoded, stats.Skipped, stats.Failed, log.lines)
+	}
+	// The excluded encode is probed once to plan it, and never again: no
+	// cropdetect pass, no ffmpeg run, no output.
+	if probes["Show S01E02 h264.mkv"] != 1 {
+		t.Errorf("excluded file probed %d times, want 1", probes["Show S01E02 h264.mkv"])
+	}
+	if !sliceEqual(inputs, []string{"Show S01E01 hevc.mkv"}) {
+		t.Errorf("ffmpeg ran on %v, want only the remux", inputs)
+	}
+	written, _ := filepath.Glob(filepath.Join(cfg.OutputDir, "*", "*", "*"))
+	for i, path := range written {
+		written[i] = filepath.Base(path)
+	}
+	if !sliceEqual(written, []string{"Show - S01E01.mkv"}) {
+		t.Errorf("outputs %v, want only the remux", written)
+	}
+	if !slices.Contains(log.lines, "WARN Skip (--only remux, planned encode): Show S01E02 h264.mkv") {
+		t.Errorf("missing --only skip line: %q", log.lines)
+	}
+}
+
+// --- Benchmark tests ---
+
+func TestBumpQuality_Direction(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	rs := &ffmpeg.RetryState{CpuCRF: 20, VaapiQP: 20}
+
+	if name, v, ok := bumpQuality(&cfg, rs, qualityBumpStep); !ok || name != "CRF" || v != 21 {
+		t.Errorf("overshoot bump: got %s %d ok=%v, want CRF 21", name, v, ok)
+	}
+	if _, v, ok := bumpQuality(&cfg, rs, -tinyRetryStep); !ok || v != 19 || rs.CpuCRF != 19 {
+		t.Errorf("tiny retry should lower CRF to 19, got %d ok=%v", v, ok)
+	}
+
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	rs.VaapiQP = planner.VaapiQPMin + 1
+	if _, v, ok := bumpQuality(&cfg, rs, -tinyRetryStep); ok || v != planner.VaapiQPMin+1 {
+		t.Errorf("QP below min should be refused and left unchanged, got %d ok=%v", v, ok)
+	}
+}
+
+func TestExecuteWithRetry_TinyOutput(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.CpuCRF = 24 // Leave room above CpuCRFMin for the retry.
+	cfg.RetryIfTinyPct = 5
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.mkv")
+	if err := os.WriteFile(in, make([]byte, 10000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+
+	// encode writes sizes[i] bytes on the i-th run and records -crf.
+	encode := func(sizes ...int) (*planner.FilePlan, []string) {
+		plan := planner.BuildPlan(&cfg, pr)
+		plan.InputPath = in
+		plan.OutputPath = filepath.Join(t.TempDir(), "out.mkv")
+		var crfs []string
+		run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+			for i, a := range args {
+				if a == "-crf" {
+					crfs = append(crfs, args[i+1])
+				}
+			}
+			os.WriteFile(args[len(args)-1], make([]byte, sizes[len(crfs)-1]), 0o644)
+			return ffmpeg.ExecResult{}
+		})
+		if !executeWithRetry(context.Background(), &cfg, &recordLogger{}, pr, plan, ffmpeg.NewRetryState(plan), run) {
+			t.Fatal("executeWithRetry failed")
+		}
+		return plan, crfs
+	}
+
+	plan, crfs := encode(200, 3000)
+	want := []string{strconv.Itoa(plan.CpuCRF), strconv.Itoa(plan.CpuCRF - tinyRetryStep)}
+	if !sliceEqual(crfs, want) {
+		t.Errorf("2%% output should re-encode at lower CRF: got %v, want %v", crfs, want)
+	}
+
+	if _, crfs := encode(3000); len(crfs) != 1 {
+		t.Errorf("30%% output is plausible, expected one run, got %v", crfs)
+	}
+
+	// Without smart quality, or under a fixed CRF, the retry still runs.
+	cfg.Encoder.SmartQuality = false
+	if plan, crfs := encode(200, 3000); !sliceEqual(crfs, []string{strconv.Itoa(plan.CpuCRF), strconv.Itoa(plan.CpuCRF - tinyRetryStep)}) {
+		t.Errorf("no smart quality: got %v, want a retry at lower CRF", crfs)
+	}
+	cfg.Encoder.SmartQuality = true
+	cfg.Encoder.ActiveQualityOverride = "24"
+	if _, crfs := encode(200, 3000); len(crfs) != 2 {
+		t.Errorf("fixed CRF: got %v, want a retry", crfs)
+	}
+	cfg.Encoder.ActiveQualityOverride = ""
+
+	cfg.RetryIfTinyPct = 0
+	if _, crfs := encode(200); len(crfs) != 1 {
+		t.Errorf("tiny retry is off by default, expected one run, got %v", crfs)
+	}
+}
+
+func TestBenchmarkPlan_NullOutput(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Display.FfmpegFPS = false
+
+	// An edge-safe HEVC clip would normally remux; the benchmark must encode.
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "hevc", Profile: "Main", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	bcfg, plan := benchmarkPlan(&cfg, pr, "/tmp/clip.mkv")
+	if plan.Action != planner.ActionEncode {
+		t.Fatalf("action = %v, want encode", plan.Action)
+	}
+
+	args := strings.Join(ffmpeg.Build(bcfg, plan, ffmpeg.NewRetryState(plan)), " ")
+	for _, want := range []string{"-stats", "-i /tmp/clip.mkv", "-c:v libx265"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args missing %q: %s", want, args)
+		}
+	}
+	if !strings.HasSuffix(args, " -f null -") {
+		t.Errorf("args should end with null muxer output: %s", args)
+	}
+	if cfg.Display.FfmpegFPS {
+		t.Error("benchmarkPlan must not modify the caller's config")
+	}
+}
+
+func TestParseFFmpegStats(t *testing.T) {
+	stderr := "frame=  120 fps= 60 q=28.0 size=N/A time=00:00:05.00 bitrate=N/A speed=2.5x\r" +
+		"frame=  720 fps=118.6 q=-0.0 Lsize=N/A time=00:01:02.50 bitrate=N/A speed=4.94x\n" +
+		"[aac @ 0x1] Qavg: 512.0\n"
+	st, ok := ParseFFmpegStats(stderr)
+	if !ok {
+		t.Fatal("expected a stats line")
+	}
+	want := BenchmarkStats{Frames: 720, FPS: 118.6, Speed: 4.94, Seconds: 62.5}
+	if st != want {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
+
+	if _, ok := ParseFFmpegStats("Error opening input"); ok {
+		t.Error("expected no stats for stderr without progress lines")
+	}
+}
+
+// --- Analyze table tests ---
+
+func TestFitName_Multibyte(t *testing.T) {
+	long := "[Group] 鬼滅の刃 刀鍛冶の里編 - 01 [1080p][HEVC] 日本語タイトル.mkv"
+	short := "進撃の巨人 - 01.mkv"
+	const w = 20
+
+	for _, name := range []string{long, short} {
+		got := fitName(name, w)
+		if !utf8.ValidString(got) {
+			t.Errorf("fitName(%q) produced invalid UTF-8: %q", name, got)
+		}
+		if n := utf8.RuneCountInString(got); n != w {
+			t.Errorf("fitName(%q) is %d runes wide, want %d", name, n, w)
+		}
+	}
+
+	if got := fitName(long, w); !strings.HasSuffix(got, "…") || !strings.HasPrefix(got, "[Group] 鬼滅の刃") {
+		t.Errorf("truncated name: got %q", got)
+	}
+	if got := fitName(short, w); strings.TrimRight(got, " ") != short {
+		t.Errorf("short name should be padded, not cut: got %q", got)
+	}
+}
+
+func TestFindInconsistentSeasons(t *testing.T) {
+	dir := "/media/Show/Season 01"
+	rows := []fileRow{
+		{Name: "Show - S01E01.mkv", Dir: dir, VideoCodec: "h264", Resolution: "1920x1080", Container: "mkv"},
+		{Name: "Show - S01E02.mkv", Dir: dir, VideoCodec: "hevc", Resolution: "1920x1080", Container: "mkv"},
+		{Name: "Show - S02E01.mkv", Dir: "/media/Show/Season 02", VideoCodec: "hevc", Resolution: "1920x1080", Container: "mkv"},
+		{Name: "Show - S02E02.mkv", Dir: "/media/Show/Season 02", VideoCodec: "hevc", Resolution: "1920x1080", Container: "mkv"},
+		{Name: "Some Movie (2020).mkv", Dir: "/media/Movies", VideoCodec: "mpeg4", Resolution: "720x480", Container: "mkv"},
+	}
+
+	got := findInconsistentSeasons(rows)
+	if len(got) != 1 {
+		t.Fatalf("got %d flagged seasons (%+v), want 1", len(got), got)
+	}
+	m := got[0]
+	if m.Key.Season != 1 || m.Files != 2 {
+		t.Errorf("flagged %+v, want season 1 with 2 files", m)
+	}
+	if !sliceEqual(m.Codecs, []string{"h264", "hevc"}) {
+		t.Errorf("codecs = %v, want [h264 hevc]", m.Codecs)
+	}
+	if len(m.Resolutions) != 1 || len(m.Containers) != 1 {
+		t.Errorf("resolution/container should be uniform: %v %v", m.Resolutions, m.Containers)
+	}
+
+	log := &recordLogger{}
+	printConsistencyReport(log, got)
+	if len(log.outliers) != 1 || !strings.Contains(log.outliers[0], "codecs h264/hevc") {
+		t.Errorf("report lines = %v", log.outliers)
+	}
+}
+
+func TestWriteAnalysisCSV(t *testing.T) {
+	rows := []fileRow{
+		{Name: "Show, Part 1.mkv", Resolution: "1920x1080", VideoCodec: "h264", VideoKbps: 4000, AudioDesc: "aac 2ch"},
+		{Name: "B.mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4200, AudioDesc: "ac3 6ch"},
+		{Name: "C.mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4400, AudioDesc: "aac 2ch"},
+		{Name: "D.mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4600, AudioDesc: "aac 2ch"},
+		{Name: "\"Huge\".mkv", Resolution: "3840x2160", VideoCodec: "h264", VideoKbps: 60000},
+		{Name: "Unknown.mkv", VideoCodec: "mpeg4"},
+	}
+	var vals []float64
+	for _, r := range rows {
+		if r.VideoKbps > 0 {
+			vals = append(vals, float64(r.VideoKbps))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeAnalysisCSV(&buf, rows, computeStats(vals, 1.5, 3.0)); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("re-parse: %v", err)
+	}
+	want := [][]string{
+		{"file", "resolution", "video_codec", "video_kbps", "audio", "outlier"},
+		{"Show, Part 1.mkv", "1920x1080", "h264", "4000", "aac 2ch", ""},
+		{"B.mkv", "1920x1080", "hevc", "4200", "ac3 6ch", ""},
+		{"C.mkv", "1920x1080", "hevc", "4400", "aac 2ch", ""},
+		{"D.mkv", "1920x1080", "hevc", "4600", "aac 2ch", ""},
+		{"\"Huge\".mkv", "3840x2160", "h264", "60000", "", "extreme"},
+		{"Unknown.mkv", "", "mpeg4", "", "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %q", len(records), len(want), records)
+	}
+	for i := range want {
+		if !slices.Equal(records[i], want[i]) {
+			t.Errorf("record %d: got %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestWriteAnalysisJSON(t *testing.T) {
+	rows := []fileRow{
+		{Name: "A.mkv", Dir: "/m", Container: "mkv", Resolution: "1920x1080", VideoCodec: "h264", VideoKbps: 4000, AudioDesc: "aac 2ch"},
+		{Name: "B.mkv", Dir: "/m", Container: "mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4200},
+		{Name: "C.mkv", Dir: "/m", Container: "mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4400},
+		{Name: "D.mkv", Dir: "/m", Container: "mkv", Resolution: "1920x1080", VideoCodec: "hevc", VideoKbps: 4600},
+		{Name: "E.mkv", Dir: "/m", Container: "mkv", Resolution: "1920x1080", VideoCodec: "h264", VideoKbps: 5600},
+		{Name: "F.mp4", Dir: "/m", Container: "mp4", Resolution: "3840x2160", VideoCodec: "h264", VideoKbps: 60000},
+	}
+	var vals []float64
+	for _, r := range rows {
+		vals = append(vals, float64(r.VideoKbps))
+	}
+	vStats := computeStats(vals, 1.5, 3.0)
+
+	var buf bytes.Buffer
+	if err := writeAnalysisJSON(&buf, rows, 2, vStats); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	for _, key := range []string{"files", "probed", "skipped", "outliers", "extremes", "video_kbps_iqr"} {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("missing key %q", key)
+		}
+	}
+
+	var got analysisJSON
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Probed != 6 || got.Skipped != 2 || len(got.Files) != 6 || got.IQR == nil {
+		t.Fatalf("got %+v", got)
+	}
+	for i, f := range got.Files {
+		if want := vStats.classify(float64(rows[i].VideoKbps)); f.Class != want || f.File != rows[i].Name {
+			t.Errorf("file %d: got %s class %q, want %s class %q", i, f.File, f.Class, rows[i].Name, want)
+		}
+	}
+	if got.Files[5].Class != "extreme" {
+		t.Errorf("60000 kbps: class %q, want extreme", got.Files[5].Class)
+	}
+	outliers, extremes := printAnalysisTable(rows, vStats)
+	if got.Outliers != outliers || got.Extremes != extremes {
+		t.Errorf("JSON counts %d/%d, table counts %d/%d", got.Outliers, got.Extremes, outliers, extremes)
+	}
+}
+
+func TestAggregateCodecStats(t *testing.T) {
+	const gib = 1 << 30
+	rows := []fileRow{
+		{Name: "a.mkv", VideoCodec: "h264", VideoKbps: 4000, Bytes: 2 * gib},
+		{Name: "b.mpg", VideoCodec: "mpeg2video", VideoKbps: 6000, Bytes: 5 * gib},
+		{Name: "c.mkv", VideoCodec: "h264", VideoKbps: 8000, Bytes: 3 * gib},
+		{Name: "d.mpg", VideoCodec: "mpeg2video", VideoKbps: 5000, Bytes: 5 * gib},
+		{Name: "e.mpg", VideoCodec: "mpeg2video", VideoKbps: 9000, Bytes: 6 * gib},
+		{Name: "f.mkv", VideoCodec: "h264", Bytes: 1 * gib}, // Unknown bitrate: counted, not averaged.
+		{Name: "g.mka", Bytes: 100},
+	}
+	got := aggregateCodecStats(rows)
+	want := []codecStat{
+		{Codec: "mpeg2video", Count: 3, MeanKbps: 6667, MedianKbps: 6000, Bytes: 16 * gib},
+		{Codec: "h264", Count: 3, MeanKbps: 6000, MedianKbps: 6000, Bytes: 6 * gib},
+		{Codec: "", Count: 1, Bytes: 100},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got := aggregateCodecStats(nil); len(got) != 0 {
+		t.Errorf("no rows: got %+v", got)
+	}
+}
+
+func TestComputeStats_TighterMultipliersFlagMore(t *testing.T) {
+	vals := []float64{4000, 4200, 4400, 4600, 4800, 5000, 6500, 9000, 2500}
+	count := func(b iqrBounds) (outliers, extremes int) {
+		for _, v := range vals {
+			switch b.classify(v) {
+			case "outlier":
+				outliers++
+			case "extreme":
+				extremes++
+			}
+		}
+		return outliers, extremes
+	}
+
+	defO, defE := count(computeStats(vals, 1.5, 3.0))
+	tightO, tightE := count(computeStats(vals, 0.2, 0.5))
+	if tightO+tightE <= defO+defE {
+		t.Errorf("tight multipliers flagged %d, default %d; want more", tightO+tightE, defO+defE)
+	}
+	if tightE <= defE {
+		t.Errorf("tight multipliers: %d extreme, default %d; want more", tightE, defE)
+	}
+	looseO, looseE := count(computeStats(vals, 5, 10))
+	if looseO+looseE != 0 {
+		t.Errorf("loose multipliers flagged %d outlier(s), %d extreme(s); want none", looseO, looseE)
+	}
+}
+
+// --- Output owner tests ---
+
+func TestMissingDirs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "Show", "Season 01")
+	got := missingDirs(dir)
+	want := []string{dir, filepath.Join(root, "Show")}
+	if !sliceEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := missingDirs(root); len(got) != 0 {
+		t.Errorf("existing dir: got %v, want none", got)
+	}
+}
+
+func TestApplyOutputOwner(t *testing.T) {
+	type call struct {
+		path     string
+		uid, gid int
+	}
+	var calls []call
+	orig := chownFunc
+	chownFunc = func(path string, uid, gid int) error {
+		calls = append(calls, call{path, uid, gid})
+		if strings.HasSuffix(path, "Show") {
+			return errors.New("operation not permitted")
+		}
+		return nil
+	}
+	defer func() { chownFunc = orig }()
+
+	cfg := config.DefaultConfig()
+	plan := &planner.FilePlan{OutputPath: "/out/Show/Season 01/Show - S01E01.mkv", Container: config.ContainerMKV}
+	dirs := []string{"/out/Show/Season 01", "/out/Show"}
+	log := &recordLogger{}
+
+	applyOutputOwner(&cfg, log, plan, dirs)
+	if len(calls) != 0 {
+		t.Fatalf("owner unset: expected no chown calls, got %v", calls)
+	}
+
+	cfg.OutputUID, cfg.OutputGID = 1000, 100
+	applyOutputOwner(&cfg, log, plan, dirs)
+	want := []call{
+		{plan.OutputPath, 1000, 100},
+		{"/out/Show/Season 01", 1000, 100},
+		{"/out/Show", 1000, 100},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: got %v, want %v", i, calls[i], want[i])
+		}
+	}
+	if len(log.warns) != 1 {
+		t.Errorf("chown failure should warn once, got %v", log.warns)
+	}
+}
+
+func TestRun_OutputModes(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "Show S01E01.mkv"), make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.DirMode = 0o775
+	cfg.FileMode = 0o664
+
+	log := &transcriptLogger{}
+	if stats := Run(context.Background(), &cfg, log, run); stats.Encoded != 1 {
+		t.Fatalf("Encoded=%d, want 1: %q", stats.Encoded, log.lines)
+	}
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(cfg.OutputDir, "Show"):                                   0o775,
+		filepath.Join(cfg.OutputDir, "Show", "Season 01"):                      0o775,
+		filepath.Join(cfg.OutputDir, "Show", "Season 01", "Show - S01E01.mkv"): 0o664,
+	} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("%s: mode %v, want %v", path, fi.Mode().Perm(), want)
+		}
+	}
+}
+
+// --- Chapter verification tests ---
+
+func TestChapterMismatch(t *testing.T) {
+	chapters := func(titles ...string) []probe.Chapter {
+		var cs []probe.Chapter
+		for _, title := range titles {
+			cs = append(cs, probe.Chapter{Title: title})
+		}
+		return cs
+	}
+	for _, tc := range []struct {
+		name     string
+		src, out []probe.Chapter
+		want     string
+	}{
+		{"none", nil, nil, ""},
+		{"match", chapters("Intro", "Part 1"), chapters("Intro", "Part 1"), ""},
+		{"dropped", chapters("Intro", "Part 1", "Credits"), nil, "Chapter count mismatch: source 3, output 0"},
+		{"added", nil, chapters(""), "Chapter count mismatch: source 0, output 1"},
+		{"fewer", chapters("A", "B", "C"), chapters("A", "B"), "Chapter count mismatch: source 3, output 2"},
+		{"renamed", chapters("Intro", "Part 1"), chapters("Chapter 1", "Part 1"), "Chapter titles changed: 1 of 2"},
+	} {
+		if got := chapterMismatch(tc.src, tc.out); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// --- Audio sync verification tests ---
+
+func TestAudioSyncDrift(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		srcV, srcA, outV, outA float64
+		want                   float64
+		ok                     bool
+	}{
+		{"in sync", 1320.04, 1320.06, 1320.04, 1320.06, 0, true},
+		{"source audio overhang kept", 1320.0, 1321.5, 1320.0, 1321.5, 0, true},
+		{"audio grew", 1320.0, 1320.0, 1320.0, 1321.2, 1.2, true},
+		{"video dropped frames", 1320.0, 1320.0, 1318.0, 1320.0, 2.0, true},
+		{"audio truncated", 1320.0, 1320.0, 1320.0, 1200.0, -120.0, true},
+		{"unknown output audio", 1320.0, 1320.0, 1320.0, 0, 0, false},
+		{"unknown source video", 0, 1320.0, 1320.0, 1320.0, 0, false},
+	} {
+		got, ok := audioSyncDrift(tc.srcV, tc.srcA, tc.outV, tc.outA)
+		if ok != tc.ok || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: got %.3f, %v; want %.3f, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestVerifyAudioSync_WarnsBeyondTolerance(t *testing.T) {
+	orig := probeFile
+	defer func() { probeFile = orig }()
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Duration: 600},
+			AudioStreams: []probe.AudioStream{{Duration: 600.1}, {Duration: 601}},
+		}, nil
+	}
+	cfg := config.DefaultConfig()
+	cfg.VerifyAudioSync = true
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Duration: 600},
+		AudioStreams: []probe.AudioStream{{Duration: 600}, {Duration: 600}},
+	}
+	plan := &planner.FilePlan{OutputPath: "/out/a.mkv", Container: config.ContainerMKV, Audio: planner.AudioPlan{CopyAll: true}}
+
+	log := &transcriptLogger{}
+	verifyAudioSync(context.Background(), &cfg, log, pr, plan)
+	if len(log.lines) != 1 || !strings.Contains(log.lines[0], "WARN") || !strings.Contains(log.lines[0], "a:1: +1.00s") {
+		t.Errorf("want one warning for a:1, got %q", log.lines)
+	}
+}
+
+// --- State ledger tests ---
+
+func TestLedger_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "a.mkv")
+	if err := os.WriteFile(input, make([]byte, minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(dir, "state.json")
+	l, err := openLedger(statePath)
+	if err != nil {
+		t.Fatalf("open missing ledger: %v", err)
+	}
+	if l.done(input, fi) {
+		t.Error("empty ledger reports done")
+	}
+	if err := l.markDone(input, fi, "/out/a.mkv"); err != nil {
+		t.Fatalf("markDone: %v", err)
+	}
+
+	reloaded, err := openLedger(statePath)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if !reloaded.done(input, fi) {
+		t.Error("reloaded ledger lost the entry")
+	}
+	if e := reloaded.files[input]; e.Output != "/out/a.mkv" || e.Size != minFileSize {
+		t.Errorf("entry = %+v", e)
+	}
+
+	// A modified input is no longer done.
+	later := fi.ModTime().Add(time.Minute)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ = os.Stat(input); reloaded.done(input, fi) {
+		t.Error("modified input still reported done")
+	}
+
+	if l, err := openLedger(""); l != nil || err != nil || l.done(input, fi) {
+		t.Errorf("no --state: got %v, %v", l, err)
+	}
+	if err := os.WriteFile(statePath, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openLedger(statePath); err == nil {
+		t.Error("corrupt ledger should fail to open")
+	}
+}
+
+func TestRun_StateSkipsCompletedOnResume(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Movie A (2001).mkv", "Movie B (2002).mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+
+	var (
+		mu      sync.Mutex
+		ran     []string
+		failing = "Movie B"
+	)
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		out := args[len(args)-1]
+		mu.Lock()
+		ran = append(ran, filepath.Base(out))
+		fail := failing != "" && strings.Contains(out, failing)
+		mu.Unlock()
+		if fail {
+			return ffmpeg.ExecResult{Err: errors.New("boom")}
+		}
+		return ffmpeg.ExecResult{Err: os.WriteFile(out, make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.SkipExisting = false // Only the ledger may skip.
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	log := &transcriptLogger{}
+	if stats := Run(context.Background(), &cfg, log, run); stats.Encoded != 1 || stats.Failed != 1 {
+		t.Fatalf("first run: encoded=%d failed=%d, want 1 and 1: %q", stats.Encoded, stats.Failed, log.lines)
+	}
+
+	mu.Lock()
+	ran, failing = nil, ""
+	mu.Unlock()
+	log = &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != 1 || stats.Skipped != 1 {
+		t.Fatalf("resume: encoded=%d skipped=%d, want 1 and 1: %q", stats.Encoded, stats.Skipped, log.lines)
+	}
+	if len(ran) != 1 || !strings.HasPrefix(ran[0], "Movie B") {
+		t.Errorf("resume ran %q, want only Movie B", ran)
+	}
+	if !slices.Contains(log.lines, "WARN Skip (done in --state): Movie A (2001).mkv") {
+		t.Errorf("missing ledger skip line: %q", log.lines)
+	}
+}
+
+// --- Dual audio tests ---
+
+func TestRun_DualAudioKeepsUntaggedUnderAudioLangs(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Show - S01E01 [Dual Audio].mkv", "Show - S01E02.mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+			AudioStreams: []probe.AudioStream{
+				{Codec: "aac", Channels: 2, SampleRate: 48000, Language: "eng"},
+				{Codec: "aac", Channels: 2, SampleRate: 48000},
+			},
+		}, nil
+	}
+	maps := map[string][]string{}
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		out := args[len(args)-1]
+		for i, a := range args[:len(args)-1] {
+			if a == "-map" && strings.HasPrefix(args[i+1], "0:a") {
+				maps[filepath.Base(out)] = append(maps[filepath.Base(out)], args[i+1])
+			}
+		}
+		return ffmpeg.ExecResult{Err: os.WriteFile(out, make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Audio.Langs = []string{"eng"}
+
+	log := &transcriptLogger{}
+	if stats := Run(context.Background(), &cfg, log, run); stats.Encoded != 2 {
+		t.Fatalf("encoded=%d, want 2: %q", stats.Encoded, log.lines)
+	}
+	want := map[string][]string{
+		"Show - S01E01.mkv": {"0:a"}, // Both tracks kept and copied whole.
+		"Show - S01E02.mkv": {"0:a:0"},
+	}
+	for name, w := range want {
+		if !sliceEqual(maps[name], w) {
+			t.Errorf("%s: audio maps %v, want %v", name, maps[name], w)
+		}
+	}
+}
+
+// --- Max file size tests ---
+
+func TestRun_MaxFileSizeSkipsOversized(t *testing.T) {
+	inputDir := t.TempDir()
+	for name, size := range map[string]int{"Movie A (2001).mkv": 2 * minFileSize, "Movie B (2002).mkv": 10 * minFileSize} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	var probed []string
+	probeFile = func(_ context.Context, _, path string) (*probe.ProbeResult, error) {
+		probed = append(probed, filepath.Base(path))
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.MaxFileSize = 5 * minFileSize
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != 1 || stats.Skipped != 1 || stats.Failed != 0 {
+		t.Fatalf("encoded=%d skipped=%d failed=%d, want 1, 1, 0: %q", stats.Encoded, stats.Skipped, stats.Failed, log.lines)
+	}
+	if !sliceEqual(probed, []string{"Movie A (2001).mkv"}) {
+		t.Errorf("probed %v, want only the file under the cap", probed)
+	}
+	want := "WARN Skip (9.8 KiB exceeds --max-file-size 4.9 KiB): Movie B (2002).mkv"
+	if !slices.Contains(log.lines, want) {
+		t.Errorf("missing %q in %q", want, log.lines)
+	}
+}
+
+// --- Two-pass tests ---
+
+func TestRun_TwoPassTargetBitrate(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "Movie A (2001).mkv"), make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+
+	var ran, stats []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		joined := strings.Join(args, " ")
+		if i := strings.Index(joined, ":stats="); i >= 0 {
+			stats = append(stats, strings.Fields(joined[i+len(":stats="):])[0])
+		}
+		out := args[len(args)-1]
+		if out == "-" {
+			ran = append(ran, "pass 1")
+			return ffmpeg.ExecResult{}
+		}
+		ran = append(ran, "pass 2")
+		// Larger than the input: a constant-quality encode would escalate.
+		return ffmpeg.ExecResult{Err: os.WriteFile(out, make([]byte, 4*minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.RunTempDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.TargetBitrateKbps = 4000
+
+	log := &transcriptLogger{}
+	if st := Run(context.Background(), &cfg, log, run); st.Encoded != 1 {
+		t.Fatalf("encoded=%d, want 1: %q", st.Encoded, log.lines)
+	}
+	if !sliceEqual(ran, []string{"pass 1", "pass 2"}) {
+		t.Errorf("ran %v, want one analysis pass then one encode", ran)
+	}
+	if len(stats) != 2 || stats[0] != stats[1] || !strings.HasPrefix(stats[0], cfg.RunTempDir) {
+		t.Fatalf("stats files %v, want one shared file under the run temp dir", stats)
+	}
+	if _, err := os.Stat(filepath.Dir(stats[0])); !os.IsNotExist(err) {
+		t.Errorf("pass log directory not removed: %v", err)
+	}
+}
+
+// --- Staging tests ---
+
+// stageOutput writes a fake completed encode under the staging mirror of
+// "Show/Season 01/Show - S01E01.mkv" and returns its plan.
+func stageOutput(t *testing.T, cfg *config.Config) *planner.FilePlan {
+	t.Helper()
+	staged, err := stagingPath(cfg, filepath.Join(cfg.OutputDir, "Show", "Season 01", "Show - S01E01.mkv"))
+	if err != nil {
+		t.Fatalf("stagingPath: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(staged, []byte("encoded"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &planner.FilePlan{OutputPath: staged, Container: config.ContainerMKV}
+}
+
+func assertPublished(t *testing.T, cfg *config.Config, plan *planner.FilePlan, staged string) {
+	t.Helper()
+	final := filepath.Join(cfg.OutputDir, "Show", "Season 01", "Show - S01E01.mkv")
+	if plan.OutputPath != final {
+		t.Errorf("OutputPath: got %s, want %s", plan.OutputPath, final)
+	}
+	if data, err := os.ReadFile(final); err != nil || string(data) != "encoded" {
+		t.Errorf("published file: got %q, %v", data, err)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("staged file still present: %v", err)
+	}
+	if _, err := os.Stat(final + ".part"); !os.IsNotExist(err) {
+		t.Errorf("temporary .part file left behind: %v", err)
+	}
+}
+
+func TestPublishOutput_SameFilesystemRename(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.OutputDir = filepath.Join(t.TempDir(), "library")
+	cfg.StagingDir = filepath.Join(t.TempDir(), "staging")
+	plan := stageOutput(t, &cfg)
+	staged := plan.OutputPath
+
+	if err := publishOutput(&cfg, plan); err != nil {
+		t.Fatalf("publishOutput: %v", err)
+	}
+	assertPublished(t, &cfg, plan, staged)
+}
+
+func TestPublishOutput_CrossFilesystemCopy(t *testing.T) {
+	var renames []string
+	orig := renameFunc
+	renameFunc = func(src, dst string) error {
+		renames = append(renames, dst)
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EXDEV}
+	}
+	defer func() { renameFunc = orig }()
+
+	cfg := config.DefaultConfig()
+	cfg.OutputDir = filepath.Join(t.TempDir(), "library")
+	cfg.StagingDir = filepath.Join(t.TempDir(), "staging")
+	plan := stageOutput(t, &cfg)
+	staged := plan.OutputPath
+
+	if err := publishOutput(&cfg, plan); err != nil {
+		t.Fatalf("publishOutput: %v", err)
+	}
+	if len(renames) != 1 {
+		t.Errorf("expected one attempted rename before the copy fallback, got %v", renames)
+	}
+	assertPublished(t, &cfg, plan, staged)
+}
+
+// --- Retry log tests ---
+
+func TestRetryLogPath_SameNameInputs(t *testing.T) {
+	a := retryLogPath("/logs", "/in/Show/Season 01/S01E01.mkv")
+	b := retryLogPath("/logs", "/in/Show/Season 02/S01E01.mkv")
+	if a == b {
+		t.Errorf("same-named inputs share retry log %s", a)
+	}
+	for _, p := range []string{a, b} {
+		if filepath.Dir(p) != "/logs" || !strings.HasPrefix(filepath.Base(p), "S01E01.mkv.") || !strings.HasSuffix(p, ".log") {
+			t.Errorf("retry log %s, want /logs/S01E01.mkv.<hash>.log", p)
+		}
+	}
+	if again := retryLogPath("/logs", "/in/Show/Season 01/S01E01.mkv"); again != a {
+		t.Errorf("retry log path not stable: %s then %s", a, again)
+	}
+}
+
+func TestRetryLog_FailedEncode(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Display.RetryLog = filepath.Join(t.TempDir(), "retry")
+
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Channels: 2}},
+	}
+	plan := planner.BuildPlan(&cfg, pr)
+	plan.InputPath = "/in/My Show - S01E01.mkv"
+	plan.OutputPath = filepath.Join(t.TempDir(), "out.mkv")
+
+	// First attempt overflows the mux queue (retried), the second fails for good.
+	calls := 0
+	failing := ffmpeg.RunFunc(func(context.Context, []string) ffmpeg.ExecResult {
+		calls++
+		if calls == 1 {
+			return ffmpeg.ExecResult{Stderr: "Too many packets buffered for output stream 0:1.", Err: errors.New("exit status 1")}
+		}
+		return ffmpeg.ExecResult{Stderr: "[hevc @ 0x1] decode error\nConversion failed!", Err: errors.New("exit status 187")}
+	})
+	trail := &attemptTrail{}
+	if attemptWithErrorRetry(context.Background(), &cfg, &recordLogger{}, pr, plan, ffmpeg.NewRetryState(plan), trail.wrap(failing)) {
+		t.Fatal("setup: expected the encode to fail")
+	}
+	writeRetryLog(&recordLogger{}, cfg.Display.RetryLog, trail, plan.InputPath)
+
+	data, err := os.ReadFile(retryLogPath(cfg.Display.RetryLog, plan.InputPath))
+	if err != nil {
+		t.Fatalf("retry log not written: %v", err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"=== Attempt 1: exit status 1 ===",
+		"Too many packets buffered",
+		"=== Attempt 2: exit status 187 ===",
+		"Conversion failed!",
+		"-i '/in/My Show - S01E01.mkv'",
+		"-max_muxing_queue_size 16384", // second attempt's command reflects the retry fix
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("retry log missing %q:\n%s", want, got)
+		}
+	}
+}
+
+// --- Preview frame tests ---
+
+func TestWritePreviewFrame(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.PreviewFrame = 120
+	out := t.TempDir()
+	plan := &planner.FilePlan{
+		Action:     planner.ActionEncode,
+		InputPath:  "/in/Show - S01E01.mkv",
+		OutputPath: filepath.Join(out, "Show - S01E01.mkv"),
+	}
+
+	var got []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		got = args
+		return ffmpeg.ExecResult{}
+	})
+	created := writePreviewFrame(context.Background(), &cfg, &recordLogger{}, plan, run)
+
+	dest := filepath.Join(out, ".compare", "Show - S01E01.png")
+	if len(got) == 0 || got[len(got)-1] != dest {
+		t.Fatalf("comparison should be written to %s, got args %v", dest, got)
+	}
+	if len(created) != 2 || created[0] != dest || created[1] != filepath.Dir(dest) {
+		t.Errorf("created = %v, want image then .compare dir", created)
+	}
+
+	got = nil
+	plan.Action = planner.ActionRemux
+	if writePreviewFrame(context.Background(), &cfg, &recordLogger{}, plan, run) != nil || got != nil {
+		t.Error("remuxes should not get a preview frame")
+	}
+}
+
+// --- Output tree tests ---
+
+func TestResolveOutputPaths_TreeWithCollision(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(inputDir, "rerip"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"Show S01E01.mkv",
+		"Show S01E02.mkv",
+		"Show S02E01.mkv",
+		"rerip/Show S01E01.mp4",
+		"Movie (2023).mp4",
+	} {
+		touch(t, inputDir, name)
+	}
+	files, err := Discover(inputDir)
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = "/out"
+
+	got := renderOutputTree(cfg.OutputDir, resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), files))
+	want := []string{
+		"/out/",
+		"  Movie (2023)/",
+		"    Movie (2023).mkv",
+		"  Show/",
+		"    Season 01/",
+		"      Show - S01E01 - dup1.mkv",
+		"      Show - S01E01.mkv",
+		"      Show - S01E02.mkv",
+		"    Season 02/",
+		"      Show - S02E01.mkv",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("tree:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestResolveOutputPaths_KeepRawNames(t *testing.T) {
+	inputDir := t.TempDir()
+	in := filepath.Join(inputDir, "4K (2019).mkv")
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = "/out"
+
+	if got := resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), []string{in}); got[0] != "Unknown (2019)/Unknown (2019).mkv" {
+		t.Errorf("default: got %q", got[0])
+	}
+	cfg.KeepRawNames = true
+	if got := resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), []string{in}); got[0] != "4K (2019)/4K (2019).mkv" {
+		t.Errorf("--keep-raw-names: got %q", got[0])
+	}
+}
+
+func TestResolveOutputPaths_Templates(t *testing.T) {
+	inputDir := t.TempDir()
+	files := []string{filepath.Join(inputDir, "Show S01E02.mkv"), filepath.Join(inputDir, "Movie (2023).mkv")}
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = "/out"
+	cfg.TVTemplate = "TV/{show}/{show} {season}x{episode:02d}.{ext}"
+	cfg.MovieTemplate = "Films/{title} ({year}).{ext}"
+
+	got := strings.Join(resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), files), " | ")
+	want := "Films/Movie (2023).mkv | TV/Show/Show 1x02.mkv"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRun_InvalidTemplateStopsBeforeProbing(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(inputDir, "Show S01E02.mkv"), make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	probes := countingProbe(t)
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.TVTemplate = "{show}/{Season}.{ext}"
+
+	log := &transcriptLogger{}
+	run := ffmpeg.RunFunc(func(context.Context, []string) ffmpeg.ExecResult {
+		t.Error("ffmpeg ran under an invalid template")
+		return ffmpeg.ExecResult{}
+	})
+	if stats := Run(context.Background(), &cfg, log, run); stats.Current != 0 {
+		t.Errorf("processed %d file(s), want none", stats.Current)
+	}
+	if len(probes) != 0 {
+		t.Errorf("probed %v, want nothing", probes)
+	}
+	if !slices.ContainsFunc(log.lines, func(l string) bool { return strings.HasPrefix(l, "ERROR Invalid output layout: --tv-template: ") }) {
+		t.Errorf("missing template error: %q", log.lines)
+	}
+}
+
+// --- Rename-only tests ---
+
+func TestRenameOnly_Modes(t *testing.T) {
+	for _, mode := range []config.RenameMode{config.RenameMove, config.RenameLink, config.RenameCopy} {
+		t.Run(string(mode), func(t *testing.T) {
+			inputDir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(inputDir, "rerip"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			moves := map[string]string{
+				"Show.S01E02.720p.mp4":  "Show/Season 01/Show - S01E02.mp4",
+				"rerip/Show S01E02.mkv": "Show/Season 01/Show - S01E02.mkv",
+				"Show S01E03.mkv":       "Show/Season 01/Show - S01E03.mkv",
+				"rerip/Show S01E03.mkv": "Show/Season 01/Show - S01E03 - dup1.mkv",
+				"Movie (2023).avi":      "Movie (2023)/Movie (2023).avi",
+			}
+			for name := range moves {
+				if err := os.WriteFile(filepath.Join(inputDir, name), []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.InputDir = inputDir
+			cfg.OutputDir = t.TempDir()
+			cfg.RenameOnly = mode
+			if !RenameOnly(context.Background(), &cfg, &recordLogger{}) {
+				t.Fatal("RenameOnly reported a failure")
+			}
+
+			for name, rel := range moves {
+				src, dst := filepath.Join(inputDir, name), filepath.Join(cfg.OutputDir, rel)
+				data, err := os.ReadFile(dst)
+				if err != nil || string(data) != name {
+					t.Errorf("%s: destination %s holds %q, %v", name, rel, data, err)
+					continue
+				}
+				_, srcErr := os.Stat(src)
+				switch mode {
+				case config.RenameMove:
+					if !os.IsNotExist(srcErr) {
+						t.Errorf("%s: move left the original in place", name)
+					}
+				case config.RenameLink:
+					if !sameFile(src, dst) {
+						t.Errorf("%s: %s is not a hardlink of the original", name, rel)
+					}
+				case config.RenameCopy:
+					if srcErr != nil || sameFile(src, dst) {
+						t.Errorf("%s: copy should leave a separate original (%v)", name, srcErr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRenameOnly_ModesAndOwner(t *testing.T) {
+	var chowned []string
+	orig := chownFunc
+	chownFunc = func(path string, _, _ int) error {
+		chowned = append(chowned, path)
+		return nil
+	}
+	t.Cleanup(func() { chownFunc = orig })
+
+	for _, mode := range []config.RenameMode{config.RenameCopy, config.RenameLink} {
+		t.Run(string(mode), func(t *testing.T) {
+			chowned = nil
+			inputDir := t.TempDir()
+			src := filepath.Join(inputDir, "Show S01E01.mkv")
+			if err := os.WriteFile(src, []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.DefaultConfig()
+			cfg.InputDir = inputDir
+			cfg.OutputDir = t.TempDir()
+			cfg.RenameOnly = mode
+			cfg.DirMode = 0o775
+			cfg.FileMode = 0o600
+			cfg.OutputUID, cfg.OutputGID = 1000, 100
+			if !RenameOnly(context.Background(), &cfg, &recordLogger{}) {
+				t.Fatal("RenameOnly reported a failure")
+			}
+
+			showDir := filepath.Join(cfg.OutputDir, "Show")
+			seasonDir := filepath.Join(showDir, "Season 01")
+			dst := filepath.Join(seasonDir, "Show - S01E01.mkv")
+			wantFile, wantChown := os.FileMode(0o600), []string{dst, seasonDir, showDir}
+			if mode == config.RenameLink {
+				// The link shares the original's inode, which stays untouched.
+				wantFile, wantChown = 0o644, []string{seasonDir, showDir}
+			}
+			for path, want := range map[string]os.FileMode{showDir: 0o775, seasonDir: 0o775, dst: wantFile} {
+				fi, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Mode().Perm() != want {
+					t.Errorf("%s: mode %v, want %v", path, fi.Mode().Perm(), want)
+				}
+			}
+			if !sliceEqual(chowned, wantChown) {
+				t.Errorf("chowned %v, want %v", chowned, wantChown)
+			}
+		})
+	}
+}
+
+func TestRenameOnly_SkipsExistingAndDryRun(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	touch(t, inputDir, "Show S01E01.mkv")
+	dst := filepath.Join(outputDir, "Show", "Season 01", "Show - S01E01.mkv")
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = outputDir
+	cfg.RenameOnly = config.RenameCopy
+	cfg.DryRun = true
+	RenameOnly(context.Background(), &cfg, &recordLogger{})
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote %s", dst)
+	}
+
+	cfg.DryRun = false
+	RenameOnly(context.Background(), &cfg, &recordLogger{})
+	log := &recordLogger{}
+	RenameOnly(context.Background(), &cfg, log)
+	if len(log.warns) != 1 || log.warns[0] != "  Skip (exists)" {
+		t.Errorf("second run warnings = %q, want one Skip (exists)", log.warns)
+	}
+
+	// An earlier link is already the input.
+	cfg.RenameOnly = config.RenameLink
+	os.Remove(dst)
+	RenameOnly(context.Background(), &cfg, &recordLogger{})
+	cfg.SkipExisting = false
+	log = &recordLogger{}
+	RenameOnly(context.Background(), &cfg, log)
+	if len(log.warns) != 1 || log.warns[0] != "  Skip (already in place)" {
+		t.Errorf("relink warnings = %q, want one Skip (already in place)", log.warns)
+	}
+}
+
+// --- Validate tests ---
+
+func TestValidate_CountsUnreadable(t *testing.T) {
+	inputDir := t.TempDir()
+	touch(t, inputDir, "good.mkv")
+	touch(t, inputDir, "bad.mkv")
+	saved := validateFile
+	t.Cleanup(func() { validateFile = saved })
+	validateFile = func(_ context.Context, bin, path string) error {
+		if bin != "/opt/ffmpeg/bin/ffprobe" {
+			t.Errorf("validated with %q, want --ffprobe-path", bin)
+		}
+		if filepath.Base(path) == "bad.mkv" {
+			return errors.New("Invalid data found when processing input")
+		}
+		return nil
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.FFprobePath = "/opt/ffmpeg/bin/ffprobe"
+	log := &transcriptLogger{}
+	if Validate(context.Background(), &cfg, log) {
+		t.Error("Validate should report failure when a file is unreadable")
+	}
+	got := strings.Join(log.lines, "\n")
+	for _, want := range []string{
+		"ERROR Unreadable: bad.mkv (Invalid data found when processing input)",
+		"INFO Readable:   1",
+		"ERROR Unreadable: 1",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+// --- Progress JSON tests ---
+
+func TestProgressJSON_DryRunEvents(t *testing.T) {
+	inputDir := t.TempDir()
+	touch(t, inputDir, "Show S01E01.mkv")
+	touch(t, inputDir, "Show S01E02.mkv")
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.DryRun = true
+	cfg.Display.ProgressJSON = filepath.Join(t.TempDir(), "progress.ndjson")
+
+	noExec := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		t.Fatalf("unexpected ffmpeg execution in dry run: %v", args)
+		return ffmpeg.ExecResult{}
+	})
+	Run(context.Background(), &cfg, &recordLogger{}, noExec)
+
+	events := readProgress(t, cfg.Display.ProgressJSON)
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev["event"].(string))
+		if _, ok := ev["time"].(string); !ok {
+			t.Errorf("%s: missing time", ev["event"])
+		}
+	}
+	want := []string{eventBatchStart, eventFileStart, eventFileDone, eventFileStart, eventFileDone, eventBatchDone}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events: got %v, want %v", names, want)
+	}
+
+	if events[0]["total"] != 2.0 || events[0]["dry_run"] != true {
+		t.Errorf("batch_start: got %v", events[0])
+	}
+	if events[1]["index"] != 1.0 || events[1]["input"] != filepath.Join(inputDir, "Show S01E01.mkv") {
+		t.Errorf("file_start: got %v", events[1])
+	}
+	// Empty fixtures fail validation before probing.
+	if events[2]["index"] != 1.0 || events[2]["status"] != "failed" {
+		t.Errorf("file_done: got %v", events[2])
+	}
+	if events[5]["failed"] != 2.0 || events[5]["encoded"] != 0.0 || events[5]["interrupted"] != false {
+		t.Errorf("batch_done: got %v", events[5])
+	}
+}
+
+func TestProgressWriter_PercentFromStats(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressEmitter(nopWriteCloser{&buf})
+	w := p.fileProgress(3, 100)
+
+	// A stats line split across writes, a repeat of the same percent, then
+	// a time past the probed duration.
+	w.Write([]byte("frame=  10 fps=0.0 time=00:00:"))
+	w.Write([]byte("25.50 speed=1x\rframe=  11 fps=0.0 time=00:00:25.90 speed=1x\r"))
+	w.Write([]byte("frame= 999 time=00:01:50.00 speed=1x\n"))
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		if ev["event"] != eventFileProgress || ev["index"] != 3.0 {
+			t.Errorf("unexpected event: %v", ev)
+		}
+		got = append(got, fmt.Sprint(ev["percent"]))
+	}
+	if strings.Join(got, ",") != "25,100" {
+		t.Errorf("percents: got %v, want [25 100]", got)
+	}
+}
+
+func TestLogProgress_Quarters(t *testing.T) {
+	log := &transcriptLogger{}
+	fn := logProgress(log)
+	for _, p := range []ffmpeg.Progress{
+		{Percent: 10, Speed: 2, ETA: 90 * time.Second},
+		{Percent: 26, Speed: 2, ETA: 74 * time.Second},
+		{Percent: 30, Speed: 2, ETA: 70 * time.Second},
+		{Percent: 51},
+		{Percent: 5}, // Retry: starts over.
+		{Percent: 27},
+		{Percent: 100, Done: true},
+		{Percent: -1},
+	} {
+		fn(p)
+	}
+	want := []string{
+		"RENDER   Progress: 26% | ETA 1m14s | 2x",
+		"RENDER   Progress: 51%",
+		"RENDER   Progress: 27%",
+	}
+	if !slices.Equal(log.lines, want) {
+		t.Errorf("got %q, want %q", log.lines, want)
+	}
+}
+
+// --- Summary-only tests ---
+
+func TestSummaryOnly_SuppressesPerFileInfo(t *testing.T) {
+	inputDir := t.TempDir()
+	touch(t, inputDir, "Show S01E01.mkv")
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.DryRun = true
+	cfg.Display.SummaryOnly = true
+
+	log := &transcriptLogger{}
+	Run(context.Background(), &cfg, log, nil)
+	got := strings.Join(log.lines, "\n")
+
+	if !strings.Contains(got, "INFO Done: 0 encoded, 0 skipped, 1 failed") {
+		t.Errorf("summary missing:\n%s", got)
+	}
+	// The per-file header is only replayed in front of the file's error.
+	if !strings.Contains(got, "INFO [1/1] Show S01E01.mkv\nERROR File too small") {
+		t.Errorf("error should follow its file header:\n%s", got)
+	}
+	if _, perFile, _ := strings.Cut(got, "[1/1]"); strings.Contains(perFile, "BLANK") {
+		t.Errorf("per-file blank lines should be suppressed:\n%s", got)
+	}
+
+	// Directly: per-file INFO/SUCCESS are dropped, WARN passes with header.
+	log = &transcriptLogger{}
+	quiet := &summaryOnlyLogger{Logger: log, header: "[2/5] Movie.mkv"}
+	quiet.Info("Encoding: %s", "Movie.mkv")
+	quiet.Success("Encoded in 10s")
+	if len(log.lines) != 0 {
+		t.Fatalf("INFO/SUCCESS should be suppressed, got %v", log.lines)
+	}
+	quiet.Warn("Skip (exists): %s", "Movie.mkv")
+	quiet.Warn("second")
+	want := "INFO [2/5] Movie.mkv,WARN Skip (exists): Movie.mkv,WARN second"
+	if strings.Join(log.lines, ",") != want {
+		t.Errorf("got %v, want %s", log.lines, want)
+	}
+}
+
+// --- Checkpoint tests ---
+
+func TestCheckpointEvery_FiresAtIntervals(t *testing.T) {
+	inputDir := t.TempDir()
+	for i := 1; i <= 7; i++ {
+		touch(t, inputDir, fmt.Sprintf("Show S01E%02d.mkv", i))
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.DryRun = true
+	cfg.Display.CheckpointEvery = 3
+
+	log := &transcriptLogger{}
+	Run(context.Background(), &cfg, log, nil)
+
+	var got []string
+	for _, line := range log.lines {
+		if strings.HasPrefix(line, "INFO Checkpoint") {
+			got = append(got, line)
+		}
+	}
+	// After files 3 and 6; the final summary covers file 7.
+	want := []string{
+		"INFO Checkpoint [3/7]: 0 encoded, 0 skipped, 3 failed",
+		"INFO Checkpoint [6/7]: 0 encoded, 0 skipped, 6 failed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("checkpoints:\ngot  %q\nwant %q", got, want)
+	}
+	// Each checkpoint follows the file that completed the interval.
+	all := strings.Join(log.lines, "\n")
+	if i, j := strings.Index(all, "[3/7] Show S01E03.mkv"), strings.Index(all, want[0]); i < 0 || j < i {
+		t.Errorf("first checkpoint should follow file 3:\n%s", all)
+	}
+	if j, k := strings.Index(all, want[0]), strings.Index(all, "[4/7]"); k < j {
+		t.Errorf("first checkpoint should precede file 4:\n%s", all)
+	}
+
+	// Space saved is reported outside dry runs.
+	cfg.DryRun = false
+	log = &transcriptLogger{}
+	logCheckpoint(&cfg, log, &RunStats{Total: 10, Current: 5, Encoded: 5, TotalInputBytes: 3 << 20, TotalOutputBytes: 1 << 20})
+	if len(log.lines) != 1 || !strings.HasPrefix(log.lines[0], "INFO Checkpoint [5/10]: 5 encoded, 0 skipped, 0 failed, ") || !strings.HasSuffix(log.lines[0], " saved") {
+		t.Errorf("got %v", log.lines)
+	}
+}
+
+// --- Summary JSON tests ---
+
+func TestRun_SummaryJSON(t *testing.T) {
+	inputDir := t.TempDir()
+	touch(t, inputDir, "Show S01E01.mkv")
+	touch(t, inputDir, "Show S01E02.mkv")
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.DryRun = true
+	cfg.Display.SummaryJSON = true
+
+	var stdout bytes.Buffer
+	orig := summaryJSONOut
+	summaryJSONOut = &stdout
+	defer func() { summaryJSONOut = orig }()
+
+	Run(context.Background(), &cfg, &recordLogger{}, nil)
+
+	if n := strings.Count(stdout.String(), "\n"); n != 1 {
+		t.Fatalf("want exactly one JSON line on stdout, got %d: %q", n, stdout.String())
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	for k, want := range map[string]interface{}{
+		"total": 2.0, "processed": 2.0, "encoded": 0.0, "skipped": 0.0, "failed": 2.0,
+		"space_saved_bytes": 0.0, "space_saved_pct": 0.0, "dry_run": true, "interrupted": false,
+	} {
+		if got[k] != want {
+			t.Errorf("%s: got %v, want %v", k, got[k], want)
+		}
+	}
+
+	// Derived space saving and grown outputs.
+	stdout.Reset()
+	stats := RunStats{Total: 2, Current: 2, Encoded: 2, TotalInputBytes: 4000, TotalOutputBytes: 3000}
+	stats.AddGrown("b.mkv", 1000, 1500, "CRF 20")
+	cfg.DryRun = false
+	if err := writeSummaryJSON(&stdout, &cfg, &stats, false); err != nil {
+		t.Fatalf("writeSummaryJSON: %v", err)
+	}
+	want := `{"total":2,"processed":2,"encoded":2,"skipped":0,"failed":0,"input_bytes":4000,"output_bytes":3000,` +
+		`"space_saved_bytes":1000,"space_saved_pct":25,"grown":[{"name":"b.mkv","input_bytes":1000,"output_bytes":1500,"quality":"CRF 20"}],` +
+		`"dry_run":false,"interrupted":false}` + "\n"
+	if stdout.String() != want {
+		t.Errorf("got  %s\nwant %s", stdout.String(), want)
+	}
+}
+
+// --- Temp dir tests ---
+
+func TestNewRunTempDir_CreatesAndCleansUp(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "scratch")
+	dir, cleanup, err := NewRunTempDir(base)
+	if err != nil {
+		t.Fatalf("NewRunTempDir: %v", err)
+	}
+	if filepath.Dir(dir) != base {
+		t.Errorf("dir %s not under --temp-dir base %s", dir, base)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		t.Fatalf("temp dir not created: %v", err)
+	}
+	touch(t, dir, "pass1.log")
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp dir still exists after cleanup: %v", err)
+	}
+}
+
+func TestNewRunTempDir_ConcurrentRunsKeepTheirDirs(t *testing.T) {
+	base := t.TempDir()
+	first, cleanupFirst, err := NewRunTempDir(base)
+	if err != nil {
+		t.Fatalf("NewRunTempDir: %v", err)
+	}
+	defer cleanupFirst()
+	touch(t, first, "x265.stats")
+
+	second, cleanupSecond, err := NewRunTempDir(base)
+	if err != nil {
+		t.Fatalf("NewRunTempDir: %v", err)
+	}
+	if second == first {
+		t.Fatalf("both runs got %s", first)
+	}
+	cleanupSecond()
+	if _, err := os.Stat(filepath.Join(first, "x265.stats")); err != nil {
+		t.Errorf("second run disturbed the first run's scratch: %v", err)
+	}
+}
+
+func TestNewRunTempDir_DefaultsToTMPDIR(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	dir, cleanup, err := NewRunTempDir("")
+	if err != nil {
+		t.Fatalf("NewRunTempDir: %v", err)
+	}
+	defer cleanup()
+	if filepath.Dir(dir) != tmp {
+		t.Errorf("dir %s not under $TMPDIR %s", dir, tmp)
+	}
+}
+
+// --- Parallel jobs tests ---
+
+func TestRun_ParallelJobsKeepsFileBlocksContiguous(t *testing.T) {
+	inputDir := t.TempDir()
+	const n = 8
+	for i := 1; i <= n; i++ {
+		touch(t, inputDir, fmt.Sprintf("Show S01E%02d.mkv", i)) // Too small: fails before probing.
+	}
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Jobs = 4
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, nil)
+	if stats.Failed != n || stats.Current != n {
+		t.Fatalf("Failed=%d Current=%d, want %d and %d", stats.Failed, stats.Current, n, n)
+	}
+
+	seen := map[string]bool{}
+	for i, l := range log.lines {
+		if !strings.HasPrefix(l, "INFO [") || !strings.Contains(l, "/8]") {
+			continue
+		}
+		seen[l] = true
+		if i+2 >= len(log.lines) || !strings.HasPrefix(log.lines[i+1], "ERROR File too small") || log.lines[i+2] != "BLANK" {
+			t.Errorf("file block for %q interleaved: %q", l, log.lines[i:])
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d file headers, want %d", len(seen), n)
+	}
+}
+
+func TestWorkerCount_VAAPICap(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Jobs = 4
+	cfg.Encoder.Mode = config.EncoderCPU
+	if got := workerCount(&cfg, &recordLogger{}); got != 4 {
+		t.Errorf("CPU: got %d workers, want 4", got)
+	}
+
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	cfg.Encoder.VaapiConcurrency = 2
+	log := &recordLogger{}
+	if got := workerCount(&cfg, log); got != 2 {
+		t.Errorf("VAAPI: got %d workers, want 2 (--vaapi-concurrency)", got)
+	}
+	if len(log.warns) != 1 {
+		t.Errorf("expected one cap warning, got %v", log.warns)
+	}
+}
+
+func TestWorkerPool_LowerAndRequeue(t *testing.T) {
+	pool := newWorkerPool(3)
+	if limit, ok := pool.lower(); !ok || limit != 2 {
+		t.Fatalf("lower() = %d, %v; want 2, true", limit, ok)
+	}
+
+	var (
+		mu            sync.Mutex
+		running, peak int
+		runs          = map[int]int{}
+		requeuedOnce  bool
+	)
+	pool.start(context.Background(), 3, []int{0, 1, 2, 3, 4, 5}, func(i int) bool {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		runs[i]++
+		requeue := i == 2 && !requeuedOnce
+		requeuedOnce = requeuedOnce || requeue
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return requeue
+	})
+	if pool.wait() {
+		t.Error("wait() reported an interruption")
+	}
+	if peak != 2 {
+		t.Errorf("peak concurrency %d, want the lowered limit 2", peak)
+	}
+	for i := 0; i < 6; i++ {
+		want := 1
+		if i == 2 {
+			want = 2
+		}
+		if runs[i] != want {
+			t.Errorf("file %d ran %d times, want %d", i, runs[i], want)
+		}
+	}
+
+	pool.lower()
+	if limit, ok := pool.lower(); ok || limit != 1 {
+		t.Errorf("lower() at one = %d, %v; want 1, false", limit, ok)
+	}
+}
+
+func TestRun_TooManyOpenFilesLowersParallelism(t *testing.T) {
+	inputDir := t.TempDir()
+	const n = 8
+	for i := 1; i <= n; i++ {
+		path := filepath.Join(inputDir, fmt.Sprintf("Show S01E%02d.mkv", i))
+		if err := os.WriteFile(path, make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+
+	var (
+		mu              sync.Mutex
+		running, peak   int
+		failed, retried bool
+		runsOfExhausted int
+	)
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		out := args[len(args)-1]
+		exhausted := strings.Contains(out, "S01E03")
+		mu.Lock()
+		running++
+		if exhausted {
+			runsOfExhausted++
+			retried = failed
+		}
+		if retried {
+			peak = max(peak, running)
+		}
+		fail := exhausted && !failed
+		failed = failed || fail
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		if fail {
+			return ffmpeg.ExecResult{
+				Stderr: "[in#0 @ 0x55d0] Error opening input: Too many open files\n",
+				Err:    errors.New("exit status 1"),
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return ffmpeg.ExecResult{Err: os.WriteFile(out, make([]byte, minFileSize), 0o644)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Jobs = 4
+	cfg.Display.ProgressJSON = filepath.Join(t.TempDir(), "progress.ndjson")
+	cfg.Display.RetryLog = filepath.Join(t.TempDir(), "retries")
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != n || stats.Failed != 0 || stats.Current != n {
+		t.Fatalf("Encoded=%d Failed=%d Current=%d, want %d, 0, %d: %q", stats.Encoded, stats.Failed, stats.Current, n, n, log.lines)
+	}
+	if runsOfExhausted != 2 {
+		t.Errorf("S01E03 ran %d times, want 2 (one retry)", runsOfExhausted)
+	}
+	if peak < 1 || peak > 3 {
+		t.Errorf("peak concurrency after the retry = %d, want at most the lowered limit 3", peak)
+	}
+	if !slices.Contains(log.lines, "WARN Too many open files: lowering parallelism to 3 and retrying Show S01E03.mkv") {
+		t.Errorf("missing downscale warning: %q", log.lines)
+	}
+	if entries, _ := os.ReadDir(cfg.Display.RetryLog); len(entries) != 0 {
+		t.Errorf("requeued attempt wrote a retry log: %v", entries)
+	}
+	events := map[string]int{}
+	for _, ev := range readProgress(t, cfg.Display.ProgressJSON) {
+		if input, _ := ev["input"].(string); strings.Contains(input, "S01E03") {
+			events[ev["event"].(string)]++
+		}
+	}
+	if events[eventFileStart] != 1 || events[eventFileDone] != 1 {
+		t.Errorf("S01E03 progress events = %v, want one file_start and one file_done", events)
+	}
+}
+
+func TestRun_AutoCropOnlyEncodes(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Encode S01E01.mkv", "Remux S01E02.mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(_ context.Context, _, path string) (*probe.ProbeResult, error) {
+		v := &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080}
+		if strings.HasPrefix(filepath.Base(path), "Encode") {
+			v = &probe.VideoStream{Codec: "h264", Profile: "High", PixFmt: "yuv420p", Width: 1920, Height: 1080}
+		}
+		return &probe.ProbeResult{
+			PrimaryVideo: v,
+			AudioStreams: []probe.AudioStream{{Codec: "aac", Channels: 2, SampleRate: 48000}},
+		}, nil
+	}
+
+	cropped := map[string]int{}
+	var encodeArgs []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		if slices.Contains(args, "cropdetect=round=2") {
+			cropped[filepath.Base(args[slices.Index(args, "-i")+1])]++
+			return ffmpeg.ExecResult{Stderr: "[Parsed_cropdetect_0 @ 0x1] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 crop=1920:800:0:140\n"}
+		}
+		if slices.Contains(args, "libx265") {
+			encodeArgs = args
+		}
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o644)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.AutoCrop = true
+
+	log := &transcriptLogger{}
+	if stats := Run(context.Background(), &cfg, log, run); stats.Encoded != 2 || stats.Failed != 0 {
+		t.Fatalf("Encoded=%d Failed=%d, want 2, 0: %q", stats.Encoded, stats.Failed, log.lines)
 	}
+	if cropped["Remux S01E02.mkv"] != 0 || cropped["Encode S01E01.mkv"] == 0 {
+		t.Errorf("cropdetect passes per input = %v, want only the encoded file", cropped)
+	}
+	if i := slices.Index(encodeArgs, "-vf"); i < 0 || !strings.HasPrefix(encodeArgs[i+1], "crop=1920:800:0:140") {
+		t.Errorf("encode command does not lead with the detected crop: %q", encodeArgs)
+	}
+}
 
-	s2 := RunStats{TotalInputBytes: 100, TotalOutputBytes: 150}
-	if got := s2.SpaceSaved(); got != -50 {
-		t.Errorf("SpaceSaved (negative): got %d, want -50", got)
+func TestRun_RemuxJobsSerializesEncodes(t *testing.T) {
+	inputDir := t.TempDir()
+	for i := 1; i <= 4; i++ {
+		for _, kind := range []string{"Encode", "Remux"} {
+			path := filepath.Join(inputDir, fmt.Sprintf("%s S01E%02d.mkv", kind, i))
+			if err := os.WriteFile(path, make([]byte, 2*minFileSize), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	var probes int32
+	probeFile = func(_ context.Context, _, path string) (*probe.ProbeResult, error) {
+		atomic.AddInt32(&probes, 1)
+		v := &probe.VideoStream{Codec: "hevc", Profile: "Main 10", PixFmt: "yuv420p10le", Width: 1920, Height: 1080}
+		if strings.HasPrefix(filepath.Base(path), "Encode") {
+			v = &probe.VideoStream{Codec: "h264", Profile: "High", PixFmt: "yuv420p", Width: 1920, Height: 1080}
+		}
+		return &probe.ProbeResult{
+			PrimaryVideo: v,
+			AudioStreams: []probe.AudioStream{{Codec: "aac", Channels: 2, SampleRate: 48000}},
+		}, nil
+	}
+
+	var (
+		mu                     sync.Mutex
+		encodes, remuxes       int
+		maxEncodes, maxRemuxes int
+	)
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		encode := strings.Contains(strings.Join(args, " "), "libx265")
+		mu.Lock()
+		if encode {
+			encodes++
+			maxEncodes = max(maxEncodes, encodes)
+		} else {
+			remuxes++
+			maxRemuxes = max(maxRemuxes, remuxes)
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		err := os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o644)
+		mu.Lock()
+		if encode {
+			encodes--
+		} else {
+			remuxes--
+		}
+		mu.Unlock()
+		return ffmpeg.ExecResult{Err: err}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Jobs = 1
+	cfg.RemuxJobs = 4
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != 8 {
+		t.Fatalf("Encoded=%d Failed=%d, want 8 and 0: %q", stats.Encoded, stats.Failed, log.lines)
+	}
+	if maxEncodes != 1 {
+		t.Errorf("got %d concurrent encodes, want 1", maxEncodes)
+	}
+	if maxRemuxes < 2 {
+		t.Errorf("got at most %d concurrent remuxes, want several", maxRemuxes)
+	}
+	if probes != 8 {
+		t.Errorf("got %d probes, want 8 (pre-pass results reused)", probes)
+	}
+	if !slices.Contains(log.lines, "INFO Lanes: 4 encode(s) on 1 worker(s), 4 other file(s) on 4 worker(s)") {
+		t.Errorf("missing lanes line: %q", log.lines)
 	}
 }
 
-// --- Bitrate outlier tests ---
+// --- Input sort tests ---
 
-func TestBitrateOutlierTiers(t *testing.T) {
-	cases := []struct {
-		w, h    int
-		kbps    int64
-		outlier bool
-		dir     string
-	}{
-		{1920, 1080, 5000, false, ""},
-		{1920, 1080, 500, true, "low"},
-		{1920, 1080, 20000, true, "high"},
-		{1280, 720, 3000, false, ""},
-		{3840, 2160, 50000, true, "high"},
-		{640, 360, 100, true, "low"},
+// sortFixture writes files with the given sizes (in bytes) and mtimes (as
+// hours before now) and returns their paths in name order.
+func sortFixture(t *testing.T, files map[string][2]int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for name, f := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, f[0]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-time.Duration(f[1]) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
 	}
-	for _, tc := range cases {
-		pixels := tc.w * tc.h
-		var low, high int64
-		var label string
-		for _, tier := range bitrateTiers {
-			if pixels <= tier.maxPixels {
-				low, high, label = tier.lowKbps, tier.highKbps, tier.label
-				break
-			}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestSortInputs_Size(t *testing.T) {
+	files := sortFixture(t, map[string][2]int{"a.mkv": {3000, 0}, "b.mkv": {1000, 0}, "c.mkv": {2000, 0}, "d.mkv": {1000, 0}})
+	files = append(files, filepath.Join(t.TempDir(), "missing.mkv"))
+	cfg := config.DefaultConfig()
+	cfg.InputSort = config.InputSortSize
+	if probed := sortInputs(context.Background(), &cfg, files); probed != nil {
+		t.Errorf("size sort should not probe, got %v", probed)
+	}
+	want := []string{"b.mkv", "d.mkv", "c.mkv", "a.mkv", "missing.mkv"}
+	if got := basenames(files); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortInputs_Mtime(t *testing.T) {
+	files := sortFixture(t, map[string][2]int{"a.mkv": {1000, 48}, "b.mkv": {1000, 1}, "c.mkv": {1000, 24}})
+	cfg := config.DefaultConfig()
+	cfg.InputSort = config.InputSortMtime
+	sortInputs(context.Background(), &cfg, files)
+	want := []string{"b.mkv", "c.mkv", "a.mkv"}
+	if got := basenames(files); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v (newest first)", got, want)
+	}
+}
+
+func TestSortInputs_DurationCachesProbes(t *testing.T) {
+	files := sortFixture(t, map[string][2]int{"a.mkv": {2000, 0}, "b.mkv": {2000, 0}, "c.mkv": {2000, 0}})
+	durations := map[string]float64{"a.mkv": 3600, "b.mkv": 1440, "c.mkv": 0}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(_ context.Context, _, path string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{Format: probe.FormatInfo{Duration: durations[filepath.Base(path)]}}, nil
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputSort = config.InputSortDuration
+	probed := sortInputs(context.Background(), &cfg, files)
+	want := []string{"b.mkv", "a.mkv", "c.mkv"}
+	if got := basenames(files); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v (unknown duration last)", got, want)
+	}
+	if len(probed) != 3 {
+		t.Errorf("got %d cached probes, want 3", len(probed))
+	}
+}
+
+func TestRun_DupSuffixFollowsDiscoveryOrder(t *testing.T) {
+	inputDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(inputDir, "rerip"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// --input-sort size runs the smaller rerip copy first.
+	for name, size := range map[string]int{"Movie A (2001).mkv": 4 * minFileSize, "rerip/Movie A (2001).mkv": 2 * minFileSize} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
 		}
-		if label == "" {
-			low, high = 15000, 65000
+	}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(context.Context, string, string) (*probe.ProbeResult, error) {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080},
+		}, nil
+	}
+	outputs := map[string]string{}
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		in := args[slices.Index(args, "-i")+1]
+		outputs[strings.TrimPrefix(in, inputDir+"/")] = filepath.Base(args[len(args)-1])
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.InputSort = config.InputSortSize
+
+	log := &transcriptLogger{}
+	if st := Run(context.Background(), &cfg, log, run); st.Encoded != 2 {
+		t.Fatalf("encoded=%d, want 2: %q", st.Encoded, log.lines)
+	}
+	want := map[string]string{
+		"Movie A (2001).mkv":       "Movie A (2001).mkv",
+		"rerip/Movie A (2001).mkv": "Movie A (2001) - dup1.mkv",
+	}
+	for in, out := range want {
+		if outputs[in] != out {
+			t.Errorf("%s -> %q, want %q (discovery order, not --input-sort order)", in, outputs[in], out)
 		}
-		isOutlier := tc.kbps < low || tc.kbps > high
-		if isOutlier != tc.outlier {
-			t.Errorf("%dx%d@%dkbps: outlier=%v, want %v", tc.w, tc.h, tc.kbps, isOutlier, tc.outlier)
+	}
+}
+
+// --- Ratio report tests ---
+
+func TestRatioReport_ListsGrownOutputs(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Display.RatioReport = true
+	var stats RunStats
+	stats.AddGrown("Grown S01E01.mkv", 2_000_000, 3_000_000, "QP 22")
+	stats.AddGrown("Shrunk S01E02.mkv", 2_000_000, 1_000_000, "QP 20")
+
+	log := &transcriptLogger{}
+	logSummary(&cfg, log, &stats)
+
+	var report []string
+	for _, l := range log.lines {
+		if strings.Contains(l, "Grown") || strings.Contains(l, "Shrunk") {
+			report = append(report, l)
+		}
+	}
+	if len(report) != 2 || report[0] != "WARN   Grown outputs (1):" ||
+		!strings.HasPrefix(report[1], "WARN     Grown S01E01.mkv: ") || !strings.HasSuffix(report[1], "(150%, QP 22)") {
+		t.Errorf("report lines: got %q", report)
+	}
+
+	cfg.Display.RatioReport = false
+	log = &transcriptLogger{}
+	logSummary(&cfg, log, &stats)
+	for _, l := range log.lines {
+		if strings.Contains(l, "Grown") {
+			t.Errorf("report printed without --keep-ratio-report: %q", l)
+		}
+	}
+}
+
+// --- Skip-if-output-newer tests ---
+
+func TestOutputUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "in.mkv")
+	in, err := os.Stat(filepath.Join(dir, "in.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out.mkv")
+	if outputUpToDate(in, out) {
+		t.Error("missing output reported up to date")
+	}
+
+	touch(t, dir, "out.mkv")
+	if err := os.Chtimes(out, in.ModTime(), in.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if !outputUpToDate(in, out) {
+		t.Error("output with equal mtime should be up to date")
+	}
+
+	stale := in.ModTime().Add(-time.Hour)
+	if err := os.Chtimes(out, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if outputUpToDate(in, out) {
+		t.Error("output older than input reported up to date")
+	}
+}
+
+func TestSkipIfOutputNewerPipeline(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not available")
+	}
+
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	fresh := filepath.Join(inputDir, "Fresh Show S01E01.mp4")
+	stale := filepath.Join(inputDir, "Stale Show S01E01.mp4")
+	for _, path := range []string{fresh, stale} {
+		gen := exec.Command("ffmpeg",
+			"-f", "lavfi", "-i", "testsrc=duration=1:size=320x240:rate=24",
+			"-c:v", "libx264", "-pix_fmt", "yuv420p",
+			"-y", path,
+		)
+		gen.Stderr = os.Stderr
+		if err := gen.Run(); err != nil {
+			t.Fatalf("generate %s: %v", path, err)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = outputDir
+	cfg.DryRun = true
+	cfg.SkipIfOutputNewer = true
+
+	// Pre-create both outputs: one newer than its input, one older.
+	outputs := resolveOutputPaths(&cfg, &recordLogger{}, testLayout(t, &cfg), []string{fresh, stale})
+	now := time.Now()
+	for i, rel := range outputs {
+		out := filepath.Join(outputDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		touch(t, filepath.Dir(out), filepath.Base(out))
+		mtime := now.Add(time.Hour)
+		if i == 1 {
+			mtime = now.Add(-time.Hour)
+		}
+		if err := os.Chtimes(out, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	noExec := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		t.Fatalf("unexpected ffmpeg execution in dry run: %v", args)
+		return ffmpeg.ExecResult{}
+	})
+	log := &recordLogger{}
+	stats := Run(context.Background(), &cfg, log, noExec)
+	if stats.Skipped != 1 || stats.Encoded != 1 {
+		t.Errorf("Skipped=%d Encoded=%d, want 1 skipped (fresh) and 1 processed (stale)", stats.Skipped, stats.Encoded)
+	}
+	var upToDate []string
+	for _, w := range log.warns {
+		if strings.HasPrefix(w, "Skip (up to date)") {
+			upToDate = append(upToDate, w)
 		}
 	}
+	if len(upToDate) != 1 || !strings.Contains(upToDate[0], "Fresh") {
+		t.Errorf("up-to-date skips: got %v, want only the fresh output", upToDate)
+	}
 }
 
 // --- Dry-run integration test ---
@@ -227,6 +2839,7 @@ func TestDryRunPipeline(t *testing.T) {
 	cfg.OutputDir = outputDir
 	cfg.DryRun = true
 	cfg.Display.ColorMode = config.ColorNever
+	cfg.Display.ProgressJSON = filepath.Join(t.TempDir(), "progress.ndjson")
 
 	log, err := logging.NewLogger(&cfg)
 	if err != nil {
@@ -253,10 +2866,257 @@ func TestDryRunPipeline(t *testing.T) {
 	if stats.Failed != 0 {
 		t.Errorf("Failed: got %d, want 0", stats.Failed)
 	}
+
+	events := readProgress(t, cfg.Display.ProgressJSON)
+	for _, ev := range events {
+		if ev["event"] == eventFileDone && ev["status"] != "dry_run" {
+			t.Errorf("file_done status: got %v, want dry_run", ev["status"])
+		}
+	}
+}
+
+// --- Planning pre-pass tests ---
+
+// countingProbe replaces probeFile for the test with one returning an H.264
+// video for files named "*h264*", an edge-safe HEVC one otherwise, and
+// counting calls per file.
+func countingProbe(t *testing.T) map[string]int {
+	t.Helper()
+	var mu sync.Mutex
+	calls := map[string]int{}
+	saved := probeFile
+	t.Cleanup(func() { probeFile = saved })
+	probeFile = func(_ context.Context, _, path string) (*probe.ProbeResult, error) {
+		mu.Lock()
+		calls[filepath.Base(path)]++
+		mu.Unlock()
+		v := &probe.VideoStream{Codec: "hevc", Profile: "Main", PixFmt: "yuv420p", Width: 1920, Height: 1080}
+		if strings.Contains(path, "h264") {
+			v = &probe.VideoStream{Codec: "h264", PixFmt: "yuv420p", Width: 1920, Height: 1080}
+		}
+		return &probe.ProbeResult{PrimaryVideo: v, Format: probe.FormatInfo{Filename: path, FormatName: "matroska,webm"}}, nil
+	}
+	return calls
+}
+
+func TestPlan_ActionsPerFile(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Movie A h264 (2001).mkv", "Movie B (2002).mkv", "Movie C h264 (2003).mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch(t, inputDir, "Tiny (2004).mkv")
+	calls := countingProbe(t)
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	planned, err := Plan(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Movie A h264 (2001).mkv": "encode",
+		"Movie B (2002).mkv":      "remux",
+		"Movie C h264 (2003).mkv": "encode",
+		"Tiny (2004).mkv":         "",
+	}
+	if len(planned) != len(want) {
+		t.Fatalf("planned %d files, want %d", len(planned), len(want))
+	}
+	for _, pf := range planned {
+		name := filepath.Base(pf.Path)
+		got := ""
+		if pf.Plan != nil {
+			got = pf.Plan.Action.String()
+		}
+		if got != want[name] {
+			t.Errorf("%s: action %q, want %q", name, got, want[name])
+		}
+	}
+	if calls["Tiny (2004).mkv"] != 0 {
+		t.Error("a file under the size floor was probed")
+	}
+}
+
+func TestRun_ProbePrepassReusesProbes(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Movie A h264 (2001).mkv", "Movie B (2002).mkv", "Movie C h264 (2003).mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := countingProbe(t)
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.ProbePrepass = true
+
+	log := &transcriptLogger{}
+	stats := Run(context.Background(), &cfg, log, run)
+	if stats.Encoded != 3 || stats.Failed != 0 {
+		t.Fatalf("encoded=%d failed=%d, want 3 and 0: %q", stats.Encoded, stats.Failed, log.lines)
+	}
+	if len(calls) != 3 {
+		t.Errorf("probed %d files, want 3", len(calls))
+	}
+	for name, n := range calls {
+		if n != 1 {
+			t.Errorf("%s probed %d times, want once", name, n)
+		}
+	}
+	if !slices.Contains(log.lines, "INFO Pre-pass: 2 encode(s), 1 remux(es), 0 skip(s), 0 unplanned") {
+		t.Errorf("missing pre-pass counts: %q", log.lines)
+	}
+}
+
+func TestRun_ProbePrepassSkipsStateDone(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, name := range []string{"Movie A h264 (2001).mkv", "Movie B h264 (2002).mkv"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), make([]byte, 2*minFileSize), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.ProbePrepass = true
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	state, err := openLedger(cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := filepath.Join(inputDir, "Movie A h264 (2001).mkv")
+	fi, err := os.Stat(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.markDone(done, fi, filepath.Join(cfg.OutputDir, "a.mkv")); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := countingProbe(t)
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+	log := &transcriptLogger{}
+	if st := Run(context.Background(), &cfg, log, run); st.Encoded != 1 || st.Skipped != 1 {
+		t.Fatalf("encoded=%d skipped=%d, want 1 and 1: %q", st.Encoded, st.Skipped, log.lines)
+	}
+	if calls["Movie A h264 (2001).mkv"] != 0 || calls["Movie B h264 (2002).mkv"] != 1 {
+		t.Errorf("probe calls %v, want none for the file done in --state", calls)
+	}
+}
+
+func TestProcessFile_ReusesPrepassPlan(t *testing.T) {
+	inputDir := t.TempDir()
+	path := filepath.Join(inputDir, "Movie A h264 (2001).mkv")
+	if err := os.WriteFile(path, make([]byte, 2*minFileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	countingProbe(t)
+	cfg := config.DefaultConfig()
+	cfg.InputDir = inputDir
+	cfg.OutputDir = t.TempDir()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.SkipExisting = false // The second run stands in for a requeued file.
+
+	planned := planFiles(context.Background(), &cfg, []string{path}, nil, nil, 1)
+	probed, plans := plannedCaches(planned)
+	// Marks the cached plan so the test can tell it from a rebuilt one.
+	plans[path].VideoFilters = "prepass"
+
+	var filters []string
+	run := ffmpeg.RunFunc(func(_ context.Context, args []string) ffmpeg.ExecResult {
+		filters = append(filters, args[slices.Index(args, "-vf")+1])
+		return ffmpeg.ExecResult{Err: os.WriteFile(args[len(args)-1], make([]byte, minFileSize), 0o600)}
+	})
+	stats := RunStats{Total: 1, Current: 1}
+	for i := 0; i < 2; i++ {
+		processFile(context.Background(), &cfg, &recordLogger{}, path, &stats, naming.BuildYearVariantIndex([]string{path}),
+			naming.NewCollisionResolver(), testLayout(t, &cfg), run, nil, probed, plans, nil)
+	}
+	if stats.Encoded != 2 || !sliceEqual(filters, []string{"prepass", "prepass"}) {
+		t.Errorf("encoded=%d filters %q, want the pre-pass plan used by both runs", stats.Encoded, filters)
+	}
+	if plans[path].OutputPath != "" {
+		t.Errorf("cached plan modified: output %q", plans[path].OutputPath)
+	}
 }
 
 // --- Helpers ---
 
+// readProgress parses an NDJSON --progress-json file.
+func readProgress(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read progress: %v", err)
+	}
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("progress line %q is not JSON: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// testLayout returns cfg's output layout, failing the test on a bad template.
+func testLayout(t *testing.T, cfg *config.Config) *naming.Layout {
+	t.Helper()
+	layout, err := outputLayout(cfg)
+	if err != nil {
+		t.Fatalf("output layout: %v", err)
+	}
+	return layout
+}
+
+// recordLogger is a Logger that keeps warnings and outliers and discards
+// everything else.
+type recordLogger struct{ warns, outliers []string }
+
+func (l *recordLogger) Info(string, ...interface{})    {}
+func (l *recordLogger) Success(string, ...interface{}) {}
+func (l *recordLogger) Warn(f string, a ...interface{}) {
+	l.warns = append(l.warns, fmt.Sprintf(f, a...))
+}
+func (l *recordLogger) Error(string, ...interface{})       {}
+func (l *recordLogger) Debug(bool, string, ...interface{}) {}
+func (l *recordLogger) Outlier(f string, a ...interface{}) {
+	l.outliers = append(l.outliers, fmt.Sprintf(f, a...))
+}
+func (l *recordLogger) Render(string, ...interface{}) {}
+func (l *recordLogger) Blank()                        {}
+
+// transcriptLogger is a Logger that records every line as "LEVEL message".
+type transcriptLogger struct{ lines []string }
+
+func (l *transcriptLogger) add(level, f string, a ...interface{}) {
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(f, a...))
+}
+func (l *transcriptLogger) Info(f string, a ...interface{})    { l.add("INFO", f, a...) }
+func (l *transcriptLogger) Success(f string, a ...interface{}) { l.add("SUCCESS", f, a...) }
+func (l *transcriptLogger) Warn(f string, a ...interface{})    { l.add("WARN", f, a...) }
+func (l *transcriptLogger) Error(f string, a ...interface{})   { l.add("ERROR", f, a...) }
+func (l *transcriptLogger) Outlier(f string, a ...interface{}) { l.add("OUTLIER", f, a...) }
+func (l *transcriptLogger) Render(f string, a ...interface{})  { l.add("RENDER", f, a...) }
+func (l *transcriptLogger) Debug(bool, string, ...interface{}) {}
+func (l *transcriptLogger) Blank()                             { l.lines = append(l.lines, "BLANK") }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
 func touch(t *testing.T, dir, name string) {
 	t.Helper()
 	path := filepath.Join(dir, name)
@@ -0,0 +1,150 @@
+// plan.go implements the planning pre-pass: probing and planning a batch concurrently before it is processed.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/naming"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// prepassWorkers is how many files --concurrent-probe-prepass probes at
+// once. ffprobe is I/O-bound and short-lived, so this is independent of
+// --jobs.
+const prepassWorkers = 4
+
+// PlannedFile is the pre-pass outcome for one discovered file.
+type PlannedFile struct {
+	Path  string
+	Probe *probe.ProbeResult // nil when the file was not probed or probing failed.
+	Plan  *planner.FilePlan  // nil when the file has no usable video or was not probed.
+	Err   error              // The probe error, if any.
+}
+
+// Plan discovers media files and probes and plans each of them on
+// prepassWorkers workers, returning one PlannedFile per file in discovery
+// order. Files that cannot be stat'ed, are under the corrupt-file size
+// floor, exceed --max-file-size, or are done in --state are returned
+// unprobed, as Run would skip or fail them before probing. Only the
+// discovery and state file errors are returned; probe failures are
+// recorded per file.
+func Plan(ctx context.Context, cfg *config.Config) ([]PlannedFile, error) {
+	files, err := Discover(cfg.InputDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := openLedger(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	return planFiles(ctx, cfg, files, nil, state, prepassWorkers), nil
+}
+
+// planFiles plans files on the given number of workers. Files already in
+// probed (from the --input-sort duration pass) are not probed again;
+// probed is only read here, so it is safe to share across the workers.
+func planFiles(ctx context.Context, cfg *config.Config, files []string, probed probeCache, state *ledger, workers int) []PlannedFile {
+	planned := make([]PlannedFile, len(files))
+	queue := make(chan int, len(files))
+	for i := range files {
+		queue <- i
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				planned[i] = planFile(ctx, cfg, files[i], probed, state)
+			}
+		}()
+	}
+	wg.Wait()
+	return planned
+}
+
+// planFile probes and plans one file. The plan is built from the
+// filename's media type and the probe alone; see splitLanes and
+// processFile for what that leaves out.
+func planFile(ctx context.Context, cfg *config.Config, path string, probed probeCache, state *ledger) PlannedFile {
+	pf := PlannedFile{Path: path}
+	if ctx.Err() != nil {
+		return pf
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() < minFileSize || exceedsMaxFileSize(cfg, fi.Size()) || state.done(path, fi) {
+		return pf
+	}
+	pf.Probe, pf.Err = probed.probe(ctx, cfg.FFprobePath, path)
+	if pf.Err != nil {
+		pf.Probe = nil
+		return pf
+	}
+	if v := pf.Probe.PrimaryVideo; v == nil || v.Width <= 0 || v.Height <= 0 {
+		return pf
+	}
+
+	parsed := naming.ParseFilename(filepath.Base(path), filepath.Dir(path))
+	cfg = fileConfig(cfg, parsed)
+	maxHeight := cfg.Encoder.MovieMaxHeight
+	if parsed.MediaType == naming.MediaTV {
+		maxHeight = cfg.Encoder.TVMaxHeight
+	}
+	plan := planner.BuildPlanWithMaxHeight(cfg, pf.Probe, maxHeight)
+	plan.InputPath = path
+	pf.Plan = plan
+	return pf
+}
+
+// planCache holds the pre-pass plans by input path, for processFile to
+// reuse. Like probeCache it is only written before the workers start.
+type planCache map[string]*planner.FilePlan
+
+// plan returns a copy of the cached plan for path, or nil. processFile
+// fills in and replans its plan in place, and a requeued file runs again,
+// so the cached plan itself is never handed out.
+func (c planCache) plan(path string) *planner.FilePlan {
+	cached, ok := c[path]
+	if !ok {
+		return nil
+	}
+	plan := *cached
+	return &plan
+}
+
+// plannedCaches returns the probe results and plans of planned by input
+// path, for processFile to reuse.
+func plannedCaches(planned []PlannedFile) (probeCache, planCache) {
+	probed, plans := probeCache{}, planCache{}
+	for _, pf := range planned {
+		if pf.Probe != nil {
+			probed[pf.Path] = pf.Probe
+		}
+		if pf.Plan != nil {
+			plans[pf.Path] = pf.Plan
+		}
+	}
+	return probed, plans
+}
+
+// logPrepass logs the action counts of a --concurrent-probe-prepass.
+// Unplanned files are those Run will skip or fail before planning.
+func logPrepass(log Logger, planned []PlannedFile) {
+	counts := map[planner.Action]int{}
+	unplanned := 0
+	for _, pf := range planned {
+		if pf.Plan == nil {
+			unplanned++
+			continue
+		}
+		counts[pf.Plan.Action]++
+	}
+	log.Info("Pre-pass: %d encode(s), %d remux(es), %d skip(s), %d unplanned",
+		counts[planner.ActionEncode], counts[planner.ActionRemux], counts[planner.ActionSkip], unplanned)
+}
@@ -0,0 +1,125 @@
+// pool.go implements Run's worker pool: lanes of workers under a shared cap on running files that can be lowered mid-batch.
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool runs file indices on lanes of workers. Every worker takes a
+// slot before running a file, so at most limit files run at once across
+// all lanes. lower cuts the limit while the batch runs (workers beyond it
+// wait for a slot), and a file whose run asks for it is put back at the
+// head of its lane to run again.
+type workerPool struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	limit       int  // Files allowed to run at once.
+	running     int  // Files running now.
+	interrupted bool // A worker stopped early on ctx cancellation.
+	wg          sync.WaitGroup
+}
+
+// newWorkerPool returns a pool running at most limit files at once (min 1).
+func newWorkerPool(limit int) *workerPool {
+	if limit < 1 {
+		limit = 1
+	}
+	p := &workerPool{limit: limit}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// start launches a lane of n workers draining indices in order. run
+// processes one file and reports whether to requeue it. Workers stop taking
+// files once ctx is cancelled.
+func (p *workerPool) start(ctx context.Context, n int, indices []int, run func(i int) (requeue bool)) {
+	l := &laneQueue{queue: append([]int(nil), indices...)}
+	for w := 0; w < n; w++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				i, ok := l.next()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					p.mu.Lock()
+					p.interrupted = true
+					p.mu.Unlock()
+					return
+				}
+				p.acquire()
+				requeue := run(i)
+				p.release()
+				if requeue {
+					l.pushFront(i)
+				}
+			}
+		}()
+	}
+}
+
+// wait blocks until every lane is drained and reports whether the batch
+// was interrupted.
+func (p *workerPool) wait() (interrupted bool) {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interrupted
+}
+
+// acquire blocks until fewer than limit files are running, then takes a slot.
+func (p *workerPool) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.running >= p.limit {
+		p.cond.Wait()
+	}
+	p.running++
+}
+
+// release frees a slot taken by acquire.
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.cond.Broadcast()
+}
+
+// lower cuts the limit by one and returns the new limit. ok is false when
+// the pool already runs one file at a time.
+func (p *workerPool) lower() (limit int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.limit <= 1 {
+		return p.limit, false
+	}
+	p.limit--
+	return p.limit, true
+}
+
+// laneQueue is the file indices still to run on one lane.
+type laneQueue struct {
+	mu    sync.Mutex
+	queue []int
+}
+
+// next pops the head of the queue; ok is false when it is empty.
+func (l *laneQueue) next() (i int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		return 0, false
+	}
+	i, l.queue = l.queue[0], l.queue[1:]
+	return i, true
+}
+
+// pushFront puts i back at the head of the queue.
+func (l *laneQueue) pushFront(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue = append([]int{i}, l.queue...)
+}
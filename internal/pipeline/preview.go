@@ -0,0 +1,47 @@
+// preview.go writes --preview-frame source/output comparison images.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+	"github.com/backmassage/muxmaster/internal/planner"
+)
+
+// previewDirName is the hidden directory, next to each output, that holds
+// comparison images. Hidden so Jellyfin does not pick the PNGs up as artwork.
+const previewDirName = ".compare"
+
+// previewFramePath returns where the comparison image for plan is written:
+// <output dir>/.compare/<output stem>.png.
+func previewFramePath(plan *planner.FilePlan) string {
+	base := filepath.Base(plan.OutputPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(filepath.Dir(plan.OutputPath), previewDirName, stem+".png")
+}
+
+// writePreviewFrame writes the --preview-frame comparison for a finished
+// encode and returns the paths it created (for --output-owner). Remuxes are
+// skipped since their video is a stream copy. Failures are logged as
+// warnings; the encode itself already succeeded.
+func writePreviewFrame(ctx context.Context, cfg *config.Config, log Logger, plan *planner.FilePlan, run ffmpeg.RunFunc) []string {
+	if cfg.PreviewFrame <= 0 || plan.Action != planner.ActionEncode {
+		return nil
+	}
+	dest := previewFramePath(plan)
+	created := missingDirs(filepath.Dir(dest))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		log.Warn("Cannot create preview directory: %v", err)
+		return nil
+	}
+	if err := ffmpeg.CompareFrame(ctx, cfg.FFmpegPath, plan.InputPath, plan.OutputPath, cfg.PreviewFrame, dest, run); err != nil {
+		log.Warn("Preview frame failed: %v", err)
+		return created
+	}
+	log.Info("  Preview: %s", filepath.Join(previewDirName, filepath.Base(dest)))
+	return append([]string{dest}, created...)
+}
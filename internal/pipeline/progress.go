@@ -0,0 +1,177 @@
+// progress.go implements --progress-json NDJSON batch and per-file progress events, and logged encode progress.
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+)
+
+// Progress event names written to --progress-json, in the order a batch
+// produces them. file_progress is only emitted while ffmpeg runs, so dry
+// runs and skipped files go straight from file_start to file_done.
+const (
+	eventBatchStart   = "batch_start"
+	eventFileStart    = "file_start"
+	eventFileProgress = "file_progress"
+	eventFileDone     = "file_done"
+	eventBatchDone    = "batch_done"
+)
+
+// progressEmitter writes one JSON object per line for each progress event.
+// A nil *progressEmitter discards everything, so callers need no checks
+// when --progress-json is off.
+type progressEmitter struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	now func() time.Time
+}
+
+// openProgress opens the --progress-json target: an all-digit value is an
+// inherited file descriptor (e.g. "3"), anything else a file path that is
+// created or truncated. An empty target returns a nil emitter.
+func openProgress(target string) (*progressEmitter, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if fd, err := strconv.Atoi(target); err == nil {
+		if fd < 0 {
+			return nil, fmt.Errorf("invalid progress fd %d", fd)
+		}
+		return newProgressEmitter(os.NewFile(uintptr(fd), "progress-fd-"+target)), nil
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return newProgressEmitter(f), nil
+}
+
+func newProgressEmitter(w io.WriteCloser) *progressEmitter {
+	return &progressEmitter{w: w, now: time.Now}
+}
+
+// emit writes event with fields plus "event" and an RFC 3339 "time".
+// Write errors are dropped: progress output must never fail a run.
+func (p *progressEmitter) emit(event string, fields map[string]interface{}) {
+	if p == nil {
+		return
+	}
+	obj := map[string]interface{}{"event": event}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	obj["time"] = p.now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	p.w.Write(append(line, '\n'))
+}
+
+// Close closes the underlying file or descriptor.
+func (p *progressEmitter) Close() {
+	if p == nil {
+		return
+	}
+	p.w.Close()
+}
+
+// fileProgress returns a writer for ffmpeg stderr that emits file_progress
+// for file index whenever the whole percent of duration (seconds) reached
+// by ffmpeg's time= field changes.
+func (p *progressEmitter) fileProgress(index int, duration float64) io.Writer {
+	return &progressWriter{p: p, index: index, duration: duration, last: -1}
+}
+
+// progressWriter parses ffmpeg -stats lines, which are \r-separated and may
+// arrive split across writes, so an incomplete trailing line is buffered.
+type progressWriter struct {
+	p        *progressEmitter
+	index    int
+	duration float64
+	last     int
+	partial  string
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	data := w.partial + string(b)
+	cut := strings.LastIndexAny(data, "\r\n")
+	if cut < 0 {
+		w.partial = data
+		return len(b), nil
+	}
+	w.partial = data[cut+1:]
+	for _, line := range strings.FieldsFunc(data[:cut], func(r rune) bool { return r == '\r' || r == '\n' }) {
+		sec, ok := parseStatTime(line)
+		if !ok || w.duration <= 0 {
+			continue
+		}
+		pct := int(math.Min(100, math.Floor(sec*100/w.duration)))
+		if pct == w.last {
+			continue
+		}
+		w.last = pct
+		w.p.emit(eventFileProgress, map[string]interface{}{"index": w.index, "percent": pct})
+	}
+	return len(b), nil
+}
+
+// progressLogStep is the percent interval between logged progress lines.
+const progressLogStep = 25
+
+// logProgress returns a WithProgress callback that logs a render line each
+// time an encode crosses another progressLogStep percent of the input
+// duration, with the ETA and speed when ffmpeg reports them. A retry
+// restarts from 0%, so a drop in percent starts the steps over.
+func logProgress(log Logger) func(ffmpeg.Progress) {
+	last := 0
+	return func(p ffmpeg.Progress) {
+		if p.Percent < 0 || p.Done {
+			return
+		}
+		if p.Percent < last {
+			last = 0
+		}
+		step := p.Percent / progressLogStep * progressLogStep
+		if step <= last || step >= 100 {
+			return
+		}
+		last = step
+		msg := fmt.Sprintf("  Progress: %d%%", p.Percent)
+		if p.ETA > 0 {
+			msg += fmt.Sprintf(" | ETA %s", p.ETA)
+		}
+		if p.Speed > 0 {
+			msg += fmt.Sprintf(" | %.2gx", p.Speed)
+		}
+		log.Render("%s", msg)
+	}
+}
+
+// fileStatus reports how processFile ended for one file by comparing the
+// counters before and after it ran.
+func fileStatus(before, after RunStats, dryRun bool) string {
+	switch {
+	case after.Failed > before.Failed:
+		return "failed"
+	case after.Skipped > before.Skipped:
+		return "skipped"
+	case after.Encoded > before.Encoded && dryRun:
+		return "dry_run"
+	case after.Encoded > before.Encoded:
+		return "done"
+	default:
+		return "interrupted"
+	}
+}
@@ -0,0 +1,145 @@
+// rename.go implements --rename-only: organizing originals into the output layout without encoding.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/naming"
+)
+
+// renameVerbs is the past-tense log wording of each --rename-only mode.
+var renameVerbs = map[config.RenameMode]string{
+	config.RenameMove: "Moved",
+	config.RenameLink: "Linked",
+	config.RenameCopy: "Copied",
+}
+
+// RenameOnly discovers media files, resolves each output path the way Run
+// would (filename parsing, show harmonization, episode offset, collisions)
+// but with the file's own extension, and moves, hardlinks, or copies the
+// original there per cfg.RenameOnly. Files are never probed or encoded.
+// An existing destination is skipped unless --force, and one that already
+// is the input (an in-place layout, or an earlier link) is left alone.
+// --dir-mode/--file-mode and --output-owner apply to the placed file and
+// the directories created for it, except that a hardlinked file keeps the
+// original's mode and owner.
+// Returns false when any file fails or discovery fails.
+func RenameOnly(ctx context.Context, cfg *config.Config, log Logger) bool {
+	files, err := Discover(cfg.InputDir)
+	if err != nil {
+		log.Error("File discovery failed: %v", err)
+		return false
+	}
+	if len(files) == 0 {
+		log.Warn("No media files found in %s", cfg.InputDir)
+		return true
+	}
+
+	layout, err := outputLayout(cfg)
+	if err != nil {
+		log.Error("Invalid output layout: %v", err)
+		return false
+	}
+	yearIndex := naming.BuildYearVariantIndex(files)
+	resolver := naming.NewCollisionResolver()
+	verb := renameVerbs[cfg.RenameOnly]
+
+	var placed, skipped, failed int
+	for i, path := range files {
+		if ctx.Err() != nil {
+			log.Warn("Interrupted")
+			break
+		}
+		parsed := parseOutputName(cfg, log, path, yearIndex)
+		ext := strings.TrimPrefix(filepath.Ext(path), ".")
+		dst := resolver.Resolve(path, layout.OutputPath(parsed, cfg.OutputDir, ext))
+		rel, relErr := filepath.Rel(cfg.OutputDir, dst)
+		if relErr != nil {
+			rel = dst
+		}
+		log.Info("[%d/%d] %s -> %s", i+1, len(files), filepath.Base(path), rel)
+
+		if sameFile(path, dst) {
+			log.Warn("  Skip (already in place)")
+			skipped++
+			continue
+		}
+		if _, err := os.Stat(dst); err == nil && cfg.SkipExisting {
+			log.Warn("  Skip (exists)")
+			skipped++
+			continue
+		}
+		if cfg.DryRun {
+			log.Success("  [DRY] Would %s", cfg.RenameOnly)
+			placed++
+			continue
+		}
+		createdDirs := missingDirs(filepath.Dir(dst))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			log.Error("  Cannot create output directory: %v", err)
+			failed++
+			continue
+		}
+		if err := placeFile(cfg.RenameOnly, path, dst); err != nil {
+			log.Error("  %v", err)
+			failed++
+			continue
+		}
+		// A hardlink shares the original's inode, so its mode and owner
+		// are left alone; only the directories created for it are set.
+		placedPaths := createdDirs
+		if cfg.RenameOnly != config.RenameLink {
+			placedPaths = append([]string{dst}, createdDirs...)
+		}
+		setMode(cfg, log, placedPaths)
+		setOwner(cfg, log, placedPaths)
+		placed++
+	}
+
+	log.Blank()
+	log.Info("%s: %d, skipped: %d", verb, placed, skipped)
+	if failed > 0 {
+		log.Error("Failed: %d", failed)
+		return false
+	}
+	return ctx.Err() == nil
+}
+
+// placeFile puts src at dst per mode, replacing any existing dst. Links
+// and copies are made beside dst and renamed into place, so dst never
+// appears half-written; a move uses moveFile, which copies across
+// filesystems. Hardlinks cannot cross filesystems.
+func placeFile(mode config.RenameMode, src, dst string) error {
+	if mode == config.RenameMove {
+		return moveFile(src, dst)
+	}
+	tmp := dst + ".part"
+	os.Remove(tmp)
+	var err error
+	if mode == config.RenameLink {
+		err = os.Link(src, tmp)
+	} else {
+		err = copyFile(src, tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// sameFile reports whether a and b both exist and are the same file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
@@ -33,57 +33,124 @@ func logStderr(log Logger, stderr string) {
 
 func logBatchHeader(cfg *config.Config, log Logger, stats *RunStats) {
 	log.Info("Found %d files", stats.Total)
+	if cfg.InputSort != "" && cfg.InputSort != config.InputSortName {
+		log.Info("Input order: %s", cfg.InputSort)
+	}
 
 	profileLabel := cfg.Encoder.CpuProfile
 	qualityValue := cfg.Encoder.CpuCRF
-	if cfg.Encoder.Mode == config.EncoderVAAPI {
+	switch cfg.Encoder.Mode {
+	case config.EncoderVAAPI:
 		profileLabel = cfg.Encoder.VaapiProfile
 		if profileLabel == "" {
 			profileLabel = "main10"
 		}
 		qualityValue = cfg.Encoder.VaapiQP
+	case config.EncoderQSV:
+		profileLabel = "main"
+		qualityValue = cfg.Encoder.VaapiQP
 	}
 	log.Info("Mode: %s (HEVC %s), QP/CRF: %d", cfg.Encoder.Mode, profileLabel, qualityValue)
 
 	if cfg.Encoder.ActiveQualityOverride != "" {
-		if cfg.Encoder.Mode == config.EncoderVAAPI {
+		if cfg.Encoder.Mode.UsesQP() {
 			log.Info("Quality mode: manual fixed override (VAAPI_QP=%s)", cfg.Encoder.ActiveQualityOverride)
 		} else {
 			log.Info("Quality mode: manual fixed override (CPU_CRF=%s)", cfg.Encoder.ActiveQualityOverride)
 		}
 	} else if cfg.Encoder.SmartQuality {
 		log.Info("Quality mode: smart per-file adaptation (mode-specific CPU/VAAPI curves)")
+		if cfg.RetryIfTinyPct > 0 {
+			log.Info("Tiny-output retry: Re-encode at -%d QP/CRF below %d%% of input", tinyRetryStep, cfg.RetryIfTinyPct)
+		}
 	} else {
 		log.Info("Quality mode: fixed defaults")
 	}
 
 	log.Info("Container: %s", strings.ToUpper(string(cfg.OutputContainer)))
-	log.Info("Audio: AAC passthrough, non-AAC encode to AAC via %s at %s", cfg.Audio.Encoder, cfg.Audio.Bitrate)
+	codec := strings.ToUpper(string(cfg.Audio.TargetCodec()))
+	log.Info("Audio: %s passthrough, non-%s encode to %s via %s at %s", codec, codec, codec, cfg.Audio.Encoder, cfg.Audio.Bitrate)
+	if cfg.Audio.AACCopyMaxKbps > 0 {
+		log.Info("AAC copy cap: Transcode AAC above %dk", cfg.Audio.AACCopyMaxKbps)
+	}
+	if cfg.Audio.CopyCompatible {
+		log.Info("Audio copy: Any codec %s supports is copied", strings.ToUpper(string(cfg.OutputContainer)))
+	}
 
 	if cfg.OutputContainer == config.ContainerMP4 {
 		log.Info("Compatibility: hvc1 tag for Apple/browser support")
 	}
+	if cfg.OutputContainer == config.ContainerHLS {
+		log.Info("HLS: single-rendition VOD playlist, %ds segments", planner.HLSSegmentSeconds)
+	}
 	if cfg.Encoder.HandleHDR == config.HDRPreserve {
 		log.Info("HDR: Preserve metadata when present")
 	} else {
 		log.Info("HDR: Tonemap to SDR")
 	}
-	if cfg.Encoder.DeinterlaceAuto {
+	if cfg.Encoder.TVMaxHeight > 0 {
+		log.Info("Max height (TV): %dp", cfg.Encoder.TVMaxHeight)
+	}
+	if cfg.Encoder.MovieMaxHeight > 0 {
+		log.Info("Max height (movies): %dp", cfg.Encoder.MovieMaxHeight)
+	}
+	if cfg.Encoder.ScaleTo > 0 {
+		log.Info("Scale to: %dp", cfg.Encoder.ScaleTo)
+	}
+	if cfg.Encoder.DeinterlaceAuto && cfg.Encoder.DetectInterlace {
+		log.Info("Deinterlace: idet sampling; yadif or fieldmatch,decimate")
+	} else if cfg.Encoder.DeinterlaceAuto {
 		log.Info("Deinterlace: Auto-detect and apply yadif")
 	}
-	if cfg.KeepSubtitles {
+	if cfg.Encoder.Denoise != config.DenoiseOff {
+		log.Info("Denoise: %s", cfg.Encoder.Denoise)
+	}
+	if cfg.KeepSubtitles && cfg.OutputContainer != config.ContainerHLS {
 		if cfg.OutputContainer == config.ContainerMP4 {
 			log.Info("Subtitles: Text subs only (mov_text for MP4)")
+		} else if cfg.SubtitleCodec != config.SubtitleCodecCopy {
+			log.Info("Subtitles: Convert all streams to %s", cfg.SubtitleCodec)
 		} else {
 			log.Info("Subtitles: Copy all streams")
 		}
 	}
-	if cfg.KeepAttachments && cfg.OutputContainer != config.ContainerMP4 {
+	if len(cfg.SubLangs) > 0 && cfg.KeepSubtitles && cfg.OutputContainer != config.ContainerHLS {
+		fallback := "all if none match"
+		if cfg.SubsOnlyIfPresentLangs {
+			fallback = "none if none match"
+		}
+		log.Info("Subtitles: Languages %s (%s)", strings.Join(cfg.SubLangs, ","), fallback)
+	}
+	if cfg.SubsDefaultByAudioLang && cfg.KeepSubtitles && cfg.OutputContainer != config.ContainerHLS {
+		log.Info("Subtitles: Default %s subs on for foreign-language audio only", cfg.MyLang)
+	}
+	if cfg.SidecarSubs && cfg.KeepSubtitles && cfg.OutputContainer != config.ContainerHLS {
+		log.Info("Subtitles: Import sidecar .srt/.ass/.vtt files")
+	}
+	if cfg.KeepAttachments && cfg.OutputContainer == config.ContainerMKV {
 		log.Info("Attachments: Copy fonts/images")
 	}
+	if cfg.KeepCoverArt && cfg.OutputContainer == config.ContainerMKV {
+		log.Info("Cover art: Keep embedded attached_pic")
+	}
+	if cfg.EpisodeOffset != 0 {
+		log.Info("Episode offset: +%d (specials unchanged)", cfg.EpisodeOffset)
+	}
 	if cfg.SkipHEVC {
 		log.Info("HEVC sources: Remux (copy video, copy/encode audio)")
 	}
+	if !cfg.StrictMode && cfg.RemuxFallback != config.RemuxFallbackFail {
+		log.Info("Rejected remuxes: Fall back to %s", cfg.RemuxFallback)
+	}
+	if cfg.OutputUID >= 0 || cfg.OutputGID >= 0 {
+		log.Info("Output owner: uid %d, gid %d (-1 = unchanged)", cfg.OutputUID, cfg.OutputGID)
+	}
+	if cfg.SkipOptimized {
+		log.Info("Already-optimized sources: Skip")
+	}
+	if cfg.Only != config.ActionFilterAll {
+		log.Info("Only: Files planned to %s", cfg.Only)
+	}
 	if cfg.StrictMode {
 		log.Info("Retry policy: Strict mode (no auto-retry)")
 	}
@@ -105,8 +172,16 @@ func logInputMeta(log Logger, pr *probe.ProbeResult) {
 	if hdr == "hdr10" {
 		flags = append(flags, "HDR10")
 	}
+	if dv := v.DolbyVision; dv != nil {
+		flags = append(flags, fmt.Sprintf("Dolby Vision (profile %d)", dv.Profile))
+	}
 	if pr.IsInterlaced() {
 		flags = append(flags, "interlaced")
+	} else if pr.IsTelecined() {
+		flags = append(flags, "telecined")
+	}
+	if pr.IsNon420Chroma() {
+		flags = append(flags, pr.PrimaryVideo.PixFmt+" (software decode, 4:2:0 for VAAPI)")
 	}
 
 	tag := fmt.Sprintf("%s[Input]%s", term.Magenta, term.NC)
@@ -122,23 +197,33 @@ func logFileStats(log Logger, plan *planner.FilePlan) {
 		return
 	}
 
+	var hdrTag string
+	if plan.HDR10Plus {
+		hdrTag = " [HDR10+]"
+	}
+
 	codec := plan.VideoCodec
 	if codec == "" || codec == "copy" {
-		log.Info("  Video: copy (remux)")
+		log.Info("  Video: copy (remux)%s", hdrTag)
+		logChapters(log, plan)
 		return
 	}
 
 	method := "CPU"
 	qLabel := fmt.Sprintf("CRF %d", plan.CpuCRF)
-	if strings.Contains(codec, "vaapi") {
+	switch {
+	case strings.Contains(codec, "vaapi"):
 		method = "VAAPI"
 		qLabel = fmt.Sprintf("QP %d", plan.VaapiQP)
+	case strings.Contains(codec, "qsv"):
+		method = "QSV"
+		qLabel = fmt.Sprintf("QP %d", plan.VaapiQP)
 	}
 
 	if plan.PreflightBumps > 0 {
-		log.Info("  Video: %s | %s (preflight +%d) | %s", codec, qLabel, plan.PreflightBumps, method)
+		log.Info("  Video: %s | %s (preflight +%d) | %s%s", codec, qLabel, plan.PreflightBumps, method, hdrTag)
 	} else {
-		log.Info("  Video: %s | %s | %s", codec, qLabel, method)
+		log.Info("  Video: %s | %s | %s%s", codec, qLabel, method, hdrTag)
 	}
 
 	if plan.MaxRateKbps > 0 {
@@ -154,6 +239,19 @@ func logFileStats(log Logger, plan *planner.FilePlan) {
 			plan.Estimate.LowKbps, plan.Estimate.HighKbps,
 			plan.Estimate.LowPct, plan.Estimate.HighPct)
 	}
+	logChapters(log, plan)
+}
+
+// logChapters reports the source chapter count, so users can confirm that
+// chapters carry over (-map_chapters 0). Files without chapters log nothing.
+func logChapters(log Logger, plan *planner.FilePlan) {
+	switch plan.ChapterCount {
+	case 0:
+	case 1:
+		log.Info("  Chapters: 1 chapter")
+	default:
+		log.Info("  Chapters: %d chapters", plan.ChapterCount)
+	}
 }
 
 // bitrateTier defines the expected bitrate range for a resolution bucket,
@@ -174,37 +272,73 @@ var bitrateTiers = []bitrateTier{
 	{3840 * 2160, 10000, 45000, "<=2160p"},
 }
 
-func logBitrateOutlier(log Logger, pr *probe.ProbeResult) {
+// outlierTiers returns the tier table for bitrate outlier checks: the
+// user's --bitrate-tiers when set, otherwise the built-in bitrateTiers.
+// User tiers are keyed by height and converted to a 16:9 pixel area.
+func outlierTiers(cfg *config.Config) []bitrateTier {
+	if len(cfg.Display.BitrateTiers) == 0 {
+		return bitrateTiers
+	}
+	tiers := make([]bitrateTier, len(cfg.Display.BitrateTiers))
+	for i, t := range cfg.Display.BitrateTiers {
+		width := (t.MaxHeight*16 + 8) / 9
+		tiers[i] = bitrateTier{
+			maxPixels: width * t.MaxHeight,
+			lowKbps:   t.LowKbps,
+			highKbps:  t.HighKbps,
+			label:     fmt.Sprintf("<=%dp", t.MaxHeight),
+		}
+	}
+	return tiers
+}
+
+// classifyBitrate returns "low", "high", or "" for a source's video bitrate
+// against tiers, plus the matched range. Sources above the built-in table
+// use the >2160p fallback; sources above a custom table are not checked.
+func classifyBitrate(pr *probe.ProbeResult, tiers []bitrateTier, custom bool) (dir string, low, high int64, label string) {
 	v := pr.PrimaryVideo
 	if v == nil || v.Width <= 0 || v.Height <= 0 {
-		return
+		return "", 0, 0, ""
 	}
 
 	bitrateKbps := pr.VideoBitRate() / 1000
 	if bitrateKbps <= 0 {
-		return
+		return "", 0, 0, ""
 	}
 
 	pixels := v.Width * v.Height
-	var low, high int64
-	var label string
-	for _, t := range bitrateTiers {
+	for _, t := range tiers {
 		if pixels <= t.maxPixels {
 			low, high, label = t.lowKbps, t.highKbps, t.label
 			break
 		}
 	}
 	if label == "" {
+		if custom {
+			return "", 0, 0, ""
+		}
 		low, high, label = 15000, 65000, ">2160p"
 	}
 
-	if bitrateKbps < low {
-		log.Outlier("  Bitrate outlier (low): %d kb/s for %s; expected %d-%d kb/s (%s)",
-			bitrateKbps, pr.Resolution(), low, high, label)
-	} else if bitrateKbps > high {
-		log.Outlier("  Bitrate outlier (high): %d kb/s for %s; expected %d-%d kb/s (%s)",
-			bitrateKbps, pr.Resolution(), low, high, label)
+	switch {
+	case bitrateKbps < low:
+		dir = "low"
+	case bitrateKbps > high:
+		dir = "high"
+	}
+	return dir, low, high, label
+}
+
+func logBitrateOutlier(cfg *config.Config, log Logger, pr *probe.ProbeResult) {
+	if !cfg.Display.ShowBitrateWarnings {
+		return
 	}
+	dir, low, high, label := classifyBitrate(pr, outlierTiers(cfg), len(cfg.Display.BitrateTiers) > 0)
+	if dir == "" {
+		return
+	}
+	log.Outlier("  Bitrate outlier (%s): %d kb/s for %s; expected %d-%d kb/s (%s)",
+		dir, pr.VideoBitRate()/1000, pr.Resolution(), low, high, label)
 }
 
 func logAudioBitrates(log Logger, pr *probe.ProbeResult, plan *planner.FilePlan) {
@@ -213,6 +347,10 @@ func logAudioBitrates(log Logger, pr *probe.ProbeResult, plan *planner.FilePlan)
 		return
 	}
 
+	planned := make(map[int]planner.AudioStreamPlan, len(ap.Streams))
+	for _, s := range ap.Streams {
+		planned[s.StreamIndex] = s
+	}
 	for i, a := range pr.AudioStreams {
 		inKbps := a.BitRate / 1000
 		inStr := "unknown"
@@ -220,16 +358,19 @@ func logAudioBitrates(log Logger, pr *probe.ProbeResult, plan *planner.FilePlan)
 			inStr = fmt.Sprintf("%d kbps", inKbps)
 		}
 
-		outStr := "n/a"
+		var outStr string
+		s, ok := planned[i]
 		switch {
+		case a.Degenerate:
+			outStr = "dropped (no usable audio)"
 		case ap.CopyAll:
 			outStr = "copy"
-		case i < len(ap.Streams):
-			if ap.Streams[i].Copy {
-				outStr = "copy"
-			} else {
-				outStr = ap.Streams[i].Bitrate
-			}
+		case ok && s.Copy:
+			outStr = "copy"
+		case ok:
+			outStr = s.Bitrate
+		default:
+			outStr = "dropped (track selection)"
 		}
 
 		log.Info("  Audio[%d]: %s | in: %s | out: %s", a.Index, a.Codec, inStr, outStr)
@@ -257,4 +398,39 @@ func logSummary(cfg *config.Config, log Logger, stats *RunStats) {
 		log.Warn("  Total space saved: -%s (overall output is larger)",
 			display.FormatBytes(-saved))
 	}
+
+	if cfg.Display.RatioReport {
+		logRatioReport(log, stats.Grown)
+	}
+}
+
+// logCheckpoint logs the running totals for --checkpoint-every: a one-line
+// logSummary printed mid-batch, counted in finished files (with --jobs,
+// files finish out of order).
+func logCheckpoint(cfg *config.Config, log Logger, stats *RunStats) {
+	counts := fmt.Sprintf("Checkpoint [%d/%d]: %d encoded, %d skipped, %d failed",
+		stats.Current, stats.Total, stats.Encoded, stats.Skipped, stats.Failed)
+	if cfg.DryRun {
+		log.Info("%s", counts)
+		return
+	}
+	if saved := stats.SpaceSaved(); saved >= 0 {
+		log.Info("%s, %s saved", counts, display.FormatBytes(saved))
+	} else {
+		log.Info("%s, -%s saved", counts, display.FormatBytes(-saved))
+	}
+}
+
+// logRatioReport lists outputs larger than their input (--keep-ratio-report),
+// which are candidates for a remux or different settings.
+func logRatioReport(log Logger, grown []GrownFile) {
+	if len(grown) == 0 {
+		log.Info("  Grown outputs: none")
+		return
+	}
+	log.Warn("  Grown outputs (%d):", len(grown))
+	for _, g := range grown {
+		log.Warn("    %s: %s -> %s (%d%%, %s)", g.Name,
+			display.FormatBytes(g.InputBytes), display.FormatBytes(g.OutputBytes), g.RatioPct(), g.Quality)
+	}
 }
@@ -0,0 +1,96 @@
+// retrylog.go implements --retry-log: the full ffmpeg command and stderr of
+// every attempt for a file that ultimately fails, written to one file.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+)
+
+// attemptRecord is one ffmpeg invocation captured by an attemptTrail.
+type attemptRecord struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+// attemptTrail records every ffmpeg run for one file. Wrapping the RunFunc
+// captures error retries, remux fallbacks, and quality re-encodes alike
+// without threading state through the retry loops.
+type attemptTrail struct {
+	attempts []attemptRecord
+}
+
+// wrap returns a RunFunc that delegates to run and records the result.
+func (t *attemptTrail) wrap(run ffmpeg.RunFunc) ffmpeg.RunFunc {
+	return func(ctx context.Context, args []string) ffmpeg.ExecResult {
+		res := run(ctx, args)
+		t.attempts = append(t.attempts, attemptRecord{args: args, stderr: res.Stderr, err: res.Err})
+		return res
+	}
+}
+
+// retryLogPath returns <dir>/<input basename>.<hash>.log, where hash is
+// eight hex digits of the input's absolute path, so that same-named inputs
+// in different directories (S01E01.mkv in every season) get their own log.
+func retryLogPath(dir, inputPath string) string {
+	if abs, err := filepath.Abs(inputPath); err == nil {
+		inputPath = abs
+	}
+	h := fnv.New32a()
+	h.Write([]byte(inputPath))
+	return filepath.Join(dir, fmt.Sprintf("%s.%08x.log", filepath.Base(inputPath), h.Sum32()))
+}
+
+// write saves the trail for inputPath under dir and returns the log path.
+// Nothing is written when no attempt was recorded.
+func (t *attemptTrail) write(dir, inputPath string) (string, error) {
+	if len(t.attempts) == 0 {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", inputPath)
+	for i, a := range t.attempts {
+		status := "ok"
+		if a.err != nil {
+			status = a.err.Error()
+		}
+		fmt.Fprintf(&b, "\n=== Attempt %d: %s ===\n$ %s\n", i+1, status, ffmpeg.ShellQuote(a.args))
+		b.WriteString(a.stderr)
+		if a.stderr != "" && !strings.HasSuffix(a.stderr, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+
+	path := retryLogPath(dir, inputPath)
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeRetryLog writes trail for a failed file when --retry-log is set,
+// logging where it went (or why it could not be written).
+func writeRetryLog(log Logger, dir string, trail *attemptTrail, inputPath string) {
+	if dir == "" || trail == nil {
+		return
+	}
+	path, err := trail.write(dir, inputPath)
+	if err != nil {
+		log.Warn("Cannot write retry log: %v", err)
+		return
+	}
+	if path != "" {
+		log.Error("Full ffmpeg output: %s", path)
+	}
+}
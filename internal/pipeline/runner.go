@@ -7,9 +7,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/display"
 	"github.com/backmassage/muxmaster/internal/ffmpeg"
 	"github.com/backmassage/muxmaster/internal/naming"
 	"github.com/backmassage/muxmaster/internal/planner"
@@ -19,10 +21,38 @@ import (
 
 const minFileSize = 1000
 
+// exceedsMaxFileSize reports whether an input of size bytes is above
+// --max-file-size (0 = no cap).
+func exceedsMaxFileSize(cfg *config.Config, size int64) bool {
+	return cfg.MaxFileSize > 0 && size > cfg.MaxFileSize
+}
+
 // Run is the top-level batch entry point. It discovers files, builds the
-// TV year-variant index, processes each file sequentially, and returns
-// aggregate stats. The run parameter controls how ffmpeg subprocesses are
-// launched; production callers pass ffmpeg.NewRunFunc, tests pass a mock.
+// TV year-variant index, claims every output path in discovery order (see
+// claimOutputs), orders the files for --input-sort, processes the files
+// on a pool of --jobs workers (one, i.e. sequential, by default; see
+// workerPool), and returns aggregate stats. The run parameter controls how ffmpeg
+// subprocesses are launched; production callers pass ffmpeg.NewRunFunc,
+// tests pass a mock.
+//
+// With --concurrent-probe-prepass or --remux-jobs, a planning pre-pass
+// (planFiles) probes and plans every file before the workers start; the
+// execution phase reuses its probes and plans, replanning only files that
+// --detect-interlace, --auto-crop, or the container checks refine. With
+// --remux-jobs, the pre-pass splits the files into an encode lane on the
+// --jobs workers and a remux lane on --remux-jobs workers of their own, so
+// fast remuxes are not queued behind encodes.
+//
+// When ffmpeg fails with file-descriptor exhaustion ("Too many open
+// files") while more than one file may run at once, the pool's limit is
+// lowered by one and the file is cancelled and requeued; its stats and
+// buffered log are discarded, and its file_start progress event is not
+// repeated. At one file at a time the failure stands.
+//
+// Each file gets its own RunStats, merged into the batch totals under a
+// mutex when it finishes. With more than one worker, each file's log lines
+// are buffered and flushed as one block under the same mutex, followed by a
+// --checkpoint-every line when the finished count reaches an interval.
 func Run(ctx context.Context, cfg *config.Config, log Logger, run ffmpeg.RunFunc) RunStats {
 	var stats RunStats
 
@@ -32,28 +62,244 @@ func Run(ctx context.Context, cfg *config.Config, log Logger, run ffmpeg.RunFunc
 		return stats
 	}
 
+	progress, err := openProgress(cfg.Display.ProgressJSON)
+	if err != nil {
+		log.Error("Cannot open progress output: %v", err)
+		return stats
+	}
+	defer progress.Close()
+
+	state, err := openLedger(cfg.StateFile)
+	if err != nil {
+		log.Error("Cannot read state file: %v", err)
+		return stats
+	}
+
+	layout, err := outputLayout(cfg)
+	if err != nil {
+		log.Error("Invalid output layout: %v", err)
+		return stats
+	}
+
 	stats.Total = len(files)
 	yearIndex := naming.BuildYearVariantIndex(files)
 	resolver := naming.NewCollisionResolver()
+	claimOutputs(cfg, files, yearIndex, resolver, layout)
+	probed := sortInputs(ctx, cfg, files)
 
 	logBatchHeader(cfg, log, &stats)
+	jobs := workerCount(cfg, log)
+	var lanes laneSplit
+	var plans planCache
+	if cfg.ProbePrepass || cfg.RemuxJobs > 0 {
+		workers := 1
+		if cfg.ProbePrepass {
+			workers = prepassWorkers
+		}
+		planned := planFiles(ctx, cfg, files, probed, state, workers)
+		probed, plans = plannedCaches(planned)
+		if cfg.ProbePrepass {
+			logPrepass(log, planned)
+		}
+		lanes = splitLanes(planned)
+	}
+	if cfg.RemuxJobs > 0 {
+		log.Info("Lanes: %d encode(s) on %d worker(s), %d other file(s) on %d worker(s)",
+			len(lanes.encodes), jobs, len(lanes.remuxes), cfg.RemuxJobs)
+	} else if jobs > 1 {
+		log.Info("Parallel jobs: %d", jobs)
+	}
+	buffered := jobs > 1 || cfg.RemuxJobs > 0
+	progress.emit(eventBatchStart, map[string]interface{}{"total": stats.Total, "dry_run": cfg.DryRun})
 
-	for i, path := range files {
-		stats.Current = i + 1
+	var mu sync.Mutex             // Guards stats and started, serializes log flushes.
+	started := make(map[int]bool) // Files whose file_start was emitted; a requeued file's run emits none.
+	pool := newWorkerPool(jobs + cfg.RemuxJobs)
+	runOne := func(i int) (requeue bool) {
+		path := files[i]
+		fstats := RunStats{Total: len(files), Current: i + 1}
 
-		if ctx.Err() != nil {
-			log.Warn("Interrupted")
-			break
+		var fileLog Logger = log
+		var buf *bufferedLogger
+		if buffered {
+			buf = &bufferedLogger{}
+			fileLog = buf
+		}
+		if cfg.Display.SummaryOnly {
+			fileLog = &summaryOnlyLogger{
+				Logger: fileLog,
+				header: fmt.Sprintf("[%d/%d] %s", fstats.Current, fstats.Total, filepath.Base(path)),
+			}
+		}
+
+		// A file whose ffmpeg runs out of file descriptors while the pool
+		// can still shrink is cancelled on the spot, so processFile stops
+		// retrying and writes no --retry-log, and then requeued.
+		fileCtx, cancelFile := context.WithCancel(ctx)
+		defer cancelFile()
+		fileRun, lowered := run, 0
+		if run != nil {
+			fileRun = func(runCtx context.Context, args []string) ffmpeg.ExecResult {
+				res := run(runCtx, args)
+				if res.Err != nil && lowered == 0 && ctx.Err() == nil && ffmpeg.MatchTooManyOpenFiles(res.Stderr) {
+					if limit, ok := pool.lower(); ok {
+						lowered = limit
+						cancelFile()
+					}
+				}
+				return res
+			}
+		}
+
+		mu.Lock()
+		first := !started[i]
+		started[i] = true
+		mu.Unlock()
+		if first {
+			progress.emit(eventFileStart, map[string]interface{}{"index": fstats.Current, "total": fstats.Total, "input": path})
+		}
+		processFile(fileCtx, cfg, fileLog, path, &fstats, yearIndex, resolver, layout, fileRun, progress, probed, plans, state)
+		if lowered > 0 {
+			mu.Lock()
+			log.Warn("Too many open files: lowering parallelism to %d and retrying %s", lowered, filepath.Base(path))
+			mu.Unlock()
+			return true
 		}
+		progress.emit(eventFileDone, map[string]interface{}{
+			"index":  fstats.Current,
+			"input":  path,
+			"status": fileStatus(RunStats{}, fstats, cfg.DryRun),
+		})
 
-		processFile(ctx, cfg, log, path, &stats, yearIndex, resolver, run)
+		mu.Lock()
+		defer mu.Unlock()
+		stats.add(fstats)
+		if buf != nil {
+			buf.flushTo(log)
+		}
+		if n := cfg.Display.CheckpointEvery; n > 0 && stats.Current%n == 0 && stats.Current < stats.Total {
+			logCheckpoint(cfg, log, &stats)
+		}
+		return false
+	}
+
+	if cfg.RemuxJobs > 0 {
+		pool.start(ctx, jobs, lanes.encodes, runOne)
+		pool.start(ctx, cfg.RemuxJobs, lanes.remuxes, runOne)
+	} else {
+		all := make([]int, len(files))
+		for i := range files {
+			all[i] = i
+		}
+		pool.start(ctx, jobs, all, runOne)
+	}
+	if pool.wait() {
+		log.Warn("Interrupted")
 	}
 
 	logSummary(cfg, log, &stats)
+	if cfg.Display.SummaryJSON {
+		if err := writeSummaryJSON(summaryJSONOut, cfg, &stats, ctx.Err() != nil); err != nil {
+			log.Error("Cannot write summary JSON: %v", err)
+		}
+	}
+	progress.emit(eventBatchDone, map[string]interface{}{
+		"total":       stats.Total,
+		"encoded":     stats.Encoded,
+		"skipped":     stats.Skipped,
+		"failed":      stats.Failed,
+		"interrupted": ctx.Err() != nil,
+	})
 	return stats
 }
 
+// workerCount returns the number of Run workers: cfg.Jobs, capped at
+// --vaapi-concurrency in VAAPI mode, where extra workers would only queue
+// on the device limiter while contending for the GPU.
+func workerCount(cfg *config.Config, log Logger) int {
+	jobs := cfg.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if limit := cfg.Encoder.VaapiConcurrency; cfg.Encoder.Mode == config.EncoderVAAPI && limit >= 1 && jobs > limit {
+		log.Warn("--jobs %d capped to %d in VAAPI mode to avoid GPU contention (see --vaapi-concurrency)", jobs, limit)
+		jobs = limit
+	}
+	return jobs
+}
+
+// fileConfig returns cfg adjusted for what the filename says about the
+// file: a Dual Audio release gets a copy with Audio.DualAudio set. The
+// pre-pass and processFile both plan under it, so their plans agree.
+func fileConfig(cfg *config.Config, parsed naming.ParsedName) *config.Config {
+	if !parsed.DualAudio {
+		return cfg
+	}
+	dual := *cfg
+	dual.Audio.DualAudio = true
+	return &dual
+}
+
+// resolveOutput parses the name of path (see parseOutputName) and returns
+// it with its final, collision-free output path under layout.
+func resolveOutput(
+	cfg *config.Config,
+	log Logger,
+	path string,
+	yearIndex naming.YearVariantIndex,
+	resolver *naming.CollisionResolver,
+	layout *naming.Layout,
+) (naming.ParsedName, string) {
+	parsed := parseOutputName(cfg, log, path, yearIndex)
+	outputPath := layout.OutputPath(parsed, cfg.OutputDir, string(cfg.OutputContainer))
+	return parsed, resolver.Resolve(path, outputPath)
+}
+
+// claimOutputs resolves the output path of every file in discovery order,
+// before --input-sort and the workers reorder them, as OutputTree does. The
+// " - dupN" suffix a file gets then never depends on scheduling, so re-runs
+// under --state or SkipExisting map each input to the same output.
+// processFile's resolveOutput gets the claimed path back; the naming debug
+// lines are only logged there, with the file.
+func claimOutputs(cfg *config.Config, files []string, yearIndex naming.YearVariantIndex, resolver *naming.CollisionResolver, layout *naming.Layout) {
+	for _, path := range files {
+		resolveOutput(cfg, &bufferedLogger{}, path, yearIndex, resolver, layout)
+	}
+}
+
+// parseOutputName parses the filename of path, harmonizes TV show names
+// and applies --absolute-numbering and --episode-offset (TV) or
+// --keep-raw-names (movies).
+func parseOutputName(cfg *config.Config, log Logger, path string, yearIndex naming.YearVariantIndex) naming.ParsedName {
+	parsed := naming.ParseFilename(filepath.Base(path), filepath.Dir(path))
+	if parsed.MediaType == naming.MediaTV {
+		if cfg.AbsoluteNumbering {
+			parsed = naming.ApplyAbsoluteNumbering(parsed)
+		}
+		orig := parsed.ShowName
+		parsed.ShowName = naming.HarmonizeShowName(parsed.ShowName, yearIndex)
+		if parsed.ShowName != orig {
+			log.Debug(cfg.Display.Verbose, "Harmonized show name: '%s' -> '%s'", orig, parsed.ShowName)
+		}
+		parsed = naming.ApplyEpisodeOffset(parsed, cfg.EpisodeOffset)
+	} else if cfg.KeepRawNames && parsed.RawMovieName != "" {
+		log.Debug(cfg.Display.Verbose, "Kept raw movie name: '%s' (tag stripping left '%s')", parsed.RawMovieName, parsed.MovieName)
+		parsed = naming.KeepRawName(parsed)
+	}
+	return parsed
+}
+
+// outputLayout parses the --tv-template / --movie-template layout over the
+// --naming-convention preset. Run, RenameOnly and OutputTree parse it once
+// and refuse to start on an invalid template.
+func outputLayout(cfg *config.Config) (*naming.Layout, error) {
+	return naming.NewConventionLayout(naming.Convention(cfg.NamingConvention), cfg.TVTemplate, cfg.MovieTemplate)
+}
+
 // processFile handles one media file: validate → probe → name → plan → execute.
+// probed and plans hold results of the planning pre-pass (nil without one),
+// and state is the --state ledger (nil without one): files it lists as done
+// are skipped, and each completed file is recorded in it.
 func processFile(
 	ctx context.Context,
 	cfg *config.Config,
@@ -62,7 +308,12 @@ func processFile(
 	stats *RunStats,
 	yearIndex naming.YearVariantIndex,
 	resolver *naming.CollisionResolver,
+	layout *naming.Layout,
 	run ffmpeg.RunFunc,
+	progress *progressEmitter,
+	probed probeCache,
+	plans planCache,
+	state *ledger,
 ) {
 	basename := filepath.Base(path)
 	log.Info("[%d/%d] %s%s%s", stats.Current, stats.Total, term.Cyan, basename, term.NC)
@@ -81,9 +332,21 @@ func processFile(
 		log.Blank()
 		return
 	}
+	if exceedsMaxFileSize(cfg, fi.Size()) {
+		log.Warn("Skip (%s exceeds --max-file-size %s): %s", display.FormatBytes(fi.Size()), display.FormatBytes(cfg.MaxFileSize), basename)
+		stats.Skipped++
+		log.Blank()
+		return
+	}
+	if state.done(path, fi) {
+		log.Warn("Skip (done in --state): %s", basename)
+		stats.Skipped++
+		log.Blank()
+		return
+	}
 
 	// --- Probe (single JSON call replaces ~10 legacy ffprobe invocations) ---
-	pr, err := probe.Probe(ctx, path)
+	pr, err := probed.probe(ctx, cfg.FFprobePath, path)
 	if err != nil {
 		log.Error("Cannot probe file (possibly corrupt): %v", err)
 		stats.Failed++
@@ -106,44 +369,114 @@ func processFile(
 		return
 	}
 
+	if cfg.Encoder.DeinterlaceAuto && cfg.Encoder.DetectInterlace {
+		detectScanType(ctx, cfg, log, pr, path, run)
+	}
+
 	logInputMeta(log, pr)
 
 	// --- Parse filename and resolve output path ---
-	parsed := naming.ParseFilename(basename, filepath.Dir(path))
+	parsed, outputPath := resolveOutput(cfg, log, path, yearIndex, resolver, layout)
+	cfg = fileConfig(cfg, parsed)
+	if parsed.DualAudio {
+		log.Debug(cfg.Display.Verbose, "Dual-audio release: %d audio stream(s); untagged ones match language filters", len(pr.AudioStreams))
+	}
+	maxHeight := cfg.Encoder.MovieMaxHeight
 	if parsed.MediaType == naming.MediaTV {
-		orig := parsed.ShowName
-		parsed.ShowName = naming.HarmonizeShowName(parsed.ShowName, yearIndex)
-		if parsed.ShowName != orig {
-			log.Debug(cfg.Display.Verbose, "Harmonized show name: '%s' -> '%s'", orig, parsed.ShowName)
+		maxHeight = cfg.Encoder.TVMaxHeight
+	}
+
+	// --- Container decision (--replace-container-only) ---
+	keepMKV, reason := planner.KeepMKVForBitmapSubs(cfg, pr, maxHeight)
+	if keepMKV {
+		mkvCfg := *cfg
+		mkvCfg.OutputContainer = config.ContainerMKV
+		cfg = &mkvCfg
+		mkvPath := resolver.Resolve(path, strings.TrimSuffix(outputPath, filepath.Ext(outputPath))+".mkv")
+		if mkvPath != outputPath {
+			resolver.Release(path, outputPath)
+			outputPath = mkvPath
 		}
+		log.Info("  Container: keeping MKV (%s)", reason)
 	}
 
-	container := string(cfg.OutputContainer)
-	outputPath := naming.GetOutputPath(parsed, cfg.OutputDir, container)
-	outputPath = resolver.Resolve(path, outputPath)
+	// --- Freshness check (--skip-if-output-newer) ---
+	if cfg.SkipIfOutputNewer && outputUpToDate(fi, outputPath) {
+		log.Warn("Skip (up to date): %s", filepath.Base(outputPath))
+		stats.Skipped++
+		log.Blank()
+		return
+	}
 
 	// --- Log file stats ---
-	logBitrateOutlier(log, pr)
+	logBitrateOutlier(cfg, log, pr)
 
 	// --- Build plan ---
-	plan := planner.BuildPlan(cfg, pr)
+	// The pre-pass plan stands unless idet measured the scan type or the
+	// container changed since it was built.
+	plan := plans.plan(path)
+	if plan == nil || pr.ScanType != probe.ScanUnknown || keepMKV {
+		plan = planner.BuildPlanWithMaxHeight(cfg, pr, maxHeight)
+	}
 	plan.InputPath = path
 	plan.OutputPath = outputPath
 
+	if excludedByOnly(cfg, plan) {
+		log.Warn("Skip (--only %s, planned %s): %s", cfg.Only, plan.Action, basename)
+		stats.Skipped++
+		log.Blank()
+		return
+	}
+	if plan.Action == planner.ActionSkip {
+		log.Warn("Skip (%s): %s", plan.SkipReason, basename)
+		stats.Skipped++
+		log.Blank()
+		return
+	}
+	if plan.Err != nil {
+		log.Error("%v: %s", plan.Err, basename)
+		stats.Failed++
+		log.Blank()
+		return
+	}
+
+	// --- Crop detection (--auto-crop) ---
+	// Only files being encoded can be cropped, so remuxes and skips never
+	// pay for the cropdetect passes. A crop changes the video filters (and
+	// rules out VAAPI decoding), so the plan is rebuilt around it.
+	if cfg.Encoder.AutoCrop && plan.Action == planner.ActionEncode {
+		if detectCrop(ctx, cfg, log, pr, path, run) {
+			plan = planner.BuildPlanWithMaxHeight(cfg, pr, maxHeight)
+			plan.InputPath = path
+			plan.OutputPath = outputPath
+		}
+	}
+
+	if cfg.SidecarSubs {
+		planner.AddSidecarSubtitles(cfg, pr, plan, FindSidecarSubs(path))
+		for _, sc := range plan.Subtitles.Sidecars {
+			log.Debug(cfg.Display.Verbose, "  Sidecar subtitle: %s", filepath.Base(sc.Path))
+		}
+	}
+
 	if cfg.Display.FileStats {
 		logFileStats(log, plan)
 	}
+	if plan.DolbyVision && plan.Action == planner.ActionEncode {
+		log.Warn("  Dolby Vision source: re-encoding keeps only the base layer; DoVi dynamic metadata will be lost")
+	}
 
+	for _, w := range plan.Warnings {
+		log.Warn("  %s", w)
+	}
 	if plan.QualityNote != "" {
-		if strings.Contains(plan.QualityNote, "not browser-safe") {
-			log.Warn("  %s", plan.QualityNote)
-		} else {
-			log.Debug(cfg.Display.Verbose, "  Quality: %s", plan.QualityNote)
-		}
+		log.Debug(cfg.Display.Verbose, "  Quality: %s", plan.QualityNote)
 	}
 
 	// --- Skip-existing check ---
-	if cfg.SkipExisting {
+	// With --skip-if-output-newer an existing output got here only because
+	// it is stale, so it is overwritten.
+	if cfg.SkipExisting && !cfg.SkipIfOutputNewer {
 		if _, err := os.Stat(outputPath); err == nil {
 			log.Warn("Skip (exists): %s", filepath.Base(outputPath))
 			stats.Skipped++
@@ -155,13 +488,19 @@ func processFile(
 	// --- Log action ---
 	actionLabel := "Encoding"
 	if plan.Action == planner.ActionRemux {
+		video := "HEVC"
+		if plan.Faststart {
+			video = strings.ToUpper(pr.PrimaryVideo.Codec) + " +faststart"
+		}
 		switch {
+		case plan.Faithful:
+			actionLabel = "Remuxing (faithful, copy all streams)"
 		case plan.Audio.NoAudio:
-			actionLabel = "Remuxing (copy HEVC, no audio)"
+			actionLabel = fmt.Sprintf("Remuxing (copy %s, no audio)", video)
 		case plan.Audio.CopyAll:
-			actionLabel = "Remuxing (copy HEVC, copy audio)"
+			actionLabel = fmt.Sprintf("Remuxing (copy %s, copy audio)", video)
 		default:
-			actionLabel = fmt.Sprintf("Remuxing (copy HEVC, encode non-AAC audio via %s)", cfg.Audio.Encoder)
+			actionLabel = fmt.Sprintf("Remuxing (copy %s, encode non-%s audio via %s)", video, strings.ToUpper(string(cfg.Audio.TargetCodec())), cfg.Audio.Encoder)
 		}
 	}
 	log.Info("%s: %s", actionLabel, basename)
@@ -181,7 +520,18 @@ func processFile(
 	}
 
 	// --- Create output directory ---
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+	createdDirs := missingDirs(filepath.Dir(outputPath))
+	if cfg.StagingDir != "" {
+		staged, err := stagingPath(cfg, outputPath)
+		if err != nil {
+			log.Error("Cannot map output into staging directory: %v", err)
+			stats.Failed++
+			log.Blank()
+			return
+		}
+		plan.OutputPath = staged
+	}
+	if err := os.MkdirAll(filepath.Dir(plan.OutputPath), 0o755); err != nil {
 		log.Error("Cannot create output directory: %v", err)
 		stats.Failed++
 		log.Blank()
@@ -189,9 +539,36 @@ func processFile(
 	}
 
 	// --- Execute with retry ---
+	var trail *attemptTrail
+	if cfg.Display.RetryLog != "" {
+		trail = &attemptTrail{}
+		run = trail.wrap(run)
+	}
+	execCtx := ctx
+	if progress != nil {
+		execCtx = ffmpeg.WithStderrTee(ctx, progress.fileProgress(stats.Current, pr.Format.Duration))
+	}
+	if cfg.Display.FfmpegFPS {
+		execCtx = ffmpeg.WithProgress(execCtx, logProgress(log))
+	}
+	if cfg.Display.PrintCommands {
+		execCtx = ffmpeg.WithCommandLog(execCtx, func(cmd string) { log.Info("  Command: %s", cmd) })
+	}
+	execCtx = withRelocate(execCtx, func(ext string) (string, error) {
+		moved := resolver.Resolve(path, strings.TrimSuffix(outputPath, filepath.Ext(outputPath))+ext)
+		if reason := keptOutput(cfg, fi, moved); reason != "" {
+			resolver.Release(path, moved)
+			return "", fmt.Errorf("%s %s", filepath.Base(moved), reason)
+		}
+		resolver.Release(path, outputPath)
+		if cfg.StagingDir != "" {
+			return stagingPath(cfg, moved)
+		}
+		return moved, nil
+	})
 	start := time.Now()
 	rs := ffmpeg.NewRetryState(plan)
-	ok := executeWithRetry(ctx, cfg, log, plan, rs, run)
+	ok := executeWithRetry(execCtx, cfg, log, pr, plan, rs, run)
 
 	if !ok {
 		if plan.Action == planner.ActionRemux {
@@ -199,19 +576,37 @@ func processFile(
 		} else {
 			log.Error("Encode failed")
 		}
-		os.Remove(outputPath)
+		// A cancelled file (SIGINT, or requeued by Run) did not fail on
+		// its own, so its attempts are not worth a retry log.
+		if ctx.Err() == nil {
+			writeRetryLog(log, cfg.Display.RetryLog, trail, path)
+		}
+		removeOutput(plan)
 		stats.Failed++
 		log.Blank()
 		return
 	}
 
+	if cfg.StagingDir != "" {
+		if err := publishOutput(cfg, plan); err != nil {
+			log.Error("Cannot publish staged output: %v", err)
+			log.Error("Staged output left at %s", plan.OutputPath)
+			stats.Failed++
+			log.Blank()
+			return
+		}
+	}
+
+	verifyChapters(ctx, cfg, log, pr, plan)
+	verifyAudioSync(ctx, cfg, log, pr, plan)
+	createdDirs = append(writePreviewFrame(ctx, cfg, log, plan, run), createdDirs...)
+	applyOutputMode(cfg, log, plan, createdDirs)
+	applyOutputOwner(cfg, log, plan, createdDirs)
+
 	// --- Update stats ---
 	elapsed := time.Since(start)
 	inSize := fi.Size()
-	var outSize int64
-	if outInfo, err := os.Stat(outputPath); err == nil {
-		outSize = outInfo.Size()
-	}
+	outSize, _ := outputSize(plan)
 
 	ratio := int64(100)
 	if inSize > 0 {
@@ -220,7 +615,11 @@ func processFile(
 
 	stats.TotalInputBytes += inSize
 	stats.TotalOutputBytes += outSize
+	stats.AddGrown(basename, inSize, outSize, finalQuality(cfg, plan, rs))
 	stats.Encoded++
+	if err := state.markDone(path, fi, plan.OutputPath); err != nil {
+		log.Warn("Cannot update state file: %v", err)
+	}
 
 	if plan.Action == planner.ActionRemux {
 		log.Success("Remuxed in %ds (%d%% of original)", int(elapsed.Seconds()), ratio)
@@ -233,16 +632,74 @@ func processFile(
 const (
 	maxQualityBumps = 2
 	qualityBumpStep = 1
+
+	// tinyRetryStep is how far QP/CRF drops for the --retry-if-tiny-pct
+	// re-encode. It is larger than the overshoot bump because an
+	// implausibly small output usually means the encoder starved the
+	// picture, not that it was slightly too eager.
+	tinyRetryStep = 2
+
+	// maxOutputRetries caps how often one file is re-run after a transient
+	// network-share write error (ffmpeg.CategoryOutputTransient).
+	maxOutputRetries = 2
 )
 
+// outputRetryBackoff is the pause before the first output-side retry; it
+// doubles for each further retry. A var so tests can shorten it.
+var outputRetryBackoff = 5 * time.Second
+
+// bumpQuality moves the active encoder's QP (VAAPI, QSV) or CRF (CPU) by step:
+// positive compresses harder, negative raises quality. It returns the
+// parameter name and its value after the move; ok is false, and rs is
+// unchanged, when the move would leave the planner's allowed range.
+func bumpQuality(cfg *config.Config, rs *ffmpeg.RetryState, step int) (name string, value int, ok bool) {
+	if cfg.Encoder.Mode.UsesQP() {
+		next := rs.VaapiQP + step
+		if next > planner.VaapiQPMax || next < planner.VaapiQPMin {
+			return "QP", rs.VaapiQP, false
+		}
+		rs.VaapiQP = next
+		return "QP", next, true
+	}
+	next := rs.CpuCRF + step
+	if next > planner.CpuCRFMax || next < planner.CpuCRFMin {
+		return "CRF", rs.CpuCRF, false
+	}
+	rs.CpuCRF = next
+	return "CRF", next, true
+}
+
+// finalQuality describes the quality setting of the last ffmpeg attempt:
+// the QP or CRF left in rs after any escalation, the --target-bitrate, or
+// "copy" for a remux.
+func finalQuality(cfg *config.Config, plan *planner.FilePlan, rs *ffmpeg.RetryState) string {
+	switch {
+	case plan.Action != planner.ActionEncode:
+		return "copy"
+	case plan.TargetBitrateKbps > 0:
+		return fmt.Sprintf("%d kb/s", plan.TargetBitrateKbps)
+	case cfg.Encoder.Mode.UsesQP():
+		return fmt.Sprintf("QP %d", rs.VaapiQP)
+	default:
+		return fmt.Sprintf("CRF %d", rs.CpuCRF)
+	}
+}
+
 // executeWithRetry runs ffmpeg with the error-retry inner loop, then checks
-// for output size overshoot. If the encode produces a file larger than the
-// input (smart quality enabled, no manual override), QP/CRF is bumped and
-// the encode is re-attempted up to maxQualityBumps times.
+// the output size. If the encode produces a file larger than the input
+// (smart quality enabled, no manual override), QP/CRF is bumped and the
+// encode is re-attempted up to maxQualityBumps times. With
+// --retry-if-tiny-pct, an output below that share of the input is
+// re-encoded once at tinyRetryStep higher quality instead.
+//
+// A two-pass plan runs its analysis pass first, once; the retry loop then
+// drives the second pass. --target-bitrate encodes have no QP/CRF to move,
+// so the size checks are skipped.
 func executeWithRetry(
 	ctx context.Context,
 	cfg *config.Config,
 	log Logger,
+	pr *probe.ProbeResult,
 	plan *planner.FilePlan,
 	rs *ffmpeg.RetryState,
 	run ffmpeg.RunFunc,
@@ -251,7 +708,15 @@ func executeWithRetry(
 		return false
 	}
 
-	if !attemptWithErrorRetry(ctx, cfg, log, plan, rs, run) {
+	if plan.TwoPass {
+		cleanup, ok := runFirstPass(ctx, cfg, log, pr, plan, rs, run)
+		defer cleanup()
+		if !ok {
+			return false
+		}
+	}
+
+	if !attemptWithErrorRetry(ctx, cfg, log, pr, plan, rs, run) {
 		return false
 	}
 
@@ -259,7 +724,7 @@ func executeWithRetry(
 		return true
 	}
 
-	canEscalate := cfg.Encoder.SmartQuality && cfg.Encoder.ActiveQualityOverride == ""
+	canEscalate := cfg.Encoder.SmartQuality && cfg.Encoder.ActiveQualityOverride == "" && plan.TargetBitrateKbps == 0
 	bumpsApplied := 0
 
 	for bump := 0; bump < maxQualityBumps && canEscalate; bump++ {
@@ -268,32 +733,21 @@ func executeWithRetry(
 			break
 		}
 
-		if cfg.Encoder.Mode == config.EncoderVAAPI {
-			next := rs.VaapiQP + qualityBumpStep
-			if next > planner.VaapiQPMax {
-				log.Warn("Output larger than input (%d%%) — QP %d already at max", pct, rs.VaapiQP)
-				break
-			}
-			rs.VaapiQP = next
-			log.Warn("Output larger than input (%d%%), re-encoding at QP %d", pct, rs.VaapiQP)
-		} else {
-			next := rs.CpuCRF + qualityBumpStep
-			if next > planner.CpuCRFMax {
-				log.Warn("Output larger than input (%d%%) — CRF %d already at max", pct, rs.CpuCRF)
-				break
-			}
-			rs.CpuCRF = next
-			log.Warn("Output larger than input (%d%%), re-encoding at CRF %d", pct, rs.CpuCRF)
+		name, value, ok := bumpQuality(cfg, rs, qualityBumpStep)
+		if !ok {
+			log.Warn("Output larger than input (%d%%) — %s %d already at max", pct, name, value)
+			break
 		}
+		log.Warn("Output larger than input (%d%%), re-encoding at %s %d", pct, name, value)
 
-		os.Remove(plan.OutputPath)
+		removeOutput(plan)
 		rs.Attempt = 0
 		bumpsApplied++
 
 		if ctx.Err() != nil {
 			return false
 		}
-		if !attemptWithErrorRetry(ctx, cfg, log, plan, rs, run) {
+		if !attemptWithErrorRetry(ctx, cfg, log, pr, plan, rs, run) {
 			return false
 		}
 	}
@@ -306,11 +760,56 @@ func executeWithRetry(
 		}
 	}
 
+	// The tiny-output retry is asked for explicitly, so unlike the
+	// oversize escalation it does not depend on smart quality or yield to
+	// a fixed QP/CRF; it only needs a QP/CRF to raise.
+	if cfg.RetryIfTinyPct > 0 && plan.TargetBitrateKbps == 0 {
+		return retryIfTiny(ctx, cfg, log, pr, plan, rs, run)
+	}
+	return true
+}
+
+// retryIfTiny re-encodes once at higher quality when the output is below
+// --retry-if-tiny-pct percent of the input, which usually indicates a
+// starved or truncated encode. A second tiny result is kept with a warning.
+func retryIfTiny(
+	ctx context.Context,
+	cfg *config.Config,
+	log Logger,
+	pr *probe.ProbeResult,
+	plan *planner.FilePlan,
+	rs *ffmpeg.RetryState,
+	run ffmpeg.RunFunc,
+) bool {
+	pct, ok := outputPct(plan)
+	if !ok || pct >= cfg.RetryIfTinyPct {
+		return true
+	}
+
+	name, value, ok := bumpQuality(cfg, rs, -tinyRetryStep)
+	if !ok {
+		log.Warn("Output implausibly small (%d%%) — %s %d too close to min to raise quality", pct, name, value)
+		return true
+	}
+	log.Warn("Output implausibly small (%d%% of input), re-encoding at %s %d", pct, name, value)
+
+	removeOutput(plan)
+	rs.Attempt = 0
+	if ctx.Err() != nil {
+		return false
+	}
+	if !attemptWithErrorRetry(ctx, cfg, log, pr, plan, rs, run) {
+		return false
+	}
+
+	if pct, ok := outputPct(plan); ok && pct < cfg.RetryIfTinyPct {
+		log.Warn("Output still implausibly small (%d%% of input); check the encode", pct)
+	}
 	return true
 }
 
 func outputPct(plan *planner.FilePlan) (int, bool) {
-	outInfo, err := os.Stat(plan.OutputPath)
+	outBytes, err := outputSize(plan)
 	if err != nil {
 		return 0, false
 	}
@@ -318,16 +817,69 @@ func outputPct(plan *planner.FilePlan) (int, bool) {
 	if err != nil || inInfo.Size() <= 0 {
 		return 0, false
 	}
-	return int(outInfo.Size() * 100 / inInfo.Size()), true
+	return int(outBytes * 100 / inInfo.Size()), true
+}
+
+// outputSize returns the total bytes written for a plan's output. For HLS
+// this is the playlist plus every segment; otherwise the single output file.
+func outputSize(plan *planner.FilePlan) (int64, error) {
+	info, err := os.Stat(plan.OutputPath)
+	if err != nil {
+		return 0, err
+	}
+	total := info.Size()
+	for _, seg := range hlsSegments(plan) {
+		if si, err := os.Stat(seg); err == nil {
+			total += si.Size()
+		}
+	}
+	return total, nil
+}
+
+// removeOutput deletes a plan's output file and, for HLS, its segments.
+func removeOutput(plan *planner.FilePlan) {
+	os.Remove(plan.OutputPath)
+	for _, seg := range hlsSegments(plan) {
+		os.Remove(seg)
+	}
+}
+
+// sleepCtx waits for d or until ctx is cancelled, reporting whether the
+// full wait elapsed.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// hlsSegments lists the segment files belonging to an HLS output, or nil
+// for single-file containers.
+func hlsSegments(plan *planner.FilePlan) []string {
+	if plan.Container != config.ContainerHLS {
+		return nil
+	}
+	pattern := strings.Replace(ffmpeg.HLSSegmentPattern(plan.OutputPath), "%05d", "*", 1)
+	segs, _ := filepath.Glob(pattern)
+	return segs
 }
 
 // attemptWithErrorRetry runs the inner retry loop: execute ffmpeg, classify
-// stderr on failure, apply the first matching fix, and retry. Returns true
-// if ffmpeg eventually succeeds.
+// stderr on failure, apply the first matching fix, and retry. A transient
+// network-share write error removes the partial output and re-runs the file
+// unchanged after a backoff, up to maxOutputRetries times. A remux the
+// output container rejects is first replanned per --remux-fail (see
+// applyRemuxFallback), running the analysis pass when the new plan is
+// two-pass. Returns true if ffmpeg eventually succeeds.
 func attemptWithErrorRetry(
 	ctx context.Context,
 	cfg *config.Config,
 	log Logger,
+	pr *probe.ProbeResult,
 	plan *planner.FilePlan,
 	rs *ffmpeg.RetryState,
 	run ffmpeg.RunFunc,
@@ -335,12 +887,14 @@ func attemptWithErrorRetry(
 	retryLabels := map[ffmpeg.RetryAction]string{
 		ffmpeg.RetryDropAttach:    "skip attachments",
 		ffmpeg.RetryDropSubs:      "skip subtitles",
+		ffmpeg.RetrySubCodec:      "convert subtitles to ",
 		ffmpeg.RetryIncreaseMux:   "increase mux queue",
 		ffmpeg.RetryFixTimestamps: "fix timestamps",
 	}
+	outputRetries := 0
 
 	for {
-		result := ffmpeg.Execute(ctx, cfg, plan, rs, run)
+		result := ffmpeg.Execute(ctx, cfg, plan, rs, pr.Format.Duration, run)
 		if result.Err == nil {
 			return true
 		}
@@ -357,14 +911,200 @@ func attemptWithErrorRetry(
 			return false
 		}
 
-		action := rs.Advance(result.Stderr)
+		if ffmpeg.HasCategory(result.Err, ffmpeg.CategoryOutputTransient) && outputRetries < maxOutputRetries {
+			delay := outputRetryBackoff << outputRetries
+			outputRetries++
+			log.Warn("Output write failed (network share), retrying in %s (%d/%d)", delay, outputRetries, maxOutputRetries)
+			removeOutput(plan)
+			if !sleepCtx(ctx, delay) {
+				log.Warn("Interrupted, aborting retries")
+				return false
+			}
+			continue
+		}
+
+		relocate, _ := ctx.Value(relocateKey{}).(relocateFunc)
+		fallback, err := applyRemuxFallback(cfg, relocate, pr, plan, rs, result.Err)
+		if err != nil {
+			log.Error("Remux rejected by %s muxer; MKV fallback skipped: %v", strings.ToUpper(string(cfg.OutputContainer)), err)
+			return false
+		}
+		if fallback != "" {
+			log.Warn("Remux rejected by %s muxer: %s", strings.ToUpper(string(cfg.OutputContainer)), fallback)
+			// A --target-bitrate CPU fallback encode is two-pass; its
+			// analysis pass has not run yet. A plan falls back at most once.
+			if plan.TwoPass {
+				cleanup, ok := runFirstPass(ctx, cfg, log, pr, plan, rs, run)
+				defer cleanup()
+				if !ok {
+					return false
+				}
+			}
+			continue
+		}
+
+		action := rs.AdvanceError(result.Err)
 		if action == ffmpeg.RetryNone {
 			log.Error("ffmpeg failed (no applicable retry)")
 			logStderr(log, result.Stderr)
 			return false
 		}
 
-		log.Warn("Retry %d: %s", rs.Attempt, retryLabels[action])
-		os.Remove(plan.OutputPath)
+		label := retryLabels[action]
+		if action == ffmpeg.RetrySubCodec {
+			label += rs.SubCodec
+		}
+		log.Warn("Retry %d: %s", rs.Attempt, label)
+		removeOutput(plan)
+	}
+}
+
+// relocateKey is the context key for withRelocate.
+type relocateKey struct{}
+
+// relocateFunc moves a file's output to the extension ext for a retry that
+// changes its container. It returns the new plan output path, or an error
+// when an output already there must not be overwritten.
+type relocateFunc func(ext string) (string, error)
+
+// withRelocate returns a context under which the --remux-fail mkv fallback
+// moves the output with fn. Without one the extension is swapped in place.
+func withRelocate(ctx context.Context, fn relocateFunc) context.Context {
+	return context.WithValue(ctx, relocateKey{}, fn)
+}
+
+// applyRemuxFallback handles a stream-copy remux that the output container
+// rejected (ffmpeg.CategoryRemuxIncompatible). Per cfg.RemuxFallback the plan
+// is rebuilt in place, under the original plan's height cap, either as an
+// encode or as an MKV remux (output moved by relocate, or its extension
+// switched to .mkv when relocate is nil), and rs is reset for the new plan.
+// Sidecar subtitles carry over. Returns a short label for the log, or ""
+// when no fallback applies; err is relocate's refusal to move the output.
+func applyRemuxFallback(
+	cfg *config.Config,
+	relocate relocateFunc,
+	pr *probe.ProbeResult,
+	plan *planner.FilePlan,
+	rs *ffmpeg.RetryState,
+	execErr error,
+) (label string, err error) {
+	if plan.Action != planner.ActionRemux || !ffmpeg.HasCategory(execErr, ffmpeg.CategoryRemuxIncompatible) {
+		return "", nil
+	}
+
+	fbCfg := *cfg
+	fbCfg.SkipOptimized = false
+	outputPath := plan.OutputPath
+	switch cfg.RemuxFallback {
+	case config.RemuxFallbackEncode:
+		if plan.Faithful {
+			return "", nil // A lossless rewrap never falls back to an encode.
+		}
+		fbCfg.SkipHEVC = false
+		fbCfg.RemuxToFaststart = false
+		label = "re-encoding video"
+	case config.RemuxFallbackMKV:
+		// A --remux-to-faststart file is only remuxed into MP4; in MKV its
+		// H.264 or AV1 video would be re-encoded, not remuxed.
+		if plan.Container == config.ContainerMKV || plan.Faststart {
+			return "", nil
+		}
+		fbCfg.OutputContainer = config.ContainerMKV
+		label = "remuxing to MKV"
+	default:
+		return "", nil
+	}
+
+	fb := planner.BuildPlanWithMaxHeight(&fbCfg, pr, plan.MaxHeight)
+	if fb.Err != nil {
+		return "", nil
+	}
+	if fb.Container != plan.Container {
+		if relocate == nil {
+			outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".mkv"
+		} else if outputPath, err = relocate(".mkv"); err != nil {
+			return "", err
+		}
+	}
+	removeOutput(plan)
+	fb.InputPath = plan.InputPath
+	fb.OutputPath = outputPath
+	if len(plan.Subtitles.Sidecars) > 0 {
+		planner.AddSidecarSubtitles(&fbCfg, pr, fb, plan.Subtitles.Sidecars)
+	}
+	*plan = *fb
+	*rs = *ffmpeg.NewRetryState(plan)
+	return label, nil
+}
+
+// excludedByOnly reports whether --only filters out plan because its
+// planned action differs from the requested one.
+func excludedByOnly(cfg *config.Config, plan *planner.FilePlan) bool {
+	return cfg.Only != config.ActionFilterAll && plan.Action.String() != string(cfg.Only)
+}
+
+// keptOutput reports why an existing output at outputPath must not be
+// overwritten: "is up to date" under --skip-if-output-newer, "exists" under
+// SkipExisting, or "" when it may be written.
+func keptOutput(cfg *config.Config, in os.FileInfo, outputPath string) string {
+	if cfg.SkipIfOutputNewer {
+		if outputUpToDate(in, outputPath) {
+			return "is up to date"
+		}
+		return ""
+	}
+	if _, err := os.Stat(outputPath); err == nil && cfg.SkipExisting {
+		return "exists"
+	}
+	return ""
+}
+
+// outputUpToDate reports whether outputPath exists and was modified no
+// earlier than the input described by in, as checked by
+// --skip-if-output-newer.
+func outputUpToDate(in os.FileInfo, outputPath string) bool {
+	out, err := os.Stat(outputPath)
+	if err != nil {
+		return false
 	}
+	return !out.ModTime().Before(in.ModTime())
+}
+
+// detectScanType runs the idet sampling pass and records the result on pr,
+// overriding the field_order heuristic. Sampling starts a quarter of the
+// way in to skip studio logos and black intros. On failure pr is left
+// unchanged so field_order still decides.
+func detectScanType(ctx context.Context, cfg *config.Config, log Logger, pr *probe.ProbeResult, path string, run ffmpeg.RunFunc) {
+	scan, err := ffmpeg.DetectScanType(ctx, cfg.FFmpegPath, path, pr.Format.Duration/4, run)
+	if err != nil {
+		log.Warn("Interlace detection failed, using field_order: %v", err)
+		return
+	}
+	log.Debug(cfg.Display.Verbose, "idet: %s (field_order %q)", scan, pr.PrimaryVideo.FieldOrder)
+	pr.ScanType = scan
+}
+
+// detectCrop runs the cropdetect sampling passes and records the letterbox
+// crop on pr, where a rebuilt plan picks it up, reporting whether one was
+// found. Files with a burned-in subtitle are left uncropped, as bitmap
+// subtitles are often placed in the bars. On failure pr is left unchanged
+// and the file is encoded uncropped.
+func detectCrop(ctx context.Context, cfg *config.Config, log Logger, pr *probe.ProbeResult, path string, run ffmpeg.RunFunc) bool {
+	if planner.SelectBurnSubtitle(cfg, pr) != nil {
+		log.Debug(cfg.Display.Verbose, "cropdetect: skipped (burning in a subtitle)")
+		return false
+	}
+	v := pr.PrimaryVideo
+	crop, err := ffmpeg.DetectCrop(ctx, cfg.FFmpegPath, path, pr.Format.Duration, v.Width, v.Height, run)
+	if err != nil {
+		log.Warn("Crop detection failed, not cropping: %v", err)
+		return false
+	}
+	if crop == nil {
+		log.Debug(cfg.Display.Verbose, "cropdetect: no letterboxing")
+		return false
+	}
+	log.Info("  Crop: %dx%d -> %dx%d (%s)", v.Width, v.Height, crop.W, crop.H, crop.Filter())
+	pr.Crop = crop
+	return true
 }
@@ -0,0 +1,104 @@
+// staging.go implements --staging-dir: encode outside the library, then publish complete outputs.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/planner"
+)
+
+// renameFunc is os.Rename, replaceable in tests to simulate a
+// cross-filesystem (EXDEV) move.
+var renameFunc = os.Rename
+
+// stagingPath maps a final output path under cfg.OutputDir to the same
+// relative path under cfg.StagingDir.
+func stagingPath(cfg *config.Config, outputPath string) (string, error) {
+	rel, err := filepath.Rel(cfg.OutputDir, outputPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfg.StagingDir, rel), nil
+}
+
+// publishOutput moves a completed staged output (and, for HLS, its
+// segments) to the same relative path under cfg.OutputDir, creating
+// directories as needed, and points plan.OutputPath at the published file.
+// The final path is derived from the staged one so a --remux-fail mkv
+// extension change carries over.
+func publishOutput(cfg *config.Config, plan *planner.FilePlan) error {
+	rel, err := filepath.Rel(cfg.StagingDir, plan.OutputPath)
+	if err != nil {
+		return err
+	}
+	finalPath := filepath.Join(cfg.OutputDir, rel)
+	finalDir := filepath.Dir(finalPath)
+	if err := os.MkdirAll(finalDir, 0o755); err != nil {
+		return err
+	}
+	// Segments first, so the playlist only appears once they are in place.
+	for _, seg := range hlsSegments(plan) {
+		if err := moveFile(seg, filepath.Join(finalDir, filepath.Base(seg))); err != nil {
+			return err
+		}
+	}
+	if err := moveFile(plan.OutputPath, finalPath); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(plan.OutputPath)) // Best effort: only succeeds when empty.
+	plan.OutputPath = finalPath
+	return nil
+}
+
+// moveFile renames src to dst. When they are on different filesystems the
+// file is copied to a temporary name beside dst, renamed into place, and src
+// removed, so dst never appears half-written.
+func moveFile(src, dst string) error {
+	err := renameFunc(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	tmp := dst + ".part"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copy %s to %s: %w", src, dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with src's permissions and syncs dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -10,6 +10,48 @@ type RunStats struct {
 	Failed           int
 	TotalInputBytes  int64
 	TotalOutputBytes int64
+
+	// Files whose final output is larger than the input, in processing
+	// order, for --keep-ratio-report.
+	Grown []GrownFile
+}
+
+// GrownFile records one output that ended up larger than its input after
+// quality retries were exhausted.
+type GrownFile struct {
+	Name        string // Input basename.
+	InputBytes  int64
+	OutputBytes int64
+	Quality     string // Final quality setting, e.g. "QP 22", "CRF 24", or "copy".
+}
+
+// RatioPct returns the output size as a percentage of the input.
+func (g GrownFile) RatioPct() int64 {
+	if g.InputBytes <= 0 {
+		return 0
+	}
+	return g.OutputBytes * 100 / g.InputBytes
+}
+
+// AddGrown records name in Grown when out exceeds in.
+func (s *RunStats) AddGrown(name string, in, out int64, quality string) {
+	if out <= in {
+		return
+	}
+	s.Grown = append(s.Grown, GrownFile{Name: name, InputBytes: in, OutputBytes: out, Quality: quality})
+}
+
+// add folds one file's counters, byte totals, and grown outputs into s and
+// counts the file as processed. Run gives every file its own RunStats and
+// calls add under a mutex, so --jobs workers never write to a shared one.
+func (s *RunStats) add(f RunStats) {
+	s.Current++
+	s.Encoded += f.Encoded
+	s.Skipped += f.Skipped
+	s.Failed += f.Failed
+	s.TotalInputBytes += f.TotalInputBytes
+	s.TotalOutputBytes += f.TotalOutputBytes
+	s.Grown = append(s.Grown, f.Grown...)
 }
 
 // SpaceSaved returns the aggregate byte difference between inputs and outputs.
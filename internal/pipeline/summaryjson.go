@@ -0,0 +1,68 @@
+// summaryjson.go implements --summary-json: the batch summary as one JSON object on stdout.
+package pipeline
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/backmassage/muxmaster/internal/config"
+)
+
+// summaryJSONOut receives the --summary-json object. The logger sends all
+// human-readable output to stderr in that mode, so stdout carries only the
+// JSON; tests swap this writer.
+var summaryJSONOut io.Writer = os.Stdout
+
+// summaryJSON is the --summary-json object: the RunStats counters plus the
+// derived space saving.
+type summaryJSON struct {
+	Total           int         `json:"total"`
+	Processed       int         `json:"processed"`
+	Encoded         int         `json:"encoded"`
+	Skipped         int         `json:"skipped"`
+	Failed          int         `json:"failed"`
+	InputBytes      int64       `json:"input_bytes"`
+	OutputBytes     int64       `json:"output_bytes"`
+	SpaceSavedBytes int64       `json:"space_saved_bytes"`
+	SpaceSavedPct   float64     `json:"space_saved_pct"` // Of input bytes; negative when outputs grew.
+	Grown           []grownJSON `json:"grown"`
+	DryRun          bool        `json:"dry_run"`
+	Interrupted     bool        `json:"interrupted"`
+}
+
+type grownJSON struct {
+	Name        string `json:"name"`
+	InputBytes  int64  `json:"input_bytes"`
+	OutputBytes int64  `json:"output_bytes"`
+	Quality     string `json:"quality"`
+}
+
+// writeSummaryJSON writes stats to w as a single line of JSON.
+func writeSummaryJSON(w io.Writer, cfg *config.Config, stats *RunStats, interrupted bool) error {
+	s := summaryJSON{
+		Total:           stats.Total,
+		Processed:       stats.Current,
+		Encoded:         stats.Encoded,
+		Skipped:         stats.Skipped,
+		Failed:          stats.Failed,
+		InputBytes:      stats.TotalInputBytes,
+		OutputBytes:     stats.TotalOutputBytes,
+		SpaceSavedBytes: stats.SpaceSaved(),
+		Grown:           []grownJSON{},
+		DryRun:          cfg.DryRun,
+		Interrupted:     interrupted,
+	}
+	if stats.TotalInputBytes > 0 {
+		s.SpaceSavedPct = float64(stats.SpaceSaved()) * 100 / float64(stats.TotalInputBytes)
+	}
+	for _, g := range stats.Grown {
+		s.Grown = append(s.Grown, grownJSON{Name: g.Name, InputBytes: g.InputBytes, OutputBytes: g.OutputBytes, Quality: g.Quality})
+	}
+	line, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
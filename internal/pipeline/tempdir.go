@@ -0,0 +1,39 @@
+// tempdir.go manages the run-scoped scratch directory shared by features that need temp files.
+package pipeline
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/backmassage/muxmaster/internal/config"
+)
+
+// NewRunTempDir creates the scratch directory for one run under base, or
+// under os.TempDir() ($TMPDIR) when base is empty. The directory gets a
+// unique muxmaster-* name, so concurrent runs sharing a base (or
+// containers where every run is pid 1) never touch each other's files.
+// The returned cleanup removes the directory and everything in it; callers
+// defer it so it also runs when the run is cancelled by SIGINT/SIGTERM.
+func NewRunTempDir(base string) (string, func(), error) {
+	if base == "" {
+		base = os.TempDir()
+	}
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return "", nil, fmt.Errorf("create temp base %s: %w", base, err)
+	}
+	dir, err := os.MkdirTemp(base, "muxmaster-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// runTempDir returns the run-scoped scratch directory from cfg.RunTempDir
+// with a no-op cleanup. When the caller did not set one up (tests, library
+// use), a fresh directory is created and its cleanup returned instead.
+func runTempDir(cfg *config.Config) (string, func(), error) {
+	if cfg.RunTempDir != "" {
+		return cfg.RunTempDir, func() {}, nil
+	}
+	return NewRunTempDir(cfg.TempDir)
+}
@@ -0,0 +1,55 @@
+// twopass.go runs the analysis pass of --target-bitrate two-pass CPU encodes.
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/ffmpeg"
+	"github.com/backmassage/muxmaster/internal/planner"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// runFirstPass runs the x265 analysis pass of a two-pass plan, pointing
+// plan.PassLogFile into a fresh directory under the run's scratch
+// directory. The returned cleanup removes that directory; callers defer it
+// until the second pass and its retries are done. ok is false, with the
+// failure logged, when the pass could not run or failed.
+func runFirstPass(
+	ctx context.Context,
+	cfg *config.Config,
+	log Logger,
+	pr *probe.ProbeResult,
+	plan *planner.FilePlan,
+	rs *ffmpeg.RetryState,
+	run ffmpeg.RunFunc,
+) (cleanup func(), ok bool) {
+	base, baseCleanup, err := runTempDir(cfg)
+	if err != nil {
+		log.Error("Cannot create temp dir: %v", err)
+		return func() {}, false
+	}
+	dir, err := os.MkdirTemp(base, "pass-*")
+	if err != nil {
+		baseCleanup()
+		log.Error("Cannot create temp dir: %v", err)
+		return func() {}, false
+	}
+	cleanup = func() {
+		os.RemoveAll(dir)
+		baseCleanup()
+	}
+	plan.PassLogFile = filepath.Join(dir, "x265.stats")
+
+	log.Info("  Pass 1/2: analysis at %d kb/s", plan.TargetBitrateKbps)
+	res := ffmpeg.ExecuteFirstPass(ctx, cfg, plan, rs, pr.Format.Duration, run)
+	if res.Err != nil {
+		log.Error("First pass failed: %v", res.Err)
+		logStderr(log, res.Stderr)
+		return cleanup, false
+	}
+	log.Info("  Pass 2/2: encode")
+	return cleanup, true
+}
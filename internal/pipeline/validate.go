@@ -0,0 +1,59 @@
+// validate.go implements --validate: a fast readability sweep with a minimal ffprobe per file.
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// validateFile is probe.Validate, replaceable in tests.
+var validateFile = probe.Validate
+
+// Validate discovers media files and checks that each one probes at all,
+// using probe.Validate instead of a full stream analysis. Unreadable files
+// are logged as errors with ffprobe's reason, followed by the
+// readable/unreadable counts. Returns false when any file is unreadable or
+// discovery fails.
+func Validate(ctx context.Context, cfg *config.Config, log Logger) bool {
+	files, err := Discover(cfg.InputDir)
+	if err != nil {
+		log.Error("File discovery failed: %v", err)
+		return false
+	}
+	if len(files) == 0 {
+		log.Warn("No media files found in %s", cfg.InputDir)
+		return true
+	}
+
+	log.Info("Validating %d files in %s …", len(files), cfg.InputDir)
+	var readable, unreadable int
+	for _, path := range files {
+		if ctx.Err() != nil {
+			log.Warn("Interrupted")
+			break
+		}
+		rel, relErr := filepath.Rel(cfg.InputDir, path)
+		if relErr != nil {
+			rel = path
+		}
+		if err := validateFile(ctx, cfg.FFprobePath, path); err != nil {
+			unreadable++
+			log.Error("Unreadable: %s (%v)", rel, err)
+			continue
+		}
+		readable++
+		log.Debug(cfg.Display.Verbose, "Readable: %s", rel)
+	}
+
+	log.Blank()
+	log.Info("Readable:   %d", readable)
+	if unreadable > 0 {
+		log.Error("Unreadable: %d", unreadable)
+		return false
+	}
+	log.Success("Unreadable: 0")
+	return ctx.Err() == nil
+}
@@ -1,4 +1,4 @@
-// Per-stream audio strategy: AAC passthrough, non-AAC transcoding, layout normalization.
+// Per-stream audio strategy: target-codec passthrough, transcoding, layout normalization.
 package planner
 
 import (
@@ -11,54 +11,167 @@ import (
 
 // BuildAudioPlan produces the audio handling strategy for a file.
 //
-//   - No audio streams → NoAudio (produces -an).
-//   - All streams are AAC → CopyAll (produces -map 0:a -c:a copy).
-//     AAC is already the target codec for Jellyfin direct play; re-encoding
-//     it at any bitrate is lossy-to-lossy with no compatibility benefit.
-//   - Otherwise → per-stream plan: copy all AAC streams, transcode
-//     non-AAC to AAC with optional MATCH_AUDIO_LAYOUT filter chains.
+//   - No usable audio streams → NoAudio (produces -an). Degenerate streams
+//     (probe.AudioStream.Degenerate: zero channels or near-zero duration)
+//     and streams filtered out by --audio-langs / --drop-commentary /
+//     --keep-only-preferred-audio-when-available (see KeptAudio) are never
+//     planned, and their presence rules out CopyAll.
+//   - All streams are copyable → CopyAll (produces -map 0:a -c:a copy).
+//     A stream is copyable when it is already in the target codec
+//     (Audio.TargetCodec: AAC unless --audio-codec or the container says
+//     otherwise); re-encoding it is lossy-to-lossy with no compatibility
+//     benefit, so only AAC above --aac-copy-max is transcoded (to save space).
+//   - Otherwise → per-stream plan: copy copyable streams, transcode the
+//     rest to the target codec with optional MATCH_AUDIO_LAYOUT filter chains.
+//     Transcoded channels are capped per source codec by
+//     --audio-channels-by-codec, falling back to Audio.Channels.
+//
+// With --audio-delay the plan is always per-stream so each stream carries
+// its own DelayMs (the builder maps delayed streams from an offset input).
 func BuildAudioPlan(cfg *config.Config, pr *probe.ProbeResult) AudioPlan {
-	if len(pr.AudioStreams) == 0 {
+	kept := KeptAudio(cfg, pr)
+	if len(kept) == 0 {
 		return AudioPlan{NoAudio: true}
 	}
 
-	copyAll := true
-	for _, a := range pr.AudioStreams {
-		if !strings.EqualFold(a.Codec, "aac") {
+	// "-map 0:a" would map degenerate and filtered streams too.
+	copyAll := len(kept) == len(pr.AudioStreams)
+	for _, i := range kept {
+		if !audioCopyable(cfg, pr.AudioStreams[i]) {
 			copyAll = false
 			break
 		}
 	}
-	if copyAll {
+	if copyAll && !cfg.Audio.HasAudioDelay() {
 		return AudioPlan{CopyAll: true}
 	}
 
 	var streams []AudioStreamPlan
-	for i, a := range pr.AudioStreams {
+	for _, i := range kept {
+		a := pr.AudioStreams[i]
 		asp := AudioStreamPlan{
 			StreamIndex: i,
-			Channels:    clampChannels(a.Channels, cfg.Audio.Channels),
+			Channels:    clampChannels(a.Channels, cfg.Audio.ChannelCap(a.Codec)),
 			Bitrate:     cfg.Audio.Bitrate,
 			SampleRate:  cfg.Audio.SampleRate,
+			DelayMs:     cfg.Audio.AudioDelayMs(i),
+			Language:    taggedLanguage(a.Language),
 		}
 
-		if strings.EqualFold(a.Codec, "aac") {
+		if audioCopyable(cfg, a) {
 			asp.Copy = true
 			streams = append(streams, asp)
 			continue
 		}
 
+		var filters []string
+		if cfg.Audio.DownmixStereo && asp.Channels == 2 {
+			if pan := stereoDownmixPan(a.Channels); pan != "" {
+				filters = append(filters, pan)
+			}
+		}
 		if cfg.Audio.MatchLayout {
-			asp.NeedsFilter = true
-			asp.FilterStr = buildAudioFilterWithRate(asp.Channels, cfg.Audio.SampleRate)
+			filters = append(filters, buildAudioFilterWithRate(asp.Channels, cfg.Audio.SampleRate))
 			asp.Layout = layoutForChannels(asp.Channels)
 		}
+		if len(filters) > 0 {
+			asp.NeedsFilter = true
+			asp.FilterStr = strings.Join(filters, ",")
+		}
 
 		streams = append(streams, asp)
 	}
 	return AudioPlan{Streams: streams}
 }
 
+// KeptAudio returns the a:N indices of the audio streams a plan maps, in
+// source order: the usable (non-degenerate) streams, narrowed to
+// --audio-langs and with --drop-commentary tracks removed, then, with
+// --keep-only-preferred-audio-when-available, to the --my-lang tracks that
+// are not commentary. Each filter is skipped when it would leave no
+// stream, so a file never loses all its audio to track selection, and one
+// without a preferred-language track keeps the rest. Untagged streams do
+// not match a language filter, except in a Dual Audio release
+// (cfg.Audio.DualAudio), whose untagged track is usually the second
+// language.
+func KeptAudio(cfg *config.Config, pr *probe.ProbeResult) []int {
+	var kept []int
+	for i, a := range pr.AudioStreams {
+		if !a.Degenerate {
+			kept = append(kept, i)
+		}
+	}
+	if len(cfg.Audio.Langs) > 0 {
+		kept = narrowAudio(kept, func(i int) bool {
+			lang := pr.AudioStreams[i].Language
+			if lang == "" {
+				return cfg.Audio.DualAudio
+			}
+			for _, want := range cfg.Audio.Langs {
+				if strings.EqualFold(lang, want) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if cfg.Audio.DropCommentary {
+		kept = narrowAudio(kept, func(i int) bool {
+			return !isCommentary(pr.AudioStreams[i])
+		})
+	}
+	if cfg.Audio.PreferredOnly {
+		kept = narrowAudio(kept, func(i int) bool {
+			a := pr.AudioStreams[i]
+			if isCommentary(a) {
+				return false
+			}
+			if a.Language == "" {
+				return cfg.Audio.DualAudio
+			}
+			return strings.EqualFold(a.Language, cfg.MyLang)
+		})
+	}
+	return kept
+}
+
+// isCommentary reports whether a is flagged or titled as commentary.
+func isCommentary(a probe.AudioStream) bool {
+	return a.IsComment || strings.Contains(strings.ToLower(a.Title), "commentary")
+}
+
+// narrowAudio returns the indices keep accepts, or all of them when it
+// accepts none.
+func narrowAudio(indices []int, keep func(int) bool) []int {
+	var out []int
+	for _, i := range indices {
+		if keep(i) {
+			out = append(out, i)
+		}
+	}
+	if len(out) == 0 {
+		return indices
+	}
+	return out
+}
+
+// audioCopyable reports whether a is already in the target codec and, for
+// AAC, at or below --aac-copy-max. AAC streams with an unknown bitrate (0)
+// are copied, as is all AAC when the cap is 0 (the default). With
+// --reencode-audio-only-if-incompatible, other codecs the output container
+// accepts are copied too.
+func audioCopyable(cfg *config.Config, a probe.AudioStream) bool {
+	target := cfg.Audio.TargetCodec()
+	if !strings.EqualFold(a.Codec, string(target)) {
+		return cfg.Audio.CopyCompatible && config.ContainerAcceptsAudio(cfg.OutputContainer, a.Codec)
+	}
+	if target != config.AudioCodecAAC {
+		return true
+	}
+	max := int64(cfg.Audio.AACCopyMaxKbps) * 1000
+	return max <= 0 || a.BitRate <= 0 || a.BitRate <= max
+}
+
 func clampChannels(source, max int) int {
 	if source < 1 {
 		return 1
@@ -69,6 +182,28 @@ func clampChannels(source, max int) int {
 	return source
 }
 
+// stereoDownmixPan returns the --downmix-stereo pan filter for a 6- or
+// 8-channel stream, or "" for other channel counts (left to -ac). The
+// coefficients are Dolby Pro Logic II-style Lt/Rt: center at -3 dB, and the
+// surrounds mixed in opposite phase (0.8718/0.4899) so a matrix decoder can
+// steer them back. LFE is left out, as in a Pro Logic II encode. Channels are
+// addressed by position, which matches both 5.1 and 5.1(side). In 7.1 the
+// back (c4, c5) and side (c6, c7) pairs each get the 5.1 surround gains at
+// -3 dB (0.6164/0.3464).
+func stereoDownmixPan(channels int) string {
+	switch channels {
+	case 6:
+		return "pan=stereo" +
+			"|c0=c0+0.707*c2-0.8718*c4-0.4899*c5" +
+			"|c1=c1+0.707*c2+0.4899*c4+0.8718*c5"
+	case 8:
+		return "pan=stereo" +
+			"|c0=c0+0.707*c2-0.6164*c4-0.3464*c5-0.6164*c6-0.3464*c7" +
+			"|c1=c1+0.707*c2+0.3464*c4+0.6164*c5+0.3464*c6+0.6164*c7"
+	}
+	return ""
+}
+
 // buildAudioFilterWithRate constructs the aresample+aformat chain used when
 // MATCH_AUDIO_LAYOUT is enabled, using the configured sample rate.
 func buildAudioFilterWithRate(channels, sampleRate int) string {
@@ -90,3 +225,13 @@ func layoutForChannels(ch int) string {
 		return ""
 	}
 }
+
+// taggedLanguage returns lang normalized for -metadata, or "" when the
+// stream is untagged ("und" carries no information worth re-applying).
+func taggedLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "und" {
+		return ""
+	}
+	return lang
+}
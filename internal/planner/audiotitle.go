@@ -0,0 +1,113 @@
+// audiotitle.go synthesizes --auto-audio-titles track names like "English 5.1 EAC3".
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// languageNames maps ISO 639 codes (as tagged in MKV/MP4) to display names.
+// Codes missing here appear upper-cased.
+var languageNames = map[string]string{
+	"eng": "English", "en": "English",
+	"jpn": "Japanese", "ja": "Japanese",
+	"spa": "Spanish", "es": "Spanish",
+	"fre": "French", "fra": "French", "fr": "French",
+	"ger": "German", "deu": "German", "de": "German",
+	"ita": "Italian", "it": "Italian",
+	"por": "Portuguese", "pt": "Portuguese",
+	"rus": "Russian", "ru": "Russian",
+	"chi": "Chinese", "zho": "Chinese", "zh": "Chinese",
+	"kor": "Korean", "ko": "Korean",
+	"dut": "Dutch", "nld": "Dutch", "nl": "Dutch",
+	"swe": "Swedish", "sv": "Swedish",
+	"nor": "Norwegian", "no": "Norwegian",
+	"dan": "Danish", "da": "Danish",
+	"fin": "Finnish", "fi": "Finnish",
+	"pol": "Polish", "pl": "Polish",
+	"hin": "Hindi", "hi": "Hindi",
+	"ara": "Arabic", "ar": "Arabic",
+	"tur": "Turkish", "tr": "Turkish",
+}
+
+// codecNames maps ffprobe codec names to their usual display spelling.
+// Other codecs appear upper-cased.
+var codecNames = map[string]string{
+	"truehd": "TrueHD",
+	"opus":   "Opus",
+	"vorbis": "Vorbis",
+}
+
+// BuildAudioTitles implements --auto-audio-titles: one title per output
+// audio stream, in output order, describing the stream as written —
+// language, channel layout, and codec (e.g. "English 5.1 EAC3", "Japanese
+// Stereo AAC"). Copied streams are described from the source; transcoded
+// ones by their target channels and codec. Returns nil when the option is
+// off or there is no audio.
+func BuildAudioTitles(cfg *config.Config, pr *probe.ProbeResult, ap AudioPlan) []string {
+	if !cfg.Audio.AutoTitles || ap.NoAudio {
+		return nil
+	}
+	if ap.CopyAll {
+		titles := make([]string, 0, len(pr.AudioStreams))
+		for _, a := range pr.AudioStreams {
+			titles = append(titles, audioTitle(a.Language, a.Channels, a.Codec))
+		}
+		return titles
+	}
+	titles := make([]string, 0, len(ap.Streams))
+	for _, s := range ap.Streams {
+		a := pr.AudioStreams[s.StreamIndex]
+		channels, codec := a.Channels, a.Codec
+		if !s.Copy {
+			channels, codec = s.Channels, string(cfg.Audio.TargetCodec())
+		}
+		titles = append(titles, audioTitle(a.Language, channels, codec))
+	}
+	return titles
+}
+
+// audioTitle joins the known parts of a track description; an untagged
+// language or unknown channel count is left out.
+func audioTitle(lang string, channels int, codec string) string {
+	var parts []string
+	if l := taggedLanguage(lang); l != "" {
+		name, ok := languageNames[l]
+		if !ok {
+			name = strings.ToUpper(l)
+		}
+		parts = append(parts, name)
+	}
+	if ch := channelLayoutName(channels); ch != "" {
+		parts = append(parts, ch)
+	}
+	if codec != "" {
+		name, ok := codecNames[strings.ToLower(codec)]
+		if !ok {
+			name = strings.ToUpper(codec)
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " ")
+}
+
+// channelLayoutName names a channel count the way players label tracks.
+func channelLayoutName(ch int) string {
+	switch ch {
+	case 0:
+		return ""
+	case 1:
+		return "Mono"
+	case 2:
+		return "Stereo"
+	case 6:
+		return "5.1"
+	case 8:
+		return "7.1"
+	default:
+		return fmt.Sprintf("%dch", ch)
+	}
+}
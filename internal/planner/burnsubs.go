@@ -0,0 +1,108 @@
+// Subtitle burn-in (--burn-subs): stream selection and the filter chain that renders it into the video.
+package planner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// BurnSubtitle is the --burn-subs subtitle stream rendered into the video.
+type BurnSubtitle struct {
+	Index    int    // Absolute source stream index.
+	SubIndex int    // Position among the source's subtitle streams (the subtitles filter's si).
+	Bitmap   bool   // PGS/VobSub/DVB: overlaid from the decoded stream instead of rendered by libass.
+	Language string // Source language tag; "" = untagged.
+}
+
+// SelectBurnSubtitle returns the stream --burn-subs renders, or nil when the
+// option is off or no stream qualifies. With --burn-subs=lang the first
+// stream in that language is chosen; otherwise the source's default
+// subtitle, else the first one.
+func SelectBurnSubtitle(cfg *config.Config, pr *probe.ProbeResult) *BurnSubtitle {
+	if !cfg.BurnSubs || cfg.FaithfulRemux || pr.PrimaryVideo == nil {
+		return nil
+	}
+	pick := -1
+	for i, s := range pr.SubtitleStreams {
+		if cfg.BurnSubsLang != "" {
+			if strings.EqualFold(s.Language, cfg.BurnSubsLang) {
+				pick = i
+				break
+			}
+			continue
+		}
+		if pick < 0 || s.IsDefault {
+			pick = i
+		}
+		if s.IsDefault {
+			break
+		}
+	}
+	if pick < 0 {
+		return nil
+	}
+	s := pr.SubtitleStreams[pick]
+	return &BurnSubtitle{Index: s.Index, SubIndex: pick, Bitmap: s.IsBitmap, Language: s.Language}
+}
+
+// withoutBurned drops the burned-in stream from streams, reporting whether
+// it was there. streams is not modified.
+func withoutBurned(streams []probe.SubtitleStream, burn *BurnSubtitle) ([]probe.SubtitleStream, bool) {
+	if burn == nil {
+		return streams, false
+	}
+	kept := make([]probe.SubtitleStream, 0, len(streams))
+	for _, s := range streams {
+		if s.Index != burn.Index {
+			kept = append(kept, s)
+		}
+	}
+	return kept, len(kept) < len(streams)
+}
+
+// BuildBurnInFilters is the software-decode filter chain of
+// BuildVideoFilter with burn rendered in. The subtitle is drawn after
+// deinterlacing, at source resolution (where bitmap subtitles are
+// positioned), and ahead of scaling, tonemapping, and the VAAPI/QSV format
+// conversion and hwupload, which close the chain.
+//
+// Text subtitles are rendered by the subtitles filter reading the source
+// file, so the chain stays a -vf chain (vf). Bitmap subtitles need the
+// decoded subtitle stream as a second filter input, so the chain becomes a
+// -filter_complex graph ending in [vout] (graph) and vf is empty.
+func BuildBurnInFilters(cfg *config.Config, pr *probe.ProbeResult, burn BurnSubtitle, videoIdx, maxHeight int) (vf, graph string) {
+	if !exceedsHeight(pr, maxHeight) {
+		maxHeight = 0
+	}
+	pre, post := softwareDecodeFilters(cfg, pr, maxHeight)
+
+	if !burn.Bitmap {
+		sub := "subtitles=filename=" + escapeFilterValue(pr.Format.Filename) + ":si=" + strconv.Itoa(burn.SubIndex)
+		return strings.Join(append(append(pre, sub), post...), ","), ""
+	}
+
+	// eof_action=pass keeps the video flowing once the subtitle stream ends.
+	base := fmt.Sprintf("[0:%d]", videoIdx)
+	if len(pre) > 0 {
+		graph = base + strings.Join(pre, ",") + "[base];"
+		base = "[base]"
+	}
+	graph += fmt.Sprintf("%s[0:%d]overlay=eof_action=pass", base, burn.Index)
+	if len(post) > 0 {
+		graph += "," + strings.Join(post, ",")
+	}
+	return "", graph + "[vout]"
+}
+
+// escapeFilterValue escapes s for use as a filter option value inside a
+// filtergraph: first for the option parser (\ ' :), then for the graph
+// parser (\ ' [ ] , ;). Arguments are passed to ffmpeg without a shell, so
+// no shell quoting is needed.
+func escapeFilterValue(s string) string {
+	opt := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(opt)
+}
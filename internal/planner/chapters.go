@@ -0,0 +1,22 @@
+// chapters.go builds the --preserve-chapters-titles per-chapter metadata options.
+package planner
+
+import (
+	"strconv"
+
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// BuildChapterTitleOpts returns -metadata:c:N title=... for each titled
+// source chapter. Output chapter N is source chapter N (-map_chapters 0);
+// untitled chapters are left to the muxer.
+func BuildChapterTitleOpts(chapters []probe.Chapter) []string {
+	var opts []string
+	for i, c := range chapters {
+		if c.Title == "" {
+			continue
+		}
+		opts = append(opts, "-metadata:c:"+strconv.Itoa(i), "title="+c.Title)
+	}
+	return opts
+}
@@ -0,0 +1,26 @@
+// denoise.go maps --denoise levels to hqdn3d and denoise_vaapi presets.
+package planner
+
+import "github.com/backmassage/muxmaster/internal/config"
+
+// denoisePresets holds the filter for each --denoise level: hqdn3d
+// (luma_spatial:chroma_spatial:luma_tmp:chroma_tmp) for software frames,
+// and denoise_vaapi (strength 0-64) for VAAPI surfaces.
+var denoisePresets = map[config.DenoiseLevel]struct{ software, vaapi string }{
+	config.DenoiseLight:  {"hqdn3d=2:1:2:3", "denoise_vaapi=denoise=8"},
+	config.DenoiseMedium: {"hqdn3d=3:2:2:3", "denoise_vaapi=denoise=16"},
+	config.DenoiseHeavy:  {"hqdn3d=7:7:5:5", "denoise_vaapi=denoise=32"},
+}
+
+// denoiseFilter returns the --denoise filter for level, the denoise_vaapi
+// preset when vaapi is set, or "" when denoising is off.
+func denoiseFilter(level config.DenoiseLevel, vaapi bool) string {
+	p, ok := denoisePresets[level]
+	if !ok {
+		return ""
+	}
+	if vaapi {
+		return p.vaapi
+	}
+	return p.software
+}
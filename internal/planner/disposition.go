@@ -1,25 +1,117 @@
-// Stream disposition flags for default video and first audio.
+// Stream disposition flags for default video, first audio, and (optionally)
+// the --default-sub or audio-language-aware default subtitle.
 package planner
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/probe"
 )
 
 // BuildDispositions produces the ffmpeg -disposition flags that set the
-// primary video stream and first audio stream as default, clearing default
-// on all subsequent audio streams. This matches the legacy behavior where
+// primary video stream and first mapped audio stream as default, clearing
+// default on all subsequent audio streams (only KeptAudio streams are mapped). This matches the legacy behavior where
 // stream 0 of each type is marked default.
-func BuildDispositions(pr *probe.ProbeResult) []string {
+func BuildDispositions(cfg *config.Config, pr *probe.ProbeResult) []string {
 	opts := []string{"-disposition:v:0", "default"}
 
-	if len(pr.AudioStreams) > 0 {
+	if n := len(KeptAudio(cfg, pr)); n > 0 {
 		opts = append(opts, "-disposition:a:0", "default")
-		for i := 1; i < len(pr.AudioStreams); i++ {
+		for i := 1; i < n; i++ {
 			opts = append(opts, fmt.Sprintf("-disposition:a:%d", i), "0")
 		}
 	}
 
 	return opts
 }
+
+// BuildSubtitleDispositions produces -disposition:s:N flags for the mapped
+// embedded subtitles, indexed in output order (sp.StreamIdxs when
+// selective, so MP4's text-only mapping is accounted for).
+//
+// With --default-sub, the first mapped subtitle in cfg.DefaultSubLang is
+// marked default and every other subtitle has its default flag cleared.
+// When no mapped subtitle is in that language, the remaining policies
+// apply.
+//
+// With --keep-subs-langs-default, the first audio stream becomes the
+// default track (see BuildDispositions); when its language is known and
+// differs from cfg.MyLang, the first mapped subtitle in cfg.MyLang is
+// marked default. Otherwise (native audio, or no matching subtitle) every
+// mapped subtitle has its default flag cleared.
+//
+// MP4 mov_text output always gets explicit flags: default follows the
+// policies above when enabled and the source stream otherwise, and forced
+// is carried over from the source. Returns nil for MKV with no policy in
+// effect (stream copy keeps the source dispositions) or when no subtitles
+// are mapped.
+func BuildSubtitleDispositions(cfg *config.Config, pr *probe.ProbeResult, sp SubtitlePlan) []string {
+	movText := sp.Codec == "mov_text"
+	if !sp.Include || sp.SidecarOnly {
+		return nil
+	}
+	if !cfg.SubsDefaultByAudioLang && cfg.DefaultSubLang == "" && !movText {
+		return nil
+	}
+
+	// Embedded subtitle streams, in output order.
+	streams := pr.SubtitleStreams
+	if sp.Selective() {
+		byIdx := make(map[int]probe.SubtitleStream, len(pr.SubtitleStreams))
+		for _, s := range pr.SubtitleStreams {
+			byIdx[s.Index] = s
+		}
+		streams = make([]probe.SubtitleStream, 0, len(sp.StreamIdxs))
+		for _, idx := range sp.StreamIdxs {
+			streams = append(streams, byIdx[idx])
+		}
+	}
+
+	defaultIdx := firstSubtitleInLang(streams, cfg.DefaultSubLang)
+	policy := defaultIdx >= 0
+	if !policy && cfg.SubsDefaultByAudioLang {
+		policy = true
+		if kept := KeptAudio(cfg, pr); len(kept) > 0 {
+			audioLang := pr.AudioStreams[kept[0]].Language
+			if audioLang != "" && !strings.EqualFold(audioLang, cfg.MyLang) {
+				defaultIdx = firstSubtitleInLang(streams, cfg.MyLang)
+			}
+		}
+	}
+	if !policy && !movText {
+		return nil
+	}
+
+	opts := make([]string, 0, 2*len(streams))
+	for i, s := range streams {
+		var flags []string
+		if i == defaultIdx || (!policy && s.IsDefault) {
+			flags = append(flags, "default")
+		}
+		if movText && s.IsForced {
+			flags = append(flags, "forced")
+		}
+		val := "0"
+		if len(flags) > 0 {
+			val = strings.Join(flags, "+")
+		}
+		opts = append(opts, fmt.Sprintf("-disposition:s:%d", i), val)
+	}
+	return opts
+}
+
+// firstSubtitleInLang returns the position in streams of the first stream
+// tagged lang, or -1 (always -1 for an empty lang).
+func firstSubtitleInLang(streams []probe.SubtitleStream, lang string) int {
+	if lang == "" {
+		return -1
+	}
+	for i, s := range streams {
+		if strings.EqualFold(s.Language, lang) {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,12 +3,18 @@
 //
 // Files:
 //   - types.go:       FilePlan, Action, AudioPlan, AudioStreamPlan, SubtitlePlan, AttachmentPlan
-//   - planner.go:     BuildPlan entry point — wires all sub-plans into a FilePlan
+//   - planner.go:     BuildPlan / BuildPlanWithMaxHeight entry points — wire all sub-plans into a FilePlan
 //   - quality.go:     SmartQuality — per-file QP/CRF from resolution/bitrate curves
 //   - estimation.go:  EstimateBitrate — ratio-based output prediction with bias adjustments
 //   - tables.go:      Lookup tables for all quality curves, ratio estimation, and biases
-//   - filter.go:      BuildVideoFilter, BuildColorOpts, BuildHDR10Meta — filters, color, HDR10 metadata passthrough
+//   - filter.go:      BuildVideoFilter, BuildColorOpts, BuildHDR10Meta — filters (incl. height-cap downscale, --dither-8bit), color, HDR10 metadata passthrough
 //   - audio.go:       BuildAudioPlan — per-stream strategy with MATCH_AUDIO_LAYOUT filters
 //   - subtitle.go:    BuildSubtitlePlan, BuildAttachmentPlan
-//   - disposition.go: BuildDispositions — default video + first audio stream flags
+//   - burnsubs.go:    SelectBurnSubtitle, BuildBurnInFilters — --burn-subs stream choice and subtitles/overlay filter chains
+//   - disposition.go: BuildDispositions, BuildSubtitleDispositions — default video, first audio, --default-sub and audio-language-aware subtitle flags
+//   - chapters.go:    BuildChapterTitleOpts — --preserve-chapters-titles per-chapter title metadata
+//   - faithful.go:    buildFaithfulPlan — --faithful-remux -map 0 -c copy plans with MP4 fixups
+//   - faststart.go:   FaststartRemux — --remux-to-faststart stream copy of web-safe MP4 sources
+//   - denoise.go:     denoiseFilter — --denoise hqdn3d / denoise_vaapi presets
+//   - optimized.go:   IsAlreadyOptimized — composite check behind --skip-optimized
 package planner
@@ -29,7 +29,7 @@ func EstimateBitrate(cfg *config.Config, pr *probe.ProbeResult, vaapiQP, cpuCRF
 	inputKbps := int((inputBps + 500) / 1000)
 
 	var qualityValue int
-	if cfg.Encoder.Mode == config.EncoderVAAPI {
+	if cfg.Encoder.Mode.UsesQP() {
 		qualityValue = vaapiQP
 	} else {
 		qualityValue = cpuCRF
@@ -91,7 +91,7 @@ func PreflightAdjust(cfg *config.Config, pr *probe.ProbeResult, vaapiQP, cpuCRF,
 			return adjQP, adjCRF, i
 		}
 
-		if cfg.Encoder.Mode == config.EncoderVAAPI {
+		if cfg.Encoder.Mode.UsesQP() {
 			if adjQP >= VaapiQPMax {
 				return adjQP, adjCRF, i
 			}
@@ -109,7 +109,7 @@ func PreflightAdjust(cfg *config.Config, pr *probe.ProbeResult, vaapiQP, cpuCRF,
 // qualityRatioPerMille returns the estimated output/input ratio (in per-mille)
 // for a given encoder mode and quality setting.
 func qualityRatioPerMille(mode config.EncoderMode, q int) int {
-	if mode == config.EncoderVAAPI {
+	if mode.UsesQP() {
 		return vaapiRatio(q)
 	}
 	return cpuRatio(q)
@@ -0,0 +1,75 @@
+// faithful.go builds --faithful-remux plans: every source stream copied as-is.
+package planner
+
+import (
+	"fmt"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// buildFaithfulPlan fills plan as a --faithful-remux: -map 0 -c copy of all
+// video, audio, subtitle, and attachment streams, bypassing the audio and
+// subtitle planning. Data streams are still dropped (-dn): neither MKV nor
+// MP4 muxes arbitrary data.
+//
+// MP4 needs container fixups: attachments are unmapped, text subtitles are
+// converted to mov_text, and HEVC gets the hvc1 tag. Streams MP4 cannot
+// carry at all (bitmap subtitles, audio outside ContainerAcceptsAudio) set
+// plan.Err rather than being dropped silently.
+func buildFaithfulPlan(cfg *config.Config, pr *probe.ProbeResult, plan *FilePlan) *FilePlan {
+	plan.Action = ActionRemux
+	plan.VideoCodec = "copy"
+	plan.Faithful = true
+	// The subtitle and attachment retries toggle planned maps, which a
+	// faithful plan does not use.
+	plan.IncludeSubs = false
+	plan.IncludeAttach = false
+	plan.DolbyVision = pr.IsDolbyVision()
+	plan.HDR10Plus = pr.IsHDR10Plus()
+
+	opts := []string{"-map", "0"}
+	if cfg.OutputContainer == config.ContainerMP4 {
+		opts = append(opts, "-map", "-0:t?")
+		for i, a := range pr.AudioStreams {
+			if !config.ContainerAcceptsAudio(config.ContainerMP4, a.Codec) {
+				plan.Err = fmt.Errorf("--faithful-remux: MP4 cannot carry %s audio (stream a:%d); use --container mkv", a.Codec, i)
+				break
+			}
+		}
+		for _, s := range pr.SubtitleStreams {
+			if s.IsBitmap && plan.Err == nil {
+				plan.Err = fmt.Errorf("--faithful-remux: MP4 cannot carry bitmap subtitle stream %d (%s); use --container mkv", s.Index, s.Codec)
+			}
+		}
+	}
+	opts = append(opts, "-c", "copy")
+	switch cfg.OutputContainer {
+	case config.ContainerMP4:
+		if len(pr.SubtitleStreams) > 0 {
+			opts = append(opts, "-c:s", "mov_text")
+		}
+		plan.ContainerOpts = []string{"-movflags", "+faststart"}
+		if v := pr.PrimaryVideo; v != nil && v.Codec == "hevc" {
+			plan.TagOpts = []string{"-tag:v", "hvc1"}
+		}
+	}
+	if plan.DolbyVision {
+		opts = append(opts, "-strict", "unofficial")
+	}
+	plan.FaithfulOpts = opts
+
+	if cfg.PreserveCreationTime {
+		plan.CreationTime = pr.CreationTime()
+	}
+	if cfg.PreserveChapterTitles {
+		plan.ChapterOpts = BuildChapterTitleOpts(pr.Chapters)
+	}
+	plan.Container = cfg.OutputContainer
+	plan.AudioStreamCount = len(pr.AudioStreams)
+	plan.ChapterCount = len(pr.Chapters)
+	if v := pr.PrimaryVideo; v != nil {
+		plan.VideoStreamIdx = v.Index
+	}
+	return plan
+}
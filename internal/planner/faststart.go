@@ -0,0 +1,47 @@
+// faststart.go implements --remux-to-faststart: stream-copying MP4 sources whose video needs no encode.
+package planner
+
+import (
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// FaststartRemux reports whether --remux-to-faststart turns the encode of
+// pr into a stream-copy remux: MP4 in and MP4 out, and video that browsers
+// play as-is and that needs no filtering. The remux rewrites the file with
+// the moov atom first (-movflags +faststart, set for all MP4 output).
+//
+// Accepted video is 8-bit 4:2:0 H.264, edge-safe HEVC, or 4:2:0 AV1 that
+// is progressive, within maxHeight, not burning in a subtitle, and not an
+// HDR source due for tonemapping.
+func FaststartRemux(cfg *config.Config, pr *probe.ProbeResult, maxHeight int, burn *BurnSubtitle) bool {
+	v := pr.PrimaryVideo
+	if !cfg.RemuxToFaststart || cfg.OutputContainer != config.ContainerMP4 || v == nil {
+		return false
+	}
+	if !sourceMatchesContainer(pr.Format.FormatName, config.ContainerMP4) {
+		return false
+	}
+	switch strings.ToLower(v.Codec) {
+	case "h264":
+		if v.PixFmt != "yuv420p" {
+			return false
+		}
+	case "hevc":
+		if !pr.IsEdgeSafeHEVC() {
+			return false
+		}
+	case "av1":
+		if v.PixFmt != "yuv420p" && v.PixFmt != "yuv420p10le" {
+			return false
+		}
+	default:
+		return false
+	}
+	if pr.IsInterlaced() || pr.IsTelecined() || exceedsHeight(pr, maxHeight) || burn != nil {
+		return false
+	}
+	return pr.HDRType() == "sdr" || cfg.Encoder.HandleHDR == config.HDRPreserve
+}
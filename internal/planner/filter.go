@@ -1,7 +1,9 @@
-// Video filter chain: deinterlace, HDR tonemap, VAAPI hw/sw decode paths.
+// Video filter chain: letterbox crop, deinterlace/inverse telecine, denoise, HDR tonemap, 8-bit dither, VAAPI hw/sw decode paths, QSV upload.
 package planner
 
 import (
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/backmassage/muxmaster/internal/config"
@@ -14,12 +16,63 @@ import (
 // deinterlace uses the GPU-native filter instead of CPU yadif.
 // When hwDecode is false, CPU-side format conversion and hwupload are
 // used for the VAAPI path; returns empty for CPU-only encodes with no
-// deinterlace or tonemap.
-func BuildVideoFilter(cfg *config.Config, pr *probe.ProbeResult, hwDecode bool) string {
+// deinterlace, scale, or tonemap.
+//
+// maxHeight > 0 downscales sources taller than the cap, keeping the aspect
+// ratio with an even width: with scale on the CPU, or scale_vaapi on the
+// GPU for VAAPI encodes. Sources at or below the cap are never upscaled.
+// A measured pr.Crop (--auto-crop) leads the software chain. --denoise
+// follows deinterlacing: hqdn3d before the upload on the software path, or
+// denoise_vaapi on the surfaces (ahead of scale_vaapi) for VAAPI encodes.
+func BuildVideoFilter(cfg *config.Config, pr *probe.ProbeResult, hwDecode bool, maxHeight int) string {
+	if !exceedsHeight(pr, maxHeight) {
+		maxHeight = 0
+	}
 	if hwDecode {
-		return buildVAAPIHWDecodeFilters(cfg, pr)
+		return buildVAAPIHWDecodeFilters(cfg, pr, maxHeight)
+	}
+	return buildSoftwareDecodeFilters(cfg, pr, maxHeight)
+}
+
+// effectiveMaxHeight combines the per-media-type cap the pipeline passes
+// (--tv-max-height / --movie-max-height) with --scale-to: the lower of the
+// two set caps wins, and 0 means neither is set.
+func effectiveMaxHeight(cfg *config.Config, typeCap int) int {
+	if scaleTo := cfg.Encoder.ScaleTo; scaleTo > 0 && (typeCap == 0 || scaleTo < typeCap) {
+		return scaleTo
+	}
+	return typeCap
+}
+
+// outputSize returns the encoded picture size: the primary video after any
+// crop, downscaled to maxHeight with an even width as scale=-2 does. Zero
+// when the source has no usable dimensions.
+func outputSize(pr *probe.ProbeResult, maxHeight int) (w, h int) {
+	v := pr.PrimaryVideo
+	if v == nil || v.Width <= 0 || v.Height <= 0 {
+		return 0, 0
+	}
+	w, h = v.Width, v.Height
+	if pr.Crop != nil {
+		w, h = pr.Crop.W, pr.Crop.H
+	}
+	if exceedsHeight(pr, maxHeight) {
+		w = int(math.Round(float64(w)*float64(maxHeight)/float64(h)/2)) * 2
+		h = maxHeight
+	}
+	return w, h
+}
+
+// exceedsHeight reports whether the primary video, after any crop, is
+// taller than maxHeight. A maxHeight of 0 means no cap.
+func exceedsHeight(pr *probe.ProbeResult, maxHeight int) bool {
+	if maxHeight <= 0 || pr.PrimaryVideo == nil {
+		return false
+	}
+	if pr.Crop != nil {
+		return pr.Crop.H > maxHeight
 	}
-	return buildSoftwareDecodeFilters(cfg, pr)
+	return pr.PrimaryVideo.Height > maxHeight
 }
 
 // buildVAAPIHWDecodeFilters builds the filter chain when VAAPI hardware
@@ -29,41 +82,91 @@ func BuildVideoFilter(cfg *config.Config, pr *probe.ProbeResult, hwDecode bool)
 // surfaces while the main10 profile needs P010. Without this, GPUs that
 // can't do implicit NV12→P010 promotion fail with "No usable encoding
 // profile found." The conversion is a no-op when formats already match.
-func buildVAAPIHWDecodeFilters(cfg *config.Config, pr *probe.ProbeResult) string {
+func buildVAAPIHWDecodeFilters(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) string {
 	var filters []string
 
 	if cfg.Encoder.DeinterlaceAuto && pr.IsInterlaced() {
 		filters = append(filters, "deinterlace_vaapi")
 	}
+	if dn := denoiseFilter(cfg.Encoder.Denoise, true); dn != "" {
+		filters = append(filters, dn)
+	}
 
 	swFormat := cfg.Encoder.VaapiSwFormat
 	if swFormat == "" {
 		swFormat = "p010"
 	}
-	filters = append(filters, "scale_vaapi=format="+swFormat)
+	if maxHeight > 0 {
+		filters = append(filters, "scale_vaapi=w=-2:h="+strconv.Itoa(maxHeight)+":format="+swFormat)
+	} else {
+		filters = append(filters, "scale_vaapi=format="+swFormat)
+	}
 
 	return strings.Join(filters, ",")
 }
 
 // buildSoftwareDecodeFilters builds the filter chain for the software-decode
-// path (CPU decode, optional CPU filters, then hwupload for VAAPI encode).
-func buildSoftwareDecodeFilters(cfg *config.Config, pr *probe.ProbeResult) string {
-	var filters []string
+// path (CPU decode, optional CPU filters, then hwupload for VAAPI and QSV
+// encodes).
+func buildSoftwareDecodeFilters(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) string {
+	pre, post := softwareDecodeFilters(cfg, pr, maxHeight)
+	return strings.Join(append(pre, post...), ",")
+}
 
+// softwareDecodeFilters returns the software-decode chain split after the
+// crop, deinterlace/inverse telecine, and software denoise steps (pre),
+// where BuildBurnInFilters draws subtitles, and the scaling, tonemap, and
+// upload steps that follow (post).
+func softwareDecodeFilters(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) (pre, post []string) {
+	// Crop offsets are even (cropdetect round=2), so field parity survives
+	// for the deinterlacer that follows.
+	if pr.Crop != nil {
+		pre = append(pre, pr.Crop.Filter())
+	}
 	if cfg.Encoder.DeinterlaceAuto && pr.IsInterlaced() {
-		filters = append(filters, "yadif=mode=send_frame:parity=auto:deint=interlaced")
+		pre = append(pre, "yadif=mode=send_frame:parity="+yadifParity(cfg.Encoder.FieldOrder)+":deint=interlaced")
+	} else if cfg.Encoder.DeinterlaceAuto && pr.IsTelecined() {
+		// Inverse telecine: rebuild progressive film frames from matching
+		// fields, then drop the duplicate frame of each 3:2 cycle.
+		pre = append(pre, "fieldmatch,decimate")
+	}
+	// VAAPI denoises on the GPU after the upload instead (denoise_vaapi).
+	if cfg.Encoder.Mode != config.EncoderVAAPI {
+		if dn := denoiseFilter(cfg.Encoder.Denoise, false); dn != "" {
+			pre = append(pre, dn)
+		}
 	}
 
+	// VAAPI downscales on the GPU after the upload instead (scale_vaapi).
+	var filters []string
+	if maxHeight > 0 && cfg.Encoder.Mode != config.EncoderVAAPI {
+		filters = append(filters, "scale=-2:"+strconv.Itoa(maxHeight))
+	}
+
+	dither := NeedsDither(cfg, pr)
 	if pr.HDRType() == "hdr10" && cfg.Encoder.HandleHDR == config.HDRTonemap {
-		if cfg.Encoder.Mode == config.EncoderVAAPI {
+		switch cfg.Encoder.Mode {
+		case config.EncoderVAAPI:
 			swFormat := cfg.Encoder.VaapiSwFormat
 			if swFormat == "" {
 				swFormat = "nv12"
 			}
-			filters = append(filters, vaapiTonemapChain(swFormat))
-		} else {
-			filters = append(filters, cpuTonemapChain)
+			filters = append(filters, tonemapChain(cfg, swFormat, dither))
+		case config.EncoderQSV:
+			filters = append(filters, tonemapChain(cfg, "nv12", dither))
+		default:
+			filters = append(filters, tonemapChain(cfg, "yuv420p", false))
+		}
+	}
+
+	// QSV encodes 8-bit main from NV12 surfaces (the tonemap chain already
+	// ends in nv12); the extra frames give the encoder's lookahead room in
+	// the upload pool.
+	if cfg.Encoder.Mode == config.EncoderQSV {
+		if pr.HDRType() != "hdr10" || cfg.Encoder.HandleHDR != config.HDRTonemap {
+			filters = append(filters, formatFilter("nv12", dither))
 		}
+		filters = append(filters, "hwupload=extra_hw_frames=64")
 	}
 
 	if cfg.Encoder.Mode == config.EncoderVAAPI {
@@ -73,35 +176,89 @@ func buildSoftwareDecodeFilters(cfg *config.Config, pr *probe.ProbeResult) strin
 			if swFormat == "" {
 				swFormat = "p010"
 			}
-			filters = append(filters, "format="+swFormat)
+			filters = append(filters, formatFilter(swFormat, dither))
 		}
 		filters = append(filters, "hwupload")
+		if dn := denoiseFilter(cfg.Encoder.Denoise, true); dn != "" {
+			filters = append(filters, dn)
+		}
+		if maxHeight > 0 {
+			filters = append(filters, "scale_vaapi=w=-2:h="+strconv.Itoa(maxHeight))
+		}
 	}
 
-	return strings.Join(filters, ",")
+	return pre, filters
+}
+
+// EncodesTo8Bit reports whether the configured encoder produces 8-bit
+// output: QSV always encodes HEVC main from NV12, and VAAPI does when
+// CheckDeps fell back to the main profile. CPU encodes are always main10.
+func EncodesTo8Bit(cfg *config.Config) bool {
+	switch cfg.Encoder.Mode {
+	case config.EncoderQSV:
+		return true
+	case config.EncoderVAAPI:
+		return cfg.Encoder.VaapiProfile == "main"
+	}
+	return false
 }
 
-// cpuTonemapChain is the zscale+tonemap pipeline for converting HDR10 to SDR
-// in CPU mode, matching the legacy script exactly.
-const cpuTonemapChain = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
-	"tonemap=tonemap=hable:desat=0," +
-	"zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
-
-// vaapiTonemapChain returns the zscale+tonemap pipeline for VAAPI mode.
-// It is identical to the CPU chain except the final format outputs the
-// VAAPI-compatible pixel format (nv12 or p010) instead of yuv420p, avoiding
-// a redundant format conversion before hwupload.
-func vaapiTonemapChain(swFormat string) string {
-	return "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709," +
-		"tonemap=tonemap=hable:desat=0," +
-		"zscale=t=bt709:m=bt709:r=tv,format=" + swFormat
+// NeedsDither reports whether --dither-8bit applies: a high-bit-depth
+// source encoded to an 8-bit profile. Dithering runs in software, so these
+// encodes skip VAAPI hardware decode.
+func NeedsDither(cfg *config.Config, pr *probe.ProbeResult) bool {
+	return cfg.Encoder.Dither8Bit && pr.IsHighBitDepth() && EncodesTo8Bit(cfg)
+}
+
+// formatFilter returns the format= conversion before hwupload. With dither,
+// an explicit scale performs the conversion with error-diffusion dithering
+// instead of the auto-inserted scaler's truncation.
+func formatFilter(pixFmt string, dither bool) string {
+	if dither {
+		return "scale=sws_dither=ed,format=" + pixFmt
+	}
+	return "format=" + pixFmt
+}
+
+// yadifParity maps --field-order to the yadif parity option: 0 = top field
+// first, 1 = bottom field first, auto = read from the frames.
+func yadifParity(order config.FieldOrder) string {
+	switch order {
+	case config.FieldOrderTFF:
+		return "0"
+	case config.FieldOrderBFF:
+		return "1"
+	default:
+		return "auto"
+	}
+}
+
+// tonemapChain returns the zscale+tonemap pipeline for converting HDR10 to
+// SDR. The linearization peak (npl) and hable desaturation come from
+// --tonemap-peak and --tonemap-desat (defaults 100 and 0, matching the
+// legacy script). outFormat is yuv420p for CPU encodes; VAAPI passes its
+// software format (nv12 or p010), avoiding a redundant conversion before
+// hwupload. dither makes the final zscale error-diffuse down to outFormat.
+func tonemapChain(cfg *config.Config, outFormat string, dither bool) string {
+	peak := strconv.FormatFloat(cfg.Encoder.TonemapPeak, 'g', -1, 64)
+	desat := strconv.FormatFloat(cfg.Encoder.TonemapDesat, 'g', -1, 64)
+	final := "zscale=t=bt709:m=bt709:r=tv"
+	if dither {
+		final += ":dither=error_diffusion"
+	}
+	return "zscale=t=linear:npl=" + peak + ",format=gbrpf32le,zscale=p=bt709," +
+		"tonemap=tonemap=hable:desat=" + desat + "," +
+		final + ",format=" + outFormat
 }
 
 // BuildColorOpts returns the ffmpeg color metadata flags for HDR preservation
 // on the encode path. When HDR is detected and preserve mode is active, the
 // source color transfer, primaries, and space are passed through to the output.
+// An 8-bit encode (see EncodesTo8Bit) gets no tags: it cannot hold HDR10's
+// PQ range, and a file tagged smpte2084 with 8-bit video plays back wrong
+// (see hdrTagsDroppedNote).
 func BuildColorOpts(cfg *config.Config, pr *probe.ProbeResult) []string {
-	if cfg.Encoder.HandleHDR != config.HDRPreserve || pr.HDRType() != "hdr10" {
+	if cfg.Encoder.HandleHDR != config.HDRPreserve || pr.HDRType() != "hdr10" || EncodesTo8Bit(cfg) {
 		return nil
 	}
 
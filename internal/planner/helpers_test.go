@@ -35,6 +35,16 @@ func hevcEdgeSafe() *probe.ProbeResult {
 	}
 }
 
+// optimizedMKV is an edge-safe HEVC MKV with modest AAC audio — a file
+// IsAlreadyOptimized should accept under default config.
+func optimizedMKV() *probe.ProbeResult {
+	pr := hevcEdgeSafe()
+	pr.PrimaryVideo.FieldOrder = "progressive"
+	pr.AudioStreams[0].BitRate = 192000
+	pr.Format.FormatName = "matroska,webm"
+	return pr
+}
+
 func hevcUnsafe() *probe.ProbeResult {
 	return &probe.ProbeResult{
 		PrimaryVideo: &probe.VideoStream{
@@ -0,0 +1,102 @@
+// IsAlreadyOptimized: composite "nothing to do" check behind --skip-optimized.
+package planner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/backmassage/muxmaster/internal/config"
+	"github.com/backmassage/muxmaster/internal/probe"
+)
+
+// IsAlreadyOptimized reports whether a file already matches what Muxmaster
+// would produce, so processing it would change essentially nothing. All of
+// the following must hold:
+//
+//   - the source container is the target container (never true for HLS)
+//   - video is edge-safe HEVC or AV1 (main / main 10 style 4:2:0 pix_fmt)
+//   - no interlacing
+//   - SDR, or HDR while HDR handling is preserve
+//   - every audio stream is AAC or Opus at or below the configured bitrate
+//
+// The returned reason names the first failing criterion, or summarizes the
+// match when the file is optimized.
+func IsAlreadyOptimized(cfg *config.Config, pr *probe.ProbeResult) (bool, string) {
+	v := pr.PrimaryVideo
+	if v == nil {
+		return false, "no video stream"
+	}
+
+	if !sourceMatchesContainer(pr.Format.FormatName, cfg.OutputContainer) {
+		return false, fmt.Sprintf("container %q is not %s", pr.Format.FormatName, cfg.OutputContainer)
+	}
+
+	switch strings.ToLower(v.Codec) {
+	case "hevc":
+		if !pr.IsEdgeSafeHEVC() {
+			return false, fmt.Sprintf("HEVC profile '%s' / %s not edge-safe", v.Profile, v.PixFmt)
+		}
+	case "av1":
+		if v.PixFmt != "yuv420p" && v.PixFmt != "yuv420p10le" {
+			return false, fmt.Sprintf("AV1 pix_fmt %s not edge-safe", v.PixFmt)
+		}
+	default:
+		return false, fmt.Sprintf("video codec %s is not HEVC/AV1", v.Codec)
+	}
+
+	if pr.IsInterlaced() {
+		return false, "interlaced"
+	}
+	if pr.IsTelecined() {
+		return false, "telecined"
+	}
+
+	if pr.HDRType() != "sdr" && cfg.Encoder.HandleHDR != config.HDRPreserve {
+		return false, "HDR source would be tonemapped"
+	}
+
+	maxAudioBps := audioBitrateBps(cfg.Audio.Bitrate)
+	for i, a := range pr.AudioStreams {
+		codec := strings.ToLower(a.Codec)
+		if codec != "aac" && codec != "opus" {
+			return false, fmt.Sprintf("audio stream %d is %s", i, a.Codec)
+		}
+		if maxAudioBps > 0 && a.BitRate > maxAudioBps {
+			return false, fmt.Sprintf("audio stream %d at %dk exceeds %s", i, a.BitRate/1000, cfg.Audio.Bitrate)
+		}
+	}
+
+	return true, fmt.Sprintf("already optimized (%s %s, %s)", strings.ToUpper(v.Codec), pr.HDRType(), cfg.OutputContainer)
+}
+
+// sourceMatchesContainer compares an ffprobe format_name (e.g.
+// "matroska,webm" or "mov,mp4,m4a,3gp,3g2,mj2") with the target container.
+func sourceMatchesContainer(formatName string, target config.Container) bool {
+	names := strings.Split(strings.ToLower(formatName), ",")
+	var want string
+	switch target {
+	case config.ContainerMKV:
+		want = "matroska"
+	case config.ContainerMP4:
+		want = "mp4"
+	default:
+		return false
+	}
+	for _, n := range names {
+		if n == want {
+			return true
+		}
+	}
+	return false
+}
+
+// audioBitrateBps converts a normalized "<n>k" bitrate to bits per second.
+// Returns 0 if the value cannot be parsed.
+func audioBitrateBps(bitrate string) int64 {
+	n, err := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	if err != nil {
+		return 0
+	}
+	return int64(n) * 1000
+}
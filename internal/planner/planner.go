@@ -3,6 +3,8 @@ package planner
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/probe"
@@ -12,14 +14,114 @@ import (
 // the central decision matrix that the pipeline calls for every file.
 //
 // Flow:
-//  1. Decide action (encode vs remux) via HEVC edge-safe check
+//  1. Decide action (skip, encode, or remux) via the optimized and HEVC
+//     edge-safe checks
 //  2. Compute smart quality (resolution/bitrate curves + bias)
 //  3. Build video filter chain (deinterlace, HDR tonemap, VAAPI hwupload)
 //  4. Build audio plan (copy AAC, transcode others, layout normalization)
 //  5. Build subtitle + attachment plans
 //  6. Set stream dispositions, container opts, retry initial state
 func BuildPlan(cfg *config.Config, pr *probe.ProbeResult) *FilePlan {
+	return BuildPlanWithMaxHeight(cfg, pr, 0)
+}
+
+// timestampFixFormats lists ffprobe format names whose timestamps are
+// commonly broken: MPEG transport streams (.ts/.m2ts) and MPEG program
+// streams (VOB/.mpg).
+var timestampFixFormats = map[string]bool{
+	"mpegts": true,
+	"mpeg":   true,
+}
+
+// NeedsTimestampFix reports whether the source container is one that
+// usually needs +genpts+discardcorrupt and -avoid_negative_ts, as used by
+// the default (format-aware) timestamp cleaning. Clean MKV/MP4 sources are
+// left untouched.
+func NeedsTimestampFix(pr *probe.ProbeResult) bool {
+	for _, name := range strings.Split(pr.Format.FormatName, ",") {
+		if timestampFixFormats[strings.TrimSpace(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// hdr10PlusLostNote is added to Warnings when an HDR10+ source is
+// encoded with HDR preserved: the encoders keep the static HDR10 metadata
+// (BuildHDR10Meta) but not the per-frame SMPTE 2094-40 metadata.
+const hdr10PlusLostNote = "HDR10+ dynamic metadata not retained by the encoder; output keeps static HDR10 only"
+
+// hdrTagsDroppedNote is added to Warnings when an HDR10 source is
+// encoded with HDR preserved but to an 8-bit profile (QSV, or the VAAPI
+// main fallback), where BuildColorOpts leaves out the HDR color tags.
+const hdrTagsDroppedNote = "HDR10 color tags not retained: the 8-bit encode profile cannot carry them (use --hdr tonemap for SDR output)"
+
+// bandingNote is added to Warnings when a high-bit-depth source is
+// encoded to an 8-bit profile: smooth gradients (skies, fades) lose the
+// source's extra precision and can band.
+const bandingNote = "10-bit source encoded to 8-bit profile; banding risk"
+
+// joinNote appends note to an existing QualityNote.
+func joinNote(existing, note string) string {
+	if existing == "" {
+		return note
+	}
+	return existing + "; " + note
+}
+
+// KeepMKVForBitmapSubs implements --replace-container-only: with MP4
+// output, a file whose video needs no work (edge-safe HEVC remuxed under
+// --skip-hevc, within maxHeight) but which has bitmap subtitles MP4 cannot
+// carry is better kept in MKV, changing only the container rather than
+// losing those subtitles. Returns a reason for the log when MKV should be
+// kept.
+func KeepMKVForBitmapSubs(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) (bool, string) {
+	if !cfg.ReplaceContainerOnly || cfg.OutputContainer != config.ContainerMP4 || !cfg.KeepSubtitles {
+		return false, ""
+	}
+	v := pr.PrimaryVideo
+	if !cfg.SkipHEVC || v == nil || v.Codec != "hevc" || !pr.IsEdgeSafeHEVC() || exceedsHeight(pr, effectiveMaxHeight(cfg, maxHeight)) {
+		return false, ""
+	}
+	streams, _ := filterSubtitleLangs(cfg, pr.SubtitleStreams)
+	bitmap := 0
+	for _, s := range streams {
+		if s.IsBitmap {
+			bitmap++
+		}
+	}
+	if bitmap == 0 {
+		return false, ""
+	}
+	return true, fmt.Sprintf("video only needs a remux; MP4 would drop %d bitmap subtitle stream(s)", bitmap)
+}
+
+// outsideHeightRange returns the skip reason when the source height is
+// outside --min-height / --max-height, or "" when it is in range (or the
+// height is unknown).
+func outsideHeightRange(cfg *config.Config, pr *probe.ProbeResult) string {
+	v := pr.PrimaryVideo
+	if v == nil || v.Height <= 0 {
+		return ""
+	}
+	switch {
+	case cfg.MinHeight > 0 && v.Height < cfg.MinHeight:
+		return fmt.Sprintf("%dp below --min-height %d", v.Height, cfg.MinHeight)
+	case cfg.MaxHeight > 0 && v.Height > cfg.MaxHeight:
+		return fmt.Sprintf("%dp above --max-height %d", v.Height, cfg.MaxHeight)
+	}
+	return ""
+}
+
+// BuildPlanWithMaxHeight is BuildPlan with a per-file height cap (0 = none),
+// as chosen by the pipeline from --tv-max-height / --movie-max-height and
+// lowered to --scale-to when that is smaller. Sources taller than the cap
+// are encoded with a downscale filter, even if they would otherwise be
+// remuxed, and smart quality targets the downscaled pixel count.
+func BuildPlanWithMaxHeight(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) *FilePlan {
+	maxHeight = effectiveMaxHeight(cfg, maxHeight)
 	plan := &FilePlan{
+		MaxHeight:     maxHeight,
 		MuxQueueSize:  4096,
 		IncludeSubs:   cfg.KeepSubtitles,
 		IncludeAttach: cfg.KeepAttachments,
@@ -28,29 +130,83 @@ func BuildPlan(cfg *config.Config, pr *probe.ProbeResult) *FilePlan {
 	v := pr.PrimaryVideo
 
 	// --- 1. Action decision ---
+	if reason := outsideHeightRange(cfg, pr); reason != "" {
+		plan.Action = ActionSkip
+		plan.SkipReason = reason
+		return plan
+	}
+	if cfg.FaithfulRemux {
+		return buildFaithfulPlan(cfg, pr, plan)
+	}
+	burn := SelectBurnSubtitle(cfg, pr)
+	if cfg.SkipOptimized && !exceedsHeight(pr, maxHeight) && burn == nil {
+		if ok, reason := IsAlreadyOptimized(cfg, pr); ok {
+			plan.Action = ActionSkip
+			plan.SkipReason = reason
+			return plan
+		}
+	}
 	if cfg.SkipHEVC && v != nil && v.Codec == "hevc" {
 		if pr.IsEdgeSafeHEVC() {
 			plan.Action = ActionRemux
 		} else {
 			plan.Action = ActionEncode
-			plan.QualityNote = fmt.Sprintf("HEVC profile '%s' not browser-safe; re-encoding", v.Profile)
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("HEVC profile '%s' not browser-safe; re-encoding", v.Profile))
 		}
 	} else {
 		plan.Action = ActionEncode
 	}
+	if plan.Action == ActionEncode && FaststartRemux(cfg, pr, maxHeight, burn) {
+		plan.Action = ActionRemux
+		plan.Faststart = true
+	}
+	if plan.Action == ActionRemux && exceedsHeight(pr, maxHeight) {
+		plan.Action = ActionEncode
+		plan.QualityNote = fmt.Sprintf("%dp exceeds %dp cap; re-encoding to downscale", v.Height, maxHeight)
+	}
+	if plan.Action == ActionRemux && burn != nil {
+		plan.Action = ActionEncode
+		plan.QualityNote = fmt.Sprintf("burning in subtitle stream %d; re-encoding", burn.Index)
+	}
+	// An unknown bitrate (0) never skips.
+	if plan.Action == ActionEncode && cfg.MinBitrateKbps > 0 {
+		if kbps := int(pr.VideoBitRate() / 1000); kbps > 0 && kbps < cfg.MinBitrateKbps {
+			plan.Action = ActionSkip
+			plan.SkipReason = fmt.Sprintf("source bitrate below threshold (%d < %d kbps)", kbps, cfg.MinBitrateKbps)
+			plan.QualityNote = ""
+			return plan
+		}
+	}
 
 	// Remux targets are already edge-safe HEVC from clean sources — PTS
 	// regeneration (+genpts) adds unnecessary container overhead. Only
-	// enable timestamp repair for encodes; the retry engine can still
-	// activate it for remuxes if ffmpeg fails with a timestamp error.
-	if plan.Action == ActionRemux {
+	// enable timestamp repair for encodes, and by default only for source
+	// formats known to carry broken timestamps; the retry engine can still
+	// activate it if ffmpeg fails with a timestamp error.
+	switch {
+	case plan.Action == ActionRemux:
 		plan.TimestampFix = false
-	} else {
+	case cfg.CleanTimestampsAuto:
+		plan.TimestampFix = NeedsTimestampFix(pr)
+	default:
 		plan.TimestampFix = cfg.CleanTimestamps
 	}
 
+	// --- 1a. Target bitrate (--target-bitrate) ---
+	// An average bitrate replaces QP/CRF, so the smart quality note, the
+	// optimal-bitrate targeting, and the CPU maxrate ceiling do not apply.
+	if plan.Action == ActionEncode && cfg.Encoder.TargetBitrateKbps > 0 {
+		plan.TargetBitrateKbps = cfg.Encoder.TargetBitrateKbps
+		plan.TwoPass = cfg.Encoder.Mode == config.EncoderCPU
+		rc := "VBR"
+		if plan.TwoPass {
+			rc = "two-pass"
+		}
+		plan.QualityNote = joinNote(plan.QualityNote, fmt.Sprintf("target bitrate %d kb/s (%s)", plan.TargetBitrateKbps, rc))
+	}
+
 	// --- 2. Smart quality ---
-	q := SmartQuality(cfg, pr)
+	q := SmartQualityAtHeight(cfg, pr, maxHeight)
 	plan.VaapiQP = q.VaapiQP
 	plan.CpuCRF = q.CpuCRF
 	if plan.QualityNote == "" {
@@ -62,12 +218,12 @@ func BuildPlan(cfg *config.Config, pr *probe.ProbeResult) *FilePlan {
 	// resolution, and density. This drives both the VAAPI QP selection and
 	// the CPU maxrate ceiling, avoiding wasteful first-pass encodes that
 	// produce output larger than the input.
-	if plan.Action == ActionEncode && cfg.Encoder.ActiveQualityOverride == "" && cfg.Encoder.SmartQuality {
+	if plan.Action == ActionEncode && plan.TargetBitrateKbps == 0 && cfg.Encoder.ActiveQualityOverride == "" && cfg.Encoder.SmartQuality {
 		optKbps := OptimalBitrate(pr)
 		plan.OptimalBitrateKbps = optKbps
 
 		if optKbps > 0 {
-			if cfg.Encoder.Mode == config.EncoderVAAPI {
+			if cfg.Encoder.Mode.UsesQP() {
 				targetQP := QPForTargetBitrate(cfg, pr, optKbps)
 				if targetQP > plan.VaapiQP {
 					ceiling := plan.VaapiQP + MaxOptimalOverride
@@ -106,7 +262,7 @@ func BuildPlan(cfg *config.Config, pr *probe.ProbeResult) *FilePlan {
 	// CRF can target quality but never produce output larger than what we
 	// expect. VAAPI constant-QP mode does not support -maxrate; the QP
 	// targeting above handles VAAPI instead.
-	if plan.Action == ActionEncode && cfg.Encoder.Mode == config.EncoderCPU {
+	if plan.Action == ActionEncode && plan.TargetBitrateKbps == 0 && cfg.Encoder.Mode == config.EncoderCPU {
 		inputKbps := int(pr.VideoBitRate() / 1000)
 		if inputKbps > 0 {
 			// Use optimal bitrate + 15% headroom as ceiling, capped at
@@ -133,38 +289,125 @@ func BuildPlan(cfg *config.Config, pr *probe.ProbeResult) *FilePlan {
 			plan.VideoCodec = "hevc_vaapi"
 		case config.EncoderCPU:
 			plan.VideoCodec = "libx265"
+		case config.EncoderQSV:
+			plan.VideoCodec = "hevc_qsv"
 		}
 
+		// Image-sequence frames (PNG, JPEG, ...) have no VAAPI decoder, and
+		// fieldmatch/decimate (inverse telecine) only run on CPU frames.
+		// 4:2:2/4:4:4 sources are decoded in software too: the GPU usually
+		// can't decode them, and the software path's format= filter
+		// downsamples chroma to 4:2:0 before hwupload. A forced
+		// --field-order needs yadif, as deinterlace_vaapi has no parity option,
+		// --dither-8bit needs the software scaler, --burn-subs draws
+		// subtitles on CPU frames, and the --auto-crop crop runs ahead of
+		// the upload.
 		needsHDRTonemap := pr.HDRType() == "hdr10" && cfg.Encoder.HandleHDR == config.HDRTonemap
-		if cfg.Encoder.Mode == config.EncoderVAAPI && !needsHDRTonemap {
+		needsIVTC := cfg.Encoder.DeinterlaceAuto && pr.IsTelecined()
+		needsParity := cfg.Encoder.DeinterlaceAuto && pr.IsInterlaced() && yadifParity(cfg.Encoder.FieldOrder) != "auto"
+		if cfg.Encoder.Mode == config.EncoderVAAPI && !needsHDRTonemap && !needsIVTC && !needsParity && !NeedsDither(cfg, pr) && burn == nil && pr.Crop == nil && !pr.IsNon420Chroma() && cfg.ImageSequence == "" {
 			plan.HWDecode = true
 		}
 
-		plan.VideoFilters = BuildVideoFilter(cfg, pr, plan.HWDecode)
+		if burn != nil {
+			plan.BurnSub = burn
+			plan.VideoFilters, plan.VideoFilterComplex = BuildBurnInFilters(cfg, pr, *burn, v.Index, maxHeight)
+		} else {
+			plan.VideoFilters = BuildVideoFilter(cfg, pr, plan.HWDecode, maxHeight)
+		}
 		plan.ColorOpts = BuildColorOpts(cfg, pr)
 		BuildHDR10Meta(cfg, pr, plan)
+		if pr.HDRType() == "hdr10" && cfg.Encoder.HandleHDR == config.HDRPreserve && EncodesTo8Bit(cfg) {
+			plan.Warnings = append(plan.Warnings, hdrTagsDroppedNote)
+		} else if pr.IsHDR10Plus() && cfg.Encoder.HandleHDR == config.HDRPreserve {
+			plan.Warnings = append(plan.Warnings, hdr10PlusLostNote)
+		}
+		if pr.IsHighBitDepth() && EncodesTo8Bit(cfg) {
+			if cfg.Encoder.Dither8Bit {
+				plan.Warnings = append(plan.Warnings, bandingNote+" (dithered)")
+			} else {
+				plan.Warnings = append(plan.Warnings, bandingNote+" (--dither-8bit to dither)")
+			}
+		}
 	}
 
+	// --- 3a. Dynamic HDR metadata ---
+	plan.HDR10Plus = pr.IsHDR10Plus()
+	plan.DolbyVision = pr.IsDolbyVision()
+
 	// --- 4. Audio ---
 	plan.Audio = BuildAudioPlan(cfg, pr)
+	plan.Audio.Titles = BuildAudioTitles(cfg, pr, plan.Audio)
 
 	// --- 5. Subtitles and attachments ---
-	plan.Subtitles = BuildSubtitlePlan(cfg, pr)
+	plan.Subtitles, plan.Err = BuildSubtitlePlan(cfg, pr)
+	plan.Subtitles.DispositionOpts = BuildSubtitleDispositions(cfg, pr, plan.Subtitles)
 	plan.Attachments = BuildAttachmentPlan(cfg)
 
 	// --- 6. Container opts ---
-	if cfg.OutputContainer == config.ContainerMP4 {
+	switch cfg.OutputContainer {
+	case config.ContainerMP4:
 		plan.ContainerOpts = []string{"-movflags", "+faststart"}
-		plan.TagOpts = []string{"-tag:v", "hvc1"}
+		// hvc1 is the HEVC sample entry; copied H.264 and AV1 keep theirs.
+		if plan.Action == ActionEncode || (v != nil && v.Codec == "hevc") {
+			plan.TagOpts = []string{"-tag:v", "hvc1"}
+		}
+	case config.ContainerHLS:
+		// Single-rendition VOD playlist. The segment filename pattern is
+		// derived from the output path by the builder.
+		plan.ContainerOpts = []string{
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(HLSSegmentSeconds),
+			"-hls_playlist_type", "vod",
+		}
+	}
+
+	// --- 6a. Creation time ---
+	// -map_metadata 0 copies it, but muxers that stamp their own
+	// creation_time overwrite it with the encode time; an explicit
+	// -metadata wins over both.
+	if cfg.PreserveCreationTime {
+		plan.CreationTime = pr.CreationTime()
+	}
+
+	// --- 6b. Chapter titles ---
+	// -map_chapters 0 copies titles, but some container conversions
+	// (MKV→MP4) rename or drop them; explicit per-chapter metadata wins.
+	if cfg.PreserveChapterTitles {
+		plan.ChapterOpts = BuildChapterTitleOpts(pr.Chapters)
+	}
+
+	// --- 6c. Cover art ---
+	if cfg.KeepCoverArt && cfg.OutputContainer == config.ContainerMKV && pr.CoverArt != nil && v != nil {
+		plan.IncludeCoverArt = true
+		plan.CoverArtIdx = pr.CoverArt.Index
 	}
 
 	// --- 7. Stream dispositions ---
-	plan.DispositionOpts = BuildDispositions(pr)
+	plan.DispositionOpts = BuildDispositions(cfg, pr)
+	if plan.IncludeCoverArt {
+		plan.DispositionOpts = append(plan.DispositionOpts, "-disposition:v:1", "attached_pic")
+	}
 
+	plan.InputOpts = AssembleInputOpts(cfg)
 	plan.Container = cfg.OutputContainer
-	plan.AudioStreamCount = len(pr.AudioStreams)
+	plan.AudioStreamCount = len(KeptAudio(cfg, pr))
+	plan.ChapterCount = len(pr.Chapters)
 	if v != nil {
 		plan.VideoStreamIdx = v.Index
 	}
 	return plan
 }
+
+// AssembleInputOpts returns the demuxer options that precede -i for
+// --concat (concat demuxer, unrestricted paths) and --image-seq (image2 at
+// --image-fps), or nil for ordinary file inputs.
+func AssembleInputOpts(cfg *config.Config) []string {
+	switch {
+	case cfg.ConcatList != "":
+		return []string{"-f", "concat", "-safe", "0"}
+	case cfg.ImageSequence != "":
+		return []string{"-f", "image2", "-framerate", strconv.FormatFloat(cfg.ImageFPS, 'g', -1, 64)}
+	}
+	return nil
+}
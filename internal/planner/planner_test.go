@@ -2,6 +2,7 @@ package planner
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
@@ -36,8 +37,8 @@ func TestBuildPlan_HEVCUnsafeReencode(t *testing.T) {
 	if plan.Action != ActionEncode {
 		t.Errorf("action: got %d, want ActionEncode (unsafe HEVC)", plan.Action)
 	}
-	if !strings.Contains(plan.QualityNote, "not browser-safe") {
-		t.Errorf("QualityNote should mention browser-safe, got %q", plan.QualityNote)
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "not browser-safe") {
+		t.Errorf("Warnings should mention browser-safe, got %q", plan.Warnings)
 	}
 }
 
@@ -74,8 +75,161 @@ func TestBuildPlan_MP4Container(t *testing.T) {
 	}
 }
 
+func TestBuildPlan_HLSContainer(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerHLS
+	plan := BuildPlan(cfg, h264SDR())
+	want := []string{"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod"}
+	if strings.Join(plan.ContainerOpts, " ") != strings.Join(want, " ") {
+		t.Errorf("ContainerOpts: got %v, want %v", plan.ContainerOpts, want)
+	}
+	if plan.Subtitles.Include {
+		t.Error("HLS should not include subtitles")
+	}
+	if plan.Attachments.Include {
+		t.Error("HLS should not include attachments")
+	}
+}
+
+func TestBuildPlan_KeepCoverArt(t *testing.T) {
+	pr := h264SDR()
+	pr.CoverArt = &probe.VideoStream{Index: 3, Codec: "mjpeg", IsAttachedPic: true}
+
+	cfg := defaultCfg()
+	if plan := BuildPlan(cfg, pr); plan.IncludeCoverArt {
+		t.Error("cover art should be off without --keep-cover")
+	}
+
+	cfg.KeepCoverArt = true
+	plan := BuildPlan(cfg, pr)
+	if !plan.IncludeCoverArt || plan.CoverArtIdx != 3 {
+		t.Errorf("got IncludeCoverArt=%v idx=%d, want true 3", plan.IncludeCoverArt, plan.CoverArtIdx)
+	}
+	if !strings.Contains(strings.Join(plan.DispositionOpts, " "), "-disposition:v:1 attached_pic") {
+		t.Errorf("missing attached_pic disposition: %v", plan.DispositionOpts)
+	}
+
+	cfg.OutputContainer = config.ContainerMP4
+	if plan := BuildPlan(cfg, pr); plan.IncludeCoverArt {
+		t.Error("cover art is MKV only")
+	}
+}
+
+// --- Per-media-type height cap tests ---
+
+func TestBuildPlanWithMaxHeight_TVDownscales(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.TVMaxHeight = 720
+	cfg.Encoder.MovieMaxHeight = 1080
+
+	// processFile picks the TV cap for a TV episode.
+	tv := BuildPlanWithMaxHeight(cfg, h264SDR(), cfg.Encoder.TVMaxHeight)
+	if !strings.Contains(tv.VideoFilters, "scale=-2:720") {
+		t.Errorf("TV 1080p should downscale to 720p, filters: %q", tv.VideoFilters)
+	}
+
+	// ...and the movie cap for a movie; 1080p is within it.
+	movie := BuildPlanWithMaxHeight(cfg, h264SDR(), cfg.Encoder.MovieMaxHeight)
+	if strings.Contains(movie.VideoFilters, "scale") {
+		t.Errorf("movie 1080p should not be scaled, filters: %q", movie.VideoFilters)
+	}
+}
+
+func TestBuildPlanWithMaxHeight_VAAPIHWDecode(t *testing.T) {
+	cfg := defaultCfg()
+	plan := BuildPlanWithMaxHeight(cfg, h264SDR(), 720)
+	if !plan.HWDecode {
+		t.Fatal("expected VAAPI hw decode")
+	}
+	if !strings.Contains(plan.VideoFilters, "scale_vaapi=w=-2:h=720:format=") {
+		t.Errorf("expected scale_vaapi downscale, filters: %q", plan.VideoFilters)
+	}
+}
+
+func TestBuildPlanWithMaxHeight_ForcesEncodeOfRemux(t *testing.T) {
+	cfg := defaultCfg()
+	if plan := BuildPlanWithMaxHeight(cfg, hevcEdgeSafe(), 1080); plan.Action != ActionRemux {
+		t.Errorf("1080p HEVC within cap: got %v, want remux", plan.Action)
+	}
+	if plan := BuildPlanWithMaxHeight(cfg, hevcEdgeSafe(), 720); plan.Action != ActionEncode {
+		t.Errorf("1080p HEVC over 720p cap: got %v, want encode", plan.Action)
+	}
+}
+
+func TestBuildPlan_ScaleTo(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderCPU
+	cfg.Encoder.ScaleTo = 1080
+	uhd := h264SDR()
+	uhd.PrimaryVideo.Width, uhd.PrimaryVideo.Height = 3840, 2160
+	uhd.PrimaryVideo.BitRate = 40000000
+
+	plan := BuildPlan(cfg, uhd)
+	if plan.VideoFilters != "scale=-2:1080" {
+		t.Errorf("cpu 2160p: got filters %q, want scale=-2:1080", plan.VideoFilters)
+	}
+	// Smart quality sees the 1080p output, not the 4K source.
+	if !strings.Contains(plan.QualityNote, "1920x1080") {
+		t.Errorf("quality note %q should describe the 1920x1080 output", plan.QualityNote)
+	}
+
+	// The lower of --scale-to and the per-media-type cap wins.
+	if f := BuildPlanWithMaxHeight(cfg, uhd, 720).VideoFilters; f != "scale=-2:720" {
+		t.Errorf("tv cap below --scale-to: got %q", f)
+	}
+
+	// Files at or below the cap are untouched.
+	if f := BuildPlan(cfg, h264SDR()).VideoFilters; f != "" {
+		t.Errorf("cpu 1080p: got filters %q, want none", f)
+	}
+	if plan := BuildPlan(defaultCfg(), hevcEdgeSafe()); plan.Action != ActionRemux {
+		t.Errorf("1080p HEVC: got %v, want remux", plan.Action)
+	}
+
+	// VAAPI scales on the GPU: scale_vaapi after hwupload on the software
+	// path (4:2:2 is decoded in software), scale_vaapi alone on hw decode.
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	uhd.PrimaryVideo.PixFmt = "yuv422p"
+	if f := BuildPlan(cfg, uhd).VideoFilters; !strings.HasSuffix(f, ",hwupload,scale_vaapi=w=-2:h=1080") || strings.Contains(f, "scale=-2") {
+		t.Errorf("vaapi software decode: got %q", f)
+	}
+	uhd.PrimaryVideo.PixFmt = "yuv420p"
+	if f := BuildPlan(cfg, uhd).VideoFilters; f != "scale_vaapi=w=-2:h=1080:format=p010" {
+		t.Errorf("vaapi hw decode: got %q", f)
+	}
+}
+
 // --- TimestampFix tests ---
 
+func TestBuildPlan_TimestampFixFormatAware(t *testing.T) {
+	cfg := defaultCfg()
+
+	mkv := h264SDR()
+	mkv.Format.FormatName = "matroska,webm"
+	if plan := BuildPlan(cfg, mkv); plan.TimestampFix {
+		t.Error("clean MKV encode should have TimestampFix=false by default")
+	}
+
+	ts := h264SDR()
+	ts.Format.FormatName = "mpegts"
+	if plan := BuildPlan(cfg, ts); !plan.TimestampFix {
+		t.Error(".ts encode should have TimestampFix=true by default")
+	}
+
+	vob := h264SDR()
+	vob.Format.FormatName = "mpeg"
+	if plan := BuildPlan(cfg, vob); !plan.TimestampFix {
+		t.Error("VOB encode should have TimestampFix=true by default")
+	}
+
+	cfg.CleanTimestampsAuto = false
+	cfg.CleanTimestamps = true
+	if plan := BuildPlan(cfg, mkv); !plan.TimestampFix {
+		t.Error("explicit --clean-timestamps should fix clean MKV too")
+	}
+}
+
 func TestBuildPlan_RemuxNoTimestampFix(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.CleanTimestamps = true
@@ -90,6 +244,7 @@ func TestBuildPlan_RemuxNoTimestampFix(t *testing.T) {
 
 func TestBuildPlan_EncodeRespectsCleanTimestamps(t *testing.T) {
 	cfg := defaultCfg()
+	cfg.CleanTimestampsAuto = false
 	cfg.CleanTimestamps = true
 	plan := BuildPlan(cfg, h264SDR())
 	if plan.Action != ActionEncode {
@@ -452,7 +607,7 @@ func TestEstimationDensityBias_Boundaries(t *testing.T) {
 
 func TestBuildVideoFilter_VaapiDefault(t *testing.T) {
 	cfg := defaultCfg()
-	f := BuildVideoFilter(cfg, h264SDR(), false)
+	f := BuildVideoFilter(cfg, h264SDR(), false, 0)
 	if !strings.Contains(f, "format=p010") || !strings.Contains(f, "hwupload") {
 		t.Errorf("VAAPI filter should have format+hwupload, got %q", f)
 	}
@@ -464,7 +619,7 @@ func TestBuildVideoFilter_VaapiDefault(t *testing.T) {
 func TestBuildVideoFilter_CPUNoFilter(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.Mode = config.EncoderCPU
-	f := BuildVideoFilter(cfg, h264SDR(), false)
+	f := BuildVideoFilter(cfg, h264SDR(), false, 0)
 	if f != "" {
 		t.Errorf("CPU + progressive + SDR should have no filter, got %q", f)
 	}
@@ -473,17 +628,168 @@ func TestBuildVideoFilter_CPUNoFilter(t *testing.T) {
 func TestBuildVideoFilter_Deinterlace(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.Mode = config.EncoderCPU
-	f := BuildVideoFilter(cfg, interlacedFile(), false)
+	f := BuildVideoFilter(cfg, interlacedFile(), false, 0)
 	if !strings.Contains(f, "yadif=mode=send_frame:parity=auto:deint=interlaced") {
 		t.Errorf("interlaced should have full yadif, got %q", f)
 	}
 }
 
+func TestBuildVideoFilter_FieldOrderOverride(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderCPU
+	for _, tc := range []struct {
+		order config.FieldOrder
+		want  string
+	}{
+		{config.FieldOrderAuto, "parity=auto"},
+		{config.FieldOrderTFF, "parity=0"},
+		{config.FieldOrderBFF, "parity=1"},
+	} {
+		cfg.Encoder.FieldOrder = tc.order
+		f := BuildVideoFilter(cfg, interlacedFile(), false, 0)
+		if !strings.Contains(f, "yadif=mode=send_frame:"+tc.want+":deint=interlaced") {
+			t.Errorf("--field-order %s: want %s, got %q", tc.order, tc.want, f)
+		}
+	}
+}
+
+func TestBuildPlan_FieldOrderForcesSoftwareDecode(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	if plan := BuildPlan(cfg, interlacedFile()); !plan.HWDecode {
+		t.Fatal("interlaced VAAPI encode with auto field order should use HW decode")
+	}
+	cfg.Encoder.FieldOrder = config.FieldOrderBFF
+	plan := BuildPlan(cfg, interlacedFile())
+	if plan.HWDecode {
+		t.Error("forced field order needs yadif, so software decode")
+	}
+	if !strings.Contains(plan.VideoFilters, "parity=1") {
+		t.Errorf("filters should carry parity=1, got %q", plan.VideoFilters)
+	}
+}
+
+func TestBuildVideoFilter_MeasuredScanType(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderCPU
+
+	// idet overrides a "progressive" field_order on soft-interlaced sources.
+	pr := h264SDR()
+	pr.ScanType = probe.ScanInterlaced
+	if f := BuildVideoFilter(cfg, pr, false, 0); !strings.HasPrefix(f, "yadif=") {
+		t.Errorf("measured interlaced should use yadif, got %q", f)
+	}
+
+	pr = interlacedFile()
+	pr.ScanType = probe.ScanTelecined
+	if f := BuildVideoFilter(cfg, pr, false, 0); f != "fieldmatch,decimate" {
+		t.Errorf("telecined should inverse-telecine instead of yadif, got %q", f)
+	}
+
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	if plan := BuildPlan(cfg, pr); plan.HWDecode {
+		t.Error("telecined VAAPI encode should fall back to software decode for fieldmatch")
+	}
+}
+
+func TestBuildPlan_Non420ChromaVAAPI(t *testing.T) {
+	cfg := defaultCfg()
+	pr := h264SDR()
+	pr.PrimaryVideo.Profile = "High 4:4:4 Predictive"
+	pr.PrimaryVideo.PixFmt = "yuv444p10le"
+
+	plan := BuildPlan(cfg, pr)
+	if plan.HWDecode {
+		t.Error("yuv444p10le should not use VAAPI hardware decode")
+	}
+	if plan.VideoFilters != "format=p010,hwupload" {
+		t.Errorf("expected explicit 4:2:0 conversion before hwupload, got %q", plan.VideoFilters)
+	}
+
+	pr.PrimaryVideo.PixFmt = "yuv420p10le"
+	if plan := BuildPlan(cfg, pr); !plan.HWDecode {
+		t.Error("4:2:0 sources should keep hardware decode")
+	}
+}
+
+func TestBuildPlan_TenBitTo8BitBanding(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.VaapiProfile = "main"
+	cfg.Encoder.VaapiSwFormat = "nv12"
+	pr := h264SDR()
+	pr.PrimaryVideo.Profile = "High 10"
+	pr.PrimaryVideo.PixFmt = "yuv420p10le"
+
+	plan := BuildPlan(cfg, pr)
+	if !slices.Contains(plan.Warnings, bandingNote+" (--dither-8bit to dither)") {
+		t.Errorf("10-bit to VAAPI main: want banding warning, got %q", plan.Warnings)
+	}
+	if !plan.HWDecode || strings.Contains(plan.VideoFilters, "sws_dither") {
+		t.Errorf("no --dither-8bit: want hardware decode without dither, got hwdecode %v filters %q", plan.HWDecode, plan.VideoFilters)
+	}
+
+	cfg.Encoder.Dither8Bit = true
+	plan = BuildPlan(cfg, pr)
+	if plan.HWDecode {
+		t.Error("--dither-8bit should force software decode")
+	}
+	if plan.VideoFilters != "scale=sws_dither=ed,format=nv12,hwupload" {
+		t.Errorf("filters: got %q, want dithered nv12 upload", plan.VideoFilters)
+	}
+	if !slices.Contains(plan.Warnings, bandingNote+" (dithered)") {
+		t.Errorf("dithered: got warnings %q", plan.Warnings)
+	}
+
+	cfg.Encoder.Mode = config.EncoderQSV
+	if f := BuildPlan(cfg, pr).VideoFilters; f != "scale=sws_dither=ed,format=nv12,hwupload=extra_hw_frames=64" {
+		t.Errorf("QSV: got %q, want dithered nv12 upload", f)
+	}
+	cfg.Encoder.HandleHDR = config.HDRTonemap
+	if f := BuildVideoFilter(cfg, hdr10File(), false, 0); !strings.Contains(f, "r=tv:dither=error_diffusion,format=nv12") {
+		t.Errorf("QSV tonemap: want dithering zscale, got %q", f)
+	}
+
+	// 8-bit sources and main10 targets are unaffected.
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	cfg.Encoder.HandleHDR = config.HDRPreserve
+	if plan := BuildPlan(cfg, h264SDR()); len(plan.Warnings) != 0 || strings.Contains(plan.VideoFilters, "sws_dither") {
+		t.Errorf("8-bit source: got warnings %q filters %q", plan.Warnings, plan.VideoFilters)
+	}
+	cfg.Encoder.VaapiProfile = "main10"
+	cfg.Encoder.VaapiSwFormat = "p010"
+	if plan := BuildPlan(cfg, pr); len(plan.Warnings) != 0 || !plan.HWDecode {
+		t.Errorf("main10 target: got warnings %q hwdecode %v", plan.Warnings, plan.HWDecode)
+	}
+}
+
+func TestBuildPlan_AutoCrop(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderCPU
+	pr := h264SDR()
+	pr.Crop = &probe.CropRect{W: 1920, H: 800, X: 0, Y: 140}
+
+	// The cap applies to the cropped height: 800 rows are not upscaled to 900.
+	plan := BuildPlanWithMaxHeight(cfg, pr, 900)
+	if plan.VideoFilters != "crop=1920:800:0:140" {
+		t.Errorf("cpu: got filters %q, want the crop alone", plan.VideoFilters)
+	}
+	if f := BuildPlanWithMaxHeight(cfg, pr, 720).VideoFilters; f != "crop=1920:800:0:140,scale=-2:720" {
+		t.Errorf("cpu capped: got %q, want crop then scale", f)
+	}
+
+	// VAAPI crops on CPU frames before the upload.
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	plan = BuildPlan(cfg, pr)
+	if plan.HWDecode || !strings.HasPrefix(plan.VideoFilters, "crop=1920:800:0:140,") || !strings.HasSuffix(plan.VideoFilters, "hwupload") {
+		t.Errorf("vaapi: got hwdecode %v filters %q", plan.HWDecode, plan.VideoFilters)
+	}
+}
+
 func TestBuildVideoFilter_DeinterlaceDisabled(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.DeinterlaceAuto = false
 	cfg.Encoder.Mode = config.EncoderCPU
-	f := BuildVideoFilter(cfg, interlacedFile(), false)
+	f := BuildVideoFilter(cfg, interlacedFile(), false, 0)
 	if strings.Contains(f, "yadif") {
 		t.Errorf("DeinterlaceAuto=false should not produce yadif, got %q", f)
 	}
@@ -494,18 +800,60 @@ func TestBuildVideoFilter_HDRTonemap(t *testing.T) {
 	cfg.Encoder.HandleHDR = config.HDRTonemap
 	cfg.Encoder.Mode = config.EncoderCPU
 	cfg.SkipHEVC = false
-	f := BuildVideoFilter(cfg, hdr10File(), false)
+	f := BuildVideoFilter(cfg, hdr10File(), false, 0)
 	if !strings.Contains(f, "tonemap") || !strings.Contains(f, "hable") {
 		t.Errorf("HDR tonemap should have tonemap filter, got %q", f)
 	}
 }
 
+func TestBuildVideoFilter_HDRTonemapTuning(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.HandleHDR = config.HDRTonemap
+	cfg.Encoder.Mode = config.EncoderCPU
+	f := BuildVideoFilter(cfg, hdr10File(), false, 0)
+	if !strings.Contains(f, "npl=100,") || !strings.Contains(f, "desat=0,") {
+		t.Errorf("defaults should keep npl=100 and desat=0, got %q", f)
+	}
+
+	cfg.Encoder.TonemapPeak = 250
+	cfg.Encoder.TonemapDesat = 0.5
+	f = BuildVideoFilter(cfg, hdr10File(), false, 0)
+	if !strings.Contains(f, "zscale=t=linear:npl=250,") || !strings.Contains(f, "tonemap=hable:desat=0.5,") {
+		t.Errorf("CPU chain should use tuned peak/desat, got %q", f)
+	}
+
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	cfg.Encoder.VaapiSwFormat = "nv12"
+	f = BuildVideoFilter(cfg, hdr10File(), false, 0)
+	if !strings.Contains(f, "npl=250,") || !strings.Contains(f, "desat=0.5,") || !strings.Contains(f, "format=nv12,hwupload") {
+		t.Errorf("VAAPI chain should use tuned peak/desat, got %q", f)
+	}
+}
+
+func TestBuildPlan_QSV(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.Mode = config.EncoderQSV
+	plan := BuildPlan(cfg, interlacedFile())
+	if plan.VideoCodec != "hevc_qsv" || plan.HWDecode {
+		t.Fatalf("got codec %q hwdecode %v, want hevc_qsv with software decode", plan.VideoCodec, plan.HWDecode)
+	}
+	if !strings.HasPrefix(plan.VideoFilters, "yadif=") || !strings.HasSuffix(plan.VideoFilters, ",format=nv12,hwupload=extra_hw_frames=64") {
+		t.Errorf("filters: got %q, want yadif then NV12 upload", plan.VideoFilters)
+	}
+
+	cfg.Encoder.HandleHDR = config.HDRTonemap
+	f := BuildVideoFilter(cfg, hdr10File(), false, 0)
+	if !strings.HasSuffix(f, "format=nv12,hwupload=extra_hw_frames=64") || strings.Contains(f, "nv12,format=nv12") {
+		t.Errorf("tonemapped QSV chain should end in a single nv12 upload, got %q", f)
+	}
+}
+
 func TestBuildVideoFilter_HDRPreserve(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.HandleHDR = config.HDRPreserve
 	cfg.Encoder.Mode = config.EncoderCPU
 	cfg.SkipHEVC = false
-	f := BuildVideoFilter(cfg, hdr10File(), false)
+	f := BuildVideoFilter(cfg, hdr10File(), false, 0)
 	if strings.Contains(f, "tonemap") {
 		t.Errorf("HDR preserve should NOT have tonemap, got %q", f)
 	}
@@ -515,7 +863,7 @@ func TestBuildVideoFilter_HDRPreserve(t *testing.T) {
 
 func TestBuildVideoFilter_HWDecode_FormatConversion(t *testing.T) {
 	cfg := defaultCfg()
-	f := BuildVideoFilter(cfg, h264SDR(), true)
+	f := BuildVideoFilter(cfg, h264SDR(), true, 0)
 	want := "scale_vaapi=format=p010"
 	if f != want {
 		t.Errorf("HW decode + progressive + SDR should have %q, got %q", want, f)
@@ -524,7 +872,7 @@ func TestBuildVideoFilter_HWDecode_FormatConversion(t *testing.T) {
 
 func TestBuildVideoFilter_HWDecode_Deinterlace(t *testing.T) {
 	cfg := defaultCfg()
-	f := BuildVideoFilter(cfg, interlacedFile(), true)
+	f := BuildVideoFilter(cfg, interlacedFile(), true, 0)
 	want := "deinterlace_vaapi,scale_vaapi=format=p010"
 	if f != want {
 		t.Errorf("HW decode + interlaced: want %q, got %q", want, f)
@@ -533,7 +881,7 @@ func TestBuildVideoFilter_HWDecode_Deinterlace(t *testing.T) {
 
 func TestBuildVideoFilter_HWDecode_NoHwupload(t *testing.T) {
 	cfg := defaultCfg()
-	f := BuildVideoFilter(cfg, h264SDR(), true)
+	f := BuildVideoFilter(cfg, h264SDR(), true, 0)
 	if strings.Contains(f, "hwupload") {
 		t.Errorf("HW decode should not have hwupload, got %q", f)
 	}
@@ -542,13 +890,56 @@ func TestBuildVideoFilter_HWDecode_NoHwupload(t *testing.T) {
 func TestBuildVideoFilter_HWDecode_8bitProfile(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.VaapiSwFormat = "nv12"
-	f := BuildVideoFilter(cfg, h264SDR(), true)
+	f := BuildVideoFilter(cfg, h264SDR(), true, 0)
 	want := "scale_vaapi=format=nv12"
 	if f != want {
 		t.Errorf("HW decode + main profile: want %q, got %q", want, f)
 	}
 }
 
+func TestBuildVideoFilter_Denoise(t *testing.T) {
+	yadif := "yadif=mode=send_frame:parity=auto:deint=interlaced"
+	for _, tc := range []struct {
+		level config.DenoiseLevel
+		cpu   string
+		vaapi string
+	}{
+		{config.DenoiseLight, "hqdn3d=2:1:2:3", "denoise_vaapi=denoise=8"},
+		{config.DenoiseMedium, "hqdn3d=3:2:2:3", "denoise_vaapi=denoise=16"},
+		{config.DenoiseHeavy, "hqdn3d=7:7:5:5", "denoise_vaapi=denoise=32"},
+	} {
+		cfg := defaultCfg()
+		cfg.Encoder.Denoise = tc.level
+
+		// CPU: denoise follows yadif on the software chain.
+		cfg.Encoder.Mode = config.EncoderCPU
+		if f := BuildVideoFilter(cfg, interlacedFile(), false, 0); f != yadif+","+tc.cpu {
+			t.Errorf("%s CPU: got %q", tc.level, f)
+		}
+		if f := BuildVideoFilter(cfg, h264SDR(), false, 720); f != tc.cpu+",scale=-2:720" {
+			t.Errorf("%s CPU progressive, scaled: got %q", tc.level, f)
+		}
+
+		// QSV denoises in software too, before the upload.
+		cfg.Encoder.Mode = config.EncoderQSV
+		if f := BuildVideoFilter(cfg, interlacedFile(), false, 0); f != yadif+","+tc.cpu+",format=nv12,hwupload=extra_hw_frames=64" {
+			t.Errorf("%s QSV: got %q", tc.level, f)
+		}
+
+		// VAAPI: on the surfaces after hwupload, ahead of scale_vaapi.
+		cfg.Encoder.Mode = config.EncoderVAAPI
+		if f := BuildVideoFilter(cfg, interlacedFile(), false, 0); f != yadif+",format=p010,hwupload,"+tc.vaapi {
+			t.Errorf("%s VAAPI software decode: got %q", tc.level, f)
+		}
+		if f := BuildVideoFilter(cfg, h264SDR(), false, 720); f != "format=p010,hwupload,"+tc.vaapi+",scale_vaapi=w=-2:h=720" {
+			t.Errorf("%s VAAPI software decode, scaled: got %q", tc.level, f)
+		}
+		if f := BuildVideoFilter(cfg, interlacedFile(), true, 0); f != "deinterlace_vaapi,"+tc.vaapi+",scale_vaapi=format=p010" {
+			t.Errorf("%s VAAPI HW decode: got %q", tc.level, f)
+		}
+	}
+}
+
 func TestBuildColorOpts_HDRPreserve(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.HandleHDR = config.HDRPreserve
@@ -578,6 +969,42 @@ func TestBuildHDR10Meta_Preserve(t *testing.T) {
 	}
 }
 
+func TestBuildPlan_HDR10PlusNote(t *testing.T) {
+	hdr10Plus := func() *probe.ProbeResult {
+		pr := hdr10File()
+		pr.PrimaryVideo.HDR10Plus = true
+		return pr
+	}
+	cfg := defaultCfg()
+	cfg.SkipHEVC = false // force the encode path
+	cfg.Encoder.HandleHDR = config.HDRPreserve
+
+	plan := BuildPlan(cfg, hdr10Plus())
+	if !plan.HDR10Plus || !slices.Contains(plan.Warnings, hdr10PlusLostNote) {
+		t.Errorf("preserve encode: want HDR10+ warning, got HDR10Plus=%v warnings %q", plan.HDR10Plus, plan.Warnings)
+	}
+	if plan.MasterDisplay == "" {
+		t.Error("static HDR10 metadata should still be carried")
+	}
+
+	// Remux keeps the dynamic metadata; tonemapping drops HDR on purpose.
+	cfg.SkipHEVC = true
+	if plan := BuildPlan(cfg, hdr10Plus()); plan.Action != ActionRemux || len(plan.Warnings) != 0 {
+		t.Errorf("remux: got action %s warnings %q", plan.Action, plan.Warnings)
+	}
+	cfg.SkipHEVC = false
+	cfg.Encoder.HandleHDR = config.HDRTonemap
+	if plan := BuildPlan(cfg, hdr10Plus()); slices.Contains(plan.Warnings, hdr10PlusLostNote) {
+		t.Errorf("tonemap: unexpected warnings %q", plan.Warnings)
+	}
+
+	// Plain HDR10 gets no warning.
+	cfg.Encoder.HandleHDR = config.HDRPreserve
+	if plan := BuildPlan(cfg, hdr10File()); plan.HDR10Plus || slices.Contains(plan.Warnings, hdr10PlusLostNote) {
+		t.Errorf("HDR10: got HDR10Plus=%v warnings %q", plan.HDR10Plus, plan.Warnings)
+	}
+}
+
 func TestBuildHDR10Meta_NoMetadata(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Encoder.HandleHDR = config.HDRPreserve
@@ -611,6 +1038,35 @@ func TestBuildHDR10Meta_SDR(t *testing.T) {
 	}
 }
 
+func TestBuildColorOpts_DroppedFor8BitProfile(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Encoder.HandleHDR = config.HDRPreserve
+	cfg.Encoder.VaapiProfile = "main"
+	cfg.Encoder.VaapiSwFormat = "nv12"
+	if opts := BuildColorOpts(cfg, hdr10File()); len(opts) != 0 {
+		t.Errorf("VAAPI main fallback should drop HDR color opts, got %v", opts)
+	}
+	cfg.SkipHEVC = false
+	plan := BuildPlan(cfg, hdr10File())
+	if plan.Action != ActionEncode {
+		t.Fatalf("want an encode, got %s", plan.Action)
+	}
+	if len(plan.ColorOpts) != 0 || !slices.Contains(plan.Warnings, hdrTagsDroppedNote) {
+		t.Errorf("plan: color opts %v, warnings %q", plan.ColorOpts, plan.Warnings)
+	}
+
+	cfg.Encoder.Mode = config.EncoderQSV
+	if opts := BuildColorOpts(cfg, hdr10File()); len(opts) != 0 {
+		t.Errorf("QSV encodes 8-bit main and should drop HDR color opts, got %v", opts)
+	}
+
+	cfg.Encoder.Mode = config.EncoderVAAPI
+	cfg.Encoder.VaapiProfile = "main10"
+	if opts := BuildColorOpts(cfg, hdr10File()); len(opts) != 6 {
+		t.Errorf("main10 should keep HDR color opts, got %v", opts)
+	}
+}
+
 func TestBuildColorOpts_SDR(t *testing.T) {
 	cfg := defaultCfg()
 	opts := BuildColorOpts(cfg, h264SDR())
@@ -666,6 +1122,265 @@ func TestBuildAudioPlan_MixedStreams(t *testing.T) {
 	}
 }
 
+func TestBuildAudioPlan_SkipsDegenerateStreams(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "pcm_s16le", Channels: 1, Duration: 0.02, Degenerate: true},
+			{Index: 2, Codec: "aac", Channels: 2, SampleRate: 48000, Language: "eng"},
+		},
+	}
+	ap := BuildAudioPlan(defaultCfg(), pr)
+	if ap.NoAudio || ap.CopyAll {
+		t.Fatalf("degenerate stream present: want a per-stream plan, got %+v", ap)
+	}
+	if len(ap.Streams) != 1 || ap.Streams[0].StreamIndex != 1 || !ap.Streams[0].Copy {
+		t.Fatalf("want only a:1 copied, got %+v", ap.Streams)
+	}
+
+	// The single output audio stream is the default.
+	disp := strings.Join(BuildDispositions(defaultCfg(), pr), " ")
+	if disp != "-disposition:v:0 default -disposition:a:0 default" {
+		t.Errorf("dispositions: got %q", disp)
+	}
+
+	// Only degenerate audio → no audio at all.
+	pr.AudioStreams = pr.AudioStreams[:1]
+	if ap := BuildAudioPlan(defaultCfg(), pr); !ap.NoAudio {
+		t.Errorf("only degenerate audio: want NoAudio, got %+v", ap)
+	}
+}
+
+func TestBuildAudioPlan_OpusTarget(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "opus", Channels: 2, SampleRate: 48000},
+			{Codec: "aac", Channels: 2, SampleRate: 48000},
+		},
+	}
+	cfg := defaultCfg()
+	cfg.Audio.Codec = config.AudioCodecOpus
+	ap := BuildAudioPlan(cfg, pr)
+	if ap.CopyAll || len(ap.Streams) != 2 {
+		t.Fatalf("expected a 2-stream plan, got CopyAll=%v streams=%d", ap.CopyAll, len(ap.Streams))
+	}
+	if !ap.Streams[0].Copy {
+		t.Error("stream 0 (opus) should be Copy when the target is opus")
+	}
+	if ap.Streams[1].Copy {
+		t.Error("stream 1 (aac) should be transcoded when the target is opus")
+	}
+}
+
+// multiLangAudio is a dual-audio release with a commentary track and an
+// untagged stream.
+func multiLangAudio() *probe.ProbeResult {
+	return &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "aac", Channels: 2, Language: "jpn"},
+			{Codec: "ac3", Channels: 6, Language: "eng"},
+			{Codec: "aac", Channels: 2, Language: "eng", Title: "Director's Commentary"},
+			{Codec: "aac", Channels: 2, Language: "fre"},
+			{Codec: "aac", Channels: 2},
+			{Codec: "aac", Channels: 2, Language: "eng", IsComment: true},
+		},
+	}
+}
+
+func TestKeptAudio(t *testing.T) {
+	tests := []struct {
+		name       string
+		langs      []string
+		commentary bool
+		want       []int
+	}{
+		{"no filter", nil, false, []int{0, 1, 2, 3, 4, 5}},
+		{"langs", []string{"eng", "JPN"}, false, []int{0, 1, 2, 5}},
+		{"drop commentary", nil, true, []int{0, 1, 3, 4}},
+		{"both", []string{"eng", "jpn"}, true, []int{0, 1}},
+		{"no language match keeps all", []string{"ger"}, true, []int{0, 1, 3, 4}},
+	}
+	for _, tt := range tests {
+		cfg := defaultCfg()
+		cfg.Audio.Langs = tt.langs
+		cfg.Audio.DropCommentary = tt.commentary
+		if got := KeptAudio(cfg, multiLangAudio()); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Commentary-only audio is kept rather than leaving the file silent.
+	cfg := defaultCfg()
+	cfg.Audio.DropCommentary = true
+	pr := &probe.ProbeResult{AudioStreams: []probe.AudioStream{{Codec: "aac", Channels: 2, Title: "Commentary"}}}
+	if got := KeptAudio(cfg, pr); !slices.Equal(got, []int{0}) {
+		t.Errorf("commentary-only: got %v, want [0]", got)
+	}
+}
+
+func TestBuildAudioPlan_LangsAndCommentary(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Audio.Langs = []string{"eng", "jpn"}
+	cfg.Audio.DropCommentary = true
+	pr := multiLangAudio()
+
+	plan := BuildPlan(cfg, pr)
+	ap := plan.Audio
+	if ap.CopyAll || len(ap.Streams) != 2 {
+		t.Fatalf("expected 2 planned streams, got CopyAll=%v streams=%+v", ap.CopyAll, ap.Streams)
+	}
+	if ap.Streams[0].StreamIndex != 0 || !ap.Streams[0].Copy || ap.Streams[1].StreamIndex != 1 || ap.Streams[1].Copy {
+		t.Errorf("want a:0 copied and a:1 transcoded, got %+v", ap.Streams)
+	}
+	if plan.AudioStreamCount != 2 {
+		t.Errorf("AudioStreamCount = %d, want 2", plan.AudioStreamCount)
+	}
+	if disp := strings.Join(plan.DispositionOpts, " "); strings.Contains(disp, "-disposition:a:2") {
+		t.Errorf("dispositions for dropped streams: %s", disp)
+	}
+
+	// All-AAC input narrowed to one language still cannot use -map 0:a.
+	cfg.Audio.DropCommentary = false
+	cfg.Audio.Langs = []string{"jpn"}
+	pr.AudioStreams = []probe.AudioStream{{Codec: "aac", Channels: 2, Language: "jpn"}, {Codec: "aac", Channels: 2, Language: "eng"}}
+	if ap := BuildAudioPlan(cfg, pr); ap.CopyAll || len(ap.Streams) != 1 || ap.Streams[0].StreamIndex != 0 {
+		t.Errorf("jpn only: got CopyAll=%v streams=%+v", ap.CopyAll, ap.Streams)
+	}
+}
+
+func TestBuildAudioPlan_DualAudioKeepsUntaggedUnderLangs(t *testing.T) {
+	// "Show [Dual Audio]": an English track and an untagged (Japanese) one.
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "aac", Channels: 2, Language: "eng"},
+			{Codec: "aac", Channels: 2},
+			{Codec: "aac", Channels: 2, Language: "fre"},
+		},
+	}
+	cfg := defaultCfg()
+	cfg.Audio.Langs = []string{"eng"}
+
+	if got := KeptAudio(cfg, pr); !slices.Equal(got, []int{0}) {
+		t.Errorf("not dual audio: got %v, want [0]", got)
+	}
+	cfg.Audio.DualAudio = true
+	ap := BuildAudioPlan(cfg, pr)
+	if len(ap.Streams) != 2 || ap.Streams[0].StreamIndex != 0 || ap.Streams[1].StreamIndex != 1 {
+		t.Errorf("dual audio: got %+v, want a:0 and the untagged a:1", ap.Streams)
+	}
+}
+
+func TestBuildAudioPlan_PreferredOnly(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Audio.PreferredOnly = true
+	cfg.MyLang = "eng"
+
+	// An English main track exists: only it is kept; English commentary goes too.
+	ap := BuildAudioPlan(cfg, multiLangAudio())
+	if ap.CopyAll || len(ap.Streams) != 1 || ap.Streams[0].StreamIndex != 1 {
+		t.Fatalf("eng present: got CopyAll=%v streams=%+v, want only a:1", ap.CopyAll, ap.Streams)
+	}
+
+	// No English track: every track is kept, so all-AAC input still copies whole.
+	pr := &probe.ProbeResult{AudioStreams: []probe.AudioStream{
+		{Codec: "aac", Channels: 2, Language: "jpn"},
+		{Codec: "aac", Channels: 2, Language: "fre"},
+		{Codec: "aac", Channels: 2},
+	}}
+	if ap := BuildAudioPlan(cfg, pr); !ap.CopyAll {
+		t.Errorf("eng absent: got streams=%+v, want CopyAll", ap.Streams)
+	}
+
+	// Combined with --audio-langs, the preference narrows the kept set further.
+	cfg.Audio.Langs = []string{"jpn", "fre"}
+	cfg.MyLang = "FRE"
+	if got := KeptAudio(cfg, multiLangAudio()); !slices.Equal(got, []int{3}) {
+		t.Errorf("with --audio-langs: got %v, want [3]", got)
+	}
+}
+
+func TestBuildAudioPlan_DownmixStereo(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "dts", Channels: 6, SampleRate: 48000},
+			{Codec: "truehd", Channels: 8, SampleRate: 48000},
+			{Codec: "ac3", Channels: 2, SampleRate: 48000},
+		},
+	}
+	cfg := defaultCfg()
+	cfg.Audio.Channels = 2
+	if ap := BuildAudioPlan(cfg, pr); strings.Contains(ap.Streams[0].FilterStr, "pan=") {
+		t.Errorf("pan without --downmix-stereo: %q", ap.Streams[0].FilterStr)
+	}
+
+	cfg.Audio.DownmixStereo = true
+	ap := BuildAudioPlan(cfg, pr)
+	if len(ap.Streams) != 3 {
+		t.Fatalf("expected 3 streams, got %d", len(ap.Streams))
+	}
+	fiveOne := ap.Streams[0].FilterStr
+	if !strings.HasPrefix(fiveOne, "pan=stereo|c0=c0+0.707*c2-0.8718*c4-0.4899*c5|c1=c1+0.707*c2+0.4899*c4+0.8718*c5,aresample=") {
+		t.Errorf("5.1: want the Pro Logic II pan ahead of the layout chain, got %q", fiveOne)
+	}
+	if !ap.Streams[0].NeedsFilter || ap.Streams[0].Channels != 2 {
+		t.Errorf("5.1: NeedsFilter=%v Channels=%d", ap.Streams[0].NeedsFilter, ap.Streams[0].Channels)
+	}
+	if sevenOne := ap.Streams[1].FilterStr; !strings.Contains(sevenOne, "-0.6164*c6-0.3464*c7") {
+		t.Errorf("7.1: side channels missing from pan: %q", sevenOne)
+	}
+	if stereo := ap.Streams[2].FilterStr; strings.Contains(stereo, "pan=") {
+		t.Errorf("stereo source should not be panned: %q", stereo)
+	}
+
+	// Without layout matching the pan is the whole filter; a 6-channel
+	// target keeps the source layout.
+	cfg.Audio.MatchLayout = false
+	if f := BuildAudioPlan(cfg, pr).Streams[0].FilterStr; !strings.HasPrefix(f, "pan=stereo|") || strings.Contains(f, ",") {
+		t.Errorf("pan alone: got %q", f)
+	}
+	cfg.Audio.Channels = 6
+	if f := BuildAudioPlan(cfg, pr).Streams[0].FilterStr; f != "" {
+		t.Errorf("6-channel target: got filter %q", f)
+	}
+}
+
+func TestBuildAudioPlan_CopyCompatibleMP4(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "ac3", Channels: 6, SampleRate: 48000},
+			{Codec: "dts", Channels: 6, SampleRate: 48000},
+		},
+	}
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.Audio.CopyCompatible = true
+	ap := BuildAudioPlan(cfg, pr)
+	if ap.CopyAll || len(ap.Streams) != 2 {
+		t.Fatalf("expected a 2-stream plan, got CopyAll=%v streams=%d", ap.CopyAll, len(ap.Streams))
+	}
+	if !ap.Streams[0].Copy {
+		t.Error("AC3 should be copied into MP4")
+	}
+	if ap.Streams[1].Copy {
+		t.Error("DTS should be transcoded for MP4")
+	}
+
+	cfg.OutputContainer = config.ContainerMKV
+	if ap := BuildAudioPlan(cfg, pr); !ap.CopyAll {
+		t.Error("MKV accepts AC3 and DTS: want CopyAll")
+	}
+
+	cfg.Audio.CopyCompatible = false
+	if ap := BuildAudioPlan(cfg, pr); ap.CopyAll || ap.Streams[0].Copy {
+		t.Error("without the policy, AC3 should be transcoded")
+	}
+}
+
 func TestBuildAudioPlan_AllAACLowBitrate(t *testing.T) {
 	pr := &probe.ProbeResult{
 		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
@@ -769,6 +1484,30 @@ func TestBuildAudioPlan_ChannelClamp(t *testing.T) {
 	}
 }
 
+func TestBuildAudioPlan_ChannelCapByCodec(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Audio.Channels = 2
+	cfg.Audio.ChannelsByCodec = map[string]int{"dts": 2, "eac3": 6}
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "dts", Channels: 6, SampleRate: 48000},
+			{Codec: "eac3", Channels: 6, SampleRate: 48000},
+			{Codec: "ac3", Channels: 6, SampleRate: 48000},
+		},
+	}
+	ap := BuildAudioPlan(cfg, pr)
+	if got := ap.Streams[0].Channels; got != 2 {
+		t.Errorf("dts: got %d channels, want 2", got)
+	}
+	if got := ap.Streams[1].Channels; got != 6 {
+		t.Errorf("eac3: got %d channels, want 6 (per-codec cap)", got)
+	}
+	if got := ap.Streams[2].Channels; got != 2 {
+		t.Errorf("ac3: got %d channels, want 2 (global fallback)", got)
+	}
+}
+
 func TestBuildAudioPlan_LayoutFilter(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.Audio.MatchLayout = true
@@ -816,33 +1555,207 @@ func TestBuildAudioPlan_NoLayoutFilter(t *testing.T) {
 	}
 }
 
-func TestBuildAudioPlan_HighChannelNoLayout(t *testing.T) {
-	cfg := defaultCfg()
-	cfg.Audio.MatchLayout = true
-	cfg.Audio.Channels = 6
-	pr := &probe.ProbeResult{
-		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
-		AudioStreams: []probe.AudioStream{{Codec: "dts", Channels: 6, SampleRate: 48000}},
+func TestBuildAudioPlan_HighChannelNoLayout(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.Audio.MatchLayout = true
+	cfg.Audio.Channels = 6
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{{Codec: "dts", Channels: 6, SampleRate: 48000}},
+	}
+	ap := BuildAudioPlan(cfg, pr)
+	s := ap.Streams[0]
+	if s.Layout != "" {
+		t.Errorf("6ch should have empty layout, got %q", s.Layout)
+	}
+	if !strings.Contains(s.FilterStr, "aresample") {
+		t.Error("should still have aresample filter")
+	}
+	if strings.Contains(s.FilterStr, "channel_layouts=") {
+		t.Error("6ch filter should NOT contain channel_layouts")
+	}
+}
+
+func TestBuildAudioPlan_UntaggedDualAudioKeepsBoth(t *testing.T) {
+	// Typical "Dual Audio" anime release: an English track and an untagged
+	// Japanese one. --audio-langs eng keeps both.
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		AudioStreams: []probe.AudioStream{
+			{Index: 1, Codec: "flac", Channels: 2, SampleRate: 48000, Language: "eng"},
+			{Index: 2, Codec: "flac", Channels: 2, SampleRate: 48000},
+		},
+	}
+	cfg := defaultCfg()
+	cfg.Audio.Langs = []string{"eng"}
+	cfg.Audio.DualAudio = true
+	plan := BuildPlan(cfg, pr)
+	ap := plan.Audio
+	if len(ap.Streams) != 2 || ap.Streams[0].StreamIndex != 0 || ap.Streams[1].StreamIndex != 1 {
+		t.Fatalf("expected both tracks kept, got %+v", ap.Streams)
+	}
+	if plan.AudioStreamCount != 2 {
+		t.Errorf("AudioStreamCount = %d, want 2", plan.AudioStreamCount)
+	}
+
+	// --audio-langs jpn keeps the untagged track, not the English one.
+	cfg.Audio.Langs = []string{"jpn"}
+	if got := KeptAudio(cfg, pr); !slices.Equal(got, []int{1}) {
+		t.Errorf("--audio-langs jpn: got %v, want [1]", got)
+	}
+}
+
+func TestAudioTitle(t *testing.T) {
+	cases := []struct {
+		lang     string
+		channels int
+		codec    string
+		want     string
+	}{
+		{"eng", 6, "eac3", "English 5.1 EAC3"},
+		{"jpn", 2, "aac", "Japanese Stereo AAC"},
+		{"fra", 8, "truehd", "French 7.1 TrueHD"},
+		{"und", 1, "opus", "Mono Opus"},
+		{"tha", 3, "ac3", "THA 3ch AC3"},
+	}
+	for _, tc := range cases {
+		if got := audioTitle(tc.lang, tc.channels, tc.codec); got != tc.want {
+			t.Errorf("audioTitle(%q, %d, %q) = %q, want %q", tc.lang, tc.channels, tc.codec, got, tc.want)
+		}
+	}
+}
+
+// --- BuildSubtitlePlan tests ---
+
+func TestBuildSubtitlePlan_MKVCopy(t *testing.T) {
+	sp, _ := BuildSubtitlePlan(defaultCfg(), h264SDR())
+	if !sp.Include || sp.Codec != "copy" {
+		t.Errorf("MKV: got include=%v codec=%q", sp.Include, sp.Codec)
+	}
+}
+
+func TestBuildSubtitlePlan_MKVSubtitleCodec(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 2, Codec: "ass"}, {Index: 3, Codec: "subrip"}},
+	}
+	for _, codec := range []config.SubtitleCodec{config.SubtitleCodecCopy, config.SubtitleCodecSRT, config.SubtitleCodecASS} {
+		cfg := defaultCfg()
+		cfg.SubtitleCodec = codec
+		sp, err := BuildSubtitlePlan(cfg, pr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", codec, err)
+		}
+		if !sp.Include || sp.Codec != string(codec) {
+			t.Errorf("%s: got include=%v codec=%q", codec, sp.Include, sp.Codec)
+		}
+	}
+}
+
+func TestBuildSubtitlePlan_MKVBitmapToTextError(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubtitleCodec = config.SubtitleCodecSRT
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{
+			{Index: 2, Codec: "subrip"},
+			{Index: 3, Codec: "hdmv_pgs_subtitle", IsBitmap: true},
+		},
+		HasBitmapSubs: true,
+	}
+	sp, err := BuildSubtitlePlan(cfg, pr)
+	if err == nil || !strings.Contains(err.Error(), "bitmap subtitle stream 3") {
+		t.Fatalf("expected bitmap-to-text error naming stream 3, got %v", err)
+	}
+	if sp.Include {
+		t.Error("failed conversion should not include subs")
+	}
+	if plan := BuildPlan(cfg, pr); plan.Err == nil {
+		t.Error("BuildPlan should carry the subtitle error in plan.Err")
+	}
+
+	// Copy is unaffected, and MP4 keeps skipping bitmap subs.
+	cfg.SubtitleCodec = config.SubtitleCodecCopy
+	if _, err := BuildSubtitlePlan(cfg, pr); err != nil {
+		t.Errorf("copy: unexpected error: %v", err)
+	}
+	cfg.SubtitleCodec = config.SubtitleCodecSRT
+	cfg.OutputContainer = config.ContainerMP4
+	if _, err := BuildSubtitlePlan(cfg, pr); err != nil {
+		t.Errorf("MP4 ignores --subtitle-codec: unexpected error: %v", err)
+	}
+}
+
+func TestBuildSubtitlePlan_RetryCodec(t *testing.T) {
+	text := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 2, Codec: "mov_text"}},
 	}
-	ap := BuildAudioPlan(cfg, pr)
-	s := ap.Streams[0]
-	if s.Layout != "" {
-		t.Errorf("6ch should have empty layout, got %q", s.Layout)
+	bitmap := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 2, Codec: "hdmv_pgs_subtitle", IsBitmap: true}},
+		HasBitmapSubs:   true,
 	}
-	if !strings.Contains(s.FilterStr, "aresample") {
-		t.Error("should still have aresample filter")
+	tests := []struct {
+		name      string
+		transcode bool
+		codec     config.SubtitleCodec
+		container config.Container
+		pr        *probe.ProbeResult
+		want      string
+	}{
+		{"off", false, config.SubtitleCodecCopy, config.ContainerMKV, text, ""},
+		{"mkv copy", true, config.SubtitleCodecCopy, config.ContainerMKV, text, "srt"},
+		{"mkv ass", true, config.SubtitleCodecASS, config.ContainerMKV, text, "srt"},
+		{"mkv already srt", true, config.SubtitleCodecSRT, config.ContainerMKV, text, ""},
+		{"mkv bitmap", true, config.SubtitleCodecCopy, config.ContainerMKV, bitmap, ""},
+		{"mp4 already mov_text", true, config.SubtitleCodecCopy, config.ContainerMP4, text, ""},
 	}
-	if strings.Contains(s.FilterStr, "channel_layouts=") {
-		t.Error("6ch filter should NOT contain channel_layouts")
+	for _, tt := range tests {
+		cfg := defaultCfg()
+		cfg.RetrySubTranscode = tt.transcode
+		cfg.SubtitleCodec = tt.codec
+		cfg.OutputContainer = tt.container
+		sp, err := BuildSubtitlePlan(cfg, tt.pr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if sp.RetryCodec != tt.want {
+			t.Errorf("%s: RetryCodec = %q, want %q", tt.name, sp.RetryCodec, tt.want)
+		}
 	}
 }
 
-// --- BuildSubtitlePlan tests ---
+func TestBuildPlan_FaithfulRemuxMP4Incompatible(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.FaithfulRemux = true
+	cfg.OutputContainer = config.ContainerMP4
+	base := func() *probe.ProbeResult {
+		return &probe.ProbeResult{
+			PrimaryVideo: &probe.VideoStream{Codec: "mpeg2video", Width: 720, Height: 480},
+			AudioStreams: []probe.AudioStream{{Codec: "ac3", Channels: 6}},
+		}
+	}
 
-func TestBuildSubtitlePlan_MKVCopy(t *testing.T) {
-	sp := BuildSubtitlePlan(defaultCfg(), h264SDR())
-	if !sp.Include || sp.Codec != "copy" {
-		t.Errorf("MKV: got include=%v codec=%q", sp.Include, sp.Codec)
+	if plan := BuildPlan(cfg, base()); plan.Err != nil || !plan.Faithful || plan.Action != ActionRemux {
+		t.Fatalf("compatible MP4: got faithful=%v action=%s err=%v", plan.Faithful, plan.Action, plan.Err)
+	}
+
+	pr := base()
+	pr.AudioStreams = append(pr.AudioStreams, probe.AudioStream{Codec: "truehd", Channels: 8})
+	if plan := BuildPlan(cfg, pr); plan.Err == nil || !strings.Contains(plan.Err.Error(), "truehd audio (stream a:1)") {
+		t.Errorf("TrueHD in MP4: got err %v", plan.Err)
+	}
+
+	pr = base()
+	pr.SubtitleStreams = []probe.SubtitleStream{{Index: 2, Codec: "hdmv_pgs_subtitle", IsBitmap: true}}
+	if plan := BuildPlan(cfg, pr); plan.Err == nil || !strings.Contains(plan.Err.Error(), "bitmap subtitle stream 2") {
+		t.Errorf("PGS in MP4: got err %v", plan.Err)
+	}
+
+	cfg.OutputContainer = config.ContainerMKV
+	if plan := BuildPlan(cfg, pr); plan.Err != nil {
+		t.Errorf("MKV carries everything: unexpected error %v", plan.Err)
 	}
 }
 
@@ -853,7 +1766,7 @@ func TestBuildSubtitlePlan_MP4TextSubs(t *testing.T) {
 		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
 		SubtitleStreams: []probe.SubtitleStream{{Codec: "srt"}},
 	}
-	sp := BuildSubtitlePlan(cfg, pr)
+	sp, _ := BuildSubtitlePlan(cfg, pr)
 	if !sp.Include || sp.Codec != "mov_text" {
 		t.Errorf("MP4 text: got include=%v codec=%q", sp.Include, sp.Codec)
 	}
@@ -867,7 +1780,7 @@ func TestBuildSubtitlePlan_MP4BitmapSkip(t *testing.T) {
 		SubtitleStreams: []probe.SubtitleStream{{Index: 3, Codec: "hdmv_pgs_subtitle", IsBitmap: true}},
 		HasBitmapSubs:   true,
 	}
-	sp := BuildSubtitlePlan(cfg, pr)
+	sp, _ := BuildSubtitlePlan(cfg, pr)
 	if sp.Include {
 		t.Error("MP4 with only bitmap subs should not include subs")
 	}
@@ -885,7 +1798,7 @@ func TestBuildSubtitlePlan_MP4MixedSubs(t *testing.T) {
 		},
 		HasBitmapSubs: true,
 	}
-	sp := BuildSubtitlePlan(cfg, pr)
+	sp, _ := BuildSubtitlePlan(cfg, pr)
 	if !sp.Include {
 		t.Fatal("MP4 with mixed subs should include text subs")
 	}
@@ -895,18 +1808,82 @@ func TestBuildSubtitlePlan_MP4MixedSubs(t *testing.T) {
 	if !sp.SkipBitmap {
 		t.Error("SkipBitmap should be true when bitmap subs are present")
 	}
-	if len(sp.TextIdxs) != 2 {
-		t.Fatalf("TextIdxs: got %v, want 2 entries", sp.TextIdxs)
+	if len(sp.StreamIdxs) != 2 {
+		t.Fatalf("StreamIdxs: got %v, want 2 entries", sp.StreamIdxs)
+	}
+	if sp.StreamIdxs[0] != 4 || sp.StreamIdxs[1] != 5 {
+		t.Errorf("StreamIdxs: got %v, want [4 5]", sp.StreamIdxs)
+	}
+}
+
+func jpnAndEngSubs() *probe.ProbeResult {
+	return &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{
+			{Index: 2, Codec: "ass", Language: "jpn"},
+			{Index: 3, Codec: "hdmv_pgs_subtitle", Language: "eng", IsBitmap: true},
+			{Index: 4, Codec: "subrip", Language: "eng"},
+		},
+		HasBitmapSubs: true,
+	}
+}
+
+func TestBuildSubtitlePlan_SubLangsFilter(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubLangs = []string{"eng"}
+	sp, _ := BuildSubtitlePlan(cfg, jpnAndEngSubs())
+	if !sp.Include || !sp.Selective() || len(sp.StreamIdxs) != 2 || sp.StreamIdxs[0] != 3 || sp.StreamIdxs[1] != 4 {
+		t.Errorf("MKV --sub-langs eng: got %+v, want streams [3 4]", sp)
+	}
+
+	// MP4 applies the language filter, then drops the eng bitmap stream.
+	cfg.OutputContainer = config.ContainerMP4
+	sp, _ = BuildSubtitlePlan(cfg, jpnAndEngSubs())
+	if !sp.Include || sp.Codec != "mov_text" || !sp.SkipBitmap || len(sp.StreamIdxs) != 1 || sp.StreamIdxs[0] != 4 {
+		t.Errorf("MP4 --sub-langs eng: got %+v, want mov_text stream [4]", sp)
+	}
+
+	// --subtitle-codec srt only sees the jpn text stream, so no bitmap error.
+	cfg.OutputContainer = config.ContainerMKV
+	cfg.SubtitleCodec = config.SubtitleCodecSRT
+	cfg.SubLangs = []string{"jpn"}
+	if sp, err := BuildSubtitlePlan(cfg, jpnAndEngSubs()); err != nil || len(sp.StreamIdxs) != 1 {
+		t.Errorf("filtered-out bitmap should not block conversion: sp=%+v err=%v", sp, err)
 	}
-	if sp.TextIdxs[0] != 4 || sp.TextIdxs[1] != 5 {
-		t.Errorf("TextIdxs: got %v, want [4 5]", sp.TextIdxs)
+}
+
+func TestBuildSubtitlePlan_OnlyIfPresentLangs(t *testing.T) {
+	pr := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 2, Codec: "ass", Language: "jpn"}, {Index: 3, Codec: "subrip"}},
+	}
+	for _, container := range []config.Container{config.ContainerMKV, config.ContainerMP4} {
+		cfg := defaultCfg()
+		cfg.OutputContainer = container
+		cfg.SubLangs = []string{"eng"}
+
+		// Default: no match falls back to keeping every stream.
+		sp, _ := BuildSubtitlePlan(cfg, pr)
+		if !sp.Include || sp.Selective() {
+			t.Errorf("%s fallback: got %+v, want all subs kept", container, sp)
+		}
+
+		cfg.SubsOnlyIfPresentLangs = true
+		sp, _ = BuildSubtitlePlan(cfg, pr)
+		if sp.Include {
+			t.Errorf("%s --subtitles-only-if-present-langs: got %+v, want no subtitle output", container, sp)
+		}
+		plan := BuildPlan(cfg, pr)
+		if plan.Subtitles.Include || plan.Subtitles.DispositionOpts != nil {
+			t.Errorf("%s: plan should carry no subtitles, got %+v", container, plan.Subtitles)
+		}
 	}
 }
 
 func TestBuildSubtitlePlan_Disabled(t *testing.T) {
 	cfg := defaultCfg()
 	cfg.KeepSubtitles = false
-	sp := BuildSubtitlePlan(cfg, h264SDR())
+	sp, _ := BuildSubtitlePlan(cfg, h264SDR())
 	if sp.Include {
 		t.Error("KeepSubtitles=false should not include subs")
 	}
@@ -914,12 +1891,59 @@ func TestBuildSubtitlePlan_Disabled(t *testing.T) {
 
 func TestBuildSubtitlePlan_NoSubs(t *testing.T) {
 	pr := &probe.ProbeResult{PrimaryVideo: &probe.VideoStream{Codec: "h264"}}
-	sp := BuildSubtitlePlan(defaultCfg(), pr)
+	sp, _ := BuildSubtitlePlan(defaultCfg(), pr)
 	if sp.Include {
 		t.Error("no subtitle streams should not include subs")
 	}
 }
 
+func TestAddSidecarSubtitles_MKVWithEmbedded(t *testing.T) {
+	cfg := defaultCfg()
+	pr := h264SDR()
+	plan := BuildPlan(cfg, pr)
+	AddSidecarSubtitles(cfg, pr, plan, []SidecarSubtitle{{Path: "/in/a.eng.srt", Language: "eng"}})
+
+	sp := plan.Subtitles
+	if !sp.Include || sp.SidecarOnly {
+		t.Errorf("include=%v sidecarOnly=%v, want embedded + sidecar", sp.Include, sp.SidecarOnly)
+	}
+	if sp.EmbeddedCount != 1 {
+		t.Errorf("EmbeddedCount: got %d, want 1", sp.EmbeddedCount)
+	}
+	if len(sp.Sidecars) != 1 {
+		t.Errorf("Sidecars: got %v", sp.Sidecars)
+	}
+}
+
+func TestAddSidecarSubtitles_MP4BitmapOnly(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	pr := &probe.ProbeResult{
+		PrimaryVideo:    &probe.VideoStream{Codec: "h264"},
+		SubtitleStreams: []probe.SubtitleStream{{Index: 3, Codec: "hdmv_pgs_subtitle", IsBitmap: true}},
+		HasBitmapSubs:   true,
+	}
+	plan := BuildPlan(cfg, pr)
+	AddSidecarSubtitles(cfg, pr, plan, []SidecarSubtitle{{Path: "/in/a.srt"}})
+
+	sp := plan.Subtitles
+	if !sp.Include || !sp.SidecarOnly || sp.Codec != "mov_text" {
+		t.Errorf("got include=%v sidecarOnly=%v codec=%q, want sidecar-only mov_text",
+			sp.Include, sp.SidecarOnly, sp.Codec)
+	}
+}
+
+func TestAddSidecarSubtitles_Disabled(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.KeepSubtitles = false
+	pr := h264SDR()
+	plan := BuildPlan(cfg, pr)
+	AddSidecarSubtitles(cfg, pr, plan, []SidecarSubtitle{{Path: "/in/a.srt"}})
+	if plan.Subtitles.Include || len(plan.Subtitles.Sidecars) != 0 {
+		t.Error("--no-subs should drop sidecars")
+	}
+}
+
 // --- BuildDispositions tests ---
 
 func TestBuildDispositions_SingleAudio(t *testing.T) {
@@ -927,7 +1951,7 @@ func TestBuildDispositions_SingleAudio(t *testing.T) {
 		PrimaryVideo: &probe.VideoStream{Codec: "h264"},
 		AudioStreams: []probe.AudioStream{{Codec: "aac"}},
 	}
-	opts := BuildDispositions(pr)
+	opts := BuildDispositions(defaultCfg(), pr)
 	if len(opts) != 4 { // -disposition:v:0 default -disposition:a:0 default
 		t.Errorf("expected 4 opts, got %d: %v", len(opts), opts)
 	}
@@ -940,7 +1964,7 @@ func TestBuildDispositions_MultiAudio(t *testing.T) {
 			{Codec: "aac"}, {Codec: "ac3"}, {Codec: "dts"},
 		},
 	}
-	opts := BuildDispositions(pr)
+	opts := BuildDispositions(defaultCfg(), pr)
 	// v:0=default, a:0=default, a:1=0, a:2=0 → 8 args
 	if len(opts) != 8 {
 		t.Errorf("expected 8 opts for 3 audio, got %d: %v", len(opts), opts)
@@ -949,12 +1973,208 @@ func TestBuildDispositions_MultiAudio(t *testing.T) {
 
 func TestBuildDispositions_NoAudio(t *testing.T) {
 	pr := &probe.ProbeResult{PrimaryVideo: &probe.VideoStream{Codec: "h264"}}
-	opts := BuildDispositions(pr)
+	opts := BuildDispositions(defaultCfg(), pr)
 	if len(opts) != 2 { // v:0=default only
 		t.Errorf("expected 2 opts for no audio, got %d: %v", len(opts), opts)
 	}
 }
 
+func dualSubsFile(audioLang string) *probe.ProbeResult {
+	return &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", Width: 1920, Height: 1080},
+		AudioStreams: []probe.AudioStream{{Index: 1, Codec: "aac", Language: audioLang}},
+		SubtitleStreams: []probe.SubtitleStream{
+			{Index: 2, Codec: "ass", Language: "jpn"},
+			{Index: 3, Codec: "ass", Language: "eng"},
+		},
+	}
+}
+
+func TestBuildSubtitleDispositions_ForeignAudio(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubsDefaultByAudioLang = true
+	plan := BuildPlan(cfg, dualSubsFile("jpn"))
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	want := "-disposition:s:0 0 -disposition:s:1 default"
+	if got != want {
+		t.Errorf("jpn audio: got %q, want %q", got, want)
+	}
+}
+
+func TestBuildSubtitleDispositions_NativeAudio(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubsDefaultByAudioLang = true
+	plan := BuildPlan(cfg, dualSubsFile("eng"))
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	want := "-disposition:s:0 0 -disposition:s:1 0"
+	if got != want {
+		t.Errorf("eng audio: got %q, want %q", got, want)
+	}
+}
+
+func TestBuildSubtitleDispositions_Off(t *testing.T) {
+	if opts := BuildPlan(defaultCfg(), dualSubsFile("jpn")).Subtitles.DispositionOpts; opts != nil {
+		t.Errorf("policy off: expected no subtitle dispositions, got %v", opts)
+	}
+}
+
+func TestBuildSubtitleDispositions_MP4TextOnlyIndices(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubsDefaultByAudioLang = true
+	cfg.OutputContainer = config.ContainerMP4
+	pr := dualSubsFile("jpn")
+	pr.SubtitleStreams[0] = probe.SubtitleStream{Index: 2, Codec: "hdmv_pgs_subtitle", Language: "eng", IsBitmap: true}
+	pr.HasBitmapSubs = true
+	plan := BuildPlan(cfg, pr)
+	// Only the text eng stream (source index 3) is mapped, as output s:0.
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	if got != "-disposition:s:0 default" {
+		t.Errorf("MP4 text-only: got %q", got)
+	}
+}
+
+func TestBuildSubtitleDispositions_MP4ForcedFromSource(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	pr := dualSubsFile("jpn")
+	pr.SubtitleStreams = []probe.SubtitleStream{
+		{Index: 2, Codec: "hdmv_pgs_subtitle", Language: "jpn", IsBitmap: true, IsDefault: true},
+		{Index: 3, Codec: "subrip", Language: "jpn"},
+		{Index: 4, Codec: "subrip", Language: "eng", IsForced: true},
+	}
+	pr.HasBitmapSubs = true
+	plan := BuildPlan(cfg, pr)
+	// The bitmap stream is dropped, so source 3 and 4 become s:0 and s:1.
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	want := "-disposition:s:0 0 -disposition:s:1 forced"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildSubtitleDispositions_MP4PolicyKeepsForced(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.SubsDefaultByAudioLang = true
+	pr := dualSubsFile("jpn")
+	pr.SubtitleStreams[0].IsDefault = true
+	pr.SubtitleStreams[1].IsForced = true
+	plan := BuildPlan(cfg, pr)
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	want := "-disposition:s:0 0 -disposition:s:1 default+forced"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildSubtitlePlan_SubLangsWithDefaultSub(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.SubLangs = []string{"eng", "fre"}
+	cfg.DefaultSubLang = "fre"
+	pr := dualSubsFile("eng")
+	pr.SubtitleStreams = []probe.SubtitleStream{
+		{Index: 2, Codec: "ass", Language: "jpn", IsDefault: true},
+		{Index: 3, Codec: "ass", Language: "eng", IsDefault: true},
+		{Index: 4, Codec: "ass", Language: "fre"},
+	}
+	plan := BuildPlan(cfg, pr)
+	if !slices.Equal(plan.Subtitles.StreamIdxs, []int{3, 4}) {
+		t.Fatalf("kept streams: got %v, want [3 4]", plan.Subtitles.StreamIdxs)
+	}
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	want := "-disposition:s:0 0 -disposition:s:1 default"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildSubtitleDispositions_DefaultSub(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.DefaultSubLang = "JPN"
+	// --default-sub wins over --keep-subs-langs-default (which would pick eng).
+	cfg.SubsDefaultByAudioLang = true
+	plan := BuildPlan(cfg, dualSubsFile("jpn"))
+	got := strings.Join(plan.Subtitles.DispositionOpts, " ")
+	if want := "-disposition:s:0 default -disposition:s:1 0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// No subtitle in the language: the source dispositions are kept.
+	cfg = defaultCfg()
+	cfg.DefaultSubLang = "ger"
+	if opts := BuildPlan(cfg, dualSubsFile("jpn")).Subtitles.DispositionOpts; opts != nil {
+		t.Errorf("no match: expected no subtitle dispositions, got %v", opts)
+	}
+}
+
+// --- Replace-container-only tests ---
+
+func TestKeepMKVForBitmapSubs(t *testing.T) {
+	// Edge-safe HEVC with AC3 audio (transcoded) and PGS subtitles, targeting MP4.
+	pgsHEVC := func() *probe.ProbeResult {
+		pr := hevcEdgeSafe()
+		pr.AudioStreams = []probe.AudioStream{{Codec: "ac3", Channels: 6, SampleRate: 48000}}
+		pr.SubtitleStreams = []probe.SubtitleStream{
+			{Index: 2, Codec: "hdmv_pgs_subtitle", Language: "eng", IsBitmap: true},
+			{Index: 3, Codec: "subrip", Language: "eng"},
+		}
+		return pr
+	}
+	cfg := defaultCfg()
+	cfg.OutputContainer = config.ContainerMP4
+	cfg.ReplaceContainerOnly = true
+
+	keep, reason := KeepMKVForBitmapSubs(cfg, pgsHEVC(), 0)
+	if !keep || !strings.Contains(reason, "1 bitmap subtitle") {
+		t.Fatalf("want MKV kept, got %v %q", keep, reason)
+	}
+	// The MP4 plan would drop the PGS stream; the MKV plan keeps it and
+	// still only remuxes the video.
+	mp4Plan := BuildPlan(cfg, pgsHEVC())
+	if !mp4Plan.Subtitles.SkipBitmap {
+		t.Error("MP4 plan should drop the bitmap subtitle")
+	}
+	mkvCfg := *cfg
+	mkvCfg.OutputContainer = config.ContainerMKV
+	mkvPlan := BuildPlan(&mkvCfg, pgsHEVC())
+	if mkvPlan.Action != ActionRemux || mkvPlan.Subtitles.Codec != "copy" || mkvPlan.Subtitles.SkipBitmap {
+		t.Errorf("MKV plan: got action %s subs %+v, want remux with all subs copied", mkvPlan.Action, mkvPlan.Subtitles)
+	}
+	if mkvPlan.Audio.CopyAll || len(mkvPlan.Audio.Streams) != 1 || mkvPlan.Audio.Streams[0].Copy {
+		t.Errorf("AC3 audio should still be transcoded: %+v", mkvPlan.Audio)
+	}
+
+	cases := []struct {
+		name   string
+		mutate func(*config.Config, *probe.ProbeResult)
+		height int
+	}{
+		{"flag off", func(c *config.Config, _ *probe.ProbeResult) { c.ReplaceContainerOnly = false }, 0},
+		{"MKV target", func(c *config.Config, _ *probe.ProbeResult) { c.OutputContainer = config.ContainerMKV }, 0},
+		{"no subs", func(c *config.Config, _ *probe.ProbeResult) { c.KeepSubtitles = false }, 0},
+		{"re-encoding HEVC", func(c *config.Config, _ *probe.ProbeResult) { c.SkipHEVC = false }, 0},
+		{"h264 video", func(_ *config.Config, pr *probe.ProbeResult) { pr.PrimaryVideo.Codec = "h264" }, 0},
+		{"unsafe HEVC", func(_ *config.Config, pr *probe.ProbeResult) { pr.PrimaryVideo.Profile = "Rext" }, 0},
+		{"downscaled", func(*config.Config, *probe.ProbeResult) {}, 720},
+		{"text subs only", func(_ *config.Config, pr *probe.ProbeResult) { pr.SubtitleStreams = pr.SubtitleStreams[1:] }, 0},
+		{"bitmap outside --sub-langs", func(c *config.Config, pr *probe.ProbeResult) {
+			c.SubLangs = []string{"jpn"}
+			c.SubsOnlyIfPresentLangs = true
+			pr.SubtitleStreams = append(pr.SubtitleStreams, probe.SubtitleStream{Index: 4, Codec: "ass", Language: "jpn"})
+		}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := *cfg
+			pr := pgsHEVC()
+			tc.mutate(&c, pr)
+			if keep, reason := KeepMKVForBitmapSubs(&c, pr, tc.height); keep {
+				t.Errorf("want target container kept, got MKV (%s)", reason)
+			}
+		})
+	}
+}
+
 // --- BuildAttachmentPlan tests ---
 
 func TestBuildAttachmentPlan_MKV(t *testing.T) {
@@ -1575,6 +2795,39 @@ func TestAudioCopy_AACAlwaysPassthrough(t *testing.T) {
 	}
 }
 
+func TestAudioCopy_AACCopyMax(t *testing.T) {
+	cfg := defaultCfg()
+	pr := &probe.ProbeResult{
+		PrimaryVideo: &probe.VideoStream{Codec: "h264", Width: 1920, Height: 1080, BitRate: 8000000},
+		AudioStreams: []probe.AudioStream{
+			{Codec: "aac", Channels: 2, BitRate: 256_000},
+			{Codec: "ac3", Channels: 6, BitRate: 448_000},
+		},
+	}
+
+	cfg.Audio.AACCopyMaxKbps = 320
+	ap := BuildAudioPlan(cfg, pr)
+	if len(ap.Streams) != 2 || !ap.Streams[0].Copy {
+		t.Errorf("256k AAC should be copied at threshold 320, got %+v", ap.Streams)
+	}
+	if ap := BuildAudioPlan(cfg, &probe.ProbeResult{AudioStreams: pr.AudioStreams[:1]}); !ap.CopyAll {
+		t.Error("all-AAC under the threshold should still be CopyAll")
+	}
+
+	cfg.Audio.AACCopyMaxKbps = 192
+	ap = BuildAudioPlan(cfg, pr)
+	if len(ap.Streams) != 2 || ap.Streams[0].Copy || ap.Streams[0].Bitrate != cfg.Audio.Bitrate {
+		t.Errorf("256k AAC should be transcoded at threshold 192, got %+v", ap.Streams)
+	}
+	if ap := BuildAudioPlan(cfg, &probe.ProbeResult{AudioStreams: pr.AudioStreams[:1]}); ap.CopyAll {
+		t.Error("all-AAC over the threshold must not be CopyAll")
+	}
+	unknown := &probe.ProbeResult{AudioStreams: []probe.AudioStream{{Codec: "aac", Channels: 2}}}
+	if ap := BuildAudioPlan(cfg, unknown); !ap.CopyAll {
+		t.Error("AAC with unknown bitrate should be copied")
+	}
+}
+
 func TestAudioCopy_NonAACTranscoded(t *testing.T) {
 	cfg := defaultCfg()
 
@@ -1594,6 +2847,233 @@ func TestAudioCopy_NonAACTranscoded(t *testing.T) {
 	}
 }
 
+// --- Burn-in subtitle tests ---
+
+func TestBuildPlan_BurnSubsText(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.BurnSubs = true
+	pr := hevcEdgeSafe()
+	pr.Format.Filename = "/in/Show: Part 1, [x].mkv"
+	pr.SubtitleStreams = []probe.SubtitleStream{
+		{Index: 2, Codec: "ass", Language: "jpn"},
+		{Index: 3, Codec: "subrip", Language: "eng", IsDefault: true},
+	}
+
+	plan := BuildPlan(cfg, pr)
+	if plan.Action != ActionEncode || plan.BurnSub == nil || plan.BurnSub.Index != 3 {
+		t.Fatalf("remuxable HEVC should encode to burn the default subtitle, got %s burn %+v", plan.Action, plan.BurnSub)
+	}
+	if plan.HWDecode {
+		t.Error("burn-in should use software decode")
+	}
+	want := `subtitles=filename=/in/Show\\: Part 1\, \[x\].mkv:si=1,format=p010,hwupload`
+	if plan.VideoFilters != want || plan.VideoFilterComplex != "" {
+		t.Errorf("filters: got %q (complex %q), want %q", plan.VideoFilters, plan.VideoFilterComplex, want)
+	}
+	if !slices.Equal(plan.Subtitles.StreamIdxs, []int{2}) || !plan.Subtitles.Selective() {
+		t.Errorf("burned stream should leave the soft-sub map, got %v", plan.Subtitles.StreamIdxs)
+	}
+
+	cfg.BurnSubsLang = "ger"
+	if plan := BuildPlan(cfg, pr); plan.Action != ActionRemux || plan.BurnSub != nil {
+		t.Errorf("no subtitle in the language: want a plain remux, got %s burn %+v", plan.Action, plan.BurnSub)
+	}
+}
+
+func TestBuildBurnInFilters_Order(t *testing.T) {
+	cfg := defaultCfg()
+	pr := interlacedFile()
+	pr.Format.Filename = "/in/a.mkv"
+	text := BurnSubtitle{Index: 2, SubIndex: 0}
+
+	// Drawn after deinterlace, before the VAAPI upload and GPU downscale.
+	vf, graph := BuildBurnInFilters(cfg, pr, text, 0, 360)
+	want := "yadif=mode=send_frame:parity=auto:deint=interlaced,subtitles=filename=/in/a.mkv:si=0,format=p010,hwupload,scale_vaapi=w=-2:h=360"
+	if vf != want || graph != "" {
+		t.Errorf("text: got %q (graph %q), want %q", vf, graph, want)
+	}
+
+	bitmap := BurnSubtitle{Index: 3, SubIndex: 1, Bitmap: true}
+	_, graph = BuildBurnInFilters(cfg, pr, bitmap, 0, 360)
+	want = "[0:0]yadif=mode=send_frame:parity=auto:deint=interlaced[base];[base][0:3]overlay=eof_action=pass,format=p010,hwupload,scale_vaapi=w=-2:h=360[vout]"
+	if graph != want {
+		t.Errorf("bitmap VAAPI: got %q, want %q", graph, want)
+	}
+
+	cfg.Encoder.Mode = config.EncoderCPU
+	vf, graph = BuildBurnInFilters(cfg, h264SDR(), bitmap, 0, 0)
+	if vf != "" || graph != "[0:0][0:3]overlay=eof_action=pass[vout]" {
+		t.Errorf("bitmap CPU: got vf %q graph %q", vf, graph)
+	}
+}
+
+func TestBuildPlan_BurnSubsBitmapByLang(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.BurnSubs = true
+	cfg.BurnSubsLang = "eng"
+	cfg.OutputContainer = config.ContainerMP4
+	pr := h264SDR()
+	pr.SubtitleStreams = []probe.SubtitleStream{
+		{Index: 2, Codec: "subrip", Language: "jpn", IsDefault: true},
+		{Index: 3, Codec: "hdmv_pgs_subtitle", Language: "eng", IsBitmap: true},
+	}
+	pr.HasBitmapSubs = true
+
+	plan := BuildPlan(cfg, pr)
+	if plan.BurnSub == nil || plan.BurnSub.Index != 3 || !plan.BurnSub.Bitmap {
+		t.Fatalf("want the eng PGS stream burned, got %+v", plan.BurnSub)
+	}
+	if plan.VideoFilters != "" || plan.VideoFilterComplex != "[0:0][0:3]overlay=eof_action=pass,format=p010,hwupload[vout]" {
+		t.Errorf("got vf %q complex %q", plan.VideoFilters, plan.VideoFilterComplex)
+	}
+	if !slices.Equal(plan.Subtitles.StreamIdxs, []int{2}) {
+		t.Errorf("MP4 soft subs: got %v, want [2]", plan.Subtitles.StreamIdxs)
+	}
+}
+
+// --- Skip-optimized tests ---
+
+func TestIsAlreadyOptimized_Accepts(t *testing.T) {
+	cfg := defaultCfg()
+	ok, reason := IsAlreadyOptimized(cfg, optimizedMKV())
+	if !ok {
+		t.Fatalf("expected optimized, got reason %q", reason)
+	}
+
+	// AV1 with Opus and HDR under preserve also qualifies.
+	pr := optimizedMKV()
+	pr.PrimaryVideo.Codec = "av1"
+	pr.PrimaryVideo.Profile = "Main"
+	pr.PrimaryVideo.ColorTransfer = "smpte2084"
+	pr.AudioStreams[0].Codec = "opus"
+	if ok, reason := IsAlreadyOptimized(cfg, pr); !ok {
+		t.Errorf("AV1/Opus HDR: expected optimized, got reason %q", reason)
+	}
+}
+
+func TestIsAlreadyOptimized_Rejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(cfg *config.Config, pr *probe.ProbeResult)
+	}{
+		{"container", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.Format.FormatName = "mov,mp4,m4a,3gp,3g2,mj2"
+		}},
+		{"hls target", func(cfg *config.Config, _ *probe.ProbeResult) {
+			cfg.OutputContainer = config.ContainerHLS
+		}},
+		{"h264 video", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.PrimaryVideo.Codec = "h264"
+		}},
+		{"unsafe hevc", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.PrimaryVideo.PixFmt = "yuv444p10le"
+		}},
+		{"interlaced", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.PrimaryVideo.FieldOrder = "tt"
+		}},
+		{"hdr tonemap", func(cfg *config.Config, pr *probe.ProbeResult) {
+			pr.PrimaryVideo.ColorTransfer = "smpte2084"
+			cfg.Encoder.HandleHDR = config.HDRTonemap
+		}},
+		{"non-aac audio", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.AudioStreams = append(pr.AudioStreams, probe.AudioStream{Codec: "dts", Channels: 6})
+		}},
+		{"audio over bitrate", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.AudioStreams[0].BitRate = 640000
+		}},
+		{"no video", func(_ *config.Config, pr *probe.ProbeResult) {
+			pr.PrimaryVideo = nil
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaultCfg()
+			pr := optimizedMKV()
+			tc.mutate(cfg, pr)
+			if ok, _ := IsAlreadyOptimized(cfg, pr); ok {
+				t.Error("expected not optimized")
+			}
+		})
+	}
+}
+
+func TestBuildPlan_SkipOptimized(t *testing.T) {
+	cfg := defaultCfg()
+	if plan := BuildPlan(cfg, optimizedMKV()); plan.Action == ActionSkip {
+		t.Fatal("should not skip without --skip-optimized")
+	}
+
+	cfg.SkipOptimized = true
+	plan := BuildPlan(cfg, optimizedMKV())
+	if plan.Action != ActionSkip {
+		t.Fatalf("action: got %v, want ActionSkip", plan.Action)
+	}
+	if plan.SkipReason == "" {
+		t.Error("SkipReason should be set")
+	}
+	if plan := BuildPlan(cfg, h264SDR()); plan.Action != ActionEncode {
+		t.Errorf("h264 source: got %v, want ActionEncode", plan.Action)
+	}
+}
+
+func TestBuildPlan_HeightBounds(t *testing.T) {
+	withHeight := func(h int) *probe.ProbeResult {
+		pr := h264SDR()
+		pr.PrimaryVideo.Width, pr.PrimaryVideo.Height = h*16/9, h
+		return pr
+	}
+
+	cfg := defaultCfg()
+	cfg.MaxHeight = 1080
+	plan := BuildPlan(cfg, withHeight(2160))
+	if plan.Action != ActionSkip || plan.SkipReason != "2160p above --max-height 1080" {
+		t.Errorf("2160p over max: got %v %q, want skip", plan.Action, plan.SkipReason)
+	}
+	if plan := BuildPlan(cfg, withHeight(1080)); plan.Action != ActionEncode {
+		t.Errorf("1080p at max: got %v, want ActionEncode", plan.Action)
+	}
+
+	cfg = defaultCfg()
+	cfg.MinHeight = 720
+	plan = BuildPlan(cfg, withHeight(480))
+	if plan.Action != ActionSkip || plan.SkipReason != "480p below --min-height 720" {
+		t.Errorf("480p under min: got %v %q, want skip", plan.Action, plan.SkipReason)
+	}
+	if plan := BuildPlan(cfg, withHeight(720)); plan.Action != ActionEncode {
+		t.Errorf("720p at min: got %v, want ActionEncode", plan.Action)
+	}
+}
+
+func TestBuildPlan_MinBitrateKbps(t *testing.T) {
+	cfg := defaultCfg()
+	cfg.MinBitrateKbps = 2000
+
+	low := h264SDR()
+	low.PrimaryVideo.BitRate = 1_500_000
+	plan := BuildPlan(cfg, low)
+	if plan.Action != ActionSkip || !strings.HasPrefix(plan.SkipReason, "source bitrate below threshold") {
+		t.Errorf("1500 kbps h264: got %v %q, want skip", plan.Action, plan.SkipReason)
+	}
+
+	if plan := BuildPlan(cfg, h264SDR()); plan.Action != ActionEncode {
+		t.Errorf("8000 kbps h264: got %v, want ActionEncode", plan.Action)
+	}
+
+	unknown := h264SDR()
+	unknown.PrimaryVideo.BitRate = 0
+	unknown.Format.BitRate = 0
+	if plan := BuildPlan(cfg, unknown); plan.Action != ActionEncode {
+		t.Errorf("unknown bitrate: got %v, want ActionEncode", plan.Action)
+	}
+
+	remux := hevcEdgeSafe()
+	remux.PrimaryVideo.BitRate = 1_000_000
+	cfg.SkipHEVC = true
+	if plan := BuildPlan(cfg, remux); plan.Action != ActionRemux {
+		t.Errorf("low-bitrate remux: got %v, want ActionRemux (threshold only skips encodes)", plan.Action)
+	}
+}
+
 // --- Comprehensive bitrate×resolution debug matrix ---
 // This exercises the FULL pipeline (SmartQuality → OptimalBitrate → target
 // QP/CRF → preflight → maxrate) for every realistic scenario to verify:
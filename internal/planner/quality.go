@@ -23,6 +23,13 @@ type QualityResult struct {
 // When a manual quality override is active, the override values are returned
 // unchanged. When smart quality is disabled, config defaults are returned.
 func SmartQuality(cfg *config.Config, pr *probe.ProbeResult) QualityResult {
+	return SmartQualityAtHeight(cfg, pr, 0)
+}
+
+// SmartQualityAtHeight is SmartQuality for the encoded picture rather than
+// the source: the resolution and density curves see the pixel count after
+// the --auto-crop crop and the downscale to maxHeight (0 = no cap).
+func SmartQualityAtHeight(cfg *config.Config, pr *probe.ProbeResult, maxHeight int) QualityResult {
 	if cfg.Encoder.ActiveQualityOverride != "" {
 		return QualityResult{
 			VaapiQP: cfg.Encoder.VaapiQP,
@@ -39,12 +46,11 @@ func SmartQuality(cfg *config.Config, pr *probe.ProbeResult) QualityResult {
 		}
 	}
 
-	v := pr.PrimaryVideo
 	var pixels int
 	resLabel := "unknown"
-	if v != nil && v.Width > 0 && v.Height > 0 {
-		pixels = v.Width * v.Height
-		resLabel = fmt.Sprintf("%dx%d", v.Width, v.Height)
+	if w, h := outputSize(pr, maxHeight); w > 0 && h > 0 {
+		pixels = w * h
+		resLabel = fmt.Sprintf("%dx%d", w, h)
 	}
 
 	bitrateKbps := int(pr.VideoBitRate() / 1000)
@@ -103,7 +109,7 @@ func vaapiBitrateCurve(kbps int) int {
 }
 
 func modeLabel(cfg *config.Config) string {
-	if cfg.Encoder.Mode == config.EncoderVAAPI {
+	if cfg.Encoder.Mode.UsesQP() {
 		return "VAAPI_QP"
 	}
 	return "CPU_CRF"
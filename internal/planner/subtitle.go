@@ -1,44 +1,180 @@
-// Subtitle and attachment plan building for MKV and MP4 containers.
+// Subtitle and attachment plan building for MKV, MP4, and HLS outputs.
 package planner
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/backmassage/muxmaster/internal/config"
 	"github.com/backmassage/muxmaster/internal/probe"
 )
 
-// BuildSubtitlePlan decides subtitle handling. MKV gets a straight copy,
-// MP4 gets mov_text for text subs and skips bitmap subs.
-// Mirrors the legacy build_subtitle_opts and describe_subtitle_plan functions.
-func BuildSubtitlePlan(cfg *config.Config, pr *probe.ProbeResult) SubtitlePlan {
+// BuildSubtitlePlan decides subtitle handling. With --sub-langs, only
+// streams in those languages are considered (see filterSubtitleLangs), and
+// the --burn-subs stream is never soft-muxed as well. MKV
+// gets --subtitle-codec (copy by default, or a conversion to srt/ass), MP4
+// gets mov_text for text subs and skips bitmap subs. HLS output carries no
+// subtitles (the single-rendition MPEG-TS segments cannot mux them). Mirrors
+// the legacy build_subtitle_opts and describe_subtitle_plan functions.
+//
+// Returns an error when an MKV text conversion is requested for a file with
+// bitmap subtitles, which ffmpeg cannot convert to text.
+func BuildSubtitlePlan(cfg *config.Config, pr *probe.ProbeResult) (SubtitlePlan, error) {
 	if !cfg.KeepSubtitles || len(pr.SubtitleStreams) == 0 {
-		return SubtitlePlan{Include: false}
+		return SubtitlePlan{Include: false}, nil
+	}
+	if cfg.OutputContainer == config.ContainerHLS {
+		return SubtitlePlan{Include: false}, nil
+	}
+
+	streams, langFiltered := filterSubtitleLangs(cfg, pr.SubtitleStreams)
+	streams, burned := withoutBurned(streams, SelectBurnSubtitle(cfg, pr))
+	if len(streams) == 0 {
+		// --subtitles-only-if-present-langs with no stream in --sub-langs,
+		// or only the --burn-subs stream.
+		return SubtitlePlan{Include: false}, nil
 	}
 
 	if cfg.OutputContainer == config.ContainerMP4 {
 		// Collect text (non-bitmap) subtitle stream indices.
 		var textIdxs []int
-		for _, s := range pr.SubtitleStreams {
-			if !s.IsBitmap {
-				textIdxs = append(textIdxs, s.Index)
+		skipBitmap := false
+		for _, s := range streams {
+			if s.IsBitmap {
+				skipBitmap = true
+				continue
 			}
+			textIdxs = append(textIdxs, s.Index)
 		}
 		if len(textIdxs) == 0 {
-			// All subs are bitmap — MP4 can't carry any of them.
-			return SubtitlePlan{Include: false}
+			// All remaining subs are bitmap — MP4 can't carry any of them.
+			return SubtitlePlan{Include: false}, nil
 		}
 		return SubtitlePlan{
-			Include:    true,
-			Codec:      "mov_text",
-			SkipBitmap: pr.HasBitmapSubs,
-			TextIdxs:   textIdxs,
+			Include:      true,
+			Codec:        "mov_text",
+			SkipBitmap:   skipBitmap,
+			LangFiltered: langFiltered,
+			Burned:       burned,
+			StreamIdxs:   textIdxs,
+			RetryCodec:   subtitleRetryCodec(cfg, "mov_text", nil),
+		}, nil
+	}
+
+	codec := mkvSubtitleCodec(cfg)
+	if codec != "copy" {
+		for _, s := range streams {
+			if s.IsBitmap {
+				return SubtitlePlan{Include: false}, fmt.Errorf(
+					"--subtitle-codec %s cannot convert bitmap subtitle stream %d (%s) to text; use --subtitle-codec copy or --no-subs",
+					codec, s.Index, s.Codec)
+			}
 		}
 	}
+	sp := SubtitlePlan{
+		Include:      true,
+		Codec:        codec,
+		LangFiltered: langFiltered,
+		Burned:       burned,
+		RetryCodec:   subtitleRetryCodec(cfg, codec, streams),
+	}
+	if sp.Selective() {
+		for _, s := range streams {
+			sp.StreamIdxs = append(sp.StreamIdxs, s.Index)
+		}
+	}
+	return sp, nil
+}
 
-	return SubtitlePlan{Include: true, Codec: "copy"}
+// filterSubtitleLangs applies --sub-langs to the source subtitle streams and
+// reports whether any stream was dropped. Untagged streams do not match.
+// When nothing matches, every stream is kept unless
+// --subtitles-only-if-present-langs asks for no subtitles instead.
+func filterSubtitleLangs(cfg *config.Config, subs []probe.SubtitleStream) ([]probe.SubtitleStream, bool) {
+	if len(cfg.SubLangs) == 0 {
+		return subs, false
+	}
+	var kept []probe.SubtitleStream
+	for _, s := range subs {
+		for _, lang := range cfg.SubLangs {
+			if s.Language != "" && strings.EqualFold(s.Language, lang) {
+				kept = append(kept, s)
+				break
+			}
+		}
+	}
+	switch {
+	case len(kept) == len(subs):
+		return subs, false
+	case len(kept) == 0 && !cfg.SubsOnlyIfPresentLangs:
+		return subs, false
+	}
+	return kept, true
+}
+
+// mkvSubtitleCodec returns the ffmpeg -c:s value for MKV output.
+func mkvSubtitleCodec(cfg *config.Config) string {
+	if cfg.SubtitleCodec == "" {
+		return "copy"
+	}
+	return string(cfg.SubtitleCodec)
+}
+
+// subtitleRetryCodec returns the --retry-subtitle-transcode codec for a plan
+// muxing streams with codec: mov_text for MP4 and srt for MKV. It returns ""
+// (drop on failure) when the option is off, when the plan already uses that
+// codec, or when a stream is bitmap, which cannot be converted to text.
+func subtitleRetryCodec(cfg *config.Config, codec string, streams []probe.SubtitleStream) string {
+	if !cfg.RetrySubTranscode {
+		return ""
+	}
+	retry := "srt"
+	if cfg.OutputContainer == config.ContainerMP4 {
+		retry = "mov_text"
+	}
+	if codec == retry {
+		return ""
+	}
+	for _, s := range streams {
+		if s.IsBitmap {
+			return ""
+		}
+	}
+	return retry
+}
+
+// AddSidecarSubtitles merges external subtitle files into a plan's subtitle
+// handling. Sidecars are text formats (srt/ass/vtt), so they are carried by
+// MKV (copy) and MP4 (mov_text) alike; HLS output, --no-subs, and
+// --faithful-remux (which copies only the source's streams) drop them.
+// When the source has no mappable embedded subs, the plan switches to
+// sidecar-only so the builder does not map 0:s.
+func AddSidecarSubtitles(cfg *config.Config, pr *probe.ProbeResult, plan *FilePlan, sidecars []SidecarSubtitle) {
+	if !cfg.KeepSubtitles || len(sidecars) == 0 || cfg.OutputContainer == config.ContainerHLS || plan.Faithful {
+		return
+	}
+
+	sp := &plan.Subtitles
+	switch {
+	case !sp.Include:
+		sp.Include = true
+		sp.SidecarOnly = true
+		sp.EmbeddedCount = 0
+		sp.Codec = mkvSubtitleCodec(cfg)
+		if cfg.OutputContainer == config.ContainerMP4 {
+			sp.Codec = "mov_text"
+		}
+		sp.RetryCodec = subtitleRetryCodec(cfg, sp.Codec, nil)
+	case sp.Selective():
+		sp.EmbeddedCount = len(sp.StreamIdxs)
+	default:
+		sp.EmbeddedCount = len(pr.SubtitleStreams)
+	}
+	sp.Sidecars = append(sp.Sidecars, sidecars...)
 }
 
 // BuildAttachmentPlan decides whether to carry font/image attachments.
-// Only MKV supports attachments; MP4 always skips them.
+// Only MKV supports attachments; MP4 and HLS always skip them.
 func BuildAttachmentPlan(cfg *config.Config) AttachmentPlan {
 	if cfg.KeepAttachments && cfg.OutputContainer == config.ContainerMKV {
 		return AttachmentPlan{Include: true}
@@ -9,26 +9,60 @@ type Action int
 const (
 	ActionEncode Action = iota
 	ActionRemux
-	ActionSkip // Reserved; BuildPlan currently produces only Encode or Remux.
+	ActionSkip // Already optimized, outside the height range, or below --min-bitrate-kbps; see SkipReason.
 )
 
+// String returns the lowercase action name, matching the --only values.
+func (a Action) String() string {
+	switch a {
+	case ActionEncode:
+		return "encode"
+	case ActionRemux:
+		return "remux"
+	case ActionSkip:
+		return "skip"
+	}
+	return "unknown"
+}
+
+// HLSSegmentSeconds is the target segment duration for HLS output.
+const HLSSegmentSeconds = 6
+
 // FilePlan holds the complete set of decisions for processing a single media
 // file. It is produced by BuildPlan and consumed by the ffmpeg package to
 // construct command arguments and by the retry engine for initial state.
 type FilePlan struct {
 	Action     Action
 	SkipReason string
+	Err        error // Non-nil when the file cannot be produced as configured; the pipeline fails it without running ffmpeg.
 
 	// Video encoding.
 	VideoCodec   string   // "hevc_vaapi", "libx265", or "copy"
 	VideoFilters string   // comma-joined filter chain (may be empty)
 	ColorOpts    []string // -color_trc, -color_primaries, -colorspace pairs
 	HWDecode     bool     // Use VAAPI hardware decode (frames stay on GPU)
+	MaxHeight    int      // Effective height cap the plan was built with (0 = none); replans reuse it.
+
+	// BurnSub is the --burn-subs stream rendered into the video (nil =
+	// none). Bitmap subtitles are overlaid by VideoFilterComplex, a
+	// -filter_complex graph whose [vout] output replaces VideoFilters and
+	// the source video map.
+	BurnSub            *BurnSubtitle
+	VideoFilterComplex string
 
 	// HDR10 static metadata (empty when not present or not preserving HDR).
 	MasterDisplay string // ffmpeg format: G(gx,gy)B(bx,by)R(rx,ry)WP(wpx,wpy)L(maxL,minL)
 	MaxCLL        string // ffmpeg format: MaxCLL,MaxFALL
 
+	// HDR10Plus is set for sources with HDR10+ dynamic metadata, which
+	// remuxes keep and encodes lose (see Warnings).
+	HDR10Plus bool
+
+	// DolbyVision is set for Dolby Vision sources. Remuxes carry the
+	// configuration record and RPUs (see the builder); encodes lose the
+	// dynamic metadata and keep only the base layer.
+	DolbyVision bool
+
 	// Quality (resolved per-file by smart quality).
 	VaapiQP            int
 	CpuCRF             int
@@ -39,6 +73,20 @@ type FilePlan struct {
 	BufSizeKbps        int             // VBV buffer size (typically 2× maxrate).
 	OptimalBitrateKbps int             // Estimated target output bitrate based on input analysis.
 
+	// Warnings are notes the pipeline logs at warning level: source
+	// properties the output loses (HDR metadata, 10-bit precision, a
+	// non-browser-safe HEVC profile forcing a re-encode). QualityNote is
+	// only logged with --verbose.
+	Warnings []string
+
+	// TargetBitrateKbps is the --target-bitrate average video bitrate (0 =
+	// constant QP/CRF). TwoPass marks a CPU encode run as an analysis pass
+	// followed by the real encode, sharing the x265 stats file PassLogFile,
+	// which the pipeline places in a scratch directory.
+	TargetBitrateKbps int
+	TwoPass           bool
+	PassLogFile       string
+
 	// Audio.
 	Audio AudioPlan
 
@@ -46,12 +94,30 @@ type FilePlan struct {
 	Subtitles   SubtitlePlan
 	Attachments AttachmentPlan
 
+	// Embedded cover art (MKV only, --keep-cover). Mapped as output video
+	// stream 1 with the attached_pic disposition.
+	IncludeCoverArt bool
+	CoverArtIdx     int // Absolute source stream index of the cover art.
+
 	// Stream dispositions.
 	DispositionOpts []string
 
 	// Container-specific flags.
-	ContainerOpts []string // e.g. -movflags +faststart
+	ContainerOpts []string // e.g. -movflags +faststart, or -f hls for HLS
 	TagOpts       []string // e.g. -tag:v hvc1
+	CreationTime  string   // Source creation_time re-applied via -metadata (--preserve-creation-time); "" = none.
+	ChapterOpts   []string // -metadata:c:N title=... per titled chapter (--preserve-chapters-titles).
+
+	// Faithful is a --faithful-remux plan: FaithfulOpts (-map 0 -c copy
+	// plus container fixups) replace the planned stream maps and codecs,
+	// and Audio, Subtitles, and Attachments are unused.
+	Faithful     bool
+	FaithfulOpts []string
+
+	// Faststart is a --remux-to-faststart plan: an MP4 source remuxed with
+	// its video copied, which may be H.264 or AV1 rather than HEVC (see
+	// FaststartRemux).
+	Faststart bool
 
 	// Retry initial state (seeded from config and probe data).
 	MuxQueueSize  int
@@ -60,11 +126,13 @@ type FilePlan struct {
 	IncludeAttach bool
 
 	// Output.
+	InputOpts        []string // Demuxer options before -i (--concat / --image-seq); nil for files.
 	InputPath        string
 	OutputPath       string
 	Container        config.Container
 	VideoStreamIdx   int
 	AudioStreamCount int
+	ChapterCount     int // Source chapters, carried by -map_chapters 0.
 }
 
 // AudioPlan describes the audio handling strategy for a file.
@@ -72,11 +140,15 @@ type AudioPlan struct {
 	NoAudio bool
 	CopyAll bool
 	Streams []AudioStreamPlan
+
+	// Titles are --auto-audio-titles track names, indexed by output audio
+	// stream (see BuildAudioTitles); nil leaves titles untouched.
+	Titles []string
 }
 
 // AudioStreamPlan describes the processing for one audio stream.
 type AudioStreamPlan struct {
-	StreamIndex int
+	StreamIndex int    // Source audio index (the N of -map 0:a:N); output indices follow Streams order
 	Copy        bool   // true for AAC passthrough
 	Channels    int    // target channel count (capped at Config.AudioChannels)
 	Bitrate     string // e.g. "320k"
@@ -84,14 +156,45 @@ type AudioStreamPlan struct {
 	Layout      string // "mono", "stereo", or "" (passthrough)
 	NeedsFilter bool
 	FilterStr   string // precomputed aresample/aformat chain
+	DelayMs     int    // --audio-delay sync shift (negative = earlier); 0 = none
+	Language    string // Source language tag, re-applied to transcoded output; "" = untagged
 }
 
 // SubtitlePlan describes how subtitles are handled.
 type SubtitlePlan struct {
-	Include    bool
-	Codec      string // "copy", "mov_text", or ""
-	SkipBitmap bool   // When true, only text subtitle streams are mapped (MP4 with mixed subs).
-	TextIdxs   []int  // Absolute stream indices of text subtitle streams (used when SkipBitmap is true).
+	Include      bool
+	Codec        string // "copy", "mov_text", "srt", "ass", or ""
+	SkipBitmap   bool   // Bitmap streams were dropped (MP4 with mixed subs).
+	LangFiltered bool   // Streams outside --sub-langs were dropped.
+	Burned       bool   // The --burn-subs stream is left out of the soft-sub map.
+	StreamIdxs   []int  // Absolute indices of the embedded streams to map (used when Selective).
+
+	// RetryCodec is the codec the retry engine switches subtitles to before
+	// dropping them (--retry-subtitle-transcode); "" = drop straight away.
+	RetryCodec string
+
+	// -disposition:s:N flags for embedded subtitles (--keep-subs-langs-default,
+	// and always for MP4 mov_text).
+	// Emitted by the builder only while subtitles are mapped.
+	DispositionOpts []string
+
+	// External subtitle files muxed in as extra inputs (--sidecar-subs).
+	Sidecars      []SidecarSubtitle
+	SidecarOnly   bool // No embedded subs are mapped; only sidecars are included.
+	EmbeddedCount int  // Number of embedded subtitle streams mapped ahead of the sidecars.
+}
+
+// Selective reports whether only StreamIdxs are mapped rather than every
+// embedded subtitle stream.
+func (sp SubtitlePlan) Selective() bool {
+	return sp.SkipBitmap || sp.LangFiltered || sp.Burned
+}
+
+// SidecarSubtitle is an external subtitle file found next to the input
+// (e.g. "Show - S01E05.eng.srt").
+type SidecarSubtitle struct {
+	Path     string
+	Language string // ISO 639 code from the filename suffix, or "" if absent.
 }
 
 // AttachmentPlan describes whether to carry attachments (fonts, etc.).
@@ -3,8 +3,8 @@
 // functions, identifies interlaced content, and validates HEVC edge-safety.
 //
 // Files:
-//   - types.go:            ProbeResult, VideoStream, AudioStream, SubtitleStream, FormatInfo
-//   - prober.go:           Probe — single ffprobe JSON call, stream classification
-//   - hdr.go:              HDR detection, HDR10 static metadata formatting (mastering display, MaxCLL)
-//   - interlace.go:        Interlace detection from field_order
+//   - types.go:            ProbeResult, CropRect, VideoStream, AudioStream, SubtitleStream, Chapter, FormatInfo
+//   - prober.go:           Probe, ProbeInput — single ffprobe JSON call (optionally via a demuxer), stream classification; Validate — minimal readability check
+//   - hdr.go:              HDR, Dolby Vision, and HDR10+ detection, HDR10 static metadata formatting (mastering display, MaxCLL)
+//   - interlace.go:        Interlace detection from field_order or a measured ScanType (idet)
 package probe
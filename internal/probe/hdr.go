@@ -1,6 +1,7 @@
-// HDR detection from color transfer, primaries, and space metadata.
-// Also provides formatting for HDR10 static metadata (mastering display
-// and content light level) used by the planner and ffmpeg builder.
+// HDR detection from color transfer, primaries, and space metadata, and
+// Dolby Vision and HDR10+ detection from stream and frame side data. Also
+// provides formatting for HDR10 static metadata (mastering display and
+// content light level) used by the planner and ffmpeg builder.
 package probe
 
 import (
@@ -28,6 +29,20 @@ func (p *ProbeResult) HDRType() string {
 	return "sdr"
 }
 
+// IsDolbyVision reports whether the primary video stream carries a Dolby
+// Vision configuration record. HDRType still describes the base layer
+// (e.g. "hdr10" for profiles 7 and 8.1).
+func (p *ProbeResult) IsDolbyVision() bool {
+	return p.PrimaryVideo != nil && p.PrimaryVideo.DolbyVision != nil
+}
+
+// IsHDR10Plus reports whether the primary video stream carries HDR10+
+// (SMPTE 2094-40) dynamic metadata. Like Dolby Vision it layers on an
+// HDR10 base, which HDRType reports.
+func (p *ProbeResult) IsHDR10Plus() bool {
+	return p.PrimaryVideo != nil && p.PrimaryVideo.HDR10Plus
+}
+
 // FFmpegMasterDisplay formats the mastering display metadata for ffmpeg's
 // -master_display / x265 --master-display option:
 //
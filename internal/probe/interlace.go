@@ -1,15 +1,31 @@
-// Interlace detection from field_order stream metadata.
+// Interlace detection from field_order stream metadata, optionally
+// overridden by an idet sampling pass.
 package probe
 
 import "strings"
 
+// ScanType is the measured scan type of the primary video stream.
+type ScanType string
+
+const (
+	ScanUnknown     ScanType = ""            // Not measured; use field_order.
+	ScanProgressive ScanType = "progressive" // Truly progressive frames.
+	ScanInterlaced  ScanType = "interlaced"  // Field-based video; deinterlace.
+	ScanTelecined   ScanType = "telecined"   // Film with 3:2 pulldown; inverse telecine.
+)
+
 // IsInterlaced returns true if the primary video stream's field_order
 // indicates interlaced content (tt, bb, tb, bt). Mirrors the legacy
-// is_interlaced function.
+// is_interlaced function. When ScanType has been measured it takes
+// precedence over field_order, which is often "progressive" on
+// soft-interlaced sources.
 func (p *ProbeResult) IsInterlaced() bool {
 	if p.PrimaryVideo == nil {
 		return false
 	}
+	if p.ScanType != ScanUnknown {
+		return p.ScanType == ScanInterlaced
+	}
 	switch strings.ToLower(strings.TrimSpace(p.PrimaryVideo.FieldOrder)) {
 	case "tt", "bb", "tb", "bt":
 		return true
@@ -17,6 +33,12 @@ func (p *ProbeResult) IsInterlaced() bool {
 	return false
 }
 
+// IsTelecined returns true if an idet pass measured 3:2 pulldown. field_order
+// cannot express telecine, so this is only ever true after detection.
+func (p *ProbeResult) IsTelecined() bool {
+	return p.PrimaryVideo != nil && p.ScanType == ScanTelecined
+}
+
 // IsEdgeSafeHEVC returns true if the primary video stream has an HEVC
 // profile and pixel format that are safe for browser/Jellyfin playback.
 // Safe profiles: main, main 10, main10. Safe pix_fmts: yuv420p, yuv420p10le.
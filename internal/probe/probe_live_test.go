@@ -33,7 +33,7 @@ func TestLiveProbe(t *testing.T) {
 		t.Fatalf("ffmpeg generate: %v", err)
 	}
 
-	pr, err := Probe(context.Background(), path)
+	pr, err := Probe(context.Background(), "ffprobe", path)
 	if err != nil {
 		t.Fatalf("Probe: %v", err)
 	}
@@ -90,3 +90,43 @@ func TestLiveProbe(t *testing.T) {
 
 	t.Log("--- LIVE PROBE OK ---")
 }
+
+// TestLiveValidate checks that Validate accepts a real synthetic file and
+// rejects empty and corrupt ones. Skipped when ffmpeg/ffprobe are unavailable.
+func TestLiveValidate(t *testing.T) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not available")
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not available")
+	}
+
+	tmp := t.TempDir()
+	valid := tmp + "/valid.mkv"
+	gen := exec.Command("ffmpeg",
+		"-f", "lavfi", "-i", "testsrc=duration=1:size=320x240:rate=24",
+		"-c:v", "libx264", "-y", valid,
+	)
+	gen.Stderr = os.Stderr
+	if err := gen.Run(); err != nil {
+		t.Fatalf("ffmpeg generate: %v", err)
+	}
+	empty := tmp + "/empty.mkv"
+	corrupt := tmp + "/corrupt.mkv"
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, []byte("not a matroska file, just text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := Validate(ctx, "ffprobe", valid); err != nil {
+		t.Errorf("valid file: %v", err)
+	}
+	for _, path := range []string{empty, corrupt} {
+		if err := Validate(ctx, "ffprobe", path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
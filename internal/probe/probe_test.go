@@ -72,7 +72,7 @@ const sampleHDR = `{
       "index": 3,
       "codec_name": "ass",
       "codec_type": "subtitle",
-      "disposition": { "default": 0 },
+      "disposition": { "default": 0, "forced": 1 },
       "tags": { "language": "eng" }
     }
   ],
@@ -231,6 +231,14 @@ func TestParseJSON_HDRFile(t *testing.T) {
 		t.Error("primary video should not be attached_pic")
 	}
 
+	// Cover art is exposed separately.
+	if pr.CoverArt == nil {
+		t.Fatal("CoverArt is nil")
+	}
+	if pr.CoverArt.Index != 0 || pr.CoverArt.Codec != "mjpeg" {
+		t.Errorf("cover art: got index %d codec %q, want 0 mjpeg", pr.CoverArt.Index, pr.CoverArt.Codec)
+	}
+
 	// HDR10 static metadata
 	if pr.PrimaryVideo.MasteringDisplay == nil {
 		t.Fatal("MasteringDisplay should be parsed from side_data_list")
@@ -287,6 +295,9 @@ func TestParseJSON_HDRFile(t *testing.T) {
 	if pr.SubtitleStreams[0].IsBitmap {
 		t.Error("ASS should not be bitmap")
 	}
+	if pr.SubtitleStreams[0].IsDefault || !pr.SubtitleStreams[0].IsForced {
+		t.Error("sub disposition: want forced, not default")
+	}
 	if pr.HasBitmapSubs {
 		t.Error("should not have bitmap subs")
 	}
@@ -437,6 +448,115 @@ func TestResolution(t *testing.T) {
 	}
 }
 
+// sampleDolbyVision is a profile 8.1 HEVC stream (HDR10-compatible base
+// layer) with a DOVI configuration record, as ffprobe reports it for MKV.
+const sampleDolbyVision = `{
+  "streams": [
+    {
+      "index": 0,
+      "codec_name": "hevc",
+      "codec_type": "video",
+      "profile": "Main 10",
+      "pix_fmt": "yuv420p10le",
+      "width": 3840,
+      "height": 2160,
+      "color_transfer": "smpte2084",
+      "color_primaries": "bt2020",
+      "color_space": "bt2020nc",
+      "disposition": { "default": 1, "attached_pic": 0 },
+      "side_data_list": [
+        {
+          "side_data_type": "DOVI configuration record",
+          "dv_version_major": 1,
+          "dv_version_minor": 0,
+          "dv_profile": 8,
+          "dv_level": 6,
+          "rpu_present_flag": 1,
+          "el_present_flag": 0,
+          "bl_present_flag": 1,
+          "dv_bl_signal_compatibility_id": 1
+        }
+      ]
+    }
+  ],
+  "format": { "filename": "/media/Movie (2021).mkv", "nb_streams": 1 }
+}`
+
+func TestParseJSON_DolbyVision(t *testing.T) {
+	pr, err := ParseJSON([]byte(sampleDolbyVision))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+	if !pr.IsDolbyVision() {
+		t.Fatal("IsDolbyVision: want true for a DOVI configuration record")
+	}
+	want := DolbyVisionConfig{Profile: 8, Level: 6, RPUPresent: true, BLPresent: true, BLCompatID: 1}
+	if got := *pr.PrimaryVideo.DolbyVision; got != want {
+		t.Errorf("DolbyVision: got %+v, want %+v", got, want)
+	}
+	// The base layer is still HDR10.
+	if got := pr.HDRType(); got != "hdr10" {
+		t.Errorf("HDRType: got %q, want hdr10", got)
+	}
+
+	// HDR10-only and SDR sources are not Dolby Vision.
+	for name, sample := range map[string]string{"hdr10": sampleHDR, "minimal": sampleMinimal} {
+		pr, _ := ParseJSON([]byte(sample))
+		if pr.IsDolbyVision() {
+			t.Errorf("%s: IsDolbyVision should be false", name)
+		}
+	}
+	if (&ProbeResult{}).IsDolbyVision() {
+		t.Error("no video: IsDolbyVision should be false")
+	}
+}
+
+func TestIsHDR10Plus(t *testing.T) {
+	// HDR10+ is per-frame SEI: the first frame's side data carries it.
+	frames := `{
+		"frames": [
+			{
+				"media_type": "video",
+				"stream_index": 0,
+				"side_data_list": [
+					{ "side_data_type": "Mastering display metadata", "max_luminance": "10000000/10000" },
+					{ "side_data_type": "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)", "application version": 1 }
+				]
+			}
+		]
+	}`
+	if !framesHaveHDR10Plus([]byte(frames)) {
+		t.Error("framesHaveHDR10Plus: want true for SMPTE2094-40 frame side data")
+	}
+	for name, out := range map[string]string{
+		"static only": `{"frames": [{"side_data_list": [{"side_data_type": "Mastering display metadata"}]}]}`,
+		"no frames":   `{"frames": []}`,
+		"malformed":   `{"frames": `,
+	} {
+		if framesHaveHDR10Plus([]byte(out)) {
+			t.Errorf("%s: framesHaveHDR10Plus should be false", name)
+		}
+	}
+
+	pr, _ := ParseJSON([]byte(sampleHDR))
+	pr.PrimaryVideo.HDR10Plus = true
+	if !pr.IsHDR10Plus() || pr.HDRType() != "hdr10" {
+		t.Error("IsHDR10Plus: want true over an HDR10 base layer")
+	}
+
+	// Stream parsing alone never sets it: HDR10, Dolby Vision, and SDR
+	// sources are not HDR10+.
+	for name, sample := range map[string]string{"hdr10": sampleHDR, "dovi": sampleDolbyVision, "sdr": sampleMinimal} {
+		pr, _ := ParseJSON([]byte(sample))
+		if pr.IsHDR10Plus() {
+			t.Errorf("%s: IsHDR10Plus should be false", name)
+		}
+	}
+	if (&ProbeResult{}).IsHDR10Plus() {
+		t.Error("no video: IsHDR10Plus should be false")
+	}
+}
+
 func TestHDRType(t *testing.T) {
 	cases := []struct {
 		name string
@@ -519,6 +639,32 @@ func TestIsInterlaced(t *testing.T) {
 	})
 }
 
+func TestIsHighBitDepth(t *testing.T) {
+	cases := []struct {
+		pixFmt string
+		want   bool
+	}{
+		{"yuv420p", false},
+		{"yuvj420p", false},
+		{"nv12", false},
+		{"rgb24", false},
+		{"", false},
+		{"yuv420p10le", true},
+		{"yuv444p12be", true},
+		{"p010le", true},
+		{"p016le", true},
+		{"gray10le", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.pixFmt, func(t *testing.T) {
+			pr := &ProbeResult{PrimaryVideo: &VideoStream{PixFmt: tc.pixFmt}}
+			if got := pr.IsHighBitDepth(); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestIsEdgeSafeHEVC(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -662,6 +808,9 @@ func TestAttachedPicSkipped(t *testing.T) {
 	if pr.PrimaryVideo != nil {
 		t.Error("PrimaryVideo should be nil when only stream is attached_pic")
 	}
+	if pr.CoverArt == nil || pr.CoverArt.Index != 0 {
+		t.Errorf("CoverArt: got %+v, want stream 0", pr.CoverArt)
+	}
 }
 
 func TestStreamBitRate_TagBPSFallback(t *testing.T) {
@@ -732,6 +881,82 @@ func TestStreamBitRate_TagBPSFallback(t *testing.T) {
 	}
 }
 
+// sampleDegenerateAudio has one real audio stream (MKV DURATION tag) followed
+// by a zero-duration "audio" stream and one with no channels.
+const sampleDegenerateAudio = `{
+	"streams": [
+		{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080},
+		{"index": 1, "codec_name": "aac", "codec_type": "audio", "channels": 2,
+		 "tags": {"language": "jpn", "DURATION": "00:23:40.042000000"}},
+		{"index": 2, "codec_name": "pcm_s16le", "codec_type": "audio", "channels": 1, "duration": "0.000000"},
+		{"index": 3, "codec_name": "mp3", "codec_type": "audio", "channels": 0, "duration": "1420.0"}
+	],
+	"format": {"filename": "thumb.mkv", "nb_streams": 4, "duration": "1420.042"}
+}`
+
+func TestParseJSON_DegenerateAudio(t *testing.T) {
+	pr, err := ParseJSON([]byte(sampleDegenerateAudio))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+	if len(pr.AudioStreams) != 3 {
+		t.Fatalf("audio streams: got %d, want 3 (degenerate streams keep their a:N slot)", len(pr.AudioStreams))
+	}
+	real := pr.AudioStreams[0]
+	if real.Degenerate || real.Duration < 1420 || real.Duration > 1421 {
+		t.Errorf("real stream: got %+v, want usable with duration 1420.042", real)
+	}
+	if !pr.AudioStreams[1].Degenerate {
+		t.Error("zero-duration stream should be degenerate")
+	}
+	if !pr.AudioStreams[2].Degenerate {
+		t.Error("zero-channel stream should be degenerate")
+	}
+	if usable := pr.UsableAudio(); len(usable) != 1 || usable[0].Index != 1 {
+		t.Errorf("UsableAudio: got %+v, want stream 1 only", usable)
+	}
+}
+
+func TestParseJSON_Chapters(t *testing.T) {
+	j := `{
+		"streams": [
+			{ "index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080 }
+		],
+		"chapters": [
+			{ "id": 0, "time_base": "1/1000000000", "start": 0, "start_time": "0.000000",
+			  "end": 90000000000, "end_time": "90.000000", "tags": { "title": "Opening" } },
+			{ "id": 1, "time_base": "1/1000000000", "start": 90000000000, "start_time": "90.000000",
+			  "end": 1350500000000, "end_time": "1350.500000", "tags": { "title": "Part A" } },
+			{ "id": 6198521307446720000, "time_base": "1/1000", "start": 1350500, "start_time": "1350.500000",
+			  "end": 1420000, "end_time": "1420.000000" }
+		],
+		"format": { "filename": "chapters.mkv", "nb_streams": 1 }
+	}`
+	pr, err := ParseJSON([]byte(j))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+	want := []Chapter{
+		{ID: 0, StartTime: 0, EndTime: 90, Title: "Opening"},
+		{ID: 1, StartTime: 90, EndTime: 1350.5, Title: "Part A"},
+		{ID: 6198521307446720000, StartTime: 1350.5, EndTime: 1420},
+	}
+	if len(pr.Chapters) != len(want) {
+		t.Fatalf("chapters: got %d, want %d", len(pr.Chapters), len(want))
+	}
+	for i := range want {
+		if pr.Chapters[i] != want[i] {
+			t.Errorf("chapter %d: got %+v, want %+v", i, pr.Chapters[i], want[i])
+		}
+	}
+
+	// No chapters array → no chapters.
+	pr, _ = ParseJSON([]byte(sampleMinimal))
+	if len(pr.Chapters) != 0 {
+		t.Errorf("minimal: got %d chapters, want 0", len(pr.Chapters))
+	}
+}
+
 func TestAudioBitRate(t *testing.T) {
 	pr := &ProbeResult{
 		AudioStreams: []AudioStream{{BitRate: 192000}},
@@ -2,6 +2,7 @@
 package probe
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,23 +11,100 @@ import (
 	"strings"
 )
 
-// Probe runs a single ffprobe JSON call against path and returns the
-// parsed result. It replaces the ~10 separate ffprobe calls made by the
-// legacy shell script.
-func Probe(ctx context.Context, path string) (*ProbeResult, error) {
-	cmd := exec.CommandContext(ctx, "ffprobe",
+// Probe runs a single ffprobe (bin, the --ffprobe-path binary) JSON call
+// against path and returns the parsed result. It replaces the ~10 separate
+// ffprobe calls made by the legacy shell script.
+func Probe(ctx context.Context, bin, path string) (*ProbeResult, error) {
+	return ProbeInput(ctx, bin, path)
+}
+
+// ProbeInput is Probe with demuxer options placed before the input, for
+// inputs that are not a single media file (e.g. "-f", "concat", "-safe",
+// "0" for a concat list, or "-f", "image2" for an image pattern). HDR
+// sources get a second, one-frame probe for HDR10+ (see probeHDR10Plus).
+func ProbeInput(ctx context.Context, bin, path string, inputOpts ...string) (*ProbeResult, error) {
+	args := []string{
 		"-v", "quiet",
 		"-print_format", "json",
-		"-show_format", "-show_streams",
-		path,
-	)
+		"-show_format", "-show_streams", "-show_chapters",
+	}
+	args = append(args, inputOpts...)
+	args = append(args, path)
+	cmd := exec.CommandContext(ctx, bin, args...)
 
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("ffprobe %q: %w", path, err)
 	}
 
-	return ParseJSON(out)
+	pr, err := ParseJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	if v := pr.PrimaryVideo; v != nil && pr.HDRType() == "hdr10" {
+		v.HDR10Plus = probeHDR10Plus(ctx, bin, path, v.Index, inputOpts)
+	}
+	return pr, nil
+}
+
+// probeHDR10Plus reports whether the first frame of video stream index
+// carries HDR10+ metadata. HDR10+ travels in per-frame SEI messages, which
+// ffprobe only reports as frame side data, never in -show_streams. A failed
+// probe reports false.
+func probeHDR10Plus(ctx context.Context, bin, path string, index int, inputOpts []string) bool {
+	args := []string{
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", strconv.Itoa(index),
+		"-read_intervals", "%+#1",
+		"-show_frames",
+	}
+	args = append(args, inputOpts...)
+	args = append(args, path)
+	out, err := exec.CommandContext(ctx, bin, args...).Output()
+	if err != nil {
+		return false
+	}
+	return framesHaveHDR10Plus(out)
+}
+
+// framesHaveHDR10Plus reports whether any frame in ffprobe -show_frames
+// JSON output carries HDR10+ side data.
+func framesHaveHDR10Plus(data []byte) bool {
+	var raw ffprobeFrames
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return false
+	}
+	for _, f := range raw.Frames {
+		for _, sd := range f.SideDataList {
+			if sd.Type == hdr10PlusSideData {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks that path is readable media with a minimal ffprobe (bin)
+// call: only the container format name is read, without stream analysis or
+// JSON output, so it is much cheaper than Probe. The error carries
+// ffprobe's first error line when there is one.
+func Validate(ctx context.Context, bin, path string) error {
+	cmd := exec.CommandContext(ctx, bin,
+		"-v", "error",
+		"-show_entries", "format=format_name",
+		"-of", "csv=p=0",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+			return fmt.Errorf("ffprobe %q: %s", path, line)
+		}
+		return fmt.Errorf("ffprobe %q: %w", path, err)
+	}
+	return nil
 }
 
 // ParseJSON converts raw ffprobe JSON output into a ProbeResult.
@@ -42,8 +120,23 @@ func ParseJSON(data []byte) (*ProbeResult, error) {
 // --- ffprobe JSON wire types ---
 
 type ffprobeOutput struct {
-	Format  ffprobeFormat   `json:"format"`
-	Streams []ffprobeStream `json:"streams"`
+	Format   ffprobeFormat    `json:"format"`
+	Streams  []ffprobeStream  `json:"streams"`
+	Chapters []ffprobeChapter `json:"chapters"`
+}
+
+// ffprobeFrames is the -show_frames output; only frame side data is read.
+type ffprobeFrames struct {
+	Frames []struct {
+		SideDataList []ffprobeSideData `json:"side_data_list"`
+	} `json:"frames"`
+}
+
+type ffprobeChapter struct {
+	ID        int64             `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
 }
 
 type ffprobeFormat struct {
@@ -74,13 +167,19 @@ type ffprobeStream struct {
 	Channels       int               `json:"channels"`
 	ChannelLayout  string            `json:"channel_layout"`
 	SampleRate     string            `json:"sample_rate"`
+	Duration       string            `json:"duration"`
 	Disposition    map[string]int    `json:"disposition"`
 	Tags           map[string]string `json:"tags"`
 	SideDataList   []ffprobeSideData `json:"side_data_list"`
 }
 
-// ffprobeSideData is a union type covering both mastering display and
-// content light level entries in a stream's side_data_list.
+// hdr10PlusSideData is the frame side_data_type ffprobe reports for HDR10+
+// (SMPTE 2094-40) dynamic metadata. Only its presence is used.
+const hdr10PlusSideData = "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"
+
+// ffprobeSideData is a union type covering the mastering display, content
+// light level, and DOVI configuration record entries in a stream's
+// side_data_list, and the HDR10+ entry in a frame's.
 type ffprobeSideData struct {
 	Type string `json:"side_data_type"`
 
@@ -99,6 +198,14 @@ type ffprobeSideData struct {
 	// Content light level metadata (integer nits).
 	MaxContent int `json:"max_content"`
 	MaxAverage int `json:"max_average"`
+
+	// DOVI configuration record.
+	DVProfile      int `json:"dv_profile"`
+	DVLevel        int `json:"dv_level"`
+	RPUPresentFlag int `json:"rpu_present_flag"`
+	ELPresentFlag  int `json:"el_present_flag"`
+	BLPresentFlag  int `json:"bl_present_flag"`
+	DVBLCompatID   int `json:"dv_bl_signal_compatibility_id"`
 }
 
 // --- Conversion from wire types to domain types ---
@@ -113,7 +220,10 @@ func buildResult(raw *ffprobeOutput) *ProbeResult {
 		switch s.CodecType {
 		case "video":
 			vs := convertVideo(s)
-			if !vs.IsAttachedPic && pr.PrimaryVideo == nil {
+			switch {
+			case vs.IsAttachedPic && pr.CoverArt == nil:
+				pr.CoverArt = &vs
+			case !vs.IsAttachedPic && pr.PrimaryVideo == nil:
 				pr.PrimaryVideo = &vs
 			}
 		case "audio":
@@ -126,6 +236,14 @@ func buildResult(raw *ffprobeOutput) *ProbeResult {
 			}
 		}
 	}
+	for _, c := range raw.Chapters {
+		pr.Chapters = append(pr.Chapters, Chapter{
+			ID:        c.ID,
+			StartTime: parseFloat(c.StartTime),
+			EndTime:   parseFloat(c.EndTime),
+			Title:     c.Tags["title"],
+		})
+	}
 	return pr
 }
 
@@ -158,6 +276,7 @@ func convertVideo(s *ffprobeStream) VideoStream {
 		IsAttachedPic:  s.Disposition["attached_pic"] == 1,
 		AvgFrameRate:   s.AvgFrameRate,
 	}
+	vs.Duration, _ = streamDuration(s)
 
 	for i := range s.SideDataList {
 		sd := &s.SideDataList[i]
@@ -176,14 +295,27 @@ func convertVideo(s *ffprobeStream) VideoStream {
 				MaxCLL:  sd.MaxContent,
 				MaxFALL: sd.MaxAverage,
 			}
+		case "DOVI configuration record":
+			vs.DolbyVision = &DolbyVisionConfig{
+				Profile:    sd.DVProfile,
+				Level:      sd.DVLevel,
+				RPUPresent: sd.RPUPresentFlag == 1,
+				ELPresent:  sd.ELPresentFlag == 1,
+				BLPresent:  sd.BLPresentFlag == 1,
+				BLCompatID: sd.DVBLCompatID,
+			}
 		}
 	}
 
 	return vs
 }
 
+// minAudioDuration is the shortest known stream duration, in seconds, an
+// audio stream may have before it is treated as Degenerate.
+const minAudioDuration = 0.1
+
 func convertAudio(s *ffprobeStream) AudioStream {
-	return AudioStream{
+	a := AudioStream{
 		Index:         s.Index,
 		Codec:         s.CodecName,
 		Channels:      s.Channels,
@@ -191,8 +323,32 @@ func convertAudio(s *ffprobeStream) AudioStream {
 		SampleRate:    parseInt(s.SampleRate),
 		BitRate:       streamBitRate(s),
 		Language:      s.Tags["language"],
+		Title:         s.Tags["title"],
 		IsDefault:     s.Disposition["default"] == 1,
+		IsComment:     s.Disposition["comment"] == 1,
+	}
+	var known bool
+	a.Duration, known = streamDuration(s)
+	a.Degenerate = a.Channels <= 0 || (known && a.Duration < minAudioDuration)
+	return a
+}
+
+// streamDuration returns a stream's duration in seconds from the duration
+// field (MP4) or, failing that, the Matroska "DURATION" tag
+// ("HH:MM:SS.nnnnnnnnn"). known is false when neither is present or
+// parseable, so an unreported duration is not mistaken for a zero one.
+func streamDuration(s *ffprobeStream) (d float64, known bool) {
+	if v := strings.TrimSpace(s.Duration); v != "" {
+		if d, err := strconv.ParseFloat(v, 64); err == nil {
+			return d, true
+		}
+	}
+	for k, v := range s.Tags {
+		if strings.EqualFold(k, "DURATION") || (len(k) >= 9 && strings.EqualFold(k[:9], "DURATION-")) {
+			return parseClockDuration(v)
+		}
 	}
+	return 0, false
 }
 
 // streamBitRate extracts the bitrate for a stream. ffprobe populates the
@@ -223,10 +379,12 @@ var bitmapSubCodecs = map[string]bool{
 
 func convertSubtitle(s *ffprobeStream) SubtitleStream {
 	return SubtitleStream{
-		Index:    s.Index,
-		Codec:    s.CodecName,
-		Language: s.Tags["language"],
-		IsBitmap: bitmapSubCodecs[s.CodecName],
+		Index:     s.Index,
+		Codec:     s.CodecName,
+		Language:  s.Tags["language"],
+		IsBitmap:  bitmapSubCodecs[s.CodecName],
+		IsDefault: s.Disposition["default"] == 1,
+		IsForced:  s.Disposition["forced"] == 1,
 	}
 }
 
@@ -255,6 +413,22 @@ func parseFloat(s string) float64 {
 	return f
 }
 
+// parseClockDuration converts "HH:MM:SS.fff" to seconds; ok is false for
+// malformed input.
+func parseClockDuration(s string) (secs float64, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	sec, errS := strconv.ParseFloat(parts[2], 64)
+	if errH != nil || errM != nil || errS != nil {
+		return 0, false
+	}
+	return float64(h)*3600 + float64(m)*60 + sec, true
+}
+
 func parseInt(s string) int {
 	s = strings.TrimSpace(s)
 	n, _ := strconv.Atoi(s)
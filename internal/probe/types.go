@@ -1,7 +1,11 @@
-// ProbeResult, VideoStream, AudioStream, SubtitleStream, FormatInfo types.
+// ProbeResult, VideoStream, AudioStream, SubtitleStream, Chapter, FormatInfo types.
 package probe
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // FormatInfo holds container-level metadata from ffprobe's format section.
 type FormatInfo struct {
@@ -30,9 +34,12 @@ type VideoStream struct {
 	ColorSpace     string
 	IsAttachedPic  bool
 	AvgFrameRate   string
+	Duration       float64 // Stream duration in seconds; 0 = unknown.
 
 	MasteringDisplay  *MasteringDisplay
 	ContentLightLevel *ContentLightLevel
+	DolbyVision       *DolbyVisionConfig
+	HDR10Plus         bool // SMPTE 2094-40 dynamic metadata on the first frame (see probeHDR10Plus).
 }
 
 // MasteringDisplay holds SMPTE ST.2086 mastering display color volume metadata.
@@ -53,6 +60,18 @@ type ContentLightLevel struct {
 	MaxFALL int
 }
 
+// DolbyVisionConfig holds the Dolby Vision decoder configuration record
+// (dvcC/dvvC) of a video stream. The per-frame RPU dynamic metadata it
+// announces survives stream copy but not re-encoding.
+type DolbyVisionConfig struct {
+	Profile    int // e.g. 5, 7, 8
+	Level      int
+	RPUPresent bool // Dynamic metadata (RPU) is present.
+	ELPresent  bool // Enhancement layer is present (profile 7).
+	BLPresent  bool // Base layer is present.
+	BLCompatID int  // Base layer signal compatibility (1 = HDR10, 2 = SDR, 4 = HLG).
+}
+
 // AudioStream holds the parsed properties of a single audio stream.
 type AudioStream struct {
 	Index         int
@@ -62,25 +81,68 @@ type AudioStream struct {
 	SampleRate    int
 	BitRate       int64
 	Language      string
+	Title         string // Stream title tag, e.g. "Director's Commentary"; "" when untitled.
 	IsDefault     bool
+	IsComment     bool    // Commentary disposition flag.
+	Duration      float64 // Stream duration in seconds; 0 = unknown.
+
+	// Degenerate marks a stream typed as audio that carries no usable audio
+	// (zero channels or a near-zero duration, e.g. a thumbnail or timecode
+	// track). It keeps its place in ProbeResult.AudioStreams, so a:N
+	// indices still match the source, but is never mapped.
+	Degenerate bool
 }
 
 // SubtitleStream holds the parsed properties of a single subtitle stream.
 type SubtitleStream struct {
-	Index    int
-	Codec    string
-	Language string
-	IsBitmap bool
+	Index     int
+	Codec     string
+	Language  string
+	IsBitmap  bool
+	IsDefault bool
+	IsForced  bool
+}
+
+// Chapter is one entry of the source's chapter list (-show_chapters).
+// Times are in seconds.
+type Chapter struct {
+	ID        int64
+	StartTime float64
+	EndTime   float64
+	Title     string // "" when untitled.
 }
 
 // ProbeResult is the fully parsed output of a single ffprobe JSON call.
 // PrimaryVideo is the first non-attached-pic video stream (nil if none).
+// CoverArt is the first attached-pic video stream, i.e. embedded poster
+// art (nil if none).
 type ProbeResult struct {
 	Format          FormatInfo
 	PrimaryVideo    *VideoStream
+	CoverArt        *VideoStream
 	AudioStreams    []AudioStream
 	SubtitleStreams []SubtitleStream
 	HasBitmapSubs   bool
+	Chapters        []Chapter
+
+	// ScanType is set by the --detect-interlace idet pass; ScanUnknown
+	// means field_order alone decides IsInterlaced.
+	ScanType ScanType
+
+	// Crop is the letterbox crop measured by the --auto-crop cropdetect
+	// pass; nil when not measured or the picture fills the frame.
+	Crop *CropRect
+}
+
+// CropRect is the picture area of a letterboxed frame: W×H pixels whose
+// top-left corner is at X,Y.
+type CropRect struct {
+	W, H, X, Y int
+}
+
+// Filter returns the ffmpeg crop filter for r.
+func (r CropRect) Filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", r.W, r.H, r.X, r.Y)
 }
 
 // VideoBitRate returns the primary video stream bitrate in bits/sec,
@@ -109,6 +171,18 @@ func (p *ProbeResult) TotalAudioBitRate() int64 {
 	return total
 }
 
+// UsableAudio returns the audio streams that are not Degenerate, in source
+// order.
+func (p *ProbeResult) UsableAudio() []AudioStream {
+	var usable []AudioStream
+	for _, a := range p.AudioStreams {
+		if !a.Degenerate {
+			usable = append(usable, a)
+		}
+	}
+	return usable
+}
+
 // AudioBitRate returns the first audio stream's bitrate in bits/sec, or 0.
 func (p *ProbeResult) AudioBitRate() int64 {
 	if len(p.AudioStreams) > 0 && p.AudioStreams[0].BitRate > 0 {
@@ -117,6 +191,76 @@ func (p *ProbeResult) AudioBitRate() int64 {
 	return 0
 }
 
+// CreationTime returns the container-level creation_time tag (matched
+// case-insensitively, since MKV muxers write it as CREATION_TIME), or ""
+// when the source has none.
+func (p *ProbeResult) CreationTime() string {
+	for k, v := range p.Format.Tags {
+		if strings.EqualFold(k, "creation_time") {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// IsNon420Chroma reports whether the primary video's pix_fmt is known and
+// not 4:2:0 subsampled (e.g. yuv444p10le, yuv422p, gbrp, rgb24). VAAPI
+// encoders and most VAAPI decoders only handle 4:2:0 surfaces. An unknown
+// pix_fmt returns false.
+func (p *ProbeResult) IsNon420Chroma() bool {
+	if p.PrimaryVideo == nil {
+		return false
+	}
+	pf := strings.ToLower(strings.TrimSpace(p.PrimaryVideo.PixFmt))
+	if pf == "" {
+		return false
+	}
+	for _, prefix := range []string{"yuv420", "yuvj420", "yuva420", "nv12", "nv21", "p010", "p016"} {
+		if strings.HasPrefix(pf, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsHighBitDepth reports whether the primary video's pix_fmt carries more
+// than 8 bits per component (e.g. yuv420p10le, p010le, gray12le). An
+// unknown pix_fmt returns false.
+func (p *ProbeResult) IsHighBitDepth() bool {
+	if p.PrimaryVideo == nil {
+		return false
+	}
+	return pixFmtBitDepth(p.PrimaryVideo.PixFmt) > 8
+}
+
+// pixFmtBitDepth returns the per-component bit depth in a planar or gray
+// pix_fmt name's suffix ("yuv420p10le" → 10, "p016le" → 16), or 8 when the
+// name carries none ("yuv420p", "nv12"). Packed RGB names, whose digits
+// count bits per pixel (rgb24), also report 8.
+func pixFmtBitDepth(pf string) int {
+	pf = strings.ToLower(strings.TrimSpace(pf))
+	if strings.HasSuffix(pf, "le") || strings.HasSuffix(pf, "be") {
+		pf = pf[:len(pf)-2]
+	}
+	i := len(pf)
+	for i > 0 && pf[i-1] >= '0' && pf[i-1] <= '9' {
+		i--
+	}
+	digits := pf[i:]
+	if digits == "" || i == 0 || (pf[i-1] != 'p' && !strings.HasSuffix(pf[:i], "gray")) {
+		return 8
+	}
+	// Semi-planar names pad the depth to three digits: p010, p210, p016.
+	if len(digits) > 2 {
+		digits = digits[len(digits)-2:]
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 8 {
+		return 8
+	}
+	return n
+}
+
 // Resolution returns "WxH" for the primary video stream, or "unknown".
 func (p *ProbeResult) Resolution() string {
 	if p.PrimaryVideo == nil || p.PrimaryVideo.Width <= 0 || p.PrimaryVideo.Height <= 0 {